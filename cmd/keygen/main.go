@@ -0,0 +1,21 @@
+// keygen prints a new Ed25519 key pair for signing verify responses.
+// Put the private key into SIGNING_PRIVATE_KEY and embed the public key
+// into client applications (see pkg/licenseclient).
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"log"
+)
+
+func main() {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		log.Fatalf("failed to generate key: %v", err)
+	}
+
+	fmt.Printf("SIGNING_PRIVATE_KEY=%s\n", base64.StdEncoding.EncodeToString(priv.Seed()))
+	fmt.Printf("public key: %s\n", base64.StdEncoding.EncodeToString(pub))
+}
@@ -4,29 +4,58 @@ import (
 	"context"
 
 	_ "github.com/dzhisl/license-api/docs"
+	"github.com/dzhisl/license-api/internal/api/middleware"
 	"github.com/dzhisl/license-api/internal/api/router"
+	"github.com/dzhisl/license-api/internal/expiry"
 	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
 	"github.com/dzhisl/license-api/pkg/config"
 	"github.com/dzhisl/license-api/pkg/logger"
+	"go.uber.org/zap"
 )
 
-func initApp(ctx context.Context) {
+func initApp(ctx context.Context) storage.Store {
 	config.InitConfig()
 	logger.InitLogger()
-	storage.InitStorage(ctx)
+	return storage.InitStorage(ctx)
 }
 
 // @title License Manager API
 // @version 1.0
 // @description API for managing user licenses.
+// @description Failed requests return an error envelope (licenseclient.ErrorResponse) whose `code` is stable, unlike its `message`.
 // @BasePath /api
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name X-API-Key
+// @securityDefinitions.apikey SessionAuth
+// @in header
+// @name Authorization
 func main() {
 	ctx := context.TODO()
-	initApp(ctx)
-	r := router.InitRouter()
+	store := initApp(ctx)
+
+	signingKey, err := config.LoadSigningKey()
+	if err != nil {
+		logger.Fatal(ctx, "failed to load signing key", zap.Error(err))
+	}
+	if signingKey == nil {
+		logger.Warn(ctx, "SIGNING_PRIVATE_KEY is not set, verify responses won't be signed")
+	}
+
+	roles, err := middleware.ParseRoles(config.AppConfig.AdminRoles)
+	if err != nil {
+		logger.Fatal(ctx, "failed to load ADMIN_ROLES", zap.Error(err))
+	}
+
+	hooks := webhook.NewDispatcher(store)
+	go hooks.Run(ctx)
+
+	expiryWorker := expiry.NewWorker(store, hooks, config.AppConfig.ExpiryWarningWindows, config.AppConfig.ExpiryCheckInterval).
+		WithGracePeriod(config.AppConfig.GracePeriod)
+	go expiryWorker.Run(ctx)
+
+	r := router.InitRouter(store, signingKey, hooks, roles)
 	logger.Info(ctx, "running API")
 	r.Run(":8080")
 }
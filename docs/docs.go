@@ -15,51 +15,14 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/license/verify": {
-            "post": {
-                "description": "Verify license by license string and HWID",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "license"
-                ],
-                "summary": "Verify license",
-                "parameters": [
-                    {
-                        "description": "payload",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/license.verifyLicenseRequest"
-                        }
-                    }
-                ],
-                "responses": {}
-            }
-        },
-        "/ping": {
-            "get": {
-                "description": "Ping pong",
-                "tags": [
-                    "user"
-                ],
-                "summary": "Simple ping endpoint",
-                "responses": {}
-            }
-        },
-        "/user": {
+        "/audit": {
             "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Retrieves user by telegram_id, discord_id, or license (one is required).",
+                "description": "Returns administrative mutations, newest first. Each entry has the actor, request ID, action, target and the changed values before and after.",
                 "consumes": [
                     "application/json"
                 ],
@@ -67,26 +30,38 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "audit"
                 ],
-                "summary": "Get user",
+                "summary": "List audit log",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Telegram ID",
-                        "name": "telegram_id",
+                        "description": "Only entries for this user",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only this action, e.g. license.status_changed",
+                        "name": "action",
                         "in": "query"
                     },
                     {
                         "type": "integer",
-                        "description": "Discord ID",
-                        "name": "discord_id",
+                        "description": "Unix timestamp, only entries at or after it",
+                        "name": "from",
                         "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "License key",
-                        "name": "license",
+                        "type": "integer",
+                        "description": "Unix timestamp, only entries at or before it",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of entries, 100 by default and at most 1000",
+                        "name": "limit",
                         "in": "query"
                     }
                 ],
@@ -94,83 +69,44 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/user.getUserResponse"
+                            "$ref": "#/definitions/audit.listAuditResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "INVALID_REQUEST",
                         "schema": {
-                            "$ref": "#/definitions/user.invalidBodyErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
-                        "schema": {
-                            "$ref": "#/definitions/user.internalErrResponse"
-                        }
-                    }
-                }
-            }
-        },
-        "/user/create": {
-            "post": {
-                "security": [
-                    {
-                        "ApiKeyAuth": []
-                    }
-                ],
-                "description": "Creates a new user with either a Telegram ID or Discord ID. Requires max activations and expiration timestamp in seconds.",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "user"
-                ],
-                "summary": "Create a new user",
-                "parameters": [
-                    {
-                        "description": "payload",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/user.createUserRequest"
-                        }
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
+                    "401": {
+                        "description": "UNAUTHORIZED",
                         "schema": {
-                            "$ref": "#/definitions/user.createUserResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "403": {
+                        "description": "FORBIDDEN",
                         "schema": {
-                            "$ref": "#/definitions/user.invalidBodyErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "INTERNAL",
                         "schema": {
-                            "$ref": "#/definitions/user.internalErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/user/{user_id}": {
-            "delete": {
+        "/keys": {
+            "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Delete a user by user_id",
+                "description": "Lists the API keys with their scopes, expiry and last use. The keys themselves aren't stored.",
                 "consumes": [
                     "application/json"
                 ],
@@ -178,48 +114,43 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
-                ],
-                "summary": "Delete user",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "user_id",
-                        "in": "path",
-                        "required": true
-                    }
+                    "api key"
                 ],
+                "summary": "List API keys",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/user.statusResponse"
+                            "$ref": "#/definitions/apikey.listKeysResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
                         "schema": {
-                            "$ref": "#/definitions/user.invalidBodyErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "INTERNAL",
                         "schema": {
-                            "$ref": "#/definitions/user.internalErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     }
                 }
-            }
-        },
-        "/user/{user_id}/device": {
+            },
             "post": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Add a device HWID to user device list",
+                "description": "Mints an API key for the private endpoints, limited to the permissions of its role and the given scopes.\nOnly permissions the caller has can be granted.\nThe key is returned once, only its hash is stored.",
                 "consumes": [
                     "application/json"
                 ],
@@ -227,24 +158,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "api key"
                 ],
-                "summary": "Bind HWID to user",
+                "summary": "Create API key",
                 "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "user_id",
-                        "in": "path",
-                        "required": true
-                    },
                     {
                         "description": "payload",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/user.addDeviceRequest"
+                            "$ref": "#/definitions/apikey.createKeyRequest"
                         }
                     }
                 ],
@@ -252,30 +176,50 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/user.statusResponse"
+                            "$ref": "#/definitions/apikey.createKeyResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
                         "schema": {
-                            "$ref": "#/definitions/user.invalidBodyErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "CONFLICT",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "INTERNAL",
                         "schema": {
-                            "$ref": "#/definitions/user.internalErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/keys/{key_id}": {
             "delete": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Remove a device HWID from user device list",
+                "description": "Deletes an API key, requests made with it are rejected from then on",
                 "consumes": [
                     "application/json"
                 ],
@@ -283,106 +227,87 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "api key"
                 ],
-                "summary": "Remove HWID from user",
+                "summary": "Revoke API key",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "user_id",
+                        "type": "string",
+                        "description": "API key ID",
+                        "name": "key_id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "payload",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/user.removeDeviceRequest"
-                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/user.statusResponse"
+                            "$ref": "#/definitions/apikey.statusResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
                         "schema": {
-                            "$ref": "#/definitions/user.invalidBodyErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "INTERNAL",
                         "schema": {
-                            "$ref": "#/definitions/user.internalErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/user/{user_id}/devices/reset": {
-            "post": {
-                "security": [
-                    {
-                        "ApiKeyAuth": []
-                    }
-                ],
-                "description": "Remove all device HWIDs from user device list",
-                "consumes": [
-                    "application/json"
-                ],
+        "/license/revocations": {
+            "get": {
+                "description": "Signed list of license keys that are not active anymore (frozen or burned). Offline clients use it together with license tokens.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "user"
-                ],
-                "summary": "Reset all HWIDs for user",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "user_id",
-                        "in": "path",
-                        "required": true
-                    }
+                    "license"
                 ],
+                "summary": "Revocation list",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/user.statusResponse"
+                            "$ref": "#/definitions/license.revocationListResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "500": {
+                        "description": "INTERNAL",
                         "schema": {
-                            "$ref": "#/definitions/user.invalidBodyErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "503": {
+                        "description": "UNAVAILABLE, no signing key is configured",
                         "schema": {
-                            "$ref": "#/definitions/user.internalErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/user/{user_id}/discord": {
+        "/license/seats/checkout": {
             "post": {
-                "security": [
-                    {
-                        "ApiKeyAuth": []
-                    }
-                ],
-                "description": "Associates a Discord ID with the user specified by user_id in the URL.",
+                "description": "Lease a seat of a floating license to the HWID. The lease ends after ttl seconds unless it is renewed with /license/seats/heartbeat.\nA HWID that already holds a seat keeps it and gets a new expiry. Expired leases are reclaimed and don't take a seat.",
                 "consumes": [
                     "application/json"
                 ],
@@ -390,24 +315,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "license"
                 ],
-                "summary": "Bind Discord to user",
+                "summary": "Check out seat",
                 "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "user_id",
-                        "in": "path",
-                        "required": true
-                    },
                     {
                         "description": "payload",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/user.bindDiscordRequest"
+                            "$ref": "#/definitions/license.checkoutSeatRequest"
                         }
                     }
                 ],
@@ -415,32 +333,45 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/user.statusResponse"
+                            "$ref": "#/definitions/license.seatLeaseResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "INVALID_REQUEST, e.g. the license is not floating",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "LICENSE_FROZEN, LICENSE_BURNED, LICENSE_EXPIRED, PRODUCT_MISMATCH or SEAT_LIMIT",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "LICENSE_NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "RATE_LIMITED",
                         "schema": {
-                            "$ref": "#/definitions/user.invalidBodyErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "INTERNAL",
                         "schema": {
-                            "$ref": "#/definitions/user.internalErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/user/{user_id}/license/hwid_limit": {
+        "/license/seats/heartbeat": {
             "post": {
-                "security": [
-                    {
-                        "ApiKeyAuth": []
-                    }
-                ],
-                "description": "Update the maximum number of HWIDs (devices) for a user",
+                "description": "Renew the lease of a seat of a floating license for another ttl seconds. Clients should send it well before expires_at.\nAn expired lease can't be renewed, the client has to check out a seat again.",
                 "consumes": [
                     "application/json"
                 ],
@@ -448,24 +379,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "license"
                 ],
-                "summary": "Update HWID limit",
+                "summary": "Seat heartbeat",
                 "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "user_id",
-                        "in": "path",
-                        "required": true
-                    },
                     {
                         "description": "payload",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/user.updateHwidLimitRequest"
+                            "$ref": "#/definitions/license.seatRequest"
                         }
                     }
                 ],
@@ -473,32 +397,103 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/user.statusResponse"
+                            "$ref": "#/definitions/license.seatLeaseResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "LICENSE_FROZEN, LICENSE_BURNED or LICENSE_EXPIRED",
                         "schema": {
-                            "$ref": "#/definitions/user.invalidBodyErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "LICENSE_NOT_FOUND or SEAT_NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "RATE_LIMITED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "INTERNAL",
                         "schema": {
-                            "$ref": "#/definitions/user.internalErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/user/{user_id}/license/renew": {
+        "/license/seats/release": {
             "post": {
-                "security": [
+                "description": "Give the seat of a floating license back, e.g. when the client exits, so another machine can check it out.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "license"
+                ],
+                "summary": "Release seat",
+                "parameters": [
                     {
-                        "ApiKeyAuth": []
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/license.seatRequest"
+                        }
                     }
                 ],
-                "description": "Renew the license for a user by user_id",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/license.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "LICENSE_NOT_FOUND or SEAT_NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "RATE_LIMITED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/license/verify": {
+            "post": {
+                "description": "Verify license by license string and HWID. When product is set, licenses issued for other products are rejected.\nAn unknown HWID is bound to the license if there is a free activation slot.\nSuccessful responses carry a payload signed with the server Ed25519 key, see pkg/licenseclient.\nExpired licenses keep verifying during their grace period (GRACE_PERIOD unless the license overrides it), with grace set to true.\nFloating licenses don't bind the HWID, they only verify while it holds a seat from /license/seats/checkout.",
                 "consumes": [
                     "application/json"
                 ],
@@ -506,24 +501,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "license"
                 ],
-                "summary": "Renew license",
+                "summary": "Verify license",
                 "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "user_id",
-                        "in": "path",
-                        "required": true
-                    },
                     {
                         "description": "payload",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/user.renewLicenseRequest"
+                            "$ref": "#/definitions/license.verifyLicenseRequest"
                         }
                     }
                 ],
@@ -531,32 +519,103 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/user.statusResponse"
+                            "$ref": "#/definitions/license.verifyLicenseResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "LICENSE_FROZEN, LICENSE_BURNED, LICENSE_EXPIRED, PRODUCT_MISMATCH, DEVICE_LIMIT or SEAT_REQUIRED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "LICENSE_NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "RATE_LIMITED",
                         "schema": {
-                            "$ref": "#/definitions/user.invalidBodyErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "INTERNAL",
                         "schema": {
-                            "$ref": "#/definitions/user.internalErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/user/{user_id}/license/status": {
+        "/ping": {
+            "get": {
+                "description": "Ping pong",
+                "tags": [
+                    "user"
+                ],
+                "summary": "Simple ping endpoint",
+                "responses": {}
+            }
+        },
+        "/plans": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "plan"
+                ],
+                "summary": "List plans",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/plan.listPlansResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            },
             "post": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Changes license status of user",
+                "description": "Creates a named license plan. Users created or licensed with the plan get its activation limit,\nan expiry computed from its duration, and its features as entitlements.",
                 "consumes": [
                     "application/json"
                 ],
@@ -564,24 +623,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "plan"
                 ],
-                "summary": "Change license status",
+                "summary": "Create plan",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "user_id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "payload enum: frozen, active, burned",
+                        "description": "payload",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/user.changeLicenseStatusRequest"
+                            "$ref": "#/definitions/plan.createPlanRequest"
                         }
                     }
                 ],
@@ -589,32 +641,49 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/user.statusResponse"
+                            "$ref": "#/definitions/plan.planResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "CONFLICT",
                         "schema": {
-                            "$ref": "#/definitions/user.invalidBodyErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "INTERNAL",
                         "schema": {
-                            "$ref": "#/definitions/user.internalErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/user/{user_id}/telegram": {
-            "post": {
+        "/plans/{plan_id}": {
+            "get": {
                 "security": [
                     {
                         "ApiKeyAuth": []
                     }
                 ],
-                "description": "Associates a Telegram ID with the user specified by user_id in the URL.",
                 "consumes": [
                     "application/json"
                 ],
@@ -622,14 +691,67 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "plan"
                 ],
-                "summary": "Bind Telegram to user",
+                "summary": "Get plan",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "user_id",
+                        "type": "string",
+                        "description": "Plan ID",
+                        "name": "plan_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/plan.planResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Replaces the plan settings. Licenses already issued keep their activation limit and expiry,\nlater renewals use the new duration and renewal behavior.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "plan"
+                ],
+                "summary": "Update plan",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Plan ID",
+                        "name": "plan_id",
                         "in": "path",
                         "required": true
                     },
@@ -639,7 +761,7 @@ const docTemplate = `{
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/user.bindTelegramRequest"
+                            "$ref": "#/definitions/plan.planRequest"
                         }
                     }
                 ],
@@ -647,96 +769,3560 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/user.statusResponse"
+                            "$ref": "#/definitions/plan.planResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
                         "schema": {
-                            "$ref": "#/definitions/user.invalidBodyErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Deletes a plan. Licenses already issued on it keep their terms but can't be renewed by plan anymore.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "plan"
+                ],
+                "summary": "Delete plan",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Plan ID",
+                        "name": "plan_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/plan.statusResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "INTERNAL",
                         "schema": {
-                            "$ref": "#/definitions/user.internalErrResponse"
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "license.verifyLicenseRequest": {
-            "type": "object",
-            "required": [
-                "hwid",
-                "license"
+        },
+        "/products": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "product"
+                ],
+                "summary": "List products",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/product.listProductsResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Creates a product. Its key prefix and length are used for the license keys issued for it,\nthe default activation limit and duration apply when a license doesn't set them.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "product"
+                ],
+                "summary": "Create product",
+                "parameters": [
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/product.createProductRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/product.productResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "CONFLICT",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/products/{product_id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "product"
+                ],
+                "summary": "Get product",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product ID",
+                        "name": "product_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/product.productResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Deletes a product. Licenses already issued for it are kept.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "product"
+                ],
+                "summary": "Delete product",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product ID",
+                        "name": "product_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/product.statusResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/self/code": {
+            "post": {
+                "description": "Sends a one-time code to the Telegram or Discord account bound to the license.\nThe code is handed to the webhooks subscribed to self_service.code, which deliver it to the customer.\nIt expires after 10 minutes, a new code can be requested once a minute.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "self-service"
+                ],
+                "summary": "Request self-service code",
+                "parameters": [
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/selfservice.requestCodeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/selfservice.requestCodeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "LICENSE_BURNED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "LICENSE_NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "RATE_LIMITED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "UNAVAILABLE, no webhook delivers self-service codes",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/self/device": {
+            "delete": {
+                "security": [
+                    {
+                        "SessionAuth": []
+                    }
+                ],
+                "description": "Frees the activation slot of one device of the session's license.\nA license can deactivate one device per cooldown (SELF_SERVICE_COOLDOWN, 24 hours by default).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "self-service"
+                ],
+                "summary": "Deactivate own device",
+                "parameters": [
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/selfservice.deactivateDeviceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/selfservice.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "LICENSE_NOT_FOUND or NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "RATE_LIMITED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/self/license": {
+            "get": {
+                "security": [
+                    {
+                        "SessionAuth": []
+                    }
+                ],
+                "description": "Returns the license of the session with its status, expiry and activated devices,\nand when the next device can be deactivated.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "self-service"
+                ],
+                "summary": "Get own license",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/selfservice.licenseResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "LICENSE_NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/self/session": {
+            "post": {
+                "description": "Exchanges a license key and its one-time code for a session token valid for 15 minutes.\nSend it as \"Authorization: Bearer \u003ctoken\u003e\" to the other self-service endpoints. A code is dropped after 5 wrong attempts.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "self-service"
+                ],
+                "summary": "Open self-service session",
+                "parameters": [
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/selfservice.createSessionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/selfservice.sessionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/trial": {
+            "post": {
+                "description": "Issues a trial license on the trial plan (TRIAL_PLAN) with the HWID bound to it. At least telegram_id or discord_id is required.\nA HWID, Telegram account or Discord account gets a single trial, accounts that already have a license get none.\nTrial licenses have no grace period and can be converted to a paid plan by an admin.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "trial"
+                ],
+                "summary": "Start trial",
+                "parameters": [
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/trial.startTrialRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/trial.startTrialResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "TRIAL_CLAIMED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "RATE_LIMITED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "UNAVAILABLE",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Retrieves user by telegram_id, discord_id, or license (one is required).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Get user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Telegram ID",
+                        "name": "telegram_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Discord ID",
+                        "name": "discord_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "License key",
+                        "name": "license",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.getUserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/create": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Creates a new user with either a Telegram ID or Discord ID. Requires max activations and expiration timestamp in seconds,\nunless a plan or a product with defaults for them is given.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Create a new user",
+                "parameters": [
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.createUserRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.createUserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "CONFLICT",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Delete a user by user_id",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Delete user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/device": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Add a device HWID to user device list",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Bind HWID to user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product ID, the primary license when omitted",
+                        "name": "product",
+                        "in": "query"
+                    },
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.addDeviceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "DEVICE_LIMIT or NO_CHANGE",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Remove a device HWID from user device list",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Remove HWID from user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product ID, the primary license when omitted",
+                        "name": "product",
+                        "in": "query"
+                    },
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.removeDeviceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "NO_CHANGE",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/devices/reset": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Remove all device HWIDs from user device list",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Reset all HWIDs for user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product ID, the primary license when omitted",
+                        "name": "product",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "NO_CHANGE",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/discord": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Associates a Discord ID with the user specified by user_id in the URL.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Bind Discord to user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.bindDiscordRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "CONFLICT or NO_CHANGE",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/license/convert": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Converts the trial license of a user by user_id to a regular license on a paid plan. The key and the bound devices are kept,\nthe activation limit, expiry and features are taken from the plan unless given. Payment providers can call it with an API key\nthat has the licenses:write scope.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Convert trial license",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product ID, the primary license when omitted",
+                        "name": "product",
+                        "in": "query"
+                    },
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.convertTrialRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "CONFLICT when the license isn't a trial",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/license/entitlements": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Grants a named entitlement to the license, optionally with a numeric quota. Granting an existing entitlement changes its quota.\nEntitlements are returned by license verify so clients can gate features.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Grant entitlement",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product ID, the primary license when omitted",
+                        "name": "product",
+                        "in": "query"
+                    },
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.grantEntitlementRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "NO_CHANGE",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/license/entitlements/{name}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Removes a named entitlement from the license",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Revoke entitlement",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Entitlement name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product ID, the primary license when omitted",
+                        "name": "product",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "NO_CHANGE",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/license/grace_period": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Overrides the grace period of the license, the time after expiry during which verify still succeeds. Without grace_period the server default applies again.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Set license grace period",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product ID, the primary license when omitted",
+                        "name": "product",
+                        "in": "query"
+                    },
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/user.setGracePeriodRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "NO_CHANGE",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/license/hwid_limit": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Update the maximum number of HWIDs (devices) for a user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Update HWID limit",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product ID, the primary license when omitted",
+                        "name": "product",
+                        "in": "query"
+                    },
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.updateHwidLimitRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "NO_CHANGE",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/license/renew": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Renew the license for a user by user_id, to expires_at or by extend_by. Without either a license on a plan is renewed by the plan.\nEvery renewal is added to the renewal history of the license.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Renew license",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product ID, the primary license when omitted",
+                        "name": "product",
+                        "in": "query"
+                    },
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/user.renewLicenseRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.renewLicenseResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND or LICENSE_NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "NO_CHANGE",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/license/renewals": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Lists the renewals of the license of a user by user_id, newest first.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "List license renewals",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product ID, the primary license when omitted",
+                        "name": "product",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.listRenewalsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND or LICENSE_NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/license/status": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Changes license status of user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Change license status",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product ID, the primary license when omitted",
+                        "name": "product",
+                        "in": "query"
+                    },
+                    {
+                        "description": "payload enum: frozen, active, burned, expired",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.changeLicenseStatusRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "NO_CHANGE",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/license/token": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Issues a signed token that clients validate locally with pkg/licenseclient. It is bound to the devices currently activated on the license.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Issue offline license token",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product ID, the primary license when omitted",
+                        "name": "product",
+                        "in": "query"
+                    },
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/user.issueTokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.issueTokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND or LICENSE_NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/licenses": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Issues the user a license for another product. Max activations and expiration default to the plan, then the product settings. A user can hold one license per product.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Add license for a product",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.addLicenseRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.addLicenseResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "CONFLICT",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{user_id}/telegram": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Associates a Telegram ID with the user specified by user_id in the URL.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Bind Telegram to user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/user.bindTelegramRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.statusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "CONFLICT or NO_CHANGE",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Lists users page by page. The license filters apply to the primary license, expiry filters exclude lifetime licenses.\nPass nextCursor of a response as cursor, with the same filters and order, to get the next page.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "List users",
+                "parameters": [
+                    {
+                        "enum": [
+                            "active",
+                            "frozen",
+                            "burned",
+                            "expired"
+                        ],
+                        "type": "string",
+                        "description": "License status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Unix timestamp, licenses expiring at or after it",
+                        "name": "expires_from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Unix timestamp, licenses expiring at or before it",
+                        "name": "expires_to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Seconds, licenses expiring between now and then, e.g. 604800 for the next 7 days",
+                        "name": "expires_within",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Unix timestamp, users created at or after it",
+                        "name": "created_from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Unix timestamp, users created at or before it",
+                        "name": "created_to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only users with (true) or without (false) a Telegram binding",
+                        "name": "telegram",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only users with (true) or without (false) a Discord binding",
+                        "name": "discord",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Minimum number of activated devices",
+                        "name": "min_devices",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of activated devices",
+                        "name": "max_devices",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "id",
+                            "created_at",
+                            "expires_at"
+                        ],
+                        "type": "string",
+                        "description": "Sort field, id by default",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "description": "Sort order, asc by default",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size, 100 by default and at most 1000",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "nextCursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.listUsersResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Lists the registered webhooks, without their secrets",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhook"
+                ],
+                "summary": "List webhooks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/webhooks.listWebhooksResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Registers an endpoint that receives license lifecycle events as signed JSON POST requests:\nuser.created, user.deleted, license.renewed, license.status_changed, license.expired, device.added, device.removed, devices.reset.\nThe X-Webhook-Signature header is \"sha256=\" and the hex HMAC-SHA256 of \"\u003cX-Webhook-Timestamp\u003e.\u003cbody\u003e\" keyed with the secret,\nwhich is only returned here. Failed deliveries are retried with exponential backoff.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhook"
+                ],
+                "summary": "Create webhook",
+                "parameters": [
+                    {
+                        "description": "payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/webhooks.createWebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/webhooks.webhookResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Lists webhook deliveries with the given status, newest first. By default the dead-letter list:\ndeliveries that failed every attempt and wait for a redelivery.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhook"
+                ],
+                "summary": "List webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "pending, delivered or dead (default)",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of deliveries, 100 by default and at most 1000",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/webhooks.listDeliveriesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "INVALID_REQUEST",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/deliveries/{delivery_id}/redeliver": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Queues a delivery again with fresh attempts, typically one from the dead-letter list after its receiver was fixed",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhook"
+                ],
+                "summary": "Redeliver webhook delivery",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Delivery ID",
+                        "name": "delivery_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/webhooks.deliveryResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{webhook_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Deletes a webhook. Its pending deliveries fail and end up in the dead-letter list.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhook"
+                ],
+                "summary": "Delete webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "webhook_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/webhooks.statusResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "UNAUTHORIZED",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "FORBIDDEN",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "NOT_FOUND",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "INTERNAL",
+                        "schema": {
+                            "$ref": "#/definitions/licenseclient.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "apikey.createKeyRequest": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "expires_at": {
+                    "description": "ExpiresAt is a unix timestamp, the key doesn't expire when omitted",
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "name": {
+                    "type": "string",
+                    "example": "support-bot"
+                },
+                "role": {
+                    "description": "Role is one of the roles from ADMIN_ROLES, a key needs a role, scopes or both",
+                    "type": "string",
+                    "example": "support"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "users:read",
+                        "devices:write"
+                    ]
+                }
+            }
+        },
+        "apikey.createKeyResponse": {
+            "type": "object",
+            "properties": {
+                "apiKey": {
+                    "$ref": "#/definitions/storage.APIKey"
+                },
+                "key": {
+                    "description": "Key is the secret to send as X-API-Key, it can't be retrieved again",
+                    "type": "string",
+                    "example": "lk_Zm9vYmFy..."
+                }
+            }
+        },
+        "apikey.listKeysResponse": {
+            "type": "object",
+            "properties": {
+                "apiKeys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storage.APIKey"
+                    }
+                }
+            }
+        },
+        "apikey.statusResponse": {
+            "type": "object",
+            "properties": {
+                "status": {
+                    "type": "string",
+                    "example": "success"
+                }
+            }
+        },
+        "audit.listAuditResponse": {
+            "type": "object",
+            "properties": {
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storage.AuditEntry"
+                    }
+                }
+            }
+        },
+        "license.checkoutSeatRequest": {
+            "type": "object",
+            "required": [
+                "hwid",
+                "license"
+            ],
+            "properties": {
+                "hwid": {
+                    "type": "string"
+                },
+                "license": {
+                    "type": "string"
+                },
+                "product": {
+                    "description": "Product is the product the client claims to be, licenses of other products are rejected",
+                    "type": "string"
+                }
+            }
+        },
+        "license.revocationListResponse": {
+            "type": "object",
+            "properties": {
+                "payload": {
+                    "description": "Payload is the base64 encoded JSON of licenseclient.RevocationList",
+                    "type": "string"
+                },
+                "signature": {
+                    "description": "Signature is the base64 encoded Ed25519 signature of the decoded Payload",
+                    "type": "string"
+                }
+            }
+        },
+        "license.seatLeaseResponse": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "description": "ExpiresAt is when the lease ends without another heartbeat, in unix seconds",
+                    "type": "integer",
+                    "example": 1767225600
+                },
+                "seat_id": {
+                    "type": "string",
+                    "example": "6f1c2b9e-8d1a-4c3e-9b0f-2a7d5e4c1b3a"
+                },
+                "ttl": {
+                    "description": "TTL is how many seconds a checkout or heartbeat leases the seat for",
+                    "type": "integer",
+                    "example": 300
+                }
+            }
+        },
+        "license.seatRequest": {
+            "type": "object",
+            "required": [
+                "license",
+                "seat_id"
+            ],
+            "properties": {
+                "license": {
+                    "type": "string"
+                },
+                "seat_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "license.statusResponse": {
+            "type": "object",
+            "properties": {
+                "status": {
+                    "type": "string",
+                    "example": "success"
+                }
+            }
+        },
+        "license.verifyLicenseRequest": {
+            "type": "object",
+            "required": [
+                "hwid",
+                "license"
+            ],
+            "properties": {
+                "hwid": {
+                    "type": "string"
+                },
+                "license": {
+                    "type": "string"
+                },
+                "nonce": {
+                    "description": "Nonce is echoed back in the signed payload so a response can't be replayed",
+                    "type": "string"
+                },
+                "product": {
+                    "description": "Product is the product the client claims to be, licenses of other products are rejected",
+                    "type": "string"
+                }
+            }
+        },
+        "license.verifyLicenseResponse": {
+            "type": "object",
+            "properties": {
+                "activated": {
+                    "description": "Activated is true when the HWID was bound to the license by this request\nand false when it was already known.",
+                    "type": "boolean",
+                    "example": true
+                },
+                "entitlements": {
+                    "description": "Entitlements are the features the license grants: true for plain features, a number for quotas",
+                    "type": "object"
+                },
+                "grace": {
+                    "description": "Grace is true when the license expired but is still in its grace period",
+                    "type": "boolean",
+                    "example": false
+                },
+                "grace_remaining": {
+                    "description": "GraceRemaining is how many seconds of the grace period are left",
+                    "type": "integer",
+                    "example": 3600
+                },
+                "message": {
+                    "type": "string",
+                    "example": "license is valid"
+                },
+                "payload": {
+                    "description": "Payload is the base64 encoded JSON of licenseclient.VerifyPayload",
+                    "type": "string"
+                },
+                "signature": {
+                    "description": "Signature is the base64 encoded Ed25519 signature of the decoded Payload",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Type is \"trial\" for trial licenses and omitted for regular ones",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/storage.LicenseType"
+                        }
+                    ],
+                    "example": "trial"
+                }
+            }
+        },
+        "licenseclient.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "LICENSE_EXPIRED"
+                },
+                "details": {
+                    "description": "Details depend on the code, e.g. max_activations for DEVICE_LIMIT",
+                    "type": "object"
+                },
+                "error": {
+                    "description": "Error repeats Message for clients of the unversioned format, which only had this field",
+                    "type": "string",
+                    "example": "license expired"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "license expired"
+                },
+                "request_id": {
+                    "type": "string",
+                    "example": "0b5c3a1e-6f0e-4d5c-9a53-2f1d2b7c8e90"
+                },
+                "version": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "plan.createPlanRequest": {
+            "type": "object",
+            "required": [
+                "id",
+                "max_activations",
+                "name"
+            ],
+            "properties": {
+                "duration": {
+                    "description": "Duration is the license lifetime in seconds, 0 or omitted for lifetime licenses",
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "features": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string",
+                    "example": "monthly-1-device"
+                },
+                "max_activations": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "renewal": {
+                    "description": "Renewal is \"extend\" (default, add the duration to the current expiry)\nor \"reset\" (the duration counts from the renewal)",
+                    "enum": [
+                        "extend",
+                        "reset"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/storage.PlanRenewal"
+                        }
+                    ]
+                }
+            }
+        },
+        "plan.listPlansResponse": {
+            "type": "object",
+            "properties": {
+                "plans": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storage.Plan"
+                    }
+                }
+            }
+        },
+        "plan.planRequest": {
+            "type": "object",
+            "required": [
+                "max_activations",
+                "name"
+            ],
+            "properties": {
+                "duration": {
+                    "description": "Duration is the license lifetime in seconds, 0 or omitted for lifetime licenses",
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "features": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "max_activations": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "renewal": {
+                    "description": "Renewal is \"extend\" (default, add the duration to the current expiry)\nor \"reset\" (the duration counts from the renewal)",
+                    "enum": [
+                        "extend",
+                        "reset"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/storage.PlanRenewal"
+                        }
+                    ]
+                }
+            }
+        },
+        "plan.planResponse": {
+            "type": "object",
+            "properties": {
+                "plan": {
+                    "$ref": "#/definitions/storage.Plan"
+                }
+            }
+        },
+        "plan.statusResponse": {
+            "type": "object",
+            "properties": {
+                "status": {
+                    "type": "string",
+                    "example": "success"
+                }
+            }
+        },
+        "product.createProductRequest": {
+            "type": "object",
+            "required": [
+                "id",
+                "name"
+            ],
+            "properties": {
+                "default_duration": {
+                    "description": "DefaultDuration is the license lifetime in seconds",
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "default_max_activations": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "id": {
+                    "type": "string"
+                },
+                "key_length": {
+                    "description": "KeyLength is the number of random characters after the prefix, 16 when omitted",
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "key_prefix": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "product.listProductsResponse": {
+            "type": "object",
+            "properties": {
+                "products": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storage.Product"
+                    }
+                }
+            }
+        },
+        "product.productResponse": {
+            "type": "object",
+            "properties": {
+                "product": {
+                    "$ref": "#/definitions/storage.Product"
+                }
+            }
+        },
+        "product.statusResponse": {
+            "type": "object",
+            "properties": {
+                "status": {
+                    "type": "string",
+                    "example": "success"
+                }
+            }
+        },
+        "selfservice.createSessionRequest": {
+            "type": "object",
+            "required": [
+                "code",
+                "license"
+            ],
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "042917"
+                },
+                "license": {
+                    "type": "string"
+                }
+            }
+        },
+        "selfservice.customerLicense": {
+            "type": "object",
+            "properties": {
+                "devices": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "expiresAt": {
+                    "description": "0 for lifetime licenses",
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "maxActivations": {
+                    "type": "integer"
+                },
+                "productId": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/storage.LicenseStatus"
+                }
+            }
+        },
+        "selfservice.deactivateDeviceRequest": {
+            "type": "object",
+            "required": [
+                "hwid"
+            ],
+            "properties": {
+                "hwid": {
+                    "type": "string"
+                }
+            }
+        },
+        "selfservice.licenseResponse": {
+            "type": "object",
+            "properties": {
+                "license": {
+                    "$ref": "#/definitions/selfservice.customerLicense"
+                },
+                "nextDeactivationAt": {
+                    "description": "NextDeactivationAt is when a device can be deactivated again, 0 if it can now",
+                    "type": "integer"
+                }
+            }
+        },
+        "selfservice.requestCodeRequest": {
+            "type": "object",
+            "required": [
+                "channel",
+                "license"
+            ],
+            "properties": {
+                "channel": {
+                    "description": "Channel is the bound account the code is sent to",
+                    "type": "string",
+                    "enum": [
+                        "telegram",
+                        "discord"
+                    ],
+                    "example": "telegram"
+                },
+                "license": {
+                    "type": "string"
+                }
+            }
+        },
+        "selfservice.requestCodeResponse": {
+            "type": "object",
+            "properties": {
+                "expiresAt": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "success"
+                }
+            }
+        },
+        "selfservice.sessionResponse": {
+            "type": "object",
+            "properties": {
+                "expiresAt": {
+                    "type": "integer"
+                },
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "selfservice.statusResponse": {
+            "type": "object",
+            "properties": {
+                "status": {
+                    "type": "string",
+                    "example": "success"
+                }
+            }
+        },
+        "storage.APIKey": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "integer"
+                },
+                "expiresAt": {
+                    "description": "0 for keys that don't expire",
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "lastUsedAt": {
+                    "description": "0 until the key is used",
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "Prefix is the start of the key, enough to tell keys apart",
+                    "type": "string"
+                },
+                "role": {
+                    "description": "Role grants the permissions defined for it in ADMIN_ROLES, on top of Scopes",
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "storage.AuditAction": {
+            "type": "string",
+            "enum": [
+                "user.created",
+                "user.deleted",
+                "user.discord_bound",
+                "user.telegram_bound",
+                "license.added",
+                "license.status_changed",
+                "license.renewed",
+                "license.converted",
+                "license.hwid_limit_changed",
+                "license.grace_period_changed",
+                "license.entitlement_granted",
+                "license.entitlement_revoked",
+                "device.added",
+                "device.removed",
+                "devices.reset",
+                "product.created",
+                "product.deleted",
+                "plan.created",
+                "plan.updated",
+                "plan.deleted",
+                "webhook.created",
+                "webhook.deleted",
+                "api_key.created",
+                "api_key.revoked"
+            ],
+            "x-enum-varnames": [
+                "AuditUserCreated",
+                "AuditUserDeleted",
+                "AuditDiscordBound",
+                "AuditTelegramBound",
+                "AuditLicenseAdded",
+                "AuditLicenseStatusChanged",
+                "AuditLicenseRenewed",
+                "AuditLicenseConverted",
+                "AuditHwidLimitChanged",
+                "AuditGracePeriodChanged",
+                "AuditEntitlementGranted",
+                "AuditEntitlementRevoked",
+                "AuditDeviceAdded",
+                "AuditDeviceRemoved",
+                "AuditDevicesReset",
+                "AuditProductCreated",
+                "AuditProductDeleted",
+                "AuditPlanCreated",
+                "AuditPlanUpdated",
+                "AuditPlanDeleted",
+                "AuditWebhookCreated",
+                "AuditWebhookDeleted",
+                "AuditAPIKeyCreated",
+                "AuditAPIKeyRevoked"
+            ]
+        },
+        "storage.AuditEntry": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "$ref": "#/definitions/storage.AuditAction"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "after": {
+                    "type": "object"
+                },
+                "before": {
+                    "type": "object"
+                },
+                "requestId": {
+                    "type": "string"
+                },
+                "target": {
+                    "description": "Target is the product of the changed license, or the changed product, plan, webhook or API key",
+                    "type": "string"
+                },
+                "time": {
+                    "type": "integer"
+                },
+                "userId": {
+                    "description": "UserId is the target user, 0 for actions on products and plans",
+                    "type": "integer"
+                }
+            }
+        },
+        "storage.DeliveryStatus": {
+            "type": "string",
+            "enum": [
+                "pending",
+                "delivered",
+                "dead"
+            ],
+            "x-enum-varnames": [
+                "DeliveryPending",
+                "DeliveryDelivered",
+                "DeliveryDead"
+            ]
+        },
+        "storage.Entitlements": {
+            "type": "object",
+            "additionalProperties": {
+                "type": "integer"
+            }
+        },
+        "storage.License": {
+            "type": "object",
+            "properties": {
+                "devices": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "entitlements": {
+                    "$ref": "#/definitions/storage.Entitlements"
+                },
+                "expiresAt": {
+                    "description": "0 for lifetime licenses",
+                    "type": "integer"
+                },
+                "gracePeriod": {
+                    "description": "GracePeriod is how many seconds after ExpiresAt verify still succeeds,\nnil for the server default (GRACE_PERIOD)",
+                    "type": "integer"
+                },
+                "issuedAt": {
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "maxActivations": {
+                    "type": "integer"
+                },
+                "mode": {
+                    "$ref": "#/definitions/storage.LicenseMode"
+                },
+                "planId": {
+                    "type": "string"
+                },
+                "productId": {
+                    "type": "string"
+                },
+                "seats": {
+                    "description": "Seats are the leases of a floating license, expired ones until they are reclaimed",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storage.Seat"
+                    }
+                },
+                "status": {
+                    "$ref": "#/definitions/storage.LicenseStatus"
+                },
+                "type": {
+                    "$ref": "#/definitions/storage.LicenseType"
+                }
+            }
+        },
+        "storage.LicenseMode": {
+            "type": "string",
+            "enum": [
+                "floating"
+            ],
+            "x-enum-varnames": [
+                "Floating"
+            ]
+        },
+        "storage.LicenseStatus": {
+            "type": "string",
+            "enum": [
+                "frozen",
+                "active",
+                "burned",
+                "expired"
+            ],
+            "x-enum-varnames": [
+                "Frozen",
+                "Active",
+                "Burned",
+                "Expired"
+            ]
+        },
+        "storage.LicenseType": {
+            "type": "string",
+            "enum": [
+                "trial"
+            ],
+            "x-enum-varnames": [
+                "Trial"
+            ]
+        },
+        "storage.Plan": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "integer"
+                },
+                "duration": {
+                    "description": "seconds, 0 for lifetime licenses",
+                    "type": "integer"
+                },
+                "features": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "maxActivations": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "renewal": {
+                    "$ref": "#/definitions/storage.PlanRenewal"
+                }
+            }
+        },
+        "storage.PlanRenewal": {
+            "type": "string",
+            "enum": [
+                "extend",
+                "reset"
+            ],
+            "x-enum-varnames": [
+                "RenewExtend",
+                "RenewReset"
+            ]
+        },
+        "storage.Product": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "integer"
+                },
+                "defaultDuration": {
+                    "description": "seconds",
+                    "type": "integer"
+                },
+                "defaultMaxActivations": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "keyLength": {
+                    "type": "integer"
+                },
+                "keyPrefix": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "storage.Renewal": {
+            "type": "object",
+            "properties": {
+                "actor": {
+                    "type": "string"
+                },
+                "amount": {
+                    "description": "Amount is the extension in seconds for extend_by, how far the expiry moved otherwise",
+                    "type": "integer"
+                },
+                "expiresAt": {
+                    "type": "integer"
+                },
+                "licenseKey": {
+                    "type": "string"
+                },
+                "previousExpiresAt": {
+                    "type": "integer"
+                },
+                "requestId": {
+                    "type": "string"
+                },
+                "source": {
+                    "$ref": "#/definitions/storage.RenewalSource"
+                },
+                "time": {
+                    "type": "integer"
+                },
+                "userId": {
+                    "type": "integer"
+                }
+            }
+        },
+        "storage.RenewalSource": {
+            "type": "string",
+            "enum": [
+                "expires_at",
+                "extend_by",
+                "plan"
             ],
+            "x-enum-varnames": [
+                "RenewalAbsolute",
+                "RenewalExtension",
+                "RenewalPlan"
+            ]
+        },
+        "storage.Seat": {
+            "type": "object",
             "properties": {
+                "checkedOutAt": {
+                    "type": "integer"
+                },
+                "expiresAt": {
+                    "type": "integer"
+                },
                 "hwid": {
                     "type": "string"
                 },
-                "license": {
+                "id": {
                     "type": "string"
                 }
             }
         },
-        "storage.License": {
+        "storage.User": {
             "type": "object",
             "properties": {
-                "devices": {
+                "createdAt": {
+                    "type": "integer"
+                },
+                "discordId": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "license": {
+                    "$ref": "#/definitions/storage.License"
+                },
+                "licenses": {
+                    "description": "Licenses holds the user's licenses for other products than the primary one.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storage.License"
+                    }
+                },
+                "telegramId": {
+                    "type": "integer"
+                }
+            }
+        },
+        "storage.Webhook": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "integer"
+                },
+                "events": {
+                    "description": "Events lists the subscribed event types, empty for all of them",
                     "type": "array",
                     "items": {
                         "type": "string"
                     }
                 },
-                "expiresAt": {
+                "id": {
+                    "type": "string"
+                },
+                "secret": {
+                    "description": "HMAC-SHA256 key, only returned on creation",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "storage.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
                     "type": "integer"
                 },
-                "issuedAt": {
+                "createdAt": {
                     "type": "integer"
                 },
-                "key": {
+                "event": {
                     "type": "string"
                 },
-                "maxActivations": {
+                "id": {
+                    "type": "string"
+                },
+                "lastError": {
+                    "type": "string"
+                },
+                "nextAttempt": {
                     "type": "integer"
                 },
+                "payload": {
+                    "type": "object"
+                },
                 "status": {
-                    "$ref": "#/definitions/storage.LicenseStatus"
+                    "$ref": "#/definitions/storage.DeliveryStatus"
+                },
+                "webhookId": {
+                    "type": "string"
                 }
             }
         },
-        "storage.LicenseStatus": {
-            "type": "string",
-            "enum": [
-                "frozen",
-                "active",
-                "burned"
-            ],
-            "x-enum-varnames": [
-                "Frozen",
-                "Active",
-                "Burned"
-            ]
-        },
-        "storage.User": {
+        "trial.startTrialRequest": {
             "type": "object",
+            "required": [
+                "hwid"
+            ],
             "properties": {
-                "createdAt": {
+                "discord_id": {
                     "type": "integer"
                 },
-                "discordId": {
-                    "type": "integer"
+                "hwid": {
+                    "description": "HWID is bound to the trial license right away",
+                    "type": "string"
                 },
-                "id": {
+                "telegram_id": {
                     "type": "integer"
-                },
+                }
+            }
+        },
+        "trial.startTrialResponse": {
+            "type": "object",
+            "properties": {
                 "license": {
                     "$ref": "#/definitions/storage.License"
                 },
-                "telegramId": {
+                "userId": {
                     "type": "integer"
                 }
             }
@@ -752,6 +4338,47 @@ const docTemplate = `{
                 }
             }
         },
+        "user.addLicenseRequest": {
+            "type": "object",
+            "required": [
+                "product"
+            ],
+            "properties": {
+                "expires_at": {
+                    "type": "integer"
+                },
+                "max_activations": {
+                    "description": "MaxActivations and Expiration default to the plan, then the product settings when omitted",
+                    "type": "integer"
+                },
+                "mode": {
+                    "description": "Mode \"floating\" leases max_activations seats at a time instead of binding devices",
+                    "enum": [
+                        "floating"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/storage.LicenseMode"
+                        }
+                    ],
+                    "example": "floating"
+                },
+                "plan": {
+                    "type": "string"
+                },
+                "product": {
+                    "type": "string"
+                }
+            }
+        },
+        "user.addLicenseResponse": {
+            "type": "object",
+            "properties": {
+                "license": {
+                    "$ref": "#/definitions/storage.License"
+                }
+            }
+        },
         "user.bindDiscordRequest": {
             "type": "object",
             "required": [
@@ -785,12 +4412,29 @@ const docTemplate = `{
                 }
             }
         },
-        "user.createUserRequest": {
+        "user.convertTrialRequest": {
             "type": "object",
             "required": [
-                "expires_at",
-                "max_activations"
+                "plan"
             ],
+            "properties": {
+                "expires_at": {
+                    "description": "ExpiresAt overrides the expiry of the plan, counted from the conversion",
+                    "type": "integer"
+                },
+                "max_activations": {
+                    "description": "MaxActivations overrides the activation limit of the plan",
+                    "type": "integer"
+                },
+                "plan": {
+                    "description": "Plan is the paid plan the trial is converted to",
+                    "type": "string",
+                    "example": "monthly-1-device"
+                }
+            }
+        },
+        "user.createUserRequest": {
+            "type": "object",
             "properties": {
                 "discord_id": {
                     "type": "integer"
@@ -801,6 +4445,27 @@ const docTemplate = `{
                 "max_activations": {
                     "type": "integer"
                 },
+                "mode": {
+                    "description": "Mode \"floating\" leases max_activations seats at a time instead of binding devices",
+                    "enum": [
+                        "floating"
+                    ],
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/storage.LicenseMode"
+                        }
+                    ],
+                    "example": "floating"
+                },
+                "plan": {
+                    "description": "Plan is optional, it sets max activations, expiry and features unless given explicitly",
+                    "type": "string",
+                    "example": "monthly-1-device"
+                },
+                "product": {
+                    "description": "Product is optional, its settings are used for the license key and as defaults",
+                    "type": "string"
+                },
                 "telegram_id": {
                     "type": "integer"
                 }
@@ -822,21 +4487,71 @@ const docTemplate = `{
                 }
             }
         },
-        "user.internalErrResponse": {
+        "user.grantEntitlementRequest": {
             "type": "object",
+            "required": [
+                "name"
+            ],
             "properties": {
-                "error": {
+                "name": {
                     "type": "string",
-                    "example": "internal server error"
+                    "example": "max_projects"
+                },
+                "quota": {
+                    "description": "Quota is optional, without it the entitlement is a plain feature",
+                    "type": "integer",
+                    "minimum": 0,
+                    "example": 10
                 }
             }
         },
-        "user.invalidBodyErrResponse": {
+        "user.issueTokenRequest": {
             "type": "object",
             "properties": {
-                "error": {
-                    "type": "string",
-                    "example": "invalid request"
+                "features": {
+                    "description": "Features default to the names of the license's entitlements",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "grace_period": {
+                    "description": "GracePeriod is how many seconds after expiry the token is still accepted,\nthe grace period of the license when omitted",
+                    "type": "integer"
+                }
+            }
+        },
+        "user.issueTokenResponse": {
+            "type": "object",
+            "properties": {
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "user.listRenewalsResponse": {
+            "type": "object",
+            "properties": {
+                "renewals": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storage.Renewal"
+                    }
+                }
+            }
+        },
+        "user.listUsersResponse": {
+            "type": "object",
+            "properties": {
+                "nextCursor": {
+                    "description": "NextCursor fetches the next page, empty on the last one",
+                    "type": "string"
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storage.User"
+                    }
                 }
             }
         },
@@ -853,12 +4568,38 @@ const docTemplate = `{
         },
         "user.renewLicenseRequest": {
             "type": "object",
-            "required": [
-                "expires_at"
-            ],
             "properties": {
                 "expires_at": {
+                    "description": "ExpiresAt sets the new expiry. Licenses on a plan may omit it and extend_by,\nthey are renewed by the plan's duration and renewal behavior",
                     "type": "integer"
+                },
+                "extend_by": {
+                    "description": "ExtendBy extends the license by a duration like \"30d\" or \"12h\", from its\ncurrent expiry or from now if it already expired",
+                    "type": "string",
+                    "example": "30d"
+                }
+            }
+        },
+        "user.renewLicenseResponse": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "integer",
+                    "example": 1760000000
+                },
+                "status": {
+                    "type": "string",
+                    "example": "success"
+                }
+            }
+        },
+        "user.setGracePeriodRequest": {
+            "type": "object",
+            "properties": {
+                "grace_period": {
+                    "description": "GracePeriod is how many seconds after expiry the license still verifies,\nnull or omitted to use the server default (GRACE_PERIOD)",
+                    "type": "integer",
+                    "example": 86400
                 }
             }
         },
@@ -881,6 +4622,76 @@ const docTemplate = `{
                     "type": "integer"
                 }
             }
+        },
+        "webhooks.createWebhookRequest": {
+            "type": "object",
+            "required": [
+                "url"
+            ],
+            "properties": {
+                "events": {
+                    "description": "Events to subscribe to, all of them when omitted",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "user.created",
+                        "license.renewed"
+                    ]
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://billing.example.com/hooks/licenses"
+                }
+            }
+        },
+        "webhooks.deliveryResponse": {
+            "type": "object",
+            "properties": {
+                "delivery": {
+                    "$ref": "#/definitions/storage.WebhookDelivery"
+                }
+            }
+        },
+        "webhooks.listDeliveriesResponse": {
+            "type": "object",
+            "properties": {
+                "deliveries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storage.WebhookDelivery"
+                    }
+                }
+            }
+        },
+        "webhooks.listWebhooksResponse": {
+            "type": "object",
+            "properties": {
+                "webhooks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storage.Webhook"
+                    }
+                }
+            }
+        },
+        "webhooks.statusResponse": {
+            "type": "object",
+            "properties": {
+                "status": {
+                    "type": "string",
+                    "example": "success"
+                }
+            }
+        },
+        "webhooks.webhookResponse": {
+            "type": "object",
+            "properties": {
+                "webhook": {
+                    "$ref": "#/definitions/storage.Webhook"
+                }
+            }
         }
     },
     "securityDefinitions": {
@@ -888,6 +4699,11 @@ const docTemplate = `{
             "type": "apiKey",
             "name": "X-API-Key",
             "in": "header"
+        },
+        "SessionAuth": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
@@ -899,7 +4715,7 @@ var SwaggerInfo = &swag.Spec{
 	BasePath:         "/api",
 	Schemes:          []string{},
 	Title:            "License Manager API",
-	Description:      "API for managing user licenses.",
+	Description:      "API for managing user licenses.\nFailed requests return an error envelope (licenseclient.ErrorResponse) whose `code` is stable, unlike its `message`.",
 	InfoInstanceName: "swagger",
 	SwaggerTemplate:  docTemplate,
 	LeftDelim:        "{{",
@@ -0,0 +1,120 @@
+package apikey
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/api/middleware"
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// prefixLength is how much of a key is kept to tell keys apart
+const prefixLength = 8
+
+type createKeyRequest struct {
+	Name string `json:"name" binding:"required" example:"support-bot"`
+	// Role is one of the roles from ADMIN_ROLES, a key needs a role, scopes or both
+	Role   string   `json:"role" example:"support"`
+	Scopes []string `json:"scopes" example:"users:read,devices:write"`
+	// ExpiresAt is a unix timestamp, the key doesn't expire when omitted
+	ExpiresAt int64 `json:"expires_at" binding:"gte=0"`
+}
+
+// @Summary Create API key
+// @Description Mints an API key for the private endpoints, limited to the permissions of its role and the given scopes.
+// @Description Only permissions the caller has can be granted.
+// @Description The key is returned once, only its hash is stored.
+// @Tags api key
+// @Accept json
+// @Produce json
+// @Param request body createKeyRequest true "payload"
+// @Success 200 {object} createKeyResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 409 {object} licenseclient.ErrorResponse "CONFLICT"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /keys [post]
+func (h *Handler) CreateKeyHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req createKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Debug(ctx, "invalid request body", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+	now := time.Now().Unix()
+	if req.ExpiresAt != 0 && req.ExpiresAt <= now {
+		api_utils.BadRequestResponse(c, "expires_at must be in the future")
+		return
+	}
+	if req.Role == "" && len(req.Scopes) == 0 {
+		api_utils.BadRequestResponse(c, "role or scopes are required")
+		return
+	}
+	rolePermissions, ok := h.roles[req.Role]
+	if req.Role != "" && !ok {
+		api_utils.BadRequestResponse(c, "unknown role "+req.Role)
+		return
+	}
+	granted := middleware.GrantedScopes(ctx)
+	for _, permission := range rolePermissions {
+		if !middleware.HasScope(granted, permission) {
+			api_utils.ErrResponse(c, http.StatusForbidden, licenseclient.CodeForbidden, "can't grant a role with a permission you don't have: "+permission)
+			return
+		}
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(middleware.Scopes, scope) {
+			api_utils.BadRequestResponse(c, "unknown scope "+scope)
+			return
+		}
+		// a key can't hand out more than it has
+		if !middleware.HasScope(granted, scope) {
+			api_utils.ErrResponse(c, http.StatusForbidden, licenseclient.CodeForbidden, "can't grant a scope you don't have: "+scope)
+			return
+		}
+	}
+
+	keys, err := h.store.GetAllAPIKeys(ctx)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get api keys", err)
+		return
+	}
+	if slices.ContainsFunc(keys, func(k *storage.APIKey) bool { return k.Name == req.Name }) {
+		api_utils.ErrResponse(c, http.StatusConflict, licenseclient.CodeConflict, "api key already exists")
+		return
+	}
+
+	secret := api_utils.GenAPIKey()
+	key := storage.APIKey{
+		Id:        uuid.New().String(),
+		Name:      req.Name,
+		Hash:      api_utils.HashAPIKey(secret),
+		Prefix:    secret[:prefixLength],
+		Role:      req.Role,
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+		ExpiresAt: storage.Timestamp(req.ExpiresAt),
+		CreatedAt: storage.Timestamp(now),
+	}
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+	if err := h.store.CreateAPIKey(ctx, key); err != nil {
+		api_utils.StorageErrResponse(c, "failed to create api key", err)
+		return
+	}
+
+	api_utils.RecordAudit(c, h.store, storage.AuditAPIKeyCreated, 0, key.Id, nil, key)
+
+	c.JSON(http.StatusOK, createKeyResponse{APIKey: key, Key: secret})
+}
@@ -0,0 +1,35 @@
+package apikey
+
+import (
+	"net/http"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary List API keys
+// @Description Lists the API keys with their scopes, expiry and last use. The keys themselves aren't stored.
+// @Tags api key
+// @Accept json
+// @Produce json
+// @Success 200 {object} listKeysResponse
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /keys [get]
+func (h *Handler) ListKeysHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	keys, err := h.store.GetAllAPIKeys(ctx)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get api keys", err)
+		return
+	}
+	if keys == nil {
+		keys = []*storage.APIKey{}
+	}
+
+	c.JSON(http.StatusOK, listKeysResponse{APIKeys: keys})
+}
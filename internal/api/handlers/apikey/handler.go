@@ -0,0 +1,17 @@
+package apikey
+
+import (
+	"github.com/dzhisl/license-api/internal/api/middleware"
+	"github.com/dzhisl/license-api/internal/storage"
+)
+
+// Handler serves the API key endpoints on top of a storage backend.
+type Handler struct {
+	store storage.Store
+	roles middleware.Roles
+}
+
+// NewHandler creates the API key handlers. Keys can be given the roles defined in roles.
+func NewHandler(store storage.Store, roles middleware.Roles) *Handler {
+	return &Handler{store: store, roles: roles}
+}
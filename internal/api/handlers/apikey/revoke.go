@@ -0,0 +1,50 @@
+package apikey
+
+import (
+	"net/http"
+	"slices"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Revoke API key
+// @Description Deletes an API key, requests made with it are rejected from then on
+// @Tags api key
+// @Accept json
+// @Produce json
+// @Param key_id path string true "API key ID"
+// @Success 200 {object} statusResponse
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /keys/{key_id} [delete]
+func (h *Handler) RevokeKeyHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	keyId := c.Param("key_id")
+	var before any
+	if keys, err := h.store.GetAllAPIKeys(ctx); err == nil {
+		if i := slices.IndexFunc(keys, func(k *storage.APIKey) bool { return k.Id == keyId }); i >= 0 {
+			before = keys[i]
+		}
+	}
+
+	deleted, err := h.store.DeleteAPIKey(ctx, keyId)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to delete api key", err)
+		return
+	}
+	if deleted == 0 {
+		api_utils.ErrResponse(c, http.StatusNotFound, licenseclient.CodeNotFound, "api key not found")
+		return
+	}
+
+	api_utils.RecordAudit(c, h.store, storage.AuditAPIKeyRevoked, 0, keyId, before, nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
@@ -0,0 +1,17 @@
+package apikey
+
+import "github.com/dzhisl/license-api/internal/storage"
+
+type createKeyResponse struct {
+	APIKey storage.APIKey `json:"apiKey"`
+	// Key is the secret to send as X-API-Key, it can't be retrieved again
+	Key string `json:"key" example:"lk_Zm9vYmFy..."`
+}
+
+type listKeysResponse struct {
+	APIKeys []*storage.APIKey `json:"apiKeys"`
+}
+
+type statusResponse struct {
+	Status string `json:"status" example:"success"`
+}
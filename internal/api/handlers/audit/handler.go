@@ -0,0 +1,13 @@
+package audit
+
+import "github.com/dzhisl/license-api/internal/storage"
+
+// Handler serves the audit log on top of a storage backend.
+type Handler struct {
+	store storage.Store
+}
+
+// NewHandler creates the audit handlers.
+func NewHandler(store storage.Store) *Handler {
+	return &Handler{store: store}
+}
@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"net/http"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+type listAuditQuery struct {
+	UserId int    `form:"user_id"`
+	Action string `form:"action"`
+	// From and To are unix timestamps in seconds, both inclusive
+	From  int64 `form:"from" binding:"gte=0"`
+	To    int64 `form:"to" binding:"gte=0"`
+	Limit int   `form:"limit" binding:"gte=0"`
+}
+
+// @Summary List audit log
+// @Description Returns administrative mutations, newest first. Each entry has the actor, request ID, action, target and the changed values before and after.
+// @Tags audit
+// @Accept json
+// @Produce json
+// @Param user_id query int false "Only entries for this user"
+// @Param action query string false "Only this action, e.g. license.status_changed"
+// @Param from query int false "Unix timestamp, only entries at or after it"
+// @Param to query int false "Unix timestamp, only entries at or before it"
+// @Param limit query int false "Maximum number of entries, 100 by default and at most 1000"
+// @Success 200 {object} listAuditResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /audit [get]
+func (h *Handler) ListAuditHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var query listAuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		logger.Debug(ctx, "invalid query", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+	switch {
+	case query.Limit == 0:
+		query.Limit = defaultLimit
+	case query.Limit > maxLimit:
+		query.Limit = maxLimit
+	}
+
+	entries, err := h.store.ListAudit(ctx, storage.AuditFilter{
+		UserId: query.UserId,
+		Action: storage.AuditAction(query.Action),
+		From:   storage.Timestamp(query.From),
+		To:     storage.Timestamp(query.To),
+		Limit:  query.Limit,
+	})
+	if err != nil {
+		logger.Error(ctx, "failed to list audit log", zap.Error(err))
+		api_utils.InternalErrResponse(c)
+		return
+	}
+	if entries == nil {
+		entries = []*storage.AuditEntry{}
+	}
+
+	c.JSON(http.StatusOK, listAuditResponse{Entries: entries})
+}
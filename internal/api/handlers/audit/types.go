@@ -0,0 +1,7 @@
+package audit
+
+import "github.com/dzhisl/license-api/internal/storage"
+
+type listAuditResponse struct {
+	Entries []*storage.AuditEntry `json:"entries"`
+}
@@ -0,0 +1,38 @@
+package license
+
+import (
+	"crypto/ed25519"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/storage"
+)
+
+// DefaultSeatTTL is how long a seat of a floating license is leased without
+// a heartbeat when no TTL is configured.
+const DefaultSeatTTL = 5 * time.Minute
+
+// Handler serves the license endpoints on top of a storage backend.
+type Handler struct {
+	store      storage.Store
+	signingKey ed25519.PrivateKey
+	// gracePeriod is the grace period of licenses without their own, in seconds
+	gracePeriod int64
+	// seatTTL is how long a checkout or heartbeat leases a seat, in seconds
+	seatTTL int64
+}
+
+// NewHandler creates the license handlers. Successful verify responses
+// are signed with signingKey; they are left unsigned if it is nil.
+// Expired licenses still verify for gracePeriod unless they override it.
+// Seats of floating licenses are leased for seatTTL, DefaultSeatTTL if it is 0.
+func NewHandler(store storage.Store, signingKey ed25519.PrivateKey, gracePeriod, seatTTL time.Duration) *Handler {
+	if seatTTL <= 0 {
+		seatTTL = DefaultSeatTTL
+	}
+	return &Handler{
+		store:       store,
+		signingKey:  signingKey,
+		gracePeriod: int64(gracePeriod.Seconds()),
+		seatTTL:     int64(seatTTL.Seconds()),
+	}
+}
@@ -0,0 +1,66 @@
+package license
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type revocationListResponse struct {
+	// Payload is the base64 encoded JSON of licenseclient.RevocationList
+	Payload string `json:"payload"`
+	// Signature is the base64 encoded Ed25519 signature of the decoded Payload
+	Signature string `json:"signature"`
+}
+
+// @Summary Revocation list
+// @Description Signed list of license keys that are not active anymore (frozen or burned). Offline clients use it together with license tokens.
+// @Tags license
+// @Produce json
+// @Success 200 {object} revocationListResponse
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Failure 503 {object} licenseclient.ErrorResponse "UNAVAILABLE, no signing key is configured"
+// @Router /license/revocations [get]
+func (h *Handler) RevocationListHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	if h.signingKey == nil {
+		utils.ErrResponse(c, http.StatusServiceUnavailable, licenseclient.CodeUnavailable, "signing key is not configured")
+		return
+	}
+
+	users, err := h.store.GetAllUsers(ctx)
+	if err != nil {
+		logger.Error(ctx, "failed to get users", zap.Error(err))
+		utils.InternalErrResponse(c)
+		return
+	}
+
+	rl := licenseclient.RevocationList{
+		IssuedAt: time.Now().Unix(),
+		Keys:     []string{},
+	}
+	for _, u := range users {
+		for _, l := range u.AllLicenses() {
+			// tokens check the expiry themselves, with their grace period
+			if l.Status != storage.Active && l.Status != storage.Expired {
+				rl.Keys = append(rl.Keys, l.Key)
+			}
+		}
+	}
+
+	signed, err := licenseclient.SignRevocationList(h.signingKey, rl)
+	if err != nil {
+		logger.Error(ctx, "failed to sign revocation list", zap.Error(err))
+		utils.InternalErrResponse(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, revocationListResponse{Payload: signed.Payload, Signature: signed.Signature})
+}
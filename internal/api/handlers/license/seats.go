@@ -0,0 +1,185 @@
+package license
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type checkoutSeatRequest struct {
+	License string `json:"license" binding:"required"`
+	HWID    string `json:"hwid" binding:"required"`
+	// Product is the product the client claims to be, licenses of other products are rejected
+	Product string `json:"product"`
+}
+
+type seatRequest struct {
+	License string `json:"license" binding:"required"`
+	SeatId  string `json:"seat_id" binding:"required"`
+}
+
+type seatLeaseResponse struct {
+	SeatId string `json:"seat_id" example:"6f1c2b9e-8d1a-4c3e-9b0f-2a7d5e4c1b3a"`
+	// ExpiresAt is when the lease ends without another heartbeat, in unix seconds
+	ExpiresAt storage.Timestamp `json:"expires_at" example:"1767225600"`
+	// TTL is how many seconds a checkout or heartbeat leases the seat for
+	TTL int64 `json:"ttl" example:"300"`
+}
+
+type statusResponse struct {
+	Status string `json:"status" example:"success"`
+}
+
+// @Summary Check out seat
+// @Description Lease a seat of a floating license to the HWID. The lease ends after ttl seconds unless it is renewed with /license/seats/heartbeat.
+// @Description A HWID that already holds a seat keeps it and gets a new expiry. Expired leases are reclaimed and don't take a seat.
+// @Tags license
+// @Accept json
+// @Produce json
+// @Param request body checkoutSeatRequest true "payload"
+// @Success 200 {object} seatLeaseResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST, e.g. the license is not floating"
+// @Failure 403 {object} licenseclient.ErrorResponse "LICENSE_FROZEN, LICENSE_BURNED, LICENSE_EXPIRED, PRODUCT_MISMATCH or SEAT_LIMIT"
+// @Failure 404 {object} licenseclient.ErrorResponse "LICENSE_NOT_FOUND"
+// @Failure 429 {object} licenseclient.ErrorResponse "RATE_LIMITED"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Router /license/seats/checkout [post]
+func (h *Handler) CheckoutSeatHandler(c *gin.Context) {
+	var req checkoutSeatRequest
+	ctx := c.Request.Context()
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.InvalidRequestResponse(c)
+		return
+	}
+
+	user, license, ok := h.findLicense(c, req.License)
+	if !ok {
+		return
+	}
+	if !h.checkUsable(c, license, req.Product) {
+		return
+	}
+	if license.Mode != storage.Floating {
+		utils.BadRequestResponse(c, "license is not floating, use /license/verify")
+		return
+	}
+
+	now := time.Now().Unix()
+	ref := storage.LicenseRef{UserId: user.Id, ProductId: license.ProductId}
+	seat, err := h.store.CheckoutSeat(ctx, ref, storage.Seat{
+		Id:           uuid.New().String(),
+		Hwid:         req.HWID,
+		CheckedOutAt: storage.Timestamp(now),
+		ExpiresAt:    storage.Timestamp(now + h.seatTTL),
+	}, storage.Timestamp(now))
+	if err != nil {
+		if errors.Is(err, storage.ErrSeatLimit) {
+			utils.ErrDetailsResponse(c, http.StatusForbidden, licenseclient.CodeSeatLimit, "every seat of the license is in use",
+				map[string]any{"max_seats": license.MaxActivations})
+			return
+		}
+		utils.StorageErrResponse(c, "failed to check out seat", err)
+		return
+	}
+
+	logger.Info(ctx, "seat checked out", zap.Int("user_id", user.Id), zap.String("hwid", req.HWID), zap.String("seat_id", seat.Id))
+	c.JSON(http.StatusOK, seatLeaseResponse{SeatId: seat.Id, ExpiresAt: seat.ExpiresAt, TTL: h.seatTTL})
+}
+
+// @Summary Seat heartbeat
+// @Description Renew the lease of a seat of a floating license for another ttl seconds. Clients should send it well before expires_at.
+// @Description An expired lease can't be renewed, the client has to check out a seat again.
+// @Tags license
+// @Accept json
+// @Produce json
+// @Param request body seatRequest true "payload"
+// @Success 200 {object} seatLeaseResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 403 {object} licenseclient.ErrorResponse "LICENSE_FROZEN, LICENSE_BURNED or LICENSE_EXPIRED"
+// @Failure 404 {object} licenseclient.ErrorResponse "LICENSE_NOT_FOUND or SEAT_NOT_FOUND"
+// @Failure 429 {object} licenseclient.ErrorResponse "RATE_LIMITED"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Router /license/seats/heartbeat [post]
+func (h *Handler) HeartbeatSeatHandler(c *gin.Context) {
+	var req seatRequest
+	ctx := c.Request.Context()
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.InvalidRequestResponse(c)
+		return
+	}
+
+	user, license, ok := h.findLicense(c, req.License)
+	if !ok {
+		return
+	}
+	// a lease can't outlive the license it belongs to
+	if !h.checkUsable(c, license, "") {
+		return
+	}
+
+	now := time.Now().Unix()
+	expiresAt := storage.Timestamp(now + h.seatTTL)
+	ref := storage.LicenseRef{UserId: user.Id, ProductId: license.ProductId}
+	if err := h.store.HeartbeatSeat(ctx, ref, req.SeatId, expiresAt, storage.Timestamp(now)); err != nil {
+		seatErrResponse(c, "failed to renew seat", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, seatLeaseResponse{SeatId: req.SeatId, ExpiresAt: expiresAt, TTL: h.seatTTL})
+}
+
+// @Summary Release seat
+// @Description Give the seat of a floating license back, e.g. when the client exits, so another machine can check it out.
+// @Tags license
+// @Accept json
+// @Produce json
+// @Param request body seatRequest true "payload"
+// @Success 200 {object} statusResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 404 {object} licenseclient.ErrorResponse "LICENSE_NOT_FOUND or SEAT_NOT_FOUND"
+// @Failure 429 {object} licenseclient.ErrorResponse "RATE_LIMITED"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Router /license/seats/release [post]
+func (h *Handler) ReleaseSeatHandler(c *gin.Context) {
+	var req seatRequest
+	ctx := c.Request.Context()
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.InvalidRequestResponse(c)
+		return
+	}
+
+	user, license, ok := h.findLicense(c, req.License)
+	if !ok {
+		return
+	}
+
+	ref := storage.LicenseRef{UserId: user.Id, ProductId: license.ProductId}
+	if err := h.store.ReleaseSeat(ctx, ref, req.SeatId); err != nil {
+		seatErrResponse(c, "failed to release seat", err)
+		return
+	}
+
+	logger.Info(ctx, "seat released", zap.Int("user_id", user.Id), zap.String("seat_id", req.SeatId))
+	c.JSON(http.StatusOK, statusResponse{Status: "success"})
+}
+
+// seatErrResponse writes the response for an error of a seat operation.
+func seatErrResponse(c *gin.Context, msg string, err error) {
+	if errors.Is(err, storage.ErrSeatNotFound) {
+		logger.Debug(c.Request.Context(), msg, zap.Error(err))
+		utils.ErrResponse(c, http.StatusNotFound, licenseclient.CodeSeatNotFound, "seat lease expired or was released")
+		return
+	}
+	utils.StorageErrResponse(c, msg, err)
+}
@@ -1,11 +1,15 @@
 package license
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/dzhisl/license-api/internal/api/utils"
 	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
 	"github.com/dzhisl/license-api/pkg/logger"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -14,62 +18,187 @@ import (
 type verifyLicenseRequest struct {
 	License string `json:"license" binding:"required"`
 	HWID    string `json:"hwid" binding:"required"`
+	// Nonce is echoed back in the signed payload so a response can't be replayed
+	Nonce string `json:"nonce"`
+	// Product is the product the client claims to be, licenses of other products are rejected
+	Product string `json:"product"`
+}
+
+type verifyLicenseResponse struct {
+	Message string `json:"message" example:"license is valid"`
+	// Activated is true when the HWID was bound to the license by this request
+	// and false when it was already known.
+	Activated bool `json:"activated" example:"true"`
+	// Type is "trial" for trial licenses and omitted for regular ones
+	Type storage.LicenseType `json:"type,omitempty" example:"trial"`
+	// Grace is true when the license expired but is still in its grace period
+	Grace bool `json:"grace,omitempty" example:"false"`
+	// GraceRemaining is how many seconds of the grace period are left
+	GraceRemaining int64 `json:"grace_remaining,omitempty" example:"3600"`
+	// Entitlements are the features the license grants: true for plain features, a number for quotas
+	Entitlements storage.Entitlements `json:"entitlements,omitempty" swaggertype:"object"`
+	// Payload is the base64 encoded JSON of licenseclient.VerifyPayload
+	Payload string `json:"payload,omitempty"`
+	// Signature is the base64 encoded Ed25519 signature of the decoded Payload
+	Signature string `json:"signature,omitempty"`
 }
 
 // @Summary Verify license
-// @Description Verify license by license string and HWID
+// @Description Verify license by license string and HWID. When product is set, licenses issued for other products are rejected.
+// @Description An unknown HWID is bound to the license if there is a free activation slot.
+// @Description Successful responses carry a payload signed with the server Ed25519 key, see pkg/licenseclient.
+// @Description Expired licenses keep verifying during their grace period (GRACE_PERIOD unless the license overrides it), with grace set to true.
+// @Description Floating licenses don't bind the HWID, they only verify while it holds a seat from /license/seats/checkout.
 // @Tags license
 // @Accept json
 // @Produce json
 // @Param request body verifyLicenseRequest true "payload"
+// @Success 200 {object} verifyLicenseResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 403 {object} licenseclient.ErrorResponse "LICENSE_FROZEN, LICENSE_BURNED, LICENSE_EXPIRED, PRODUCT_MISMATCH, DEVICE_LIMIT or SEAT_REQUIRED"
+// @Failure 404 {object} licenseclient.ErrorResponse "LICENSE_NOT_FOUND"
+// @Failure 429 {object} licenseclient.ErrorResponse "RATE_LIMITED"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
 // @Router /license/verify [post]
-func VerifyLicenseHandler(c *gin.Context) {
+func (h *Handler) VerifyLicenseHandler(c *gin.Context) {
 	var req verifyLicenseRequest
 	ctx := c.Request.Context()
-	conn := storage.GetConnector()
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		status, resp := utils.FormInvalidRequestResponse()
-		c.JSON(status, resp)
+		utils.InvalidRequestResponse(c)
 		return
 	}
 
-	user, err := conn.GetUser(ctx, storage.GetUserParams{License: req.License})
-	if err != nil || user == nil {
-		logger.Error(ctx, "failed to find user", zap.Error(err))
-		status, resp := utils.FormErrResponse(http.StatusNotFound, "license not found")
-		c.JSON(status, resp)
+	user, license, ok := h.findLicense(c, req.License)
+	if !ok {
 		return
 	}
-
-	license := user.License
-
-	if license.Status != storage.Active {
-		status, resp := utils.FormErrResponse(http.StatusForbidden, "license not active")
-		c.JSON(status, resp)
+	if !h.checkUsable(c, license, req.Product) {
 		return
 	}
 
-	// NEW: check if HWID is already registered
-	hwidExists := false
-	for _, hwid := range license.Devices {
-		if hwid == req.HWID {
-			hwidExists = true
-			break
+	// floating licenses don't bind devices, the machine needs a leased seat
+	if license.Mode == storage.Floating {
+		if license.HeldSeat(req.HWID, time.Now().Unix()) == nil {
+			utils.ErrResponse(c, http.StatusForbidden, licenseclient.CodeSeatRequired, "no seat is checked out for this device")
+			return
 		}
+		h.respondValid(c, req, license, false)
+		return
 	}
 
-	if len(license.Devices) >= license.MaxActivations && !hwidExists {
-		status, resp := utils.FormErrResponse(http.StatusForbidden, "device limit reached — new device not allowed")
-		c.JSON(status, resp)
+	ref := storage.LicenseRef{UserId: user.Id, ProductId: license.ProductId}
+
+	if slices.Contains(license.Devices, req.HWID) {
+		h.respondValid(c, req, license, false)
 		return
 	}
 
-	if time.Now().Unix() >= int64(license.ExpiresAt) {
-		status, resp := utils.FormErrResponse(http.StatusForbidden, "license expired")
-		c.JSON(status, resp)
+	// unknown HWID: take a free activation slot, the store enforces the limit atomically
+	if err := h.store.AddHwidSession(ctx, ref, req.HWID); err != nil {
+		// the activation may have lost a race against another one
+		switch {
+		case errors.Is(err, storage.ErrNoChange):
+			// the same device was activated concurrently
+			h.respondValid(c, req, license, false)
+		case errors.Is(err, storage.ErrActivationLimit):
+			utils.ErrDetailsResponse(c, http.StatusForbidden, licenseclient.CodeDeviceLimit, "device limit reached — new device not allowed",
+				map[string]any{"max_activations": license.MaxActivations})
+		default:
+			utils.StorageErrResponse(c, "failed to activate device", err)
+		}
 		return
 	}
 
-	c.JSON(utils.FormResponse("license is valid"))
+	logger.Info(ctx, "device activated", zap.Int("user_id", user.Id), zap.String("hwid", req.HWID))
+	h.respondValid(c, req, license, true)
+}
+
+// findLicense looks up the license with the given key and its user. It writes
+// the error response and returns false if there is none.
+func (h *Handler) findLicense(c *gin.Context, key string) (*storage.User, storage.License, bool) {
+	ctx := c.Request.Context()
+
+	user, err := h.store.GetUser(ctx, storage.GetUserParams{License: key})
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		utils.StorageErrResponse(c, "failed to find user", err)
+		return nil, storage.License{}, false
+	}
+	if err == nil && user.LicenseByKey(key) == nil {
+		err = fmt.Errorf("user %d has no license %s", user.Id, key)
+	}
+	if err != nil {
+		logger.Debug(ctx, "failed to find user", zap.Error(err))
+		utils.ErrResponse(c, http.StatusNotFound, licenseclient.CodeLicenseNotFound, "license not found")
+		return nil, storage.License{}, false
+	}
+	return user, *user.LicenseByKey(key), true
+}
+
+// checkUsable rejects licenses of another product than the given one, if set,
+// and licenses that are not active or expired past their grace period.
+// It writes the error response and returns false if the license can't be used.
+func (h *Handler) checkUsable(c *gin.Context, license storage.License, product string) bool {
+	if product != "" && license.ProductId != product {
+		utils.ErrResponse(c, http.StatusForbidden, licenseclient.CodeProductMismatch, "license is not valid for this product")
+		return false
+	}
+
+	if license.Status != storage.Active && license.Status != storage.Expired {
+		code := licenseclient.CodeLicenseFrozen
+		if license.Status == storage.Burned {
+			code = licenseclient.CodeLicenseBurned
+		}
+		utils.ErrResponse(c, http.StatusForbidden, code, "license not active")
+		return false
+	}
+
+	// an active license may be past its expiry before the expiry worker marks it
+	now := time.Now().Unix()
+	if license.Status == storage.Expired || (license.Expired(now) && !license.InGrace(now, h.gracePeriod)) {
+		utils.ErrDetailsResponse(c, http.StatusForbidden, licenseclient.CodeLicenseExpired, "license expired",
+			map[string]any{"expires_at": license.ExpiresAt, "grace_ends_at": license.GraceEnd(h.gracePeriod)})
+		return false
+	}
+	return true
+}
+
+// respondValid writes a successful verify response, signed when the handler has a key.
+func (h *Handler) respondValid(c *gin.Context, req verifyLicenseRequest, license storage.License, activated bool) {
+	now := time.Now().Unix()
+	resp := verifyLicenseResponse{
+		Message:      "license is valid",
+		Activated:    activated,
+		Type:         license.Type,
+		Entitlements: license.Entitlements,
+	}
+	if license.InGrace(now, h.gracePeriod) {
+		resp.Grace = true
+		resp.GraceRemaining = int64(license.GraceEnd(h.gracePeriod)) - now
+	}
+
+	if h.signingKey != nil {
+		signed, err := licenseclient.Sign(h.signingKey, licenseclient.VerifyPayload{
+			License:        license.Key,
+			Product:        license.ProductId,
+			HWID:           req.HWID,
+			Status:         string(license.Status),
+			ExpiresAt:      int64(license.ExpiresAt),
+			Entitlements:   licenseclient.Entitlements(license.Entitlements),
+			Type:           string(license.Type),
+			Grace:          resp.Grace,
+			GraceRemaining: resp.GraceRemaining,
+			Timestamp:      now,
+			Nonce:          req.Nonce,
+		})
+		if err != nil {
+			logger.Error(c.Request.Context(), "failed to sign verify response", zap.Error(err))
+			utils.InternalErrResponse(c)
+			return
+		}
+		resp.Payload = signed.Payload
+		resp.Signature = signed.Signature
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
@@ -0,0 +1,60 @@
+package plan
+
+import (
+	"net/http"
+	"time"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type createPlanRequest struct {
+	Id string `json:"id" binding:"required" example:"monthly-1-device"`
+	planRequest
+}
+
+// @Summary Create plan
+// @Description Creates a named license plan. Users created or licensed with the plan get its activation limit,
+// @Description an expiry computed from its duration, and its features as entitlements.
+// @Tags plan
+// @Accept json
+// @Produce json
+// @Param request body createPlanRequest true "payload"
+// @Success 200 {object} planResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 409 {object} licenseclient.ErrorResponse "CONFLICT"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /plans [post]
+func (h *Handler) CreatePlanHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req createPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Debug(ctx, "invalid request body", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+
+	if _, err := h.store.GetPlan(ctx, req.Id); err == nil {
+		api_utils.ErrResponse(c, http.StatusConflict, licenseclient.CodeConflict, "plan already exists")
+		return
+	}
+
+	plan := req.plan(req.Id)
+	plan.CreatedAt = storage.Timestamp(time.Now().Unix())
+	if err := h.store.CreatePlan(ctx, plan); err != nil {
+		api_utils.StorageErrResponse(c, "failed to create plan", err)
+		return
+	}
+
+	api_utils.RecordAudit(c, h.store, storage.AuditPlanCreated, 0, plan.Id, nil, plan)
+
+	c.JSON(http.StatusOK, planResponse{Plan: plan})
+}
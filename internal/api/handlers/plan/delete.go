@@ -0,0 +1,44 @@
+package plan
+
+import (
+	"net/http"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Delete plan
+// @Description Deletes a plan. Licenses already issued on it keep their terms but can't be renewed by plan anymore.
+// @Tags plan
+// @Accept json
+// @Produce json
+// @Param plan_id path string true "Plan ID"
+// @Success 200 {object} statusResponse
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /plans/{plan_id} [delete]
+func (h *Handler) DeletePlanHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	planId := c.Param("plan_id")
+	before, _ := h.store.GetPlan(ctx, planId)
+
+	deleted, err := h.store.DeletePlan(ctx, planId)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to delete plan", err)
+		return
+	}
+	if deleted == 0 {
+		api_utils.ErrResponse(c, http.StatusNotFound, licenseclient.CodeNotFound, "plan not found")
+		return
+	}
+
+	api_utils.RecordAudit(c, h.store, storage.AuditPlanDeleted, 0, planId, before, nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
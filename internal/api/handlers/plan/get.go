@@ -0,0 +1,57 @@
+package plan
+
+import (
+	"net/http"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get plan
+// @Tags plan
+// @Accept json
+// @Produce json
+// @Param plan_id path string true "Plan ID"
+// @Success 200 {object} planResponse
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Security ApiKeyAuth
+// @Router /plans/{plan_id} [get]
+func (h *Handler) GetPlanHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	plan, err := h.store.GetPlan(ctx, c.Param("plan_id"))
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get plan", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, planResponse{Plan: *plan})
+}
+
+// @Summary List plans
+// @Tags plan
+// @Accept json
+// @Produce json
+// @Success 200 {object} listPlansResponse
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /plans [get]
+func (h *Handler) ListPlansHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	plans, err := h.store.GetAllPlans(ctx)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get plans", err)
+		return
+	}
+	if plans == nil {
+		plans = []*storage.Plan{}
+	}
+
+	c.JSON(http.StatusOK, listPlansResponse{Plans: plans})
+}
@@ -0,0 +1,13 @@
+package plan
+
+import "github.com/dzhisl/license-api/internal/storage"
+
+// Handler serves the plan endpoints on top of a storage backend.
+type Handler struct {
+	store storage.Store
+}
+
+// NewHandler creates the plan handlers.
+func NewHandler(store storage.Store) *Handler {
+	return &Handler{store: store}
+}
@@ -0,0 +1,43 @@
+package plan
+
+import "github.com/dzhisl/license-api/internal/storage"
+
+// planRequest is the body shared by create and update.
+type planRequest struct {
+	Name           string `json:"name" binding:"required"`
+	MaxActivations int    `json:"max_activations" binding:"required,gt=0"`
+	// Duration is the license lifetime in seconds, 0 or omitted for lifetime licenses
+	Duration int64    `json:"duration" binding:"gte=0"`
+	Features []string `json:"features"`
+	// Renewal is "extend" (default, add the duration to the current expiry)
+	// or "reset" (the duration counts from the renewal)
+	Renewal storage.PlanRenewal `json:"renewal" binding:"omitempty,oneof=extend reset"`
+}
+
+// plan builds the stored plan with the given id.
+func (req planRequest) plan(id string) storage.Plan {
+	renewal := req.Renewal
+	if renewal == "" {
+		renewal = storage.RenewExtend
+	}
+	return storage.Plan{
+		Id:             id,
+		Name:           req.Name,
+		MaxActivations: req.MaxActivations,
+		Duration:       req.Duration,
+		Features:       req.Features,
+		Renewal:        renewal,
+	}
+}
+
+type planResponse struct {
+	Plan storage.Plan `json:"plan"`
+}
+
+type listPlansResponse struct {
+	Plans []*storage.Plan `json:"plans"`
+}
+
+type statusResponse struct {
+	Status string `json:"status" example:"success"`
+}
@@ -0,0 +1,55 @@
+package plan
+
+import (
+	"net/http"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// @Summary Update plan
+// @Description Replaces the plan settings. Licenses already issued keep their activation limit and expiry,
+// @Description later renewals use the new duration and renewal behavior.
+// @Tags plan
+// @Accept json
+// @Produce json
+// @Param plan_id path string true "Plan ID"
+// @Param request body planRequest true "payload"
+// @Success 200 {object} planResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /plans/{plan_id} [put]
+func (h *Handler) UpdatePlanHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req planRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Debug(ctx, "invalid request body", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+
+	current, err := h.store.GetPlan(ctx, c.Param("plan_id"))
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get plan", err)
+		return
+	}
+
+	plan := req.plan(current.Id)
+	plan.CreatedAt = current.CreatedAt
+	if err := h.store.UpdatePlan(ctx, plan); err != nil {
+		api_utils.StorageErrResponse(c, "failed to update plan", err)
+		return
+	}
+
+	api_utils.RecordAudit(c, h.store, storage.AuditPlanUpdated, 0, plan.Id, current, plan)
+
+	c.JSON(http.StatusOK, planResponse{Plan: plan})
+}
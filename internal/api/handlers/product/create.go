@@ -0,0 +1,77 @@
+package product
+
+import (
+	"net/http"
+	"time"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type createProductRequest struct {
+	Id        string `json:"id" binding:"required"`
+	Name      string `json:"name" binding:"required"`
+	KeyPrefix string `json:"key_prefix"`
+	// KeyLength is the number of random characters after the prefix, 16 when omitted
+	KeyLength             int `json:"key_length" binding:"gte=0"`
+	DefaultMaxActivations int `json:"default_max_activations" binding:"gte=0"`
+	// DefaultDuration is the license lifetime in seconds
+	DefaultDuration int64 `json:"default_duration" binding:"gte=0"`
+}
+
+type productResponse struct {
+	Product storage.Product `json:"product"`
+}
+
+// @Summary Create product
+// @Description Creates a product. Its key prefix and length are used for the license keys issued for it,
+// @Description the default activation limit and duration apply when a license doesn't set them.
+// @Tags product
+// @Accept json
+// @Produce json
+// @Param request body createProductRequest true "payload"
+// @Success 200 {object} productResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 409 {object} licenseclient.ErrorResponse "CONFLICT"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /products [post]
+func (h *Handler) CreateProductHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req createProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Debug(ctx, "invalid request body", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+
+	if _, err := h.store.GetProduct(ctx, req.Id); err == nil {
+		api_utils.ErrResponse(c, http.StatusConflict, licenseclient.CodeConflict, "product already exists")
+		return
+	}
+
+	product := storage.Product{
+		Id:                    req.Id,
+		Name:                  req.Name,
+		KeyPrefix:             req.KeyPrefix,
+		KeyLength:             req.KeyLength,
+		DefaultMaxActivations: req.DefaultMaxActivations,
+		DefaultDuration:       req.DefaultDuration,
+		CreatedAt:             storage.Timestamp(time.Now().Unix()),
+	}
+	if err := h.store.CreateProduct(ctx, product); err != nil {
+		api_utils.StorageErrResponse(c, "failed to create product", err)
+		return
+	}
+
+	api_utils.RecordAudit(c, h.store, storage.AuditProductCreated, 0, product.Id, nil, product)
+
+	c.JSON(http.StatusOK, productResponse{Product: product})
+}
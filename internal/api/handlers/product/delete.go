@@ -0,0 +1,44 @@
+package product
+
+import (
+	"net/http"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Delete product
+// @Description Deletes a product. Licenses already issued for it are kept.
+// @Tags product
+// @Accept json
+// @Produce json
+// @Param product_id path string true "Product ID"
+// @Success 200 {object} statusResponse
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /products/{product_id} [delete]
+func (h *Handler) DeleteProductHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	productId := c.Param("product_id")
+	before, _ := h.store.GetProduct(ctx, productId)
+
+	deleted, err := h.store.DeleteProduct(ctx, productId)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to delete product", err)
+		return
+	}
+	if deleted == 0 {
+		api_utils.ErrResponse(c, http.StatusNotFound, licenseclient.CodeNotFound, "product not found")
+		return
+	}
+
+	api_utils.RecordAudit(c, h.store, storage.AuditProductDeleted, 0, productId, before, nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
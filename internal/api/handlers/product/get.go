@@ -0,0 +1,61 @@
+package product
+
+import (
+	"net/http"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+type listProductsResponse struct {
+	Products []*storage.Product `json:"products"`
+}
+
+// @Summary Get product
+// @Tags product
+// @Accept json
+// @Produce json
+// @Param product_id path string true "Product ID"
+// @Success 200 {object} productResponse
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Security ApiKeyAuth
+// @Router /products/{product_id} [get]
+func (h *Handler) GetProductHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	product, err := h.store.GetProduct(ctx, c.Param("product_id"))
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get product", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, productResponse{Product: *product})
+}
+
+// @Summary List products
+// @Tags product
+// @Accept json
+// @Produce json
+// @Success 200 {object} listProductsResponse
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /products [get]
+func (h *Handler) ListProductsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	products, err := h.store.GetAllProducts(ctx)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get products", err)
+		return
+	}
+	if products == nil {
+		products = []*storage.Product{}
+	}
+
+	c.JSON(http.StatusOK, listProductsResponse{Products: products})
+}
@@ -0,0 +1,13 @@
+package product
+
+import "github.com/dzhisl/license-api/internal/storage"
+
+// Handler serves the product endpoints on top of a storage backend.
+type Handler struct {
+	store storage.Store
+}
+
+// NewHandler creates the product handlers.
+func NewHandler(store storage.Store) *Handler {
+	return &Handler{store: store}
+}
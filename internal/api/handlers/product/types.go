@@ -0,0 +1,5 @@
+package product
+
+type statusResponse struct {
+	Status string `json:"status" example:"success"`
+}
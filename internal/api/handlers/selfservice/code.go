@@ -0,0 +1,96 @@
+package selfservice
+
+import (
+	"net/http"
+	"time"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	channelTelegram = "telegram"
+	channelDiscord  = "discord"
+)
+
+type requestCodeRequest struct {
+	License string `json:"license" binding:"required"`
+	// Channel is the bound account the code is sent to
+	Channel string `json:"channel" binding:"required,oneof=telegram discord" example:"telegram"`
+}
+
+// @Summary Request self-service code
+// @Description Sends a one-time code to the Telegram or Discord account bound to the license.
+// @Description The code is handed to the webhooks subscribed to self_service.code, which deliver it to the customer.
+// @Description It expires after 10 minutes, a new code can be requested once a minute.
+// @Tags self-service
+// @Accept json
+// @Produce json
+// @Param request body requestCodeRequest true "payload"
+// @Success 200 {object} requestCodeResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 403 {object} licenseclient.ErrorResponse "LICENSE_BURNED"
+// @Failure 404 {object} licenseclient.ErrorResponse "LICENSE_NOT_FOUND"
+// @Failure 429 {object} licenseclient.ErrorResponse "RATE_LIMITED"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Failure 503 {object} licenseclient.ErrorResponse "UNAVAILABLE, no webhook delivers self-service codes"
+// @Router /self/code [post]
+func (h *Handler) RequestCodeHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req requestCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Debug(ctx, "invalid request body", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+
+	user, license, ok := h.findLicense(c, req.License)
+	if !ok {
+		return
+	}
+	data := webhook.SelfServiceCodeData{UserId: user.Id, Product: license.ProductId, Channel: req.Channel}
+	switch req.Channel {
+	case channelTelegram:
+		data.TelegramId = user.TelegramId
+	case channelDiscord:
+		data.DiscordId = user.DiscordId
+	}
+	if data.TelegramId == 0 && data.DiscordId == 0 {
+		api_utils.BadRequestResponse(c, "no "+req.Channel+" account is bound to this license")
+		return
+	}
+
+	subscribed, err := h.hooks.HasSubscribers(ctx, webhook.EventSelfServiceCode)
+	if err != nil {
+		logger.Error(ctx, "failed to check self-service code subscribers", zap.Error(err))
+		api_utils.InternalErrResponse(c)
+		return
+	}
+	if !subscribed {
+		api_utils.ErrResponse(c, http.StatusServiceUnavailable, licenseclient.CodeUnavailable, "no webhook delivers self-service codes")
+		return
+	}
+
+	code, expiresAt, ok := h.codes.issue(license.Key, time.Now())
+	if !ok {
+		api_utils.ErrResponse(c, http.StatusTooManyRequests, licenseclient.CodeRateLimited, "a code was sent recently, try again later")
+		return
+	}
+	data.Code = code
+	data.ExpiresAt = storage.Timestamp(expiresAt.Unix())
+	if err := h.hooks.Publish(ctx, webhook.EventSelfServiceCode, data); err != nil {
+		logger.Error(ctx, "failed to publish self-service code", zap.Error(err))
+		// the code never reached the customer, let them ask for another one
+		h.codes.cancel(license.Key, code)
+		api_utils.InternalErrResponse(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, requestCodeResponse{Status: "success", ExpiresAt: data.ExpiresAt})
+}
@@ -0,0 +1,141 @@
+package selfservice
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/api/middleware"
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type deactivateDeviceRequest struct {
+	HWID string `json:"hwid" binding:"required"`
+}
+
+// @Summary Deactivate own device
+// @Description Frees the activation slot of one device of the session's license.
+// @Description A license can deactivate one device per cooldown (SELF_SERVICE_COOLDOWN, 24 hours by default).
+// @Tags self-service
+// @Accept json
+// @Produce json
+// @Param request body deactivateDeviceRequest true "payload"
+// @Success 200 {object} statusResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 404 {object} licenseclient.ErrorResponse "LICENSE_NOT_FOUND or NOT_FOUND"
+// @Failure 429 {object} licenseclient.ErrorResponse "RATE_LIMITED"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security SessionAuth
+// @Router /self/device [delete]
+func (h *Handler) DeactivateDeviceHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req deactivateDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Debug(ctx, "invalid request body", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+
+	user, license, ok := h.sessionLicense(c)
+	if !ok {
+		return
+	}
+	if !slices.Contains(license.Devices, req.HWID) {
+		api_utils.ErrResponse(c, http.StatusNotFound, licenseclient.CodeNotFound, "device not found")
+		return
+	}
+	ref := storage.LicenseRef{UserId: user.Id, ProductId: license.ProductId}
+	release, ok := h.reserveDeactivation(c, ref)
+	if !ok {
+		return
+	}
+	before := license.Devices
+	if err := h.store.DeleteHwidSession(ctx, ref, req.HWID); err != nil {
+		release()
+		api_utils.StorageErrResponse(c, "failed to delete hwid session", err)
+		return
+	}
+
+	after := slices.DeleteFunc(slices.Clone(before), func(hwid string) bool { return hwid == req.HWID })
+	api_utils.RecordAudit(c, h.store, storage.AuditDeviceRemoved, user.Id, license.ProductId,
+		gin.H{"devices": before}, gin.H{"devices": after})
+	if current, err := h.store.GetUser(ctx, storage.GetUserParams{UserId: user.Id}); err == nil {
+		h.publish(c, webhook.EventDeviceRemoved, current, license.ProductId)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// reserveDeactivation checks the cooldown of the license and records a
+// deactivation now in one step, so parallel requests can't both pass it. It
+// writes the error response and returns false if the license has to wait.
+// release gives the reservation back when no device was removed.
+func (h *Handler) reserveDeactivation(c *gin.Context, ref storage.LicenseRef) (release func(), ok bool) {
+	h.deactivationsMu.Lock()
+	defer h.deactivationsMu.Unlock()
+
+	now := time.Now()
+	for r, at := range h.deactivations {
+		if now.Sub(at) >= h.cooldown {
+			delete(h.deactivations, r)
+		}
+	}
+	next, ok := h.nextDeactivation(c, ref.UserId, ref.ProductId)
+	if !ok {
+		return nil, false
+	}
+	if at, exists := h.deactivations[ref]; exists {
+		next = max(next, storage.Timestamp(at.Add(h.cooldown).Unix()))
+	}
+	if wait := int64(next) - now.Unix(); wait > 0 {
+		c.Header("Retry-After", strconv.FormatInt(wait, 10))
+		api_utils.ErrResponse(c, http.StatusTooManyRequests, licenseclient.CodeRateLimited, "a device was deactivated recently, try again later")
+		return nil, false
+	}
+
+	h.deactivations[ref] = now
+	return func() {
+		h.deactivationsMu.Lock()
+		defer h.deactivationsMu.Unlock()
+
+		if h.deactivations[ref].Equal(now) {
+			delete(h.deactivations, ref)
+		}
+	}, true
+}
+
+// nextDeactivation returns when the license can deactivate a device again,
+// 0 if it can now. The last self-service deactivation is taken from the audit
+// log, so the cooldown survives restarts. It writes the error response and
+// returns false if the audit log can't be read.
+func (h *Handler) nextDeactivation(c *gin.Context, userId int, productId string) (storage.Timestamp, bool) {
+	ctx := c.Request.Context()
+
+	entries, err := h.store.ListAudit(ctx, storage.AuditFilter{
+		UserId: userId,
+		Action: storage.AuditDeviceRemoved,
+		From:   storage.Timestamp(time.Now().Add(-h.cooldown).Unix()),
+	})
+	if err != nil {
+		logger.Error(ctx, "failed to list audit entries", zap.Error(err))
+		api_utils.InternalErrResponse(c)
+		return 0, false
+	}
+	// entries are newest first, admins removing devices don't count
+	for _, e := range entries {
+		if strings.HasPrefix(e.Actor, middleware.SelfActorPrefix) && e.Target == productId {
+			return e.Time + storage.Timestamp(h.cooldown.Seconds()), true
+		}
+	}
+	return 0, true
+}
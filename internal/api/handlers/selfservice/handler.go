@@ -0,0 +1,115 @@
+package selfservice
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/api/middleware"
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// DefaultCooldown is the time between two device deactivations of a license
+// when no cooldown is configured.
+const DefaultCooldown = 24 * time.Hour
+
+// sessionKey holds the license key of the session in the gin context
+const sessionKey = "self_service_license"
+
+// Handler serves the self-service endpoints, where customers authenticate
+// with their license key and a one-time code instead of an API key.
+// Codes and sessions are kept in memory, so they don't survive restarts and
+// aren't shared between instances.
+type Handler struct {
+	store    storage.Store
+	hooks    *webhook.Dispatcher
+	cooldown time.Duration
+	codes    *codeStore
+	sessions *sessionStore
+
+	// deactivations holds the last self-service deactivation of each license
+	// until it is older than cooldown, see reserveDeactivation
+	deactivationsMu sync.Mutex
+	deactivations   map[storage.LicenseRef]time.Time
+}
+
+// NewHandler creates the self-service handlers. Codes are sent through hooks,
+// a license can deactivate one device per cooldown, DefaultCooldown if it is 0.
+func NewHandler(store storage.Store, hooks *webhook.Dispatcher, cooldown time.Duration) *Handler {
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	return &Handler{
+		store:    store,
+		hooks:    hooks,
+		cooldown: cooldown,
+		codes:    newCodeStore(),
+		sessions: newSessionStore(),
+
+		deactivations: make(map[storage.LicenseRef]time.Time),
+	}
+}
+
+// SessionMiddleware authenticates the "Authorization: Bearer <token>" header
+// with a session from CreateSessionHandler and records the customer as the actor.
+func (h *Handler) SessionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		licenseKey, valid := h.sessions.get(token, time.Now())
+		if !ok || !valid {
+			api_utils.ErrResponse(c, http.StatusUnauthorized, licenseclient.CodeUnauthorized, "invalid or expired session")
+			c.Abort()
+			return
+		}
+		c.Set(sessionKey, licenseKey)
+		c.Next()
+	}
+}
+
+// findLicense looks up the license with key and its user. It writes the error
+// response and returns false if there is no such license.
+func (h *Handler) findLicense(c *gin.Context, key string) (*storage.User, *storage.License, bool) {
+	ctx := c.Request.Context()
+
+	user, err := h.store.GetUser(ctx, storage.GetUserParams{License: key})
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		api_utils.StorageErrResponse(c, "failed to find license", err)
+		return nil, nil, false
+	}
+	if err != nil || user.LicenseByKey(key) == nil {
+		logger.Debug(ctx, "failed to find license", zap.Error(err))
+		api_utils.ErrResponse(c, http.StatusNotFound, licenseclient.CodeLicenseNotFound, "license not found")
+		return nil, nil, false
+	}
+	license := user.LicenseByKey(key)
+	if license.Status == storage.Burned {
+		api_utils.ErrResponse(c, http.StatusForbidden, licenseclient.CodeLicenseBurned, "license not active")
+		return nil, nil, false
+	}
+	// changes are audited as made by the customer
+	middleware.SetActor(c, middleware.SelfActor(user.Id))
+	return user, license, true
+}
+
+// sessionLicense is findLicense for the license of the authenticated session.
+func (h *Handler) sessionLicense(c *gin.Context) (*storage.User, *storage.License, bool) {
+	return h.findLicense(c, c.GetString(sessionKey))
+}
+
+// publish sends a webhook event for the customer's license, failures are only logged.
+func (h *Handler) publish(c *gin.Context, event string, user *storage.User, productId string) {
+	ctx := c.Request.Context()
+
+	err := h.hooks.Publish(ctx, event, webhook.UserData{User: user, Product: productId})
+	if err != nil {
+		logger.Error(ctx, "failed to publish webhook event", zap.String("event", event), zap.Error(err))
+	}
+}
@@ -0,0 +1,46 @@
+package selfservice
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get own license
+// @Description Returns the license of the session with its status, expiry and activated devices,
+// @Description and when the next device can be deactivated.
+// @Tags self-service
+// @Accept json
+// @Produce json
+// @Success 200 {object} licenseResponse
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 404 {object} licenseclient.ErrorResponse "LICENSE_NOT_FOUND"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security SessionAuth
+// @Router /self/license [get]
+func (h *Handler) GetLicenseHandler(c *gin.Context) {
+	user, license, ok := h.sessionLicense(c)
+	if !ok {
+		return
+	}
+	nextDeactivation, ok := h.nextDeactivation(c, user.Id, license.ProductId)
+	if !ok {
+		return
+	}
+
+	devices := license.Devices
+	if devices == nil {
+		devices = []string{}
+	}
+	c.JSON(http.StatusOK, licenseResponse{
+		License: customerLicense{
+			Key:            license.Key,
+			ProductId:      license.ProductId,
+			Status:         license.Status,
+			MaxActivations: license.MaxActivations,
+			Devices:        devices,
+			ExpiresAt:      license.ExpiresAt,
+		},
+		NextDeactivationAt: nextDeactivation,
+	})
+}
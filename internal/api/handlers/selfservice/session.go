@@ -0,0 +1,50 @@
+package selfservice
+
+import (
+	"net/http"
+	"time"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type createSessionRequest struct {
+	License string `json:"license" binding:"required"`
+	Code    string `json:"code" binding:"required" example:"042917"`
+}
+
+// @Summary Open self-service session
+// @Description Exchanges a license key and its one-time code for a session token valid for 15 minutes.
+// @Description Send it as "Authorization: Bearer <token>" to the other self-service endpoints. A code is dropped after 5 wrong attempts.
+// @Tags self-service
+// @Accept json
+// @Produce json
+// @Param request body createSessionRequest true "payload"
+// @Success 200 {object} sessionResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Router /self/session [post]
+func (h *Handler) CreateSessionHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req createSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Debug(ctx, "invalid request body", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+
+	now := time.Now()
+	if !h.codes.redeem(req.License, req.Code, now) {
+		logger.Info(ctx, "invalid self-service code")
+		api_utils.ErrResponse(c, http.StatusUnauthorized, licenseclient.CodeUnauthorized, "invalid or expired code")
+		return
+	}
+
+	token, expiresAt := h.sessions.open(req.License, now)
+	c.JSON(http.StatusOK, sessionResponse{Token: token, ExpiresAt: storage.Timestamp(expiresAt.Unix())})
+}
@@ -0,0 +1,163 @@
+package selfservice
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	codeTTL    = 10 * time.Minute
+	sessionTTL = 15 * time.Minute
+	// codeInterval is the time before another code can be sent for a license
+	codeInterval = time.Minute
+	// maxCodeAttempts limits guessing, the code is dropped after that many
+	// wrong tries and the license is locked out for codeLockout
+	maxCodeAttempts = 5
+	codeLockout     = codeTTL
+)
+
+// pendingCode is the code state of a license. It outlives a dropped code, so
+// wrong tries, the lockout and the codeInterval throttle are kept until they pass.
+type pendingCode struct {
+	// code is empty once it was dropped
+	code      string
+	expiresAt time.Time
+	sentAt    time.Time
+	// attempts counts wrong tries, also across codes sent in between
+	attempts    int
+	lockedUntil time.Time
+}
+
+// codeStore holds the outstanding one-time code of each license key.
+type codeStore struct {
+	mu    sync.Mutex
+	codes map[string]*pendingCode
+}
+
+func newCodeStore() *codeStore {
+	return &codeStore{codes: make(map[string]*pendingCode)}
+}
+
+// issue returns a new 6 digit code for licenseKey, replacing the previous one.
+// It returns ok false if a code was sent less than codeInterval ago or the
+// license is locked out.
+func (s *codeStore) issue(licenseKey string, now time.Time) (code string, expiresAt time.Time, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(now)
+	pending, exists := s.codes[licenseKey]
+	if !exists {
+		pending = &pendingCode{}
+		s.codes[licenseKey] = pending
+	}
+	if now.Before(pending.lockedUntil) || now.Sub(pending.sentAt) < codeInterval {
+		return "", time.Time{}, false
+	}
+	n, _ := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	pending.code = fmt.Sprintf("%06d", n.Int64())
+	pending.expiresAt = now.Add(codeTTL)
+	pending.sentAt = now
+	return pending.code, pending.expiresAt, true
+}
+
+// cancel drops code if it is still the outstanding code of licenseKey and
+// lifts the codeInterval throttle, for a code that couldn't be sent.
+func (s *codeStore) cancel(licenseKey, code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pending, exists := s.codes[licenseKey]; exists && pending.code == code {
+		pending.code = ""
+		pending.sentAt = time.Time{}
+	}
+}
+
+// redeem reports whether code is the outstanding code of licenseKey, which
+// can only be redeemed once.
+func (s *codeStore) redeem(licenseKey, code string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(now)
+	pending, exists := s.codes[licenseKey]
+	if !exists || pending.code == "" || now.Before(pending.lockedUntil) {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(pending.code), []byte(code)) == 1 {
+		delete(s.codes, licenseKey)
+		return true
+	}
+	pending.attempts++
+	if pending.attempts >= maxCodeAttempts {
+		pending.code = ""
+		pending.attempts = 0
+		pending.lockedUntil = now.Add(codeLockout)
+	}
+	return false
+}
+
+// purge drops the state of licenses whose code expired and whose lockout and
+// throttle have passed.
+func (s *codeStore) purge(now time.Time) {
+	for key, pending := range s.codes {
+		if !now.Before(pending.expiresAt) && !now.Before(pending.lockedUntil) && now.Sub(pending.sentAt) >= codeInterval {
+			delete(s.codes, key)
+		}
+	}
+}
+
+type session struct {
+	licenseKey string
+	expiresAt  time.Time
+}
+
+// sessionStore maps session tokens to the license they were opened for.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]session)}
+}
+
+// open starts a session for licenseKey and returns its token.
+func (s *sessionStore) open(licenseKey string, now time.Time) (token string, expiresAt time.Time) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token = hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(now)
+	s.sessions[token] = session{licenseKey: licenseKey, expiresAt: now.Add(sessionTTL)}
+	return token, now.Add(sessionTTL)
+}
+
+// get returns the license key of the session with token, ok is false if
+// there is no such session or it expired.
+func (s *sessionStore) get(token string, now time.Time) (licenseKey string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, exists := s.sessions[token]
+	if !exists || !now.Before(sess.expiresAt) {
+		return "", false
+	}
+	return sess.licenseKey, true
+}
+
+func (s *sessionStore) purge(now time.Time) {
+	for token, sess := range s.sessions {
+		if !now.Before(sess.expiresAt) {
+			delete(s.sessions, token)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package selfservice
+
+import "github.com/dzhisl/license-api/internal/storage"
+
+type requestCodeResponse struct {
+	Status    string            `json:"status" example:"success"`
+	ExpiresAt storage.Timestamp `json:"expiresAt"`
+}
+
+type sessionResponse struct {
+	Token     string            `json:"token"`
+	ExpiresAt storage.Timestamp `json:"expiresAt"`
+}
+
+// customerLicense is the part of a license shown to its customer.
+type customerLicense struct {
+	Key            string                `json:"key"`
+	ProductId      string                `json:"productId,omitempty"`
+	Status         storage.LicenseStatus `json:"status"`
+	MaxActivations int                   `json:"maxActivations"`
+	Devices        []string              `json:"devices"`
+	ExpiresAt      storage.Timestamp     `json:"expiresAt"` // 0 for lifetime licenses
+}
+
+type licenseResponse struct {
+	License customerLicense `json:"license"`
+	// NextDeactivationAt is when a device can be deactivated again, 0 if it can now
+	NextDeactivationAt storage.Timestamp `json:"nextDeactivationAt"`
+}
+
+type statusResponse struct {
+	Status string `json:"status" example:"success"`
+}
@@ -0,0 +1,21 @@
+package trial
+
+import (
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
+)
+
+// Handler serves the public trial endpoint. Trial licenses are issued on a
+// plan chosen by the operator, and a HWID, Telegram account or Discord
+// account gets a single one.
+type Handler struct {
+	store  storage.Store
+	hooks  *webhook.Dispatcher
+	planId string
+}
+
+// NewHandler creates the trial handlers. Trials are issued on the plan
+// planId, there are none if it is empty.
+func NewHandler(store storage.Store, hooks *webhook.Dispatcher, planId string) *Handler {
+	return &Handler{store: store, hooks: hooks, planId: planId}
+}
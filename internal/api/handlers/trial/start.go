@@ -0,0 +1,129 @@
+package trial
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/api/middleware"
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/dzhisl/license-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type startTrialRequest struct {
+	// HWID is bound to the trial license right away
+	HWID       string `json:"hwid" binding:"required"`
+	TelegramId int    `json:"telegram_id"`
+	DiscordId  int    `json:"discord_id"`
+}
+
+// @Summary Start trial
+// @Description Issues a trial license on the trial plan (TRIAL_PLAN) with the HWID bound to it. At least telegram_id or discord_id is required.
+// @Description A HWID, Telegram account or Discord account gets a single trial, accounts that already have a license get none.
+// @Description Trial licenses have no grace period and can be converted to a paid plan by an admin.
+// @Tags trial
+// @Accept json
+// @Produce json
+// @Param request body startTrialRequest true "payload"
+// @Success 200 {object} startTrialResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 409 {object} licenseclient.ErrorResponse "TRIAL_CLAIMED"
+// @Failure 429 {object} licenseclient.ErrorResponse "RATE_LIMITED"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Failure 503 {object} licenseclient.ErrorResponse "UNAVAILABLE"
+// @Router /trial [post]
+func (h *Handler) StartTrialHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	if h.planId == "" {
+		api_utils.ErrResponse(c, http.StatusServiceUnavailable, licenseclient.CodeUnavailable, "trials are not configured")
+		return
+	}
+
+	var req startTrialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Debug(ctx, "invalid request body", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+	if req.TelegramId == 0 && req.DiscordId == 0 {
+		api_utils.BadRequestResponse(c, "at least discord or telegram ID must be provided")
+		return
+	}
+
+	plan, err := h.store.GetPlan(ctx, h.planId)
+	if err != nil {
+		logger.Error(ctx, "failed to get trial plan", zap.String("plan_id", h.planId), zap.Error(err))
+		api_utils.InternalErrResponse(c)
+		return
+	}
+	if plan.Duration == 0 {
+		logger.Error(ctx, "trial plan issues lifetime licenses", zap.String("plan_id", h.planId))
+		api_utils.InternalErrResponse(c)
+		return
+	}
+
+	now := time.Now().Unix()
+	user := storage.User{
+		TelegramId: req.TelegramId,
+		DiscordId:  req.DiscordId,
+		CreatedAt:  storage.Timestamp(now),
+		License: storage.License{
+			Key:            utils.GenLicense(),
+			Type:           storage.Trial,
+			PlanId:         plan.Id,
+			MaxActivations: plan.MaxActivations,
+			Devices:        []string{req.HWID},
+			IssuedAt:       storage.Timestamp(now),
+			ExpiresAt:      plan.ExpiresAt(now),
+			Status:         storage.Active,
+			Entitlements:   plan.Entitlements(),
+			// a trial ends at its expiry
+			GracePeriod: new(int64),
+		},
+	}
+	if err := storage.CreateUserWithNewId(ctx, h.store, &user); err != nil {
+		if errors.Is(err, storage.ErrDuplicate) {
+			api_utils.ErrResponse(c, http.StatusConflict, licenseclient.CodeTrialClaimed, "this account already has a license")
+			return
+		}
+		api_utils.StorageErrResponse(c, "failed to create trial user", err)
+		return
+	}
+
+	err = h.store.ClaimTrial(ctx, storage.TrialClaim{
+		LicenseKey: user.License.Key,
+		UserId:     user.Id,
+		Hwid:       req.HWID,
+		TelegramId: req.TelegramId,
+		DiscordId:  req.DiscordId,
+		ClaimedAt:  storage.Timestamp(now),
+	})
+	if err != nil {
+		// the HWID or account had a trial before, drop the new user again
+		if _, deleteErr := h.store.DeleteUser(ctx, user.Id); deleteErr != nil {
+			logger.Error(ctx, "failed to delete unclaimed trial user", zap.Int("user_id", user.Id), zap.Error(deleteErr))
+		}
+		if errors.Is(err, storage.ErrDuplicate) {
+			api_utils.ErrResponse(c, http.StatusConflict, licenseclient.CodeTrialClaimed, "a trial was already claimed for this device or account")
+			return
+		}
+		api_utils.StorageErrResponse(c, "failed to claim trial", err)
+		return
+	}
+
+	// audited as made by the customer, like the self-service changes
+	middleware.SetActor(c, middleware.SelfActor(user.Id))
+	api_utils.RecordAudit(c, h.store, storage.AuditUserCreated, user.Id, "", nil, user)
+	if err := h.hooks.Publish(ctx, webhook.EventUserCreated, webhook.UserData{User: &user}); err != nil {
+		logger.Error(ctx, "failed to publish webhook event", zap.String("event", webhook.EventUserCreated), zap.Error(err))
+	}
+
+	c.JSON(http.StatusOK, startTrialResponse{UserId: user.Id, License: user.License})
+}
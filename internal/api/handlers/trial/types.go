@@ -0,0 +1,8 @@
+package trial
+
+import "github.com/dzhisl/license-api/internal/storage"
+
+type startTrialResponse struct {
+	UserId  int             `json:"userId"`
+	License storage.License `json:"license"`
+}
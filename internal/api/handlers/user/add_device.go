@@ -6,6 +6,7 @@ import (
 
 	api_utils "github.com/dzhisl/license-api/internal/api/utils"
 	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
 	"github.com/dzhisl/license-api/pkg/logger"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -21,37 +22,46 @@ type addDeviceRequest struct {
 // @Accept json
 // @Produce json
 // @Param user_id path int true "User ID"
+// @Param product query string false "Product ID, the primary license when omitted"
 // @Param request body addDeviceRequest true "payload"
 // @Success 200 {object} statusResponse
-// @Failure 400 {object} invalidBodyErrResponse
-// @Failure 500 {object} internalErrResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 409 {object} licenseclient.ErrorResponse "DEVICE_LIMIT or NO_CHANGE"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
 // @Security ApiKeyAuth
 // @Router /user/{user_id}/device [post]
-func AddDeviceHandler(c *gin.Context) {
-	conn := storage.GetConnector()
+func (h *Handler) AddDeviceHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	userIdStr := c.Param("user_id")
 	userId, err := strconv.Atoi(userIdStr)
 	if err != nil {
 		logger.Debug(ctx, "invalid user_id", zap.Error(err))
-		c.JSON(api_utils.FormErrResponse(http.StatusBadRequest, "user_id must be an integer"))
+		api_utils.BadRequestResponse(c, "user_id must be an integer")
 		return
 	}
 
 	var req addDeviceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Debug(ctx, "invalid request body", zap.Error(err))
-		c.JSON(api_utils.FormInvalidRequestResponse())
+		api_utils.InvalidRequestResponse(c)
 		return
 	}
 
-	err = conn.AddHwidSession(ctx, userId, req.HWID)
+	ref := licenseRef(c, userId)
+	before := h.licenseSnapshot(ctx, ref)
+
+	err = h.store.AddHwidSession(ctx, ref, req.HWID)
 	if err != nil {
-		logger.Error(ctx, "failed to add hwid session", zap.Error(err))
-		c.JSON(api_utils.FormInternalErrResponse())
+		api_utils.StorageErrResponse(c, "failed to add hwid session", err)
 		return
 	}
 
+	h.audit(c, storage.AuditDeviceAdded, ref, devicesState(before), devicesState(h.licenseSnapshot(ctx, ref)))
+	h.publish(c, webhook.EventDeviceAdded, ref)
+
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
@@ -0,0 +1,92 @@
+package user
+
+import (
+	"net/http"
+	"strconv"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type addLicenseRequest struct {
+	Product string `json:"product" binding:"required"`
+	Plan    string `json:"plan"`
+	// MaxActivations and Expiration default to the plan, then the product settings when omitted
+	MaxActivations int `json:"max_activations"`
+	Expiration     int `json:"expires_at"`
+	// Mode "floating" leases max_activations seats at a time instead of binding devices
+	Mode storage.LicenseMode `json:"mode" binding:"omitempty,oneof=floating" example:"floating"`
+}
+
+type addLicenseResponse struct {
+	License storage.License `json:"license"`
+}
+
+// @Summary Add license for a product
+// @Description Issues the user a license for another product. Max activations and expiration default to the plan, then the product settings. A user can hold one license per product.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param request body addLicenseRequest true "payload"
+// @Success 200 {object} addLicenseResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 409 {object} licenseclient.ErrorResponse "CONFLICT"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /user/{user_id}/licenses [post]
+func (h *Handler) AddLicenseHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userIdStr := c.Param("user_id")
+	userId, err := strconv.Atoi(userIdStr)
+	if err != nil {
+		logger.Debug(ctx, "invalid user_id", zap.Error(err))
+		api_utils.BadRequestResponse(c, "user_id must be an integer")
+		return
+	}
+
+	var req addLicenseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Debug(ctx, "invalid request body", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+
+	user, err := h.store.GetUser(ctx, storage.GetUserParams{UserId: userId})
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get user", err)
+		return
+	}
+	if user.FindLicense(req.Product) != nil {
+		api_utils.ErrResponse(c, http.StatusConflict, licenseclient.CodeConflict, "user already has a license for this product")
+		return
+	}
+
+	license, ok := h.newLicense(c, licenseOptions{
+		ProductId:      req.Product,
+		PlanId:         req.Plan,
+		MaxActivations: req.MaxActivations,
+		ExpiresAt:      req.Expiration,
+		Mode:           req.Mode,
+	})
+	if !ok {
+		return
+	}
+
+	if err := h.store.AddLicense(ctx, userId, license); err != nil {
+		api_utils.StorageErrResponse(c, "failed to add license", err)
+		return
+	}
+
+	h.audit(c, storage.AuditLicenseAdded, storage.LicenseRef{UserId: userId, ProductId: license.ProductId}, nil, license)
+
+	c.JSON(http.StatusOK, addLicenseResponse{License: license})
+}
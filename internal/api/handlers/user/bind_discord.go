@@ -23,35 +23,44 @@ type bindDiscordRequest struct {
 // @Param user_id path int true "User ID"
 // @Param request body bindDiscordRequest true "payload"
 // @Success 200 {object} statusResponse
-// @Failure 400 {object} invalidBodyErrResponse
-// @Failure 500 {object} internalErrResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 409 {object} licenseclient.ErrorResponse "CONFLICT or NO_CHANGE"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
 // @Security ApiKeyAuth
 // @Router /user/{user_id}/discord [post]
-func BindDiscordHandler(c *gin.Context) {
-	conn := storage.GetConnector()
+func (h *Handler) BindDiscordHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	userIdStr := c.Param("user_id")
 	userId, err := strconv.Atoi(userIdStr)
 	if err != nil {
 		logger.Debug(ctx, "invalid user_id", zap.Error(err))
-		c.JSON(api_utils.FormErrResponse(http.StatusBadRequest, "user_id must be an integer"))
+		api_utils.BadRequestResponse(c, "user_id must be an integer")
 		return
 	}
 
 	var req bindDiscordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Debug(ctx, "invalid request body", zap.Error(err))
-		c.JSON(api_utils.FormInvalidRequestResponse())
+		api_utils.InvalidRequestResponse(c)
 		return
 	}
 
-	err = conn.BindDiscord(ctx, userId, req.DiscordId)
+	var before any
+	if user := h.userSnapshot(ctx, userId); user != nil {
+		before = gin.H{"discordId": user.DiscordId}
+	}
+
+	err = h.store.BindDiscord(ctx, userId, req.DiscordId)
 	if err != nil {
-		logger.Error(ctx, "failed to bind discord", zap.Error(err))
-		c.JSON(api_utils.FormInternalErrResponse())
+		api_utils.StorageErrResponse(c, "failed to bind discord", err)
 		return
 	}
 
+	h.audit(c, storage.AuditDiscordBound, storage.LicenseRef{UserId: userId}, before, gin.H{"discordId": req.DiscordId})
+
 	c.JSON(http.StatusOK, statusResponse{Status: "success"})
 }
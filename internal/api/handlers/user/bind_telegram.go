@@ -23,35 +23,44 @@ type bindTelegramRequest struct {
 // @Param user_id path int true "User ID"
 // @Param request body bindTelegramRequest true "payload"
 // @Success 200 {object} statusResponse
-// @Failure 400 {object} invalidBodyErrResponse
-// @Failure 500 {object} internalErrResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 409 {object} licenseclient.ErrorResponse "CONFLICT or NO_CHANGE"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
 // @Security ApiKeyAuth
 // @Router /user/{user_id}/telegram [post]
-func BindTelegramHandler(c *gin.Context) {
-	conn := storage.GetConnector()
+func (h *Handler) BindTelegramHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	userIdStr := c.Param("user_id")
 	userId, err := strconv.Atoi(userIdStr)
 	if err != nil {
 		logger.Debug(ctx, "invalid user_id", zap.Error(err))
-		c.JSON(api_utils.FormErrResponse(http.StatusBadRequest, "user_id must be an integer"))
+		api_utils.BadRequestResponse(c, "user_id must be an integer")
 		return
 	}
 
 	var req bindTelegramRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Debug(ctx, "invalid request body", zap.Error(err))
-		c.JSON(api_utils.FormInvalidRequestResponse())
+		api_utils.InvalidRequestResponse(c)
 		return
 	}
 
-	err = conn.BindTelegram(ctx, userId, req.TelegramId)
+	var before any
+	if user := h.userSnapshot(ctx, userId); user != nil {
+		before = gin.H{"telegramId": user.TelegramId}
+	}
+
+	err = h.store.BindTelegram(ctx, userId, req.TelegramId)
 	if err != nil {
-		logger.Error(ctx, "failed to bind telegram", zap.Error(err))
-		c.JSON(api_utils.FormInternalErrResponse())
+		api_utils.StorageErrResponse(c, "failed to bind telegram", err)
 		return
 	}
 
+	h.audit(c, storage.AuditTelegramBound, storage.LicenseRef{UserId: userId}, before, gin.H{"telegramId": req.TelegramId})
+
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
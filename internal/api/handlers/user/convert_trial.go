@@ -0,0 +1,104 @@
+package user
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type convertTrialRequest struct {
+	// Plan is the paid plan the trial is converted to
+	Plan string `json:"plan" binding:"required" example:"monthly-1-device"`
+	// MaxActivations overrides the activation limit of the plan
+	MaxActivations int `json:"max_activations"`
+	// ExpiresAt overrides the expiry of the plan, counted from the conversion
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// @Summary Convert trial license
+// @Description Converts the trial license of a user by user_id to a regular license on a paid plan. The key and the bound devices are kept,
+// @Description the activation limit, expiry and features are taken from the plan unless given. Payment providers can call it with an API key
+// @Description that has the licenses:write scope.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param product query string false "Product ID, the primary license when omitted"
+// @Param request body convertTrialRequest true "payload"
+// @Success 200 {object} statusResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 409 {object} licenseclient.ErrorResponse "CONFLICT when the license isn't a trial"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /user/{user_id}/license/convert [post]
+func (h *Handler) ConvertTrialHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userIdStr := c.Param("user_id")
+	userId, err := strconv.Atoi(userIdStr)
+	if err != nil {
+		logger.Debug(ctx, "invalid user_id", zap.Error(err))
+		api_utils.BadRequestResponse(c, "user_id must be an integer")
+		return
+	}
+
+	var req convertTrialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Debug(ctx, "invalid request body", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+
+	plan, err := h.store.GetPlan(ctx, req.Plan)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get plan", err)
+		return
+	}
+
+	ref := licenseRef(c, userId)
+	current := h.licenseSnapshot(ctx, ref)
+	if current != nil && current.Type != storage.Trial {
+		api_utils.ErrResponse(c, http.StatusConflict, licenseclient.CodeConflict, "license is not a trial")
+		return
+	}
+
+	terms := storage.License{
+		PlanId:         plan.Id,
+		MaxActivations: req.MaxActivations,
+		ExpiresAt:      storage.Timestamp(req.ExpiresAt),
+		Entitlements:   plan.Entitlements(),
+	}
+	if terms.MaxActivations == 0 {
+		terms.MaxActivations = plan.MaxActivations
+	}
+	if terms.ExpiresAt == 0 {
+		terms.ExpiresAt = plan.ExpiresAt(time.Now().Unix())
+	}
+
+	err = h.store.ConvertTrial(ctx, ref, terms)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to convert trial", err)
+		return
+	}
+
+	var before any
+	if current != nil {
+		before = gin.H{"type": current.Type, "planId": current.PlanId, "maxActivations": current.MaxActivations, "expiresAt": current.ExpiresAt}
+	}
+	h.audit(c, storage.AuditLicenseConverted, ref, before,
+		gin.H{"planId": terms.PlanId, "maxActivations": terms.MaxActivations, "expiresAt": terms.ExpiresAt})
+	h.publish(c, webhook.EventLicenseConverted, ref)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
@@ -1,25 +1,28 @@
 package user
 
 import (
-	"math/rand"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
 	api_utils "github.com/dzhisl/license-api/internal/api/utils"
 	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
 	"github.com/dzhisl/license-api/pkg/logger"
-	"github.com/dzhisl/license-api/pkg/utils"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
 type createUserRequest struct {
-	TelegramId     int `json:"telegram_id"`
-	DiscordId      int `json:"discord_id"`
-	MaxActivations int `json:"max_activations" binding:"required"`
-	Expiration     int `json:"expires_at" binding:"required"`
+	TelegramId int `json:"telegram_id"`
+	DiscordId  int `json:"discord_id"`
+	// Product is optional, its settings are used for the license key and as defaults
+	Product string `json:"product"`
+	// Plan is optional, it sets max activations, expiry and features unless given explicitly
+	Plan           string `json:"plan" example:"monthly-1-device"`
+	MaxActivations int    `json:"max_activations"`
+	Expiration     int    `json:"expires_at"`
+	// Mode "floating" leases max_activations seats at a time instead of binding devices
+	Mode storage.LicenseMode `json:"mode" binding:"omitempty,oneof=floating" example:"floating"`
 }
 
 type createUserResponse struct {
@@ -27,38 +30,33 @@ type createUserResponse struct {
 }
 
 // @Summary Create a new user
-// @Description Creates a new user with either a Telegram ID or Discord ID. Requires max activations and expiration timestamp in seconds.
+// @Description Creates a new user with either a Telegram ID or Discord ID. Requires max activations and expiration timestamp in seconds,
+// @Description unless a plan or a product with defaults for them is given.
 // @Tags user
 // @Accept json
 // @Produce json
 // @Param request body createUserRequest true "payload"
 // @Success 200 {object} createUserResponse
-// @Failure 400 {object} invalidBodyErrResponse
-// @Failure 500 {object} internalErrResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 409 {object} licenseclient.ErrorResponse "CONFLICT"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
 // @Security ApiKeyAuth
 // @Router /user/create [post]
-func CreateUserHandler(c *gin.Context) {
-	conn := storage.GetConnector()
+func (h *Handler) CreateUserHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	var reqBody createUserRequest
 	if err := c.ShouldBind(&reqBody); err != nil {
 		logger.Debug(ctx, "invalid request body", zap.Error(err))
-		c.JSON(api_utils.FormInvalidRequestResponse())
+		api_utils.InvalidRequestResponse(c)
 		return
 	}
 
-	now := time.Now().Unix()
 	user := storage.User{
-		Id:        genUserID(),
-		CreatedAt: storage.Timestamp(now),
-		License: storage.License{
-			Key:            utils.GenLicense(),
-			MaxActivations: reqBody.MaxActivations,
-			IssuedAt:       storage.Timestamp(now),
-			ExpiresAt:      storage.Timestamp(reqBody.Expiration),
-			Status:         storage.Active,
-		},
+		CreatedAt: storage.Timestamp(time.Now().Unix()),
 	}
 	switch {
 	case reqBody.TelegramId != 0:
@@ -66,28 +64,31 @@ func CreateUserHandler(c *gin.Context) {
 	case reqBody.DiscordId != 0:
 		user.DiscordId = reqBody.DiscordId
 	default:
-		c.JSON(api_utils.FormErrResponse(http.StatusBadRequest, "at least discord or telegram ID must be provided"))
+		api_utils.BadRequestResponse(c, "at least discord or telegram ID must be provided")
 		return
 	}
 
-	if err := conn.CreateUser(ctx, user); err != nil {
-		logger.Error(ctx, err.Error(), zap.Any("request_body", reqBody))
-		c.JSON(api_utils.FormInternalErrResponse())
+	license, ok := h.newLicense(c, licenseOptions{
+		ProductId:      reqBody.Product,
+		PlanId:         reqBody.Plan,
+		MaxActivations: reqBody.MaxActivations,
+		ExpiresAt:      reqBody.Expiration,
+		Mode:           reqBody.Mode,
+	})
+	if !ok {
 		return
 	}
+	user.License = license
+
+	if err := storage.CreateUserWithNewId(ctx, h.store, &user); err != nil {
+		api_utils.StorageErrResponse(c, "failed to create user", err)
+		return
+	}
+
+	h.audit(c, storage.AuditUserCreated, storage.LicenseRef{UserId: user.Id}, nil, user)
+	h.publishUser(c, webhook.EventUserCreated, &user, "")
 
 	c.JSON(http.StatusOK, createUserResponse{
 		User: user,
 	})
 }
-
-func genUserID() int {
-	const digits = "123456789"
-
-	var sb strings.Builder
-	for i := 0; i < 8; i++ {
-		sb.WriteByte(digits[rand.Intn(len(digits))])
-	}
-	userId, _ := strconv.Atoi(sb.String())
-	return userId
-}
@@ -6,6 +6,7 @@ import (
 
 	api_utils "github.com/dzhisl/license-api/internal/api/utils"
 	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
 	"github.com/dzhisl/license-api/pkg/logger"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -18,28 +19,40 @@ import (
 // @Produce json
 // @Param user_id path int true "User ID"
 // @Success 200 {object} statusResponse
-// @Failure 400 {object} invalidBodyErrResponse
-// @Failure 500 {object} internalErrResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
 // @Security ApiKeyAuth
 // @Router /user/{user_id} [delete]
-func DeleteUserHandler(c *gin.Context) {
-	conn := storage.GetConnector()
+func (h *Handler) DeleteUserHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	userIdStr := c.Param("user_id")
 	userId, err := strconv.Atoi(userIdStr)
 	if err != nil {
 		logger.Debug(ctx, "invalid user_id", zap.Error(err))
-		c.JSON(api_utils.FormErrResponse(http.StatusBadRequest, "user_id must be an integer"))
+		api_utils.BadRequestResponse(c, "user_id must be an integer")
 		return
 	}
 
-	_, err = conn.DeleteUser(ctx, userId)
+	before := h.userSnapshot(ctx, userId)
+
+	deletedCount, err := h.store.DeleteUser(ctx, userId)
 	if err != nil {
-		logger.Error(ctx, "failed to delete user", zap.Error(err))
-		c.JSON(api_utils.FormInternalErrResponse())
+		api_utils.StorageErrResponse(c, "failed to delete user", err)
+		return
+	}
+	if deletedCount == 0 {
+		api_utils.StorageErrResponse(c, "failed to delete user", storage.ErrUserNotFound)
 		return
 	}
 
+	h.audit(c, storage.AuditUserDeleted, storage.LicenseRef{UserId: userId}, before, nil)
+	if before != nil {
+		h.publishUser(c, webhook.EventUserDeleted, before, "")
+	}
+
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
@@ -0,0 +1,133 @@
+package user
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// entitlementName restricts names to characters that are safe as document keys.
+var entitlementName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type grantEntitlementRequest struct {
+	Name string `json:"name" binding:"required" example:"max_projects"`
+	// Quota is optional, without it the entitlement is a plain feature
+	Quota *int64 `json:"quota" binding:"omitempty,gte=0" example:"10"`
+}
+
+// @Summary Grant entitlement
+// @Description Grants a named entitlement to the license, optionally with a numeric quota. Granting an existing entitlement changes its quota.
+// @Description Entitlements are returned by license verify so clients can gate features.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param product query string false "Product ID, the primary license when omitted"
+// @Param request body grantEntitlementRequest true "payload"
+// @Success 200 {object} statusResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 409 {object} licenseclient.ErrorResponse "NO_CHANGE"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /user/{user_id}/license/entitlements [post]
+func (h *Handler) GrantEntitlementHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userIdStr := c.Param("user_id")
+	userId, err := strconv.Atoi(userIdStr)
+	if err != nil {
+		logger.Debug(ctx, "invalid user_id", zap.Error(err))
+		api_utils.BadRequestResponse(c, "user_id must be an integer")
+		return
+	}
+
+	var req grantEntitlementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Debug(ctx, "invalid request body", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+	if !entitlementName.MatchString(req.Name) {
+		api_utils.BadRequestResponse(c, "name may only contain letters, digits, '_' and '-'")
+		return
+	}
+
+	ref := licenseRef(c, userId)
+	before := entitlementState(h.licenseSnapshot(ctx, ref), req.Name)
+
+	err = h.store.GrantEntitlement(ctx, ref, req.Name, req.Quota)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to grant entitlement", err)
+		return
+	}
+
+	h.audit(c, storage.AuditEntitlementGranted, ref, before, storage.Entitlements{req.Name: req.Quota})
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// entitlementState is the audited state of a single entitlement, nil if the
+// license doesn't have it.
+func entitlementState(license *storage.License, name string) any {
+	if license == nil || !license.Entitlements.Has(name) {
+		return nil
+	}
+	return storage.Entitlements{name: license.Entitlements[name]}
+}
+
+// @Summary Revoke entitlement
+// @Description Removes a named entitlement from the license
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param name path string true "Entitlement name"
+// @Param product query string false "Product ID, the primary license when omitted"
+// @Success 200 {object} statusResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 409 {object} licenseclient.ErrorResponse "NO_CHANGE"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /user/{user_id}/license/entitlements/{name} [delete]
+func (h *Handler) RevokeEntitlementHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userIdStr := c.Param("user_id")
+	userId, err := strconv.Atoi(userIdStr)
+	if err != nil {
+		logger.Debug(ctx, "invalid user_id", zap.Error(err))
+		api_utils.BadRequestResponse(c, "user_id must be an integer")
+		return
+	}
+
+	name := c.Param("name")
+	if !entitlementName.MatchString(name) {
+		api_utils.BadRequestResponse(c, "name may only contain letters, digits, '_' and '-'")
+		return
+	}
+
+	ref := licenseRef(c, userId)
+	before := entitlementState(h.licenseSnapshot(ctx, ref), name)
+
+	err = h.store.RevokeEntitlement(ctx, ref, name)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to revoke entitlement", err)
+		return
+	}
+
+	h.audit(c, storage.AuditEntitlementRevoked, ref, before, nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
@@ -24,12 +24,14 @@ type getUserResponse struct {
 // @Param discord_id query int false "Discord ID"
 // @Param license query string false "License key"
 // @Success 200 {object} getUserResponse
-// @Failure 400 {object} invalidBodyErrResponse
-// @Failure 500 {object} internalErrResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
 // @Security ApiKeyAuth
 // @Router /user [get]
-func GetUserHandler(c *gin.Context) {
-	conn := storage.GetConnector()
+func (h *Handler) GetUserHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	telegramIdStr := c.Query("telegram_id")
@@ -43,27 +45,26 @@ func GetUserHandler(c *gin.Context) {
 		params.TelegramId, err = strconv.Atoi(telegramIdStr)
 		if err != nil {
 			logger.Debug(ctx, "invalid telegram_id", zap.Error(err))
-			c.JSON(api_utils.FormErrResponse(http.StatusBadRequest, "telegram_id must be an integer"))
+			api_utils.BadRequestResponse(c, "telegram_id must be an integer")
 			return
 		}
 	} else if discordIdStr != "" {
 		params.DiscordId, err = strconv.Atoi(discordIdStr)
 		if err != nil {
 			logger.Debug(ctx, "invalid discord_id", zap.Error(err))
-			c.JSON(api_utils.FormErrResponse(http.StatusBadRequest, "discord_id must be an integer"))
+			api_utils.BadRequestResponse(c, "discord_id must be an integer")
 			return
 		}
 	} else if license != "" {
 		params.License = license
 	} else {
-		c.JSON(api_utils.FormErrResponse(http.StatusBadRequest, "at least telegram_id, discord_id or license must be provided"))
+		api_utils.BadRequestResponse(c, "at least telegram_id, discord_id or license must be provided")
 		return
 	}
 
-	user, err := conn.GetUser(ctx, params)
+	user, err := h.store.GetUser(ctx, params)
 	if err != nil {
-		logger.Error(ctx, "failed to get user", zap.Error(err))
-		c.JSON(api_utils.FormInternalErrResponse())
+		api_utils.StorageErrResponse(c, "failed to get user", err)
 		return
 	}
 
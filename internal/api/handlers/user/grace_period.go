@@ -0,0 +1,76 @@
+package user
+
+import (
+	"net/http"
+	"strconv"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type setGracePeriodRequest struct {
+	// GracePeriod is how many seconds after expiry the license still verifies,
+	// null or omitted to use the server default (GRACE_PERIOD)
+	GracePeriod *int64 `json:"grace_period" example:"86400"`
+}
+
+// @Summary Set license grace period
+// @Description Overrides the grace period of the license, the time after expiry during which verify still succeeds. Without grace_period the server default applies again.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param product query string false "Product ID, the primary license when omitted"
+// @Param request body setGracePeriodRequest false "payload"
+// @Success 200 {object} statusResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 409 {object} licenseclient.ErrorResponse "NO_CHANGE"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /user/{user_id}/license/grace_period [post]
+func (h *Handler) SetGracePeriodHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userIdStr := c.Param("user_id")
+	userId, err := strconv.Atoi(userIdStr)
+	if err != nil {
+		logger.Debug(ctx, "invalid user_id", zap.Error(err))
+		api_utils.BadRequestResponse(c, "user_id must be an integer")
+		return
+	}
+
+	var req setGracePeriodRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			logger.Debug(ctx, "invalid request body", zap.Error(err))
+			api_utils.InvalidRequestResponse(c)
+			return
+		}
+	}
+	if req.GracePeriod != nil && *req.GracePeriod < 0 {
+		api_utils.BadRequestResponse(c, "grace_period must not be negative")
+		return
+	}
+
+	ref := licenseRef(c, userId)
+	var before any
+	if l := h.licenseSnapshot(ctx, ref); l != nil {
+		before = gin.H{"gracePeriod": l.GracePeriod}
+	}
+
+	err = h.store.SetGracePeriod(ctx, ref, req.GracePeriod)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to set grace period", err)
+		return
+	}
+
+	h.audit(c, storage.AuditGracePeriodChanged, ref, before, gin.H{"gracePeriod": req.GracePeriod})
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
@@ -0,0 +1,87 @@
+package user
+
+import (
+	"context"
+	"crypto/ed25519"
+	"time"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Handler serves the user endpoints on top of a storage backend.
+type Handler struct {
+	store      storage.Store
+	signingKey ed25519.PrivateKey
+	hooks      *webhook.Dispatcher
+	// gracePeriod is the grace period of licenses without their own, in seconds
+	gracePeriod int64
+}
+
+// NewHandler creates the user handlers. signingKey is used to issue
+// offline license tokens, which are unavailable if it is nil.
+// Lifecycle events are published to hooks. Offline tokens default to the
+// grace period of their license, gracePeriod unless the license overrides it.
+func NewHandler(store storage.Store, signingKey ed25519.PrivateKey, hooks *webhook.Dispatcher, gracePeriod time.Duration) *Handler {
+	return &Handler{store: store, signingKey: signingKey, hooks: hooks, gracePeriod: int64(gracePeriod.Seconds())}
+}
+
+// licenseRef addresses the license of userId selected by the optional
+// "product" query parameter, the primary license when it is absent.
+func licenseRef(c *gin.Context, userId int) storage.LicenseRef {
+	return storage.LicenseRef{UserId: userId, ProductId: c.Query("product")}
+}
+
+// userSnapshot reads the user before a mutation so the audit entry can record
+// the previous values. It is nil if the user can't be read.
+func (h *Handler) userSnapshot(ctx context.Context, userId int) *storage.User {
+	user, err := h.store.GetUser(ctx, storage.GetUserParams{UserId: userId})
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+// licenseSnapshot is userSnapshot for the referenced license.
+func (h *Handler) licenseSnapshot(ctx context.Context, ref storage.LicenseRef) *storage.License {
+	user := h.userSnapshot(ctx, ref.UserId)
+	if user == nil {
+		return nil
+	}
+	return user.FindLicense(ref.ProductId)
+}
+
+// devicesState is the audited state of the license devices.
+func devicesState(license *storage.License) any {
+	if license == nil {
+		return nil
+	}
+	return gin.H{"devices": license.Devices}
+}
+
+// audit records a successful mutation of the referenced user or license.
+func (h *Handler) audit(c *gin.Context, action storage.AuditAction, ref storage.LicenseRef, before, after any) {
+	api_utils.RecordAudit(c, h.store, action, ref.UserId, ref.ProductId, before, after)
+}
+
+// publish sends a webhook event for the referenced license with the current state of its user.
+func (h *Handler) publish(c *gin.Context, event string, ref storage.LicenseRef) {
+	if user := h.userSnapshot(c.Request.Context(), ref.UserId); user != nil {
+		h.publishUser(c, event, user, ref.ProductId)
+	}
+}
+
+// publishUser sends a webhook event carrying user. Like the audit, a failure
+// is only logged because the change has already happened.
+func (h *Handler) publishUser(c *gin.Context, event string, user *storage.User, productId string) {
+	ctx := c.Request.Context()
+
+	err := h.hooks.Publish(ctx, event, webhook.UserData{User: user, Product: productId})
+	if err != nil {
+		logger.Error(ctx, "failed to publish webhook event", zap.String("event", event), zap.Error(err))
+	}
+}
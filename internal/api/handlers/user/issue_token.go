@@ -0,0 +1,126 @@
+package user
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type issueTokenRequest struct {
+	// Features default to the names of the license's entitlements
+	Features []string `json:"features"`
+	// GracePeriod is how many seconds after expiry the token is still accepted,
+	// the grace period of the license when omitted
+	GracePeriod *int64 `json:"grace_period"`
+}
+
+type issueTokenResponse struct {
+	Token string `json:"token"`
+}
+
+// @Summary Issue offline license token
+// @Description Issues a signed token that clients validate locally with pkg/licenseclient. It is bound to the devices currently activated on the license.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param product query string false "Product ID, the primary license when omitted"
+// @Param request body issueTokenRequest false "payload"
+// @Success 200 {object} issueTokenResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND or LICENSE_NOT_FOUND"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /user/{user_id}/license/token [post]
+func (h *Handler) IssueTokenHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	if h.signingKey == nil {
+		api_utils.ErrResponse(c, http.StatusServiceUnavailable, licenseclient.CodeUnavailable, "signing key is not configured")
+		return
+	}
+
+	userIdStr := c.Param("user_id")
+	userId, err := strconv.Atoi(userIdStr)
+	if err != nil {
+		logger.Debug(ctx, "invalid user_id", zap.Error(err))
+		api_utils.BadRequestResponse(c, "user_id must be an integer")
+		return
+	}
+
+	var req issueTokenRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			logger.Debug(ctx, "invalid request body", zap.Error(err))
+			api_utils.InvalidRequestResponse(c)
+			return
+		}
+	}
+	if req.GracePeriod != nil && *req.GracePeriod < 0 {
+		api_utils.BadRequestResponse(c, "grace_period must not be negative")
+		return
+	}
+
+	user, err := h.store.GetUser(ctx, storage.GetUserParams{UserId: userId})
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get user", err)
+		return
+	}
+
+	ref := licenseRef(c, userId)
+	license := user.FindLicense(ref.ProductId)
+	if license == nil {
+		api_utils.ErrResponse(c, http.StatusNotFound, licenseclient.CodeLicenseNotFound, "user has no license for this product")
+		return
+	}
+	if license.Status != storage.Active {
+		api_utils.BadRequestResponse(c, "license not active")
+		return
+	}
+	if len(license.Devices) == 0 {
+		api_utils.BadRequestResponse(c, "license has no activated devices")
+		return
+	}
+
+	var gracePeriod int64
+	if req.GracePeriod != nil {
+		gracePeriod = *req.GracePeriod
+	} else if license.ExpiresAt != 0 {
+		gracePeriod = int64(license.GraceEnd(h.gracePeriod) - license.ExpiresAt)
+	}
+
+	features := req.Features
+	if features == nil && len(license.Entitlements) > 0 {
+		features = slices.Sorted(maps.Keys(license.Entitlements))
+	}
+
+	token, err := licenseclient.SignToken(h.signingKey, licenseclient.TokenClaims{
+		License:        license.Key,
+		Product:        license.ProductId,
+		HWIDs:          license.Devices,
+		MaxActivations: license.MaxActivations,
+		Features:       features,
+		Entitlements:   licenseclient.Entitlements(license.Entitlements),
+		IssuedAt:       time.Now().Unix(),
+		ExpiresAt:      int64(license.ExpiresAt),
+		GracePeriod:    gracePeriod,
+	})
+	if err != nil {
+		logger.Error(ctx, "failed to sign license token", zap.Error(err))
+		api_utils.InternalErrResponse(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, issueTokenResponse{Token: token})
+}
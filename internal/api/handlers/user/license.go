@@ -0,0 +1,83 @@
+package user
+
+import (
+	"time"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// licenseOptions are the license settings of the create user and add license requests.
+type licenseOptions struct {
+	ProductId      string
+	PlanId         string
+	MaxActivations int
+	ExpiresAt      int
+	Mode           storage.LicenseMode
+}
+
+// newLicense builds a fresh active license. For a product the key uses the
+// product's prefix and length. Settings left zero are taken from the plan
+// first and then from the product defaults, the plan features are granted
+// as entitlements. It writes the error response
+// and returns false if the license can't be built.
+func (h *Handler) newLicense(c *gin.Context, opts licenseOptions) (storage.License, bool) {
+	ctx := c.Request.Context()
+	now := time.Now().Unix()
+
+	license := storage.License{
+		ProductId:      opts.ProductId,
+		PlanId:         opts.PlanId,
+		MaxActivations: opts.MaxActivations,
+		IssuedAt:       storage.Timestamp(now),
+		ExpiresAt:      storage.Timestamp(opts.ExpiresAt),
+		Status:         storage.Active,
+		Mode:           opts.Mode,
+	}
+	// a plan may issue lifetime licenses, otherwise an expiry is required
+	lifetime := false
+
+	if opts.PlanId != "" {
+		plan, err := h.store.GetPlan(ctx, opts.PlanId)
+		if err != nil {
+			api_utils.StorageErrResponse(c, "failed to get plan", err)
+			return storage.License{}, false
+		}
+
+		if license.MaxActivations == 0 {
+			license.MaxActivations = plan.MaxActivations
+		}
+		if license.ExpiresAt == 0 {
+			license.ExpiresAt = plan.ExpiresAt(now)
+			lifetime = plan.Duration == 0
+		}
+		// the plan features become plain entitlements of the license
+		license.Entitlements = plan.Entitlements()
+	}
+
+	if opts.ProductId == "" {
+		license.Key = utils.GenLicense()
+	} else {
+		product, err := h.store.GetProduct(ctx, opts.ProductId)
+		if err != nil {
+			api_utils.StorageErrResponse(c, "failed to get product", err)
+			return storage.License{}, false
+		}
+
+		license.Key = utils.GenLicenseKey(product.KeyPrefix, product.KeyLength)
+		if license.MaxActivations == 0 {
+			license.MaxActivations = product.DefaultMaxActivations
+		}
+		if license.ExpiresAt == 0 && !lifetime && product.DefaultDuration > 0 {
+			license.ExpiresAt = storage.Timestamp(now + product.DefaultDuration)
+		}
+	}
+
+	if license.MaxActivations <= 0 || (license.ExpiresAt == 0 && !lifetime) {
+		api_utils.BadRequestResponse(c, "max_activations and expires_at are required")
+		return storage.License{}, false
+	}
+	return license, true
+}
@@ -0,0 +1,169 @@
+package user
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+type listUsersQuery struct {
+	Status string `form:"status" binding:"omitempty,oneof=active frozen burned expired"`
+	// timestamps are unix seconds, the ranges are inclusive
+	ExpiresFrom int64 `form:"expires_from" binding:"gte=0"`
+	ExpiresTo   int64 `form:"expires_to" binding:"gte=0"`
+	// ExpiresWithin selects licenses expiring in the next given seconds
+	ExpiresWithin int64  `form:"expires_within" binding:"gte=0"`
+	CreatedFrom   int64  `form:"created_from" binding:"gte=0"`
+	CreatedTo     int64  `form:"created_to" binding:"gte=0"`
+	Telegram      *bool  `form:"telegram"`
+	Discord       *bool  `form:"discord"`
+	MinDevices    *int   `form:"min_devices" binding:"omitempty,gte=0"`
+	MaxDevices    *int   `form:"max_devices" binding:"omitempty,gte=0"`
+	Sort          string `form:"sort" binding:"omitempty,oneof=id created_at expires_at"`
+	Order         string `form:"order" binding:"omitempty,oneof=asc desc"`
+	Limit         int    `form:"limit" binding:"gte=0"`
+	Cursor        string `form:"cursor"`
+}
+
+// pageCursor is the decoded cursor parameter. It carries the order it was
+// made for, so it can't be used with another one.
+type pageCursor struct {
+	Sort storage.UserSort `json:"s"`
+	Desc bool             `json:"d,omitempty"`
+	storage.UserCursor
+}
+
+func encodeCursor(c pageCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(raw, &c)
+	return c, err
+}
+
+type listUsersResponse struct {
+	Users []*storage.User `json:"users"`
+	// NextCursor fetches the next page, empty on the last one
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// @Summary List users
+// @Description Lists users page by page. The license filters apply to the primary license, expiry filters exclude lifetime licenses.
+// @Description Pass nextCursor of a response as cursor, with the same filters and order, to get the next page.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param status query string false "License status" Enums(active, frozen, burned, expired)
+// @Param expires_from query int false "Unix timestamp, licenses expiring at or after it"
+// @Param expires_to query int false "Unix timestamp, licenses expiring at or before it"
+// @Param expires_within query int false "Seconds, licenses expiring between now and then, e.g. 604800 for the next 7 days"
+// @Param created_from query int false "Unix timestamp, users created at or after it"
+// @Param created_to query int false "Unix timestamp, users created at or before it"
+// @Param telegram query bool false "Only users with (true) or without (false) a Telegram binding"
+// @Param discord query bool false "Only users with (true) or without (false) a Discord binding"
+// @Param min_devices query int false "Minimum number of activated devices"
+// @Param max_devices query int false "Maximum number of activated devices"
+// @Param sort query string false "Sort field, id by default" Enums(id, created_at, expires_at)
+// @Param order query string false "Sort order, asc by default" Enums(asc, desc)
+// @Param limit query int false "Page size, 100 by default and at most 1000"
+// @Param cursor query string false "nextCursor of the previous page"
+// @Success 200 {object} listUsersResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /users [get]
+func (h *Handler) ListUsersHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var query listUsersQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		logger.Debug(ctx, "invalid query", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+	switch {
+	case query.Limit == 0:
+		query.Limit = defaultListLimit
+	case query.Limit > maxListLimit:
+		query.Limit = maxListLimit
+	}
+
+	filter := storage.UserFilter{
+		Status:      storage.LicenseStatus(query.Status),
+		ExpiresFrom: storage.Timestamp(query.ExpiresFrom),
+		ExpiresTo:   storage.Timestamp(query.ExpiresTo),
+		CreatedFrom: storage.Timestamp(query.CreatedFrom),
+		CreatedTo:   storage.Timestamp(query.CreatedTo),
+		HasTelegram: query.Telegram,
+		HasDiscord:  query.Discord,
+		MinDevices:  query.MinDevices,
+		MaxDevices:  query.MaxDevices,
+		Sort:        storage.SortById,
+		Desc:        query.Order == "desc",
+		// one more than the page tells whether there is a next one
+		Limit: query.Limit + 1,
+	}
+	if query.Sort != "" {
+		filter.Sort = storage.UserSort(query.Sort)
+	}
+	if query.ExpiresWithin > 0 {
+		now := time.Now().Unix()
+		filter.ExpiresFrom = max(filter.ExpiresFrom, storage.Timestamp(now))
+		within := storage.Timestamp(now + query.ExpiresWithin)
+		if filter.ExpiresTo == 0 || within < filter.ExpiresTo {
+			filter.ExpiresTo = within
+		}
+	}
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor)
+		if err != nil {
+			logger.Debug(ctx, "invalid cursor", zap.Error(err))
+			api_utils.BadRequestResponse(c, "invalid cursor")
+			return
+		}
+		if cursor.Sort != filter.Sort || cursor.Desc != filter.Desc {
+			api_utils.BadRequestResponse(c, "cursor was made for another sort order")
+			return
+		}
+		filter.After = &cursor.UserCursor
+	}
+
+	users, err := h.store.ListUsers(ctx, filter)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to list users", err)
+		return
+	}
+
+	resp := listUsersResponse{Users: users}
+	if len(users) > query.Limit {
+		resp.Users = users[:query.Limit]
+		last := resp.Users[query.Limit-1]
+		resp.NextCursor = encodeCursor(pageCursor{Sort: filter.Sort, Desc: filter.Desc, UserCursor: filter.Cursor(last)})
+	}
+	if resp.Users == nil {
+		resp.Users = []*storage.User{}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
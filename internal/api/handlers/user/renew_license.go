@@ -3,55 +3,168 @@ package user
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	api_utils "github.com/dzhisl/license-api/internal/api/utils"
 	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
 	"github.com/dzhisl/license-api/pkg/logger"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
 type renewLicenseRequest struct {
-	ExpiresAt int64 `json:"expires_at" binding:"required"`
+	// ExpiresAt sets the new expiry. Licenses on a plan may omit it and extend_by,
+	// they are renewed by the plan's duration and renewal behavior
+	ExpiresAt int64 `json:"expires_at"`
+	// ExtendBy extends the license by a duration like "30d" or "12h", from its
+	// current expiry or from now if it already expired
+	ExtendBy string `json:"extend_by" example:"30d"`
+}
+
+type renewLicenseResponse struct {
+	Status    string            `json:"status" example:"success"`
+	ExpiresAt storage.Timestamp `json:"expires_at" example:"1760000000"`
 }
 
 // @Summary Renew license
-// @Description Renew the license for a user by user_id
+// @Description Renew the license for a user by user_id, to expires_at or by extend_by. Without either a license on a plan is renewed by the plan.
+// @Description Every renewal is added to the renewal history of the license.
 // @Tags user
 // @Accept json
 // @Produce json
 // @Param user_id path int true "User ID"
-// @Param request body renewLicenseRequest true "payload"
-// @Success 200 {object} statusResponse
-// @Failure 400 {object} invalidBodyErrResponse
-// @Failure 500 {object} internalErrResponse
+// @Param product query string false "Product ID, the primary license when omitted"
+// @Param request body renewLicenseRequest false "payload"
+// @Success 200 {object} renewLicenseResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND or LICENSE_NOT_FOUND"
+// @Failure 409 {object} licenseclient.ErrorResponse "NO_CHANGE"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
 // @Security ApiKeyAuth
 // @Router /user/{user_id}/license/renew [post]
-func RenewLicenseHandler(c *gin.Context) {
-	conn := storage.GetConnector()
+func (h *Handler) RenewLicenseHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	userIdStr := c.Param("user_id")
 	userId, err := strconv.Atoi(userIdStr)
 	if err != nil {
 		logger.Debug(ctx, "invalid user_id", zap.Error(err))
-		c.JSON(api_utils.FormErrResponse(http.StatusBadRequest, "user_id must be an integer"))
+		api_utils.BadRequestResponse(c, "user_id must be an integer")
 		return
 	}
 
 	var req renewLicenseRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		logger.Debug(ctx, "invalid request body", zap.Error(err))
-		c.JSON(api_utils.FormInvalidRequestResponse())
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			logger.Debug(ctx, "invalid request body", zap.Error(err))
+			api_utils.InvalidRequestResponse(c)
+			return
+		}
+	}
+	if req.ExpiresAt != 0 && req.ExtendBy != "" {
+		api_utils.BadRequestResponse(c, "expires_at and extend_by can't be combined")
 		return
 	}
+	var extendBy int64
+	if req.ExtendBy != "" {
+		d, err := api_utils.ParseDuration(req.ExtendBy)
+		if err != nil || d < time.Second {
+			api_utils.BadRequestResponse(c, "extend_by must be a positive duration like 30d or 12h")
+			return
+		}
+		extendBy = int64(d.Seconds())
+	}
 
-	err = conn.RenewLicense(ctx, userId, storage.Timestamp(req.ExpiresAt))
+	ref := licenseRef(c, userId)
+	current := h.licenseSnapshot(ctx, ref)
+
+	renewal := storage.Renewal{UserId: userId, Source: storage.RenewalAbsolute}
+	if current != nil {
+		renewal.LicenseKey = current.Key
+		renewal.PreviousExpiresAt = current.ExpiresAt
+	}
+	if extendBy > 0 {
+		if current != nil && current.ExpiresAt == 0 {
+			api_utils.BadRequestResponse(c, "lifetime licenses can't be extended")
+			return
+		}
+		renewal.Source, renewal.Amount = storage.RenewalExtension, extendBy
+		renewal.PreviousExpiresAt, renewal.ExpiresAt, err = h.store.ExtendLicense(ctx, ref, extendBy, storage.Timestamp(time.Now().Unix()))
+	} else {
+		renewal.ExpiresAt = storage.Timestamp(req.ExpiresAt)
+		if renewal.ExpiresAt == 0 {
+			var ok bool
+			if renewal.ExpiresAt, ok = h.planRenewal(c, ref); !ok {
+				return
+			}
+			renewal.Source = storage.RenewalPlan
+		}
+		renewal.Amount = int64(renewal.ExpiresAt - renewal.PreviousExpiresAt)
+		err = h.store.RenewLicense(ctx, ref, renewal.ExpiresAt)
+	}
 	if err != nil {
-		logger.Error(ctx, "failed to renew license", zap.Error(err))
-		c.JSON(api_utils.FormInternalErrResponse())
+		api_utils.StorageErrResponse(c, "failed to renew license", err)
+		return
+	}
+
+	var before any
+	if current != nil {
+		before = gin.H{"expiresAt": renewal.PreviousExpiresAt}
+		api_utils.RecordRenewal(c, h.store, renewal)
+	}
+	h.audit(c, storage.AuditLicenseRenewed, ref, before, gin.H{"expiresAt": renewal.ExpiresAt})
+	if current != nil && current.Status == storage.Expired && int64(renewal.ExpiresAt) > time.Now().Unix() {
+		h.reactivate(c, ref)
+	}
+	h.publish(c, webhook.EventLicenseRenewed, ref)
+
+	c.JSON(http.StatusOK, renewLicenseResponse{Status: "success", ExpiresAt: renewal.ExpiresAt})
+}
+
+// reactivate makes a license the expiry worker marked as expired active again
+// after it was renewed.
+func (h *Handler) reactivate(c *gin.Context, ref storage.LicenseRef) {
+	ctx := c.Request.Context()
+
+	if err := h.store.ChangeLicenseStatus(ctx, ref, storage.Active); err != nil {
+		logger.Error(ctx, "failed to reactivate renewed license", zap.Error(err))
 		return
 	}
+	h.audit(c, storage.AuditLicenseStatusChanged, ref, gin.H{"status": storage.Expired}, gin.H{"status": storage.Active})
+}
+
+// planRenewal computes the new expiry of the referenced license from its plan.
+// It writes the error response and returns false if that isn't possible.
+func (h *Handler) planRenewal(c *gin.Context, ref storage.LicenseRef) (storage.Timestamp, bool) {
+	ctx := c.Request.Context()
+
+	user, err := h.store.GetUser(ctx, storage.GetUserParams{UserId: ref.UserId})
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get user", err)
+		return 0, false
+	}
+	license := user.FindLicense(ref.ProductId)
+	if license == nil {
+		api_utils.ErrResponse(c, http.StatusNotFound, licenseclient.CodeLicenseNotFound, "user has no license for this product")
+		return 0, false
+	}
+	if license.PlanId == "" {
+		api_utils.BadRequestResponse(c, "expires_at is required for licenses without a plan")
+		return 0, false
+	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success"})
+	plan, err := h.store.GetPlan(ctx, license.PlanId)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get plan", err)
+		return 0, false
+	}
+	if plan.Duration == 0 {
+		api_utils.BadRequestResponse(c, "lifetime licenses can't be renewed")
+		return 0, false
+	}
+	return plan.RenewedExpiry(*license, time.Now().Unix()), true
 }
@@ -0,0 +1,67 @@
+package user
+
+import (
+	"net/http"
+	"strconv"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type listRenewalsResponse struct {
+	Renewals []*storage.Renewal `json:"renewals"`
+}
+
+// @Summary List license renewals
+// @Description Lists the renewals of the license of a user by user_id, newest first.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param product query string false "Product ID, the primary license when omitted"
+// @Success 200 {object} listRenewalsResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND or LICENSE_NOT_FOUND"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /user/{user_id}/license/renewals [get]
+func (h *Handler) ListRenewalsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userIdStr := c.Param("user_id")
+	userId, err := strconv.Atoi(userIdStr)
+	if err != nil {
+		logger.Debug(ctx, "invalid user_id", zap.Error(err))
+		api_utils.BadRequestResponse(c, "user_id must be an integer")
+		return
+	}
+
+	user, err := h.store.GetUser(ctx, storage.GetUserParams{UserId: userId})
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get user", err)
+		return
+	}
+
+	license := user.FindLicense(licenseRef(c, userId).ProductId)
+	if license == nil {
+		api_utils.ErrResponse(c, http.StatusNotFound, licenseclient.CodeLicenseNotFound, "user has no license for this product")
+		return
+	}
+
+	renewals, err := h.store.ListRenewals(ctx, license.Key)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to list renewals", err)
+		return
+	}
+	if renewals == nil {
+		renewals = []*storage.Renewal{}
+	}
+
+	c.JSON(http.StatusOK, listRenewalsResponse{Renewals: renewals})
+}
@@ -21,37 +21,48 @@ type updateHwidLimitRequest struct {
 // @Accept json
 // @Produce json
 // @Param user_id path int true "User ID"
+// @Param product query string false "Product ID, the primary license when omitted"
 // @Param request body updateHwidLimitRequest true "payload"
 // @Success 200 {object} statusResponse
-// @Failure 400 {object} invalidBodyErrResponse
-// @Failure 500 {object} internalErrResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 409 {object} licenseclient.ErrorResponse "NO_CHANGE"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
 // @Security ApiKeyAuth
 // @Router /user/{user_id}/license/hwid_limit [post]
-func UpdateHwidLimitHandler(c *gin.Context) {
-	conn := storage.GetConnector()
+func (h *Handler) UpdateHwidLimitHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	userIdStr := c.Param("user_id")
 	userId, err := strconv.Atoi(userIdStr)
 	if err != nil {
 		logger.Debug(ctx, "invalid user_id", zap.Error(err))
-		c.JSON(api_utils.FormErrResponse(http.StatusBadRequest, "user_id must be an integer"))
+		api_utils.BadRequestResponse(c, "user_id must be an integer")
 		return
 	}
 
 	var req updateHwidLimitRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Debug(ctx, "invalid request body", zap.Error(err))
-		c.JSON(api_utils.FormInvalidRequestResponse())
+		api_utils.InvalidRequestResponse(c)
 		return
 	}
 
-	err = conn.UpdateHwidLimit(ctx, userId, req.MaxActivations)
+	ref := licenseRef(c, userId)
+	var before any
+	if l := h.licenseSnapshot(ctx, ref); l != nil {
+		before = gin.H{"maxActivations": l.MaxActivations}
+	}
+
+	err = h.store.UpdateHwidLimit(ctx, ref, req.MaxActivations)
 	if err != nil {
-		logger.Error(ctx, "failed to update hwid limit", zap.Error(err))
-		c.JSON(api_utils.FormInternalErrResponse())
+		api_utils.StorageErrResponse(c, "failed to update hwid limit", err)
 		return
 	}
 
+	h.audit(c, storage.AuditHwidLimitChanged, ref, before, gin.H{"maxActivations": req.MaxActivations})
+
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
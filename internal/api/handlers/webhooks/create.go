@@ -0,0 +1,68 @@
+package webhooks
+
+import (
+	"net/http"
+	"slices"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type createWebhookRequest struct {
+	URL string `json:"url" binding:"required,url" example:"https://billing.example.com/hooks/licenses"`
+	// Events to subscribe to, all of them when omitted
+	Events []string `json:"events" example:"user.created,license.renewed"`
+}
+
+// @Summary Create webhook
+// @Description Registers an endpoint that receives license lifecycle events as signed JSON POST requests:
+// @Description user.created, user.deleted, license.renewed, license.status_changed, license.expired, device.added, device.removed, devices.reset.
+// @Description The X-Webhook-Signature header is "sha256=" and the hex HMAC-SHA256 of "<X-Webhook-Timestamp>.<body>" keyed with the secret,
+// @Description which is only returned here. Failed deliveries are retried with exponential backoff.
+// @Tags webhook
+// @Accept json
+// @Produce json
+// @Param request body createWebhookRequest true "payload"
+// @Success 200 {object} webhookResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /webhooks [post]
+func (h *Handler) CreateWebhookHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req createWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Debug(ctx, "invalid request body", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+	for _, event := range req.Events {
+		if !slices.Contains(webhook.Events, event) {
+			api_utils.BadRequestResponse(c, "unknown event "+event)
+			return
+		}
+	}
+
+	hook := webhook.NewWebhook(req.URL, req.Events)
+	if err := h.store.CreateWebhook(ctx, hook); err != nil {
+		api_utils.StorageErrResponse(c, "failed to create webhook", err)
+		return
+	}
+
+	api_utils.RecordAudit(c, h.store, storage.AuditWebhookCreated, 0, hook.Id, nil, withoutSecret(hook))
+
+	c.JSON(http.StatusOK, webhookResponse{Webhook: hook})
+}
+
+// withoutSecret returns w for responses and audit entries after its creation.
+func withoutSecret(w storage.Webhook) storage.Webhook {
+	w.Secret = ""
+	return w
+}
@@ -0,0 +1,47 @@
+package webhooks
+
+import (
+	"net/http"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Delete webhook
+// @Description Deletes a webhook. Its pending deliveries fail and end up in the dead-letter list.
+// @Tags webhook
+// @Accept json
+// @Produce json
+// @Param webhook_id path string true "Webhook ID"
+// @Success 200 {object} statusResponse
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /webhooks/{webhook_id} [delete]
+func (h *Handler) DeleteWebhookHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	webhookId := c.Param("webhook_id")
+	var before any
+	if hook, err := h.store.GetWebhook(ctx, webhookId); err == nil {
+		before = withoutSecret(*hook)
+	}
+
+	deleted, err := h.store.DeleteWebhook(ctx, webhookId)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to delete webhook", err)
+		return
+	}
+	if deleted == 0 {
+		api_utils.ErrResponse(c, http.StatusNotFound, licenseclient.CodeNotFound, "webhook not found")
+		return
+	}
+
+	api_utils.RecordAudit(c, h.store, storage.AuditWebhookDeleted, 0, webhookId, before, nil)
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
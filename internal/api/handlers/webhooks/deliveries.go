@@ -0,0 +1,100 @@
+package webhooks
+
+import (
+	"net/http"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+type listDeliveriesQuery struct {
+	// Status defaults to "dead", the deliveries that ran out of attempts
+	Status storage.DeliveryStatus `form:"status" binding:"omitempty,oneof=pending delivered dead"`
+	Limit  int                    `form:"limit" binding:"gte=0"`
+}
+
+// @Summary List webhook deliveries
+// @Description Lists webhook deliveries with the given status, newest first. By default the dead-letter list:
+// @Description deliveries that failed every attempt and wait for a redelivery.
+// @Tags webhook
+// @Accept json
+// @Produce json
+// @Param status query string false "pending, delivered or dead (default)"
+// @Param limit query int false "Maximum number of deliveries, 100 by default and at most 1000"
+// @Success 200 {object} listDeliveriesResponse
+// @Failure 400 {object} licenseclient.ErrorResponse "INVALID_REQUEST"
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /webhooks/deliveries [get]
+func (h *Handler) ListDeliveriesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var query listDeliveriesQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		logger.Debug(ctx, "invalid query", zap.Error(err))
+		api_utils.InvalidRequestResponse(c)
+		return
+	}
+	if query.Status == "" {
+		query.Status = storage.DeliveryDead
+	}
+	switch {
+	case query.Limit == 0:
+		query.Limit = defaultLimit
+	case query.Limit > maxLimit:
+		query.Limit = maxLimit
+	}
+
+	deliveries, err := h.store.ListDeliveries(ctx, query.Status, query.Limit)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to list webhook deliveries", err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*storage.WebhookDelivery{}
+	}
+
+	c.JSON(http.StatusOK, listDeliveriesResponse{Deliveries: deliveries})
+}
+
+// @Summary Redeliver webhook delivery
+// @Description Queues a delivery again with fresh attempts, typically one from the dead-letter list after its receiver was fixed
+// @Tags webhook
+// @Accept json
+// @Produce json
+// @Param delivery_id path string true "Delivery ID"
+// @Success 200 {object} deliveryResponse
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 404 {object} licenseclient.ErrorResponse "NOT_FOUND"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /webhooks/deliveries/{delivery_id}/redeliver [post]
+func (h *Handler) RedeliverHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	deliveryId := c.Param("delivery_id")
+	if _, err := h.store.GetDelivery(ctx, deliveryId); err != nil {
+		api_utils.StorageErrResponse(c, "failed to get delivery", err)
+		return
+	}
+
+	delivery, err := h.hooks.Redeliver(ctx, deliveryId)
+	if err != nil {
+		logger.Error(ctx, "failed to redeliver webhook delivery", zap.Error(err))
+		api_utils.InternalErrResponse(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveryResponse{Delivery: *delivery})
+}
@@ -0,0 +1,38 @@
+package webhooks
+
+import (
+	"net/http"
+
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary List webhooks
+// @Description Lists the registered webhooks, without their secrets
+// @Tags webhook
+// @Accept json
+// @Produce json
+// @Success 200 {object} listWebhooksResponse
+// @Failure 401 {object} licenseclient.ErrorResponse "UNAUTHORIZED"
+// @Failure 403 {object} licenseclient.ErrorResponse "FORBIDDEN"
+// @Failure 500 {object} licenseclient.ErrorResponse "INTERNAL"
+// @Security ApiKeyAuth
+// @Router /webhooks [get]
+func (h *Handler) ListWebhooksHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	hooks, err := h.store.GetAllWebhooks(ctx)
+	if err != nil {
+		api_utils.StorageErrResponse(c, "failed to get webhooks", err)
+		return
+	}
+
+	webhooks := make([]*storage.Webhook, 0, len(hooks))
+	for _, hook := range hooks {
+		w := withoutSecret(*hook)
+		webhooks = append(webhooks, &w)
+	}
+
+	c.JSON(http.StatusOK, listWebhooksResponse{Webhooks: webhooks})
+}
@@ -0,0 +1,17 @@
+package webhooks
+
+import (
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
+)
+
+// Handler serves the webhook endpoints on top of a storage backend.
+type Handler struct {
+	store storage.Store
+	hooks *webhook.Dispatcher
+}
+
+// NewHandler creates the webhook handlers, redeliveries are queued on hooks.
+func NewHandler(store storage.Store, hooks *webhook.Dispatcher) *Handler {
+	return &Handler{store: store, hooks: hooks}
+}
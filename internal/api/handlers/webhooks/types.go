@@ -0,0 +1,23 @@
+package webhooks
+
+import "github.com/dzhisl/license-api/internal/storage"
+
+type webhookResponse struct {
+	Webhook storage.Webhook `json:"webhook"`
+}
+
+type listWebhooksResponse struct {
+	Webhooks []*storage.Webhook `json:"webhooks"`
+}
+
+type deliveryResponse struct {
+	Delivery storage.WebhookDelivery `json:"delivery"`
+}
+
+type listDeliveriesResponse struct {
+	Deliveries []*storage.WebhookDelivery `json:"deliveries"`
+}
+
+type statusResponse struct {
+	Status string `json:"status" example:"success"`
+}
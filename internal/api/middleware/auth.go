@@ -4,38 +4,89 @@ import (
 	"context"
 	"crypto/subtle"
 	"net/http"
+	"strconv"
 
+	"github.com/dzhisl/license-api/pkg/licenseclient"
 	"github.com/gin-gonic/gin"
 	uuid "github.com/google/uuid"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 )
 
 type contextKey string
 
-const RequestIDKey contextKey = "request_id"
+const (
+	RequestIDKey contextKey = "request_id"
+	// ActorKey holds the name of the authenticated caller of a private endpoint
+	ActorKey contextKey = "actor"
+	// ScopesKey holds the scopes granted to the caller of a private endpoint
+	ScopesKey contextKey = "scopes"
+	// RoleKey holds the role of the caller of a private endpoint, if it has one
+	RoleKey contextKey = "role"
+)
 
-func AdminAuthMiddleware(c *gin.Context) {
-	adminKey := viper.GetString("ADMIN_SECRET_KEY")
-	if adminKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server configuration error"})
-		c.Abort()
-		return
-	}
+// adminActor is the actor recorded for requests authenticated with ADMIN_SECRET_KEY.
+const adminActor = "admin"
+
+// Principal is an authenticated caller of the private endpoints.
+type Principal struct {
+	// Name is recorded as the actor of the request
+	Name string
+	Role string
+	// Scopes are the permissions of the caller, including those of its role
+	Scopes []string
+}
+
+// KeyResolver authenticates a managed API key, it returns nil for keys that
+// are unknown, revoked or expired.
+type KeyResolver func(ctx context.Context, key string) *Principal
+
+// AdminAuthMiddleware authenticates the X-API-Key header. ADMIN_SECRET_KEY,
+// when set, grants every scope; other keys are looked up with keys.
+func AdminAuthMiddleware(keys KeyResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("X-API-Key")
+		if header == "" {
+			AbortWithError(c, http.StatusUnauthorized, licenseclient.CodeUnauthorized, "API key required")
+			return
+		}
 
-	header := c.GetHeader("X-API-Key")
-	if header == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
-		c.Abort()
-		return
+		adminKey := viper.GetString("ADMIN_SECRET_KEY")
+		if adminKey != "" && subtle.ConstantTimeCompare([]byte(header), []byte(adminKey)) == 1 {
+			setPrincipal(c, Principal{Name: adminActor, Role: RoleOwner, Scopes: []string{ScopeAll}})
+			c.Next()
+			return
+		}
+		if p := keys(c.Request.Context(), header); p != nil {
+			setPrincipal(c, *p)
+			c.Next()
+			return
+		}
+
+		AbortWithError(c, http.StatusUnauthorized, licenseclient.CodeUnauthorized, "Invalid API key")
 	}
+}
 
-	if subtle.ConstantTimeCompare([]byte(header), []byte(adminKey)) == 1 {
+// RequireScope rejects requests whose caller wasn't granted scope, by its API
+// key or its role, with 403 and logs the denial. It must run after AdminAuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if !HasScope(GrantedScopes(ctx), scope) {
+			// pkg/logger depends on this package, so log through the global zap logger it installs
+			zap.L().Warn("permission denied",
+				zap.String("actor", Actor(ctx)),
+				zap.String("role", Role(ctx)),
+				zap.String("permission", scope),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.FullPath()),
+				zap.String("request_id", RequestID(ctx)))
+			AbortWithErrorDetails(c, http.StatusForbidden, licenseclient.CodeForbidden, "missing permission "+scope,
+				map[string]any{"permission": scope})
+			return
+		}
 		c.Next()
-		return
 	}
-
-	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
-	c.Abort()
 }
 
 func RequestIDMiddleware() gin.HandlerFunc {
@@ -43,6 +94,55 @@ func RequestIDMiddleware() gin.HandlerFunc {
 		reqID := uuid.New().String()
 		ctx := context.WithValue(c.Request.Context(), RequestIDKey, reqID)
 		c.Request = c.Request.WithContext(ctx)
+		// error responses carry the id too, it finds the request in the logs
+		c.Header("X-Request-ID", reqID)
 		c.Next()
 	}
 }
+
+// RequestID returns the id RequestIDMiddleware assigned to the request of ctx.
+func RequestID(ctx context.Context) string {
+	reqID, _ := ctx.Value(RequestIDKey).(string)
+	return reqID
+}
+
+// Actor returns who authenticated the request of ctx, empty for public endpoints.
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(ActorKey).(string)
+	return actor
+}
+
+// Role returns the role of the caller of ctx, empty if it has none.
+func Role(ctx context.Context) string {
+	role, _ := ctx.Value(RoleKey).(string)
+	return role
+}
+
+// GrantedScopes returns the scopes of the caller of ctx, nil for public endpoints.
+func GrantedScopes(ctx context.Context) []string {
+	scopes, _ := ctx.Value(ScopesKey).([]string)
+	return scopes
+}
+
+// SetActor records actor as the caller of the request in c, for requests
+// authenticated outside AdminAuthMiddleware such as self-service sessions.
+// It grants no scopes.
+func SetActor(c *gin.Context, actor string) {
+	ctx := context.WithValue(c.Request.Context(), ActorKey, actor)
+	c.Request = c.Request.WithContext(ctx)
+}
+
+// SelfActorPrefix starts the audit actor of changes customers make to their own licenses
+const SelfActorPrefix = "self:"
+
+// SelfActor is the audit actor of the customer with the given user id.
+func SelfActor(userId int) string {
+	return SelfActorPrefix + strconv.Itoa(userId)
+}
+
+func setPrincipal(c *gin.Context, p Principal) {
+	ctx := context.WithValue(c.Request.Context(), ActorKey, p.Name)
+	ctx = context.WithValue(ctx, RoleKey, p.Role)
+	ctx = context.WithValue(ctx, ScopesKey, p.Scopes)
+	c.Request = c.Request.WithContext(ctx)
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/gin-gonic/gin"
+)
+
+// AbortWithError writes the error response every endpoint uses, with the
+// request id of c, and stops the handler chain.
+func AbortWithError(c *gin.Context, status int, code, msg string) {
+	AbortWithErrorDetails(c, status, code, msg, nil)
+}
+
+// AbortWithErrorDetails is like AbortWithError with details for the code.
+func AbortWithErrorDetails(c *gin.Context, status int, code, msg string, details map[string]any) {
+	c.AbortWithStatusJSON(status, licenseclient.ErrorResponse{
+		Version:   licenseclient.ErrorVersion,
+		Code:      code,
+		Message:   msg,
+		Error:     msg,
+		RequestId: RequestID(c.Request.Context()),
+		Details:   details,
+	})
+}
@@ -2,8 +2,10 @@ package middleware
 
 import (
 	"net"
+	"net/http"
 	"sync"
 
+	"github.com/dzhisl/license-api/pkg/licenseclient"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
 )
@@ -48,9 +50,7 @@ func RateLimitMiddleware(cl *ClientLimiter) gin.HandlerFunc {
 		limiter := cl.getLimiter(ip)
 
 		if !limiter.Allow() {
-			c.AbortWithStatusJSON(429, gin.H{
-				"error": "Rate limit exceeded",
-			})
+			AbortWithError(c, http.StatusTooManyRequests, licenseclient.CodeRateLimited, "Rate limit exceeded")
 			return
 		}
 
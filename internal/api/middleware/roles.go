@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Built-in roles, ADMIN_ROLES can redefine them and add others.
+const (
+	RoleOwner   = "owner"
+	RoleSupport = "support"
+)
+
+// Roles maps role names to the permissions they grant. Permissions use the
+// scope names, so a role is a named bundle of scopes.
+type Roles map[string][]string
+
+// DefaultRoles are used when ADMIN_ROLES doesn't define a role. Support staff
+// look up users and manage their devices, owners can do everything.
+var DefaultRoles = Roles{
+	RoleOwner:   {ScopeAll},
+	RoleSupport: {ScopeUsersRead, ScopeDevicesWrite},
+}
+
+// ParseRoles decodes a JSON object of role names to permission lists, like
+// {"billing": ["users:read", "licenses:write"]}, on top of DefaultRoles.
+// An empty raw returns the defaults.
+func ParseRoles(raw string) (Roles, error) {
+	roles := maps.Clone(DefaultRoles)
+	if raw == "" {
+		return roles, nil
+	}
+
+	var configured Roles
+	if err := json.Unmarshal([]byte(raw), &configured); err != nil {
+		return nil, fmt.Errorf("failed to decode roles: %w", err)
+	}
+	for name, permissions := range configured {
+		for _, permission := range permissions {
+			if !slices.Contains(Scopes, permission) {
+				return nil, fmt.Errorf("role %s has unknown permission %s", name, permission)
+			}
+		}
+		roles[name] = permissions
+	}
+	return roles, nil
+}
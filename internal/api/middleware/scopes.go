@@ -0,0 +1,45 @@
+package middleware
+
+import "slices"
+
+// Scopes of the private endpoints, each route declares the one it needs.
+const (
+	// ScopeAll grants every scope, ADMIN_SECRET_KEY has it
+	ScopeAll           = "*"
+	ScopeUsersRead     = "users:read"
+	ScopeUsersWrite    = "users:write"
+	ScopeLicensesWrite = "licenses:write"
+	ScopeDevicesWrite  = "devices:write"
+	ScopeProductsRead  = "products:read"
+	ScopeProductsWrite = "products:write"
+	ScopePlansRead     = "plans:read"
+	ScopePlansWrite    = "plans:write"
+	ScopeWebhooksRead  = "webhooks:read"
+	ScopeWebhooksWrite = "webhooks:write"
+	ScopeAuditRead     = "audit:read"
+	ScopeKeysRead      = "keys:read"
+	ScopeKeysWrite     = "keys:write"
+)
+
+// Scopes lists every scope an API key can be granted.
+var Scopes = []string{
+	ScopeAll,
+	ScopeUsersRead,
+	ScopeUsersWrite,
+	ScopeLicensesWrite,
+	ScopeDevicesWrite,
+	ScopeProductsRead,
+	ScopeProductsWrite,
+	ScopePlansRead,
+	ScopePlansWrite,
+	ScopeWebhooksRead,
+	ScopeWebhooksWrite,
+	ScopeAuditRead,
+	ScopeKeysRead,
+	ScopeKeysWrite,
+}
+
+// HasScope reports whether granted contains scope, directly or through ScopeAll.
+func HasScope(granted []string, scope string) bool {
+	return slices.Contains(granted, ScopeAll) || slices.Contains(granted, scope)
+}
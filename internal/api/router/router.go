@@ -1,17 +1,32 @@
 package router
 
 import (
+	"crypto/ed25519"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/api/handlers/apikey"
+	"github.com/dzhisl/license-api/internal/api/handlers/audit"
 	"github.com/dzhisl/license-api/internal/api/handlers/license"
 	"github.com/dzhisl/license-api/internal/api/handlers/ping"
+	"github.com/dzhisl/license-api/internal/api/handlers/plan"
+	"github.com/dzhisl/license-api/internal/api/handlers/product"
+	"github.com/dzhisl/license-api/internal/api/handlers/selfservice"
+	"github.com/dzhisl/license-api/internal/api/handlers/trial"
 	"github.com/dzhisl/license-api/internal/api/handlers/user"
+	"github.com/dzhisl/license-api/internal/api/handlers/webhooks"
 	"github.com/dzhisl/license-api/internal/api/middleware"
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
+	"github.com/dzhisl/license-api/pkg/config"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"golang.org/x/time/rate"
 )
 
-func InitRouter() *gin.Engine {
+func InitRouter(store storage.Store, signingKey ed25519.PrivateKey, hooks *webhook.Dispatcher, roles middleware.Roles) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	middleware.PrometheusInit()
@@ -25,31 +40,91 @@ func InitRouter() *gin.Engine {
 
 	RouterGroup := r.Group("/api")
 
-	registerPublicRoutes(*RouterGroup)
-	registerPrivateRoutes(*RouterGroup)
+	registerPublicRoutes(*RouterGroup, store, signingKey, hooks)
+	registerPrivateRoutes(*RouterGroup, store, signingKey, hooks, roles)
 	return r
 }
 
-func registerPublicRoutes(r gin.RouterGroup) {
+func registerPublicRoutes(r gin.RouterGroup, store storage.Store, signingKey ed25519.PrivateKey, hooks *webhook.Dispatcher) {
+	licenseHandler := license.NewHandler(store, signingKey, config.AppConfig.GracePeriod, config.AppConfig.SeatLeaseTTL)
+	selfHandler := selfservice.NewHandler(store, hooks, config.AppConfig.SelfServiceCooldown)
+	trialHandler := trial.NewHandler(store, hooks, config.AppConfig.TrialPlan)
+
 	limiter := middleware.NewClientLimiter(1, 5) // 1 req/sec, burst up to 5
 	r.Use(middleware.RateLimitMiddleware(limiter))
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	r.GET("ping", ping.PingHandler)
-	r.POST("license/verify", license.VerifyLicenseHandler)
+	r.POST("license/verify", licenseHandler.VerifyLicenseHandler)
+	r.GET("license/revocations", licenseHandler.RevocationListHandler)
+	r.POST("license/seats/checkout", licenseHandler.CheckoutSeatHandler)
+	r.POST("license/seats/heartbeat", licenseHandler.HeartbeatSeatHandler)
+	r.POST("license/seats/release", licenseHandler.ReleaseSeatHandler)
+
+	// customers authenticate with their license key and a one-time code
+	r.POST("self/code", selfHandler.RequestCodeHandler)
+	r.POST("self/session", selfHandler.CreateSessionHandler)
+	self := r.Group("self", selfHandler.SessionMiddleware())
+	self.GET("license", selfHandler.GetLicenseHandler)
+	self.DELETE("device", selfHandler.DeactivateDeviceHandler)
+
+	// on top of the uniqueness checks, an address gets three trial requests and one a minute after that
+	trialLimiter := middleware.NewClientLimiter(rate.Every(time.Minute), 3)
+	r.POST("trial", middleware.RateLimitMiddleware(trialLimiter), trialHandler.StartTrialHandler)
 }
 
-func registerPrivateRoutes(r gin.RouterGroup) {
-	r.Use(middleware.AdminAuthMiddleware)
-	r.POST("user/create", user.CreateUserHandler)
-	r.GET("user", user.GetUserHandler)
-	r.POST("user/:user_id/device", user.AddDeviceHandler)
-	r.DELETE("user/:user_id/device", user.RemoveDeviceHandler)
-	r.POST("user/:user_id/devices/reset", user.ResetDevicesHandler)
-	r.POST("user/:user_id/license/status", user.ChangeLicenseStatusHandler)
-	r.POST("user/:user_id/license/hwid_limit", user.UpdateHwidLimitHandler)
-	r.POST("user/:user_id/license/renew", user.RenewLicenseHandler)
-	r.POST("user/:user_id/discord", user.BindDiscordHandler)
-	r.POST("user/:user_id/telegram", user.BindTelegramHandler)
-	r.DELETE("user/:user_id", user.DeleteUserHandler)
+func registerPrivateRoutes(r gin.RouterGroup, store storage.Store, signingKey ed25519.PrivateKey, hooks *webhook.Dispatcher, roles middleware.Roles) {
+	userHandler := user.NewHandler(store, signingKey, hooks, config.AppConfig.GracePeriod)
+	productHandler := product.NewHandler(store)
+	planHandler := plan.NewHandler(store)
+	auditHandler := audit.NewHandler(store)
+	webhookHandler := webhooks.NewHandler(store, hooks)
+	apiKeyHandler := apikey.NewHandler(store, roles)
+
+	// every route declares the permission it needs, granted by the role or the scopes of an API key
+	scope := middleware.RequireScope
+
+	r.Use(middleware.AdminAuthMiddleware(api_utils.APIKeyResolver(store, roles)))
+	r.POST("user/create", scope(middleware.ScopeUsersWrite), userHandler.CreateUserHandler)
+	r.GET("user", scope(middleware.ScopeUsersRead), userHandler.GetUserHandler)
+	r.GET("users", scope(middleware.ScopeUsersRead), userHandler.ListUsersHandler)
+	r.POST("user/:user_id/device", scope(middleware.ScopeDevicesWrite), userHandler.AddDeviceHandler)
+	r.DELETE("user/:user_id/device", scope(middleware.ScopeDevicesWrite), userHandler.RemoveDeviceHandler)
+	r.POST("user/:user_id/devices/reset", scope(middleware.ScopeDevicesWrite), userHandler.ResetDevicesHandler)
+	r.POST("user/:user_id/license/status", scope(middleware.ScopeLicensesWrite), userHandler.ChangeLicenseStatusHandler)
+	r.POST("user/:user_id/license/hwid_limit", scope(middleware.ScopeLicensesWrite), userHandler.UpdateHwidLimitHandler)
+	r.POST("user/:user_id/license/grace_period", scope(middleware.ScopeLicensesWrite), userHandler.SetGracePeriodHandler)
+	r.POST("user/:user_id/license/renew", scope(middleware.ScopeLicensesWrite), userHandler.RenewLicenseHandler)
+	r.GET("user/:user_id/license/renewals", scope(middleware.ScopeUsersRead), userHandler.ListRenewalsHandler)
+	r.POST("user/:user_id/license/convert", scope(middleware.ScopeLicensesWrite), userHandler.ConvertTrialHandler)
+	r.POST("user/:user_id/license/token", scope(middleware.ScopeLicensesWrite), userHandler.IssueTokenHandler)
+	r.POST("user/:user_id/licenses", scope(middleware.ScopeLicensesWrite), userHandler.AddLicenseHandler)
+	r.POST("user/:user_id/license/entitlements", scope(middleware.ScopeLicensesWrite), userHandler.GrantEntitlementHandler)
+	r.DELETE("user/:user_id/license/entitlements/:name", scope(middleware.ScopeLicensesWrite), userHandler.RevokeEntitlementHandler)
+	r.POST("user/:user_id/discord", scope(middleware.ScopeUsersWrite), userHandler.BindDiscordHandler)
+	r.POST("user/:user_id/telegram", scope(middleware.ScopeUsersWrite), userHandler.BindTelegramHandler)
+	r.DELETE("user/:user_id", scope(middleware.ScopeUsersWrite), userHandler.DeleteUserHandler)
+
+	r.POST("products", scope(middleware.ScopeProductsWrite), productHandler.CreateProductHandler)
+	r.GET("products", scope(middleware.ScopeProductsRead), productHandler.ListProductsHandler)
+	r.GET("products/:product_id", scope(middleware.ScopeProductsRead), productHandler.GetProductHandler)
+	r.DELETE("products/:product_id", scope(middleware.ScopeProductsWrite), productHandler.DeleteProductHandler)
+
+	r.POST("plans", scope(middleware.ScopePlansWrite), planHandler.CreatePlanHandler)
+	r.GET("plans", scope(middleware.ScopePlansRead), planHandler.ListPlansHandler)
+	r.GET("plans/:plan_id", scope(middleware.ScopePlansRead), planHandler.GetPlanHandler)
+	r.PUT("plans/:plan_id", scope(middleware.ScopePlansWrite), planHandler.UpdatePlanHandler)
+	r.DELETE("plans/:plan_id", scope(middleware.ScopePlansWrite), planHandler.DeletePlanHandler)
+
+	r.POST("webhooks", scope(middleware.ScopeWebhooksWrite), webhookHandler.CreateWebhookHandler)
+	r.GET("webhooks", scope(middleware.ScopeWebhooksRead), webhookHandler.ListWebhooksHandler)
+	r.DELETE("webhooks/:webhook_id", scope(middleware.ScopeWebhooksWrite), webhookHandler.DeleteWebhookHandler)
+	r.GET("webhooks/deliveries", scope(middleware.ScopeWebhooksRead), webhookHandler.ListDeliveriesHandler)
+	r.POST("webhooks/deliveries/:delivery_id/redeliver", scope(middleware.ScopeWebhooksWrite), webhookHandler.RedeliverHandler)
+
+	r.GET("audit", scope(middleware.ScopeAuditRead), auditHandler.ListAuditHandler)
+
+	r.POST("keys", scope(middleware.ScopeKeysWrite), apiKeyHandler.CreateKeyHandler)
+	r.GET("keys", scope(middleware.ScopeKeysRead), apiKeyHandler.ListKeysHandler)
+	r.DELETE("keys/:key_id", scope(middleware.ScopeKeysWrite), apiKeyHandler.RevokeKeyHandler)
 }
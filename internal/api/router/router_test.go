@@ -3,23 +3,38 @@ package router
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/dzhisl/license-api/internal/api/middleware"
+	api_utils "github.com/dzhisl/license-api/internal/api/utils"
 	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
 	"github.com/dzhisl/license-api/pkg/config"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
 	"github.com/dzhisl/license-api/pkg/logger"
 	"github.com/spf13/viper"
 	"github.com/test-go/testify/assert"
 )
 
 var (
-	ctx context.Context
-	r   http.Handler
+	ctx        context.Context
+	r          http.Handler
+	signingKey ed25519.PrivateKey
+	hooks      *webhook.Dispatcher
 )
 
 func TestMain(m *testing.M) {
@@ -27,8 +42,19 @@ func TestMain(m *testing.M) {
 	ctx = context.TODO()
 	config.InitConfig()
 	logger.InitLogger()
-	storage.InitStorage(ctx)
-	r = InitRouter()
+
+	// run against the in-memory backend unless another one is requested explicitly
+	if config.AppConfig.StorageBackend == "" {
+		config.AppConfig.StorageBackend = storage.BackendMemory
+	}
+	if viper.GetString("ADMIN_SECRET_KEY") == "" {
+		viper.Set("ADMIN_SECRET_KEY", "test-admin-key")
+	}
+	_, signingKey, _ = ed25519.GenerateKey(nil)
+	store := storage.InitStorage(ctx)
+	hooks = webhook.NewDispatcher(store)
+	config.AppConfig.TrialPlan = "router-trial"
+	r = InitRouter(store, signingKey, hooks, middleware.DefaultRoles)
 
 	code := m.Run()
 	os.Exit(code)
@@ -74,3 +100,1331 @@ func TestCreateUser(t *testing.T) {
 
 	assert.Equal(t, 200, w.Code)
 }
+
+func TestVerifyActivatesDevice(t *testing.T) {
+	exampleUser := map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     4242,
+	}
+	body, err := json.Marshal(exampleUser)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/api/user/create", bytes.NewBuffer(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", viper.GetString("ADMIN_SECRET_KEY"))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var created struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	verifier := licenseclient.NewVerifier(signingKey.Public().(ed25519.PublicKey))
+	verify := func(hwid string) (*httptest.ResponseRecorder, verifyResponse) {
+		body, err := json.Marshal(map[string]string{"license": created.User.License.Key, "hwid": hwid, "nonce": "nonce-" + hwid})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/api/license/verify", bytes.NewBuffer(body))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		var resp verifyResponse
+		if w.Code == 200 {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			_, err := verifier.Verify(resp.SignedPayload, created.User.License.Key, hwid, "nonce-"+hwid)
+			assert.NoError(t, err)
+		}
+		return w, resp
+	}
+
+	// first use binds the device
+	w, resp := verify("hwid_1")
+	assert.Equal(t, 200, w.Code)
+	assert.True(t, resp.Activated)
+
+	// second use recognizes it
+	w, resp = verify("hwid_1")
+	assert.Equal(t, 200, w.Code)
+	assert.False(t, resp.Activated)
+
+	// no free slot left for another device
+	w, _ = verify("hwid_2")
+	assert.Equal(t, 403, w.Code)
+	resp403 := errorResponse(t, w)
+	assert.Equal(t, licenseclient.CodeDeviceLimit, resp403.Code)
+	assert.Equal(t, float64(1), resp403.Details["max_activations"])
+}
+
+// errorResponse decodes the error envelope of a failed request.
+func errorResponse(t *testing.T, w *httptest.ResponseRecorder) licenseclient.ErrorResponse {
+	var resp licenseclient.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	w := adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(-time.Hour).Unix(),
+		"telegram_id":     4040,
+	})
+	assert.Equal(t, 200, w.Code)
+	var expired struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &expired))
+
+	w = adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(time.Hour).Unix(),
+		"telegram_id":     4041,
+	})
+	assert.Equal(t, 200, w.Code)
+	var frozen struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &frozen))
+	w = adminRequest(t, "POST", fmt.Sprintf("/api/user/%d/license/status", frozen.User.Id), map[string]string{"status": string(storage.Frozen)})
+	assert.Equal(t, 200, w.Code)
+
+	verify := func(license string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(map[string]string{"license": license, "hwid": "envelope_hwid"})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/api/license/verify", bytes.NewBuffer(body))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "192.0.2.9:1234"
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	testCases := []struct {
+		name    string
+		license string
+		status  int
+		code    string
+	}{
+		{"Unknown license", "no-such-license", 404, licenseclient.CodeLicenseNotFound},
+		{"Expired license", expired.User.License.Key, 403, licenseclient.CodeLicenseExpired},
+		{"Frozen license", frozen.User.License.Key, 403, licenseclient.CodeLicenseFrozen},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := verify(tc.license)
+			assert.Equal(t, tc.status, w.Code)
+			resp := errorResponse(t, w)
+			assert.Equal(t, licenseclient.ErrorVersion, resp.Version)
+			assert.Equal(t, tc.code, resp.Code)
+			assert.NotEqual(t, "", resp.Message)
+			assert.Equal(t, resp.Message, resp.Error)
+			assert.NotEqual(t, "", resp.RequestId)
+			assert.Equal(t, w.Header().Get("X-Request-ID"), resp.RequestId)
+		})
+	}
+
+	// middleware errors use the envelope too
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, licenseclient.CodeUnauthorized, errorResponse(t, w).Code)
+}
+
+func TestStorageErrors(t *testing.T) {
+	w := adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     4141,
+	})
+	assert.Equal(t, 200, w.Code)
+	var created struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	userURL := fmt.Sprintf("/api/user/%d", created.User.Id)
+	errorCode := func(w *httptest.ResponseRecorder) string {
+		return errorResponse(t, w).Code
+	}
+
+	w = adminRequest(t, "GET", "/api/user?telegram_id=4140", nil)
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, licenseclient.CodeNotFound, errorCode(w))
+
+	w = adminRequest(t, "POST", "/api/user/1/device", map[string]string{"hwid": "errors_hwid_1"})
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, licenseclient.CodeNotFound, errorCode(w))
+
+	// updates of a missing user are not found, not "nothing changed"
+	missingURL := "/api/user/424242"
+	for _, tc := range []struct {
+		path    string
+		payload any
+	}{
+		{"/license/status", map[string]string{"status": "frozen"}},
+		{"/devices/reset", nil},
+		{"/discord", map[string]int{"discord_id": 4242}},
+		{"/telegram", map[string]int{"telegram_id": 4242}},
+		{"/license/renew", map[string]int64{"expires_at": time.Now().Add(48 * time.Hour).Unix()}},
+		{"/license/hwid_limit", map[string]int{"max_activations": 3}},
+	} {
+		w = adminRequest(t, "POST", missingURL+tc.path, tc.payload)
+		assert.Equal(t, 404, w.Code, tc.path)
+		assert.Equal(t, licenseclient.CodeNotFound, errorCode(w), tc.path)
+	}
+	w = adminRequest(t, "DELETE", missingURL, nil)
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, licenseclient.CodeNotFound, errorCode(w))
+	w = adminRequest(t, "GET", "/api/audit?user_id=424242", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"entries":[]`)
+
+	w = adminRequest(t, "POST", userURL+"/device", map[string]string{"hwid": "errors_hwid_1"})
+	assert.Equal(t, 200, w.Code)
+	w = adminRequest(t, "POST", userURL+"/device", map[string]string{"hwid": "errors_hwid_1"})
+	assert.Equal(t, 409, w.Code)
+	assert.Equal(t, licenseclient.CodeNoChange, errorCode(w))
+	w = adminRequest(t, "POST", userURL+"/device", map[string]string{"hwid": "errors_hwid_2"})
+	assert.Equal(t, 409, w.Code)
+	assert.Equal(t, licenseclient.CodeDeviceLimit, errorCode(w))
+
+	w = adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     4141,
+	})
+	assert.Equal(t, 409, w.Code)
+	assert.Equal(t, licenseclient.CodeConflict, errorCode(w))
+}
+
+// adminRequest sends payload as JSON to a private endpoint.
+func adminRequest(t *testing.T, method, url string, payload any) *httptest.ResponseRecorder {
+	body, err := json.Marshal(payload)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", viper.GetString("ADMIN_SECRET_KEY"))
+	r.ServeHTTP(w, req)
+	return w
+}
+
+type verifyResponse struct {
+	licenseclient.SignedPayload
+	Activated      bool   `json:"activated"`
+	Type           string `json:"type"`
+	Grace          bool   `json:"grace"`
+	GraceRemaining int64  `json:"grace_remaining"`
+}
+
+func TestOfflineTokenRevocation(t *testing.T) {
+	w := adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     4343,
+	})
+	assert.Equal(t, 200, w.Code)
+	var created struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	userURL := fmt.Sprintf("/api/user/%d", created.User.Id)
+
+	w = adminRequest(t, "POST", userURL+"/device", map[string]string{"hwid": "offline_hwid"})
+	assert.Equal(t, 200, w.Code)
+
+	w = adminRequest(t, "POST", userURL+"/license/token", map[string]interface{}{"features": []string{"export"}})
+	assert.Equal(t, 200, w.Code)
+	var issued struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &issued))
+
+	verifier := licenseclient.NewVerifier(signingKey.Public().(ed25519.PublicKey))
+	claims, err := verifier.VerifyToken(issued.Token, "offline_hwid", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"export"}, claims.Features)
+
+	w = adminRequest(t, "POST", userURL+"/license/status", map[string]string{"status": string(storage.Burned)})
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/api/license/revocations", nil)
+	assert.NoError(t, err)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var signed licenseclient.SignedPayload
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &signed))
+	rl, err := verifier.VerifyRevocationList(signed)
+	assert.NoError(t, err)
+
+	_, err = verifier.VerifyToken(issued.Token, "offline_hwid", rl)
+	assert.True(t, errors.Is(err, licenseclient.ErrRevoked))
+}
+
+func TestExpiredLicense(t *testing.T) {
+	w := adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     5454,
+	})
+	assert.Equal(t, 200, w.Code)
+	var created struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	userURL := fmt.Sprintf("/api/user/%d", created.User.Id)
+
+	verify := func() *httptest.ResponseRecorder {
+		body, err := json.Marshal(map[string]string{"license": created.User.License.Key, "hwid": "expiry_hwid"})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/api/license/verify", bytes.NewBuffer(body))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "192.0.2.10:1234"
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// as marked by the expiry worker
+	w = adminRequest(t, "POST", userURL+"/license/status", map[string]string{"status": string(storage.Expired)})
+	assert.Equal(t, 200, w.Code)
+	w = verify()
+	assert.Equal(t, 403, w.Code)
+	assert.Equal(t, licenseclient.CodeLicenseExpired, errorResponse(t, w).Code)
+
+	// an expired license isn't revoked, offline tokens check the expiry themselves
+	w = httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/api/license/revocations", nil)
+	assert.NoError(t, err)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var signed licenseclient.SignedPayload
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &signed))
+	rl, err := licenseclient.NewVerifier(signingKey.Public().(ed25519.PublicKey)).VerifyRevocationList(signed)
+	assert.NoError(t, err)
+	assert.NotContains(t, rl.Keys, created.User.License.Key)
+
+	// renewing makes it active again
+	w = adminRequest(t, "POST", userURL+"/license/renew", map[string]interface{}{
+		"expires_at": time.Now().Add(48 * time.Hour).Unix(),
+	})
+	assert.Equal(t, 200, w.Code)
+	w = adminRequest(t, "GET", fmt.Sprintf("/api/user?license=%s", created.User.License.Key), nil)
+	assert.Equal(t, 200, w.Code)
+	var renewed struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &renewed))
+	assert.Equal(t, storage.Active, renewed.User.License.Status)
+	assert.Equal(t, 200, verify().Code)
+}
+
+func TestGracePeriod(t *testing.T) {
+	w := adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(-time.Hour).Unix(),
+		"telegram_id":     5555,
+	})
+	assert.Equal(t, 200, w.Code)
+	var created struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	userURL := fmt.Sprintf("/api/user/%d", created.User.Id)
+
+	verify := func() (*httptest.ResponseRecorder, verifyResponse) {
+		body, err := json.Marshal(map[string]string{"license": created.User.License.Key, "hwid": "grace_hwid", "nonce": "grace"})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/api/license/verify", bytes.NewBuffer(body))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "192.0.2.11:1234"
+		r.ServeHTTP(w, req)
+
+		var resp verifyResponse
+		if w.Code == 200 {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+
+	// no grace period by default
+	w, _ = verify()
+	assert.Equal(t, 403, w.Code)
+	assert.Equal(t, licenseclient.CodeLicenseExpired, errorResponse(t, w).Code)
+
+	w = adminRequest(t, "POST", userURL+"/license/grace_period", map[string]interface{}{"grace_period": -1})
+	assert.Equal(t, 400, w.Code)
+	w = adminRequest(t, "POST", userURL+"/license/grace_period", map[string]interface{}{"grace_period": 2 * 3600})
+	assert.Equal(t, 200, w.Code)
+
+	w, resp := verify()
+	assert.Equal(t, 200, w.Code)
+	assert.True(t, resp.Grace)
+	assert.InDelta(t, 3600, resp.GraceRemaining, 5)
+	payload, err := licenseclient.NewVerifier(signingKey.Public().(ed25519.PublicKey)).
+		Verify(resp.SignedPayload, created.User.License.Key, "grace_hwid", "grace")
+	assert.NoError(t, err)
+	assert.True(t, payload.Grace)
+	assert.Equal(t, resp.GraceRemaining, payload.GraceRemaining)
+
+	// back to the default
+	w = adminRequest(t, "POST", userURL+"/license/grace_period", nil)
+	assert.Equal(t, 200, w.Code)
+	w, _ = verify()
+	assert.Equal(t, 403, w.Code)
+}
+
+func TestRenewals(t *testing.T) {
+	expiresAt := time.Now().Add(24 * time.Hour).Unix()
+	w := adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      expiresAt,
+		"telegram_id":     5656,
+	})
+	assert.Equal(t, 200, w.Code)
+	var created struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	userURL := fmt.Sprintf("/api/user/%d", created.User.Id)
+
+	w = adminRequest(t, "POST", userURL+"/license/renew", map[string]interface{}{"extend_by": "30d", "expires_at": expiresAt})
+	assert.Equal(t, 400, w.Code)
+	w = adminRequest(t, "POST", userURL+"/license/renew", map[string]interface{}{"extend_by": "-1d"})
+	assert.Equal(t, 400, w.Code)
+
+	// extended from the current expiry, not from now
+	w = adminRequest(t, "POST", userURL+"/license/renew", map[string]interface{}{"extend_by": "30d"})
+	assert.Equal(t, 200, w.Code)
+	var renewed struct {
+		ExpiresAt int64 `json:"expires_at"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &renewed))
+	assert.Equal(t, expiresAt+30*24*3600, renewed.ExpiresAt)
+
+	w = adminRequest(t, "POST", userURL+"/license/renew", map[string]interface{}{"expires_at": expiresAt})
+	assert.Equal(t, 200, w.Code)
+
+	w = adminRequest(t, "GET", userURL+"/license/renewals", nil)
+	assert.Equal(t, 200, w.Code)
+	var history struct {
+		Renewals []storage.Renewal `json:"renewals"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	if assert.Len(t, history.Renewals, 2) {
+		assert.Equal(t, storage.RenewalAbsolute, history.Renewals[0].Source)
+		assert.Equal(t, -int64(30*24*3600), history.Renewals[0].Amount)
+		assert.Equal(t, storage.RenewalExtension, history.Renewals[1].Source)
+		assert.Equal(t, int64(30*24*3600), history.Renewals[1].Amount)
+		assert.Equal(t, storage.Timestamp(expiresAt), history.Renewals[1].PreviousExpiresAt)
+		assert.Equal(t, "admin", history.Renewals[1].Actor)
+	}
+
+	w = adminRequest(t, "GET", userURL+"/license/renewals?product=missing", nil)
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, licenseclient.CodeLicenseNotFound, errorResponse(t, w).Code)
+}
+
+func TestTrials(t *testing.T) {
+	for _, plan := range []map[string]interface{}{
+		{"id": "router-trial", "name": "Trial", "max_activations": 1, "duration": 7 * 24 * 3600},
+		{"id": "router-paid", "name": "Paid", "max_activations": 3, "duration": 30 * 24 * 3600, "features": []string{"export"}},
+	} {
+		w := adminRequest(t, "POST", "/api/plans", plan)
+		assert.Equal(t, 200, w.Code)
+	}
+
+	publicRequest := func(path, remoteAddr string, payload any) *httptest.ResponseRecorder {
+		body, err := json.Marshal(payload)
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", path, bytes.NewBuffer(body))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		r.ServeHTTP(w, req)
+		return w
+	}
+	startTrial := func(hwid string, telegramId int) *httptest.ResponseRecorder {
+		return publicRequest("/api/trial", "192.0.2.12:1234", map[string]interface{}{"hwid": hwid, "telegram_id": telegramId})
+	}
+	verify := func(license string) verifyResponse {
+		w := publicRequest("/api/license/verify", "192.0.2.13:1234", map[string]string{"license": license, "hwid": "trial_hwid", "nonce": "trial"})
+		assert.Equal(t, 200, w.Code)
+		var resp verifyResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	w := startTrial("trial_hwid", 5757)
+	assert.Equal(t, 200, w.Code)
+	var started struct {
+		UserId  int             `json:"userId"`
+		License storage.License `json:"license"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &started))
+	assert.Equal(t, storage.Trial, started.License.Type)
+	assert.Equal(t, []string{"trial_hwid"}, started.License.Devices)
+	assert.Equal(t, started.License.IssuedAt+7*24*3600, started.License.ExpiresAt)
+
+	// neither the machine nor the account gets another trial
+	w = startTrial("trial_hwid", 5758)
+	assert.Equal(t, 409, w.Code)
+	assert.Equal(t, licenseclient.CodeTrialClaimed, errorResponse(t, w).Code)
+	w = startTrial("other_trial_hwid", 5757)
+	assert.Equal(t, 409, w.Code)
+	assert.Equal(t, licenseclient.CodeTrialClaimed, errorResponse(t, w).Code)
+	w = adminRequest(t, "GET", "/api/user?telegram_id=5758", nil)
+	assert.Equal(t, 404, w.Code)
+	w = startTrial("third_trial_hwid", 5759)
+	assert.Equal(t, 429, w.Code)
+
+	resp := verify(started.License.Key)
+	assert.Equal(t, "trial", resp.Type)
+	payload, err := licenseclient.NewVerifier(signingKey.Public().(ed25519.PublicKey)).
+		Verify(resp.SignedPayload, started.License.Key, "trial_hwid", "trial")
+	assert.NoError(t, err)
+	assert.Equal(t, "trial", payload.Type)
+
+	userURL := fmt.Sprintf("/api/user/%d", started.UserId)
+	w = adminRequest(t, "POST", userURL+"/license/convert", map[string]interface{}{"plan": "router-paid"})
+	assert.Equal(t, 200, w.Code)
+	w = adminRequest(t, "POST", userURL+"/license/convert", map[string]interface{}{"plan": "router-paid"})
+	assert.Equal(t, 409, w.Code)
+	assert.Equal(t, licenseclient.CodeConflict, errorResponse(t, w).Code)
+
+	w = adminRequest(t, "GET", "/api/user?telegram_id=5757", nil)
+	assert.Equal(t, 200, w.Code)
+	var got struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	license := got.User.License
+	assert.Equal(t, started.License.Key, license.Key)
+	assert.Equal(t, storage.LicenseType(""), license.Type)
+	assert.Equal(t, "router-paid", license.PlanId)
+	assert.Equal(t, 3, license.MaxActivations)
+	assert.Equal(t, []string{"trial_hwid"}, license.Devices)
+	assert.True(t, license.Entitlements.Has("export"))
+	assert.Empty(t, verify(license.Key).Type)
+}
+
+func TestFloatingLicense(t *testing.T) {
+	w := adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 2,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     5858,
+		"mode":            "floating",
+	})
+	assert.Equal(t, 200, w.Code)
+	var created struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	license := created.User.License.Key
+	assert.Equal(t, storage.Floating, created.User.License.Mode)
+
+	// the rate limit allows five requests per address, spread them
+	publicRequest := func(path, remoteAddr string, payload any) *httptest.ResponseRecorder {
+		body, err := json.Marshal(payload)
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", path, bytes.NewBuffer(body))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		r.ServeHTTP(w, req)
+		return w
+	}
+	type lease struct {
+		SeatId    string `json:"seat_id"`
+		ExpiresAt int64  `json:"expires_at"`
+		TTL       int64  `json:"ttl"`
+	}
+	checkout := func(hwid string) (*httptest.ResponseRecorder, lease) {
+		w := publicRequest("/api/license/seats/checkout", "192.0.2.14:1234", map[string]string{"license": license, "hwid": hwid})
+		var l lease
+		if w.Code == 200 {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &l))
+		}
+		return w, l
+	}
+	verify := func(hwid string) *httptest.ResponseRecorder {
+		return publicRequest("/api/license/verify", "192.0.2.15:1234", map[string]string{"license": license, "hwid": hwid})
+	}
+
+	w, a := checkout("seat_hwid_a")
+	assert.Equal(t, 200, w.Code)
+	assert.NotEmpty(t, a.SeatId)
+	assert.Equal(t, int64(300), a.TTL)
+	w, b := checkout("seat_hwid_b")
+	assert.Equal(t, 200, w.Code)
+	w, _ = checkout("seat_hwid_c")
+	assert.Equal(t, 403, w.Code)
+	assert.Equal(t, licenseclient.CodeSeatLimit, errorResponse(t, w).Code)
+	// a machine checking out again keeps its seat
+	w, again := checkout("seat_hwid_a")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, a.SeatId, again.SeatId)
+
+	// verify doesn't bind devices of floating licenses
+	w = verify("seat_hwid_a")
+	assert.Equal(t, 200, w.Code)
+	var resp verifyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.Activated)
+	w = verify("seat_hwid_c")
+	assert.Equal(t, 403, w.Code)
+	assert.Equal(t, licenseclient.CodeSeatRequired, errorResponse(t, w).Code)
+
+	w = publicRequest("/api/license/seats/heartbeat", "192.0.2.16:1234", map[string]string{"license": license, "seat_id": a.SeatId})
+	assert.Equal(t, 200, w.Code)
+	w = publicRequest("/api/license/seats/heartbeat", "192.0.2.16:1234", map[string]string{"license": license, "seat_id": "unknown"})
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, licenseclient.CodeSeatNotFound, errorResponse(t, w).Code)
+	w = publicRequest("/api/license/seats/release", "192.0.2.16:1234", map[string]string{"license": license, "seat_id": b.SeatId})
+	assert.Equal(t, 200, w.Code)
+	w = publicRequest("/api/license/seats/release", "192.0.2.16:1234", map[string]string{"license": license, "seat_id": b.SeatId})
+	assert.Equal(t, 404, w.Code)
+
+	// the released seat is free for another machine
+	w = publicRequest("/api/license/seats/checkout", "192.0.2.17:1234", map[string]string{"license": license, "hwid": "seat_hwid_c"})
+	assert.Equal(t, 200, w.Code)
+
+	w = adminRequest(t, "GET", "/api/user?telegram_id=5858", nil)
+	assert.Equal(t, 200, w.Code)
+	var got struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Empty(t, got.User.License.Devices)
+	assert.Len(t, got.User.License.Seats, 2)
+}
+
+func TestProductLicenses(t *testing.T) {
+	w := adminRequest(t, "POST", "/api/products", map[string]interface{}{
+		"id":                      "suite",
+		"name":                    "Suite",
+		"key_prefix":              "SUITE",
+		"key_length":              12,
+		"default_max_activations": 2,
+		"default_duration":        3600,
+	})
+	assert.Equal(t, 200, w.Code)
+	w = adminRequest(t, "POST", "/api/products", map[string]string{"id": "suite", "name": "Suite"})
+	assert.Equal(t, 409, w.Code)
+
+	w = adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     4444,
+	})
+	assert.Equal(t, 200, w.Code)
+	var created struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	userURL := fmt.Sprintf("/api/user/%d", created.User.Id)
+
+	w = adminRequest(t, "POST", userURL+"/licenses", map[string]string{"product": "missing"})
+	assert.Equal(t, 404, w.Code)
+	w = adminRequest(t, "POST", userURL+"/licenses", map[string]string{"product": "suite"})
+	assert.Equal(t, 200, w.Code)
+	var added struct {
+		License storage.License `json:"license"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &added))
+	assert.True(t, strings.HasPrefix(added.License.Key, "SUITE-"))
+	assert.Equal(t, len("SUITE-")+12, len(added.License.Key))
+	assert.Equal(t, 2, added.License.MaxActivations)
+	w = adminRequest(t, "POST", userURL+"/licenses", map[string]string{"product": "suite"})
+	assert.Equal(t, 409, w.Code)
+
+	verify := func(license, product string) (*httptest.ResponseRecorder, verifyResponse) {
+		body, err := json.Marshal(map[string]string{"license": license, "hwid": "suite_hwid", "product": product})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/api/license/verify", bytes.NewBuffer(body))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		// a separate client, the other tests use up the shared rate limit
+		req.RemoteAddr = "192.0.2.8:1234"
+		r.ServeHTTP(w, req)
+
+		var resp verifyResponse
+		if w.Code == 200 {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+
+	// the primary license doesn't belong to the product
+	w, _ = verify(created.User.License.Key, "suite")
+	assert.Equal(t, 403, w.Code)
+
+	w, resp := verify(added.License.Key, "suite")
+	assert.Equal(t, 200, w.Code)
+	verifier := licenseclient.NewVerifier(signingKey.Public().(ed25519.PublicKey))
+	payload, err := verifier.Verify(resp.SignedPayload, added.License.Key, "suite_hwid", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "suite", payload.Product)
+
+	// the device was bound to the product license only
+	w = adminRequest(t, "GET", fmt.Sprintf("/api/user?license=%s", added.License.Key), nil)
+	assert.Equal(t, 200, w.Code)
+	var got struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, 0, len(got.User.License.Devices))
+	assert.Equal(t, []string{"suite_hwid"}, got.User.FindLicense("suite").Devices)
+}
+
+func TestPlans(t *testing.T) {
+	const duration = 30 * 24 * 3600
+
+	w := adminRequest(t, "POST", "/api/plans", map[string]interface{}{
+		"id":              "monthly-1-device",
+		"name":            "Monthly, 1 device",
+		"max_activations": 1,
+		"duration":        duration,
+		"features":        []string{"export"},
+	})
+	assert.Equal(t, 200, w.Code)
+	w = adminRequest(t, "POST", "/api/plans", map[string]interface{}{
+		"id":              "bad-renewal",
+		"name":            "Bad",
+		"max_activations": 1,
+		"renewal":         "sometimes",
+	})
+	assert.Equal(t, 400, w.Code)
+
+	w = adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"plan":        "monthly-1-device",
+		"telegram_id": 4545,
+	})
+	assert.Equal(t, 200, w.Code)
+	var created struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	license := created.User.License
+	assert.Equal(t, "monthly-1-device", license.PlanId)
+	assert.Equal(t, 1, license.MaxActivations)
+	assert.Equal(t, license.IssuedAt+duration, license.ExpiresAt)
+	userURL := fmt.Sprintf("/api/user/%d", created.User.Id)
+
+	// renewing without expires_at extends the license by the plan duration
+	w = adminRequest(t, "POST", userURL+"/license/renew", map[string]interface{}{})
+	assert.Equal(t, 200, w.Code)
+	w = adminRequest(t, "GET", fmt.Sprintf("/api/user?license=%s", license.Key), nil)
+	assert.Equal(t, 200, w.Code)
+	var got struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, license.ExpiresAt+duration, got.User.License.ExpiresAt)
+
+	// offline tokens carry the plan features
+	w = adminRequest(t, "POST", userURL+"/device", map[string]string{"hwid": "plan_hwid"})
+	assert.Equal(t, 200, w.Code)
+	w = adminRequest(t, "POST", userURL+"/license/token", map[string]interface{}{})
+	assert.Equal(t, 200, w.Code)
+	var issued struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &issued))
+	verifier := licenseclient.NewVerifier(signingKey.Public().(ed25519.PublicKey))
+	claims, err := verifier.VerifyToken(issued.Token, "plan_hwid", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"export"}, claims.Features)
+
+	w = adminRequest(t, "PUT", "/api/plans/monthly-1-device", map[string]interface{}{
+		"name":            "Monthly, 2 devices",
+		"max_activations": 2,
+		"duration":        duration,
+		"renewal":         "reset",
+	})
+	assert.Equal(t, 200, w.Code)
+	w = adminRequest(t, "GET", "/api/plans/monthly-1-device", nil)
+	assert.Equal(t, 200, w.Code)
+	var plan struct {
+		Plan storage.Plan `json:"plan"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &plan))
+	assert.Equal(t, 2, plan.Plan.MaxActivations)
+	assert.Equal(t, storage.RenewReset, plan.Plan.Renewal)
+
+	w = adminRequest(t, "DELETE", "/api/plans/monthly-1-device", nil)
+	assert.Equal(t, 200, w.Code)
+	w = adminRequest(t, "GET", "/api/plans/monthly-1-device", nil)
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestEntitlements(t *testing.T) {
+	w := adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     4646,
+	})
+	assert.Equal(t, 200, w.Code)
+	var created struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	userURL := fmt.Sprintf("/api/user/%d", created.User.Id)
+
+	w = adminRequest(t, "POST", userURL+"/license/entitlements", map[string]interface{}{"name": "export"})
+	assert.Equal(t, 200, w.Code)
+	w = adminRequest(t, "POST", userURL+"/license/entitlements", map[string]interface{}{"name": "max_projects", "quota": 10})
+	assert.Equal(t, 200, w.Code)
+	w = adminRequest(t, "POST", userURL+"/license/entitlements", map[string]interface{}{"name": "sync"})
+	assert.Equal(t, 200, w.Code)
+	w = adminRequest(t, "POST", userURL+"/license/entitlements", map[string]interface{}{"name": "bad.name"})
+	assert.Equal(t, 400, w.Code)
+	w = adminRequest(t, "DELETE", userURL+"/license/entitlements/sync", nil)
+	assert.Equal(t, 200, w.Code)
+
+	body, err := json.Marshal(map[string]string{"license": created.User.License.Key, "hwid": "entitled_hwid"})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/api/license/verify", bytes.NewBuffer(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "192.0.2.9:1234"
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"entitlements":{"export":true,"max_projects":10}`)
+
+	var resp verifyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	verifier := licenseclient.NewVerifier(signingKey.Public().(ed25519.PublicKey))
+	payload, err := verifier.Verify(resp.SignedPayload, created.User.License.Key, "entitled_hwid", "")
+	assert.NoError(t, err)
+	assert.True(t, payload.Entitlements.Has("export"))
+	assert.False(t, payload.Entitlements.Has("sync"))
+	quota, ok := payload.Entitlements.Quota("max_projects")
+	assert.True(t, ok)
+	assert.Equal(t, int64(10), quota)
+}
+
+func TestAuditLog(t *testing.T) {
+	w := adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     4747,
+	})
+	assert.Equal(t, 200, w.Code)
+	var created struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	userURL := fmt.Sprintf("/api/user/%d", created.User.Id)
+
+	w = adminRequest(t, "POST", userURL+"/license/status", map[string]interface{}{"status": "frozen"})
+	assert.Equal(t, 200, w.Code)
+	w = adminRequest(t, "POST", userURL+"/device", map[string]interface{}{"hwid": "audited_hwid"})
+	assert.Equal(t, 200, w.Code)
+
+	var list struct {
+		Entries []storage.AuditEntry `json:"entries"`
+	}
+	w = adminRequest(t, "GET", fmt.Sprintf("/api/audit?user_id=%d", created.User.Id), nil)
+	assert.Equal(t, 200, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list.Entries, 3) {
+		assert.Equal(t, storage.AuditDeviceAdded, list.Entries[0].Action)
+		assert.JSONEq(t, `{"devices":null}`, string(list.Entries[0].Before))
+		assert.JSONEq(t, `{"devices":["audited_hwid"]}`, string(list.Entries[0].After))
+		assert.Equal(t, storage.AuditLicenseStatusChanged, list.Entries[1].Action)
+		assert.JSONEq(t, `{"status":"active"}`, string(list.Entries[1].Before))
+		assert.JSONEq(t, `{"status":"frozen"}`, string(list.Entries[1].After))
+		assert.Equal(t, storage.AuditUserCreated, list.Entries[2].Action)
+		for _, e := range list.Entries {
+			assert.Equal(t, "admin", e.Actor)
+			assert.NotEmpty(t, e.RequestId)
+		}
+	}
+
+	w = adminRequest(t, "GET", fmt.Sprintf("/api/audit?user_id=%d&action=license.status_changed", created.User.Id), nil)
+	assert.Equal(t, 200, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Entries, 1)
+
+	w = adminRequest(t, "GET", "/api/audit?user_id=1&from=1&to=2", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"entries":[]`)
+
+	w = adminRequest(t, "GET", "/api/audit?limit=-1", nil)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestWebhooks(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []webhook.Event
+		secret   string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, _ := io.ReadAll(req.Body)
+		timestamp, _ := strconv.ParseInt(req.Header.Get("X-Webhook-Timestamp"), 10, 64)
+		if req.Header.Get("X-Webhook-Signature") != webhook.Signature(secret, timestamp, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var e webhook.Event
+		json.Unmarshal(body, &e)
+		received = append(received, e)
+	}))
+	defer srv.Close()
+
+	w := adminRequest(t, "POST", "/api/webhooks", map[string]interface{}{"url": srv.URL, "events": []string{"unknown.event"}})
+	assert.Equal(t, 400, w.Code)
+
+	w = adminRequest(t, "POST", "/api/webhooks", map[string]interface{}{
+		"url":    srv.URL,
+		"events": []string{webhook.EventUserCreated, webhook.EventLicenseStatusChanged},
+	})
+	assert.Equal(t, 200, w.Code)
+	var created struct {
+		Webhook storage.Webhook `json:"webhook"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.Webhook.Secret)
+	mu.Lock()
+	secret = created.Webhook.Secret
+	mu.Unlock()
+	defer adminRequest(t, "DELETE", "/api/webhooks/"+created.Webhook.Id, nil)
+
+	w = adminRequest(t, "GET", "/api/webhooks", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), created.Webhook.Id)
+	assert.NotContains(t, w.Body.String(), secret)
+
+	w = adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     4848,
+	})
+	assert.Equal(t, 200, w.Code)
+	var user struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	w = adminRequest(t, "POST", fmt.Sprintf("/api/user/%d/license/status", user.User.Id), map[string]interface{}{"status": "frozen"})
+	assert.Equal(t, 200, w.Code)
+	// not subscribed
+	w = adminRequest(t, "POST", fmt.Sprintf("/api/user/%d/device", user.User.Id), map[string]interface{}{"hwid": "hooked_hwid"})
+	assert.Equal(t, 200, w.Code)
+
+	hooks.DeliverDue(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, received, 2) {
+		assert.Equal(t, webhook.EventUserCreated, received[0].Type)
+		assert.Equal(t, webhook.EventLicenseStatusChanged, received[1].Type)
+		data, err := json.Marshal(received[1].Data)
+		assert.NoError(t, err)
+		var userData struct {
+			User storage.User `json:"user"`
+		}
+		assert.NoError(t, json.Unmarshal(data, &userData))
+		assert.Equal(t, user.User.Id, userData.User.Id)
+		assert.Equal(t, storage.Frozen, userData.User.License.Status)
+	}
+
+	w = adminRequest(t, "GET", "/api/webhooks/deliveries", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"deliveries":[]`)
+	w = adminRequest(t, "GET", "/api/webhooks/deliveries?status=bogus", nil)
+	assert.Equal(t, 400, w.Code)
+	w = adminRequest(t, "POST", "/api/webhooks/deliveries/missing/redeliver", nil)
+	assert.Equal(t, 404, w.Code)
+}
+
+// keyRequest is adminRequest authenticated with a managed API key.
+func keyRequest(t *testing.T, key, method, url string, payload any) *httptest.ResponseRecorder {
+	body, err := json.Marshal(payload)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+type createKeyResponse struct {
+	APIKey storage.APIKey `json:"apiKey"`
+	Key    string         `json:"key"`
+}
+
+func TestAPIKeys(t *testing.T) {
+	w := adminRequest(t, "POST", "/api/keys", map[string]interface{}{"name": "bad", "scopes": []string{"users:everything"}})
+	assert.Equal(t, 400, w.Code)
+	w = adminRequest(t, "POST", "/api/keys", map[string]interface{}{"name": "bad", "scopes": []string{"users:read"}, "expires_at": 1})
+	assert.Equal(t, 400, w.Code)
+
+	w = adminRequest(t, "POST", "/api/keys", map[string]interface{}{
+		"name":   "support-bot",
+		"scopes": []string{"users:read", "devices:write"},
+	})
+	assert.Equal(t, 200, w.Code)
+	var support createKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &support))
+	assert.True(t, strings.HasPrefix(support.Key, support.APIKey.Prefix))
+	w = adminRequest(t, "POST", "/api/keys", map[string]interface{}{"name": "support-bot", "scopes": []string{"users:read"}})
+	assert.Equal(t, 409, w.Code)
+
+	w = adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     4949,
+	})
+	assert.Equal(t, 200, w.Code)
+
+	w = keyRequest(t, support.Key, "GET", "/api/user?telegram_id=4949", nil)
+	assert.Equal(t, 200, w.Code)
+	w = keyRequest(t, support.Key, "POST", "/api/user/create", map[string]interface{}{"telegram_id": 5050, "max_activations": 1})
+	assert.Equal(t, 403, w.Code)
+	assert.Contains(t, w.Body.String(), "users:write")
+	w = keyRequest(t, support.Key, "GET", "/api/keys", nil)
+	assert.Equal(t, 403, w.Code)
+	w = keyRequest(t, "lk_unknown", "GET", "/api/user?telegram_id=4949", nil)
+	assert.Equal(t, 401, w.Code)
+
+	w = adminRequest(t, "GET", "/api/keys", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.NotContains(t, w.Body.String(), api_utils.HashAPIKey(support.Key))
+	var list struct {
+		APIKeys []storage.APIKey `json:"apiKeys"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	for _, k := range list.APIKeys {
+		if k.Id == support.APIKey.Id {
+			assert.NotZero(t, k.LastUsedAt)
+		}
+	}
+
+	// a key can only hand out scopes it has
+	w = adminRequest(t, "POST", "/api/keys", map[string]interface{}{"name": "key-manager", "scopes": []string{"keys:write", "users:read"}})
+	assert.Equal(t, 200, w.Code)
+	var manager createKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &manager))
+	w = keyRequest(t, manager.Key, "POST", "/api/keys", map[string]interface{}{"name": "escalated", "scopes": []string{"users:write"}})
+	assert.Equal(t, 403, w.Code)
+	w = keyRequest(t, manager.Key, "POST", "/api/keys", map[string]interface{}{"name": "reader", "scopes": []string{"users:read"}})
+	assert.Equal(t, 200, w.Code)
+
+	w = adminRequest(t, "GET", "/api/audit?action=api_key.created&limit=1", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"actor":"key:key-manager"`)
+
+	w = adminRequest(t, "DELETE", "/api/keys/"+support.APIKey.Id, nil)
+	assert.Equal(t, 200, w.Code)
+	w = keyRequest(t, support.Key, "GET", "/api/user?telegram_id=4949", nil)
+	assert.Equal(t, 401, w.Code)
+	w = adminRequest(t, "DELETE", "/api/keys/"+support.APIKey.Id, nil)
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestRoles(t *testing.T) {
+	w := adminRequest(t, "POST", "/api/keys", map[string]interface{}{"name": "no-permissions"})
+	assert.Equal(t, 400, w.Code)
+	w = adminRequest(t, "POST", "/api/keys", map[string]interface{}{"name": "unknown-role", "role": "janitor"})
+	assert.Equal(t, 400, w.Code)
+
+	w = adminRequest(t, "POST", "/api/keys", map[string]interface{}{"name": "support-agent", "role": middleware.RoleSupport})
+	assert.Equal(t, 200, w.Code)
+	var agent createKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &agent))
+	assert.Equal(t, middleware.RoleSupport, agent.APIKey.Role)
+
+	w = adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     5151,
+	})
+	assert.Equal(t, 200, w.Code)
+	var created struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	userURL := fmt.Sprintf("/api/user/%d", created.User.Id)
+
+	// support looks up users and manages their devices
+	w = keyRequest(t, agent.Key, "GET", "/api/user?telegram_id=5151", nil)
+	assert.Equal(t, 200, w.Code)
+	w = keyRequest(t, agent.Key, "POST", userURL+"/device", map[string]interface{}{"hwid": "support_hwid"})
+	assert.Equal(t, 200, w.Code)
+	w = keyRequest(t, agent.Key, "POST", userURL+"/devices/reset", nil)
+	assert.Equal(t, 200, w.Code)
+
+	// but can't burn licenses, change HWID limits or delete users
+	w = keyRequest(t, agent.Key, "POST", userURL+"/license/status", map[string]interface{}{"status": "burned"})
+	assert.Equal(t, 403, w.Code)
+	assert.Contains(t, w.Body.String(), "missing permission licenses:write")
+	w = keyRequest(t, agent.Key, "POST", userURL+"/license/hwid_limit", map[string]interface{}{"max_activations": 5})
+	assert.Equal(t, 403, w.Code)
+	w = keyRequest(t, agent.Key, "DELETE", userURL, nil)
+	assert.Equal(t, 403, w.Code)
+	assert.Contains(t, w.Body.String(), "missing permission users:write")
+
+	// nor mint keys with a role it doesn't fully have
+	w = adminRequest(t, "POST", "/api/keys", map[string]interface{}{"name": "support-lead", "role": middleware.RoleSupport, "scopes": []string{"keys:write"}})
+	assert.Equal(t, 200, w.Code)
+	var lead createKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &lead))
+	w = keyRequest(t, lead.Key, "POST", "/api/keys", map[string]interface{}{"name": "escalated-owner", "role": middleware.RoleOwner})
+	assert.Equal(t, 403, w.Code)
+	w = keyRequest(t, lead.Key, "POST", "/api/keys", map[string]interface{}{"name": "support-agent-2", "role": middleware.RoleSupport})
+	assert.Equal(t, 200, w.Code)
+}
+
+// selfRequest sends payload to a self-service endpoint, authenticated with the
+// session token when it is set. Every request comes from its own client to stay
+// under the public rate limit.
+func selfRequest(t *testing.T, token, method, url string, payload any) *httptest.ResponseRecorder {
+	body, err := json.Marshal(payload)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.RemoteAddr = fmt.Sprintf("198.51.100.%d:1234", selfClients.Add(1))
+	r.ServeHTTP(w, req)
+	return w
+}
+
+var selfClients atomic.Int32
+
+func TestSelfService(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		codes []webhook.SelfServiceCodeData
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var e struct {
+			Data webhook.SelfServiceCodeData `json:"data"`
+		}
+		json.NewDecoder(req.Body).Decode(&e)
+		codes = append(codes, e.Data)
+	}))
+	defer srv.Close()
+
+	w := adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 2,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     5252,
+	})
+	assert.Equal(t, 200, w.Code)
+	var created struct {
+		User storage.User `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	licenseKey := created.User.License.Key
+	for _, hwid := range []string{"self_hwid_1", "self_hwid_2"} {
+		w = adminRequest(t, "POST", fmt.Sprintf("/api/user/%d/device", created.User.Id), map[string]interface{}{"hwid": hwid})
+		assert.Equal(t, 200, w.Code)
+	}
+
+	// nobody would receive the code
+	w = selfRequest(t, "", "POST", "/api/self/code", map[string]interface{}{"license": licenseKey, "channel": "telegram"})
+	assert.Equal(t, 503, w.Code)
+	assert.Equal(t, licenseclient.CodeUnavailable, errorResponse(t, w).Code)
+
+	w = adminRequest(t, "POST", "/api/webhooks", map[string]interface{}{"url": srv.URL, "events": []string{webhook.EventSelfServiceCode}})
+	assert.Equal(t, 200, w.Code)
+	var hook struct {
+		Webhook storage.Webhook `json:"webhook"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+	defer adminRequest(t, "DELETE", "/api/webhooks/"+hook.Webhook.Id, nil)
+
+	w = selfRequest(t, "", "POST", "/api/self/code", map[string]interface{}{"license": licenseKey, "channel": "discord"})
+	assert.Equal(t, 400, w.Code)
+	w = selfRequest(t, "", "POST", "/api/self/code", map[string]interface{}{"license": "unknown", "channel": "telegram"})
+	assert.Equal(t, 404, w.Code)
+	w = selfRequest(t, "", "POST", "/api/self/code", map[string]interface{}{"license": licenseKey, "channel": "telegram"})
+	assert.Equal(t, 200, w.Code)
+	w = selfRequest(t, "", "POST", "/api/self/code", map[string]interface{}{"license": licenseKey, "channel": "telegram"})
+	assert.Equal(t, 429, w.Code)
+
+	hooks.DeliverDue(ctx)
+	mu.Lock()
+	if !assert.Len(t, codes, 1) {
+		mu.Unlock()
+		return
+	}
+	code := codes[0]
+	mu.Unlock()
+	assert.Equal(t, 5252, code.TelegramId)
+	assert.Equal(t, created.User.Id, code.UserId)
+
+	w = selfRequest(t, "", "GET", "/api/self/license", nil)
+	assert.Equal(t, 401, w.Code)
+	w = selfRequest(t, "", "POST", "/api/self/session", map[string]interface{}{"license": licenseKey, "code": "wrong"})
+	assert.Equal(t, 401, w.Code)
+	w = selfRequest(t, "", "POST", "/api/self/session", map[string]interface{}{"license": licenseKey, "code": code.Code})
+	assert.Equal(t, 200, w.Code)
+	var session struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	// codes are single use
+	w = selfRequest(t, "", "POST", "/api/self/session", map[string]interface{}{"license": licenseKey, "code": code.Code})
+	assert.Equal(t, 401, w.Code)
+
+	w = selfRequest(t, session.Token, "GET", "/api/self/license", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"devices":["self_hwid_1","self_hwid_2"]`)
+	assert.Contains(t, w.Body.String(), `"nextDeactivationAt":0`)
+
+	w = selfRequest(t, session.Token, "DELETE", "/api/self/device", map[string]interface{}{"hwid": "unknown_hwid"})
+	assert.Equal(t, 404, w.Code)
+	// parallel deactivations can't both pass the cooldown
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 2)
+	for i, hwid := range []string{"self_hwid_1", "self_hwid_2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = selfRequest(t, session.Token, "DELETE", "/api/self/device", map[string]interface{}{"hwid": hwid})
+		}()
+	}
+	wg.Wait()
+	statuses := []int{responses[0].Code, responses[1].Code}
+	slices.Sort(statuses)
+	assert.Equal(t, []int{200, 429}, statuses)
+	for _, w := range responses {
+		if w.Code == 429 {
+			assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		}
+	}
+
+	w = adminRequest(t, "GET", fmt.Sprintf("/api/audit?user_id=%d&action=device.removed", created.User.Id), nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), fmt.Sprintf(`"actor":"self:%d"`, created.User.Id))
+
+	// too many wrong tries drop the code and lock the license out, also from new codes
+	w = adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+		"max_activations": 1,
+		"expires_at":      time.Now().Add(24 * time.Hour).Unix(),
+		"telegram_id":     6060,
+	})
+	assert.Equal(t, 200, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	licenseKey = created.User.License.Key
+	w = selfRequest(t, "", "POST", "/api/self/code", map[string]interface{}{"license": licenseKey, "channel": "telegram"})
+	assert.Equal(t, 200, w.Code)
+	hooks.DeliverDue(ctx)
+	mu.Lock()
+	code = codes[len(codes)-1]
+	mu.Unlock()
+	assert.Equal(t, created.User.Id, code.UserId)
+	for range 5 {
+		w = selfRequest(t, "", "POST", "/api/self/session", map[string]interface{}{"license": licenseKey, "code": "wrong"})
+		assert.Equal(t, 401, w.Code)
+	}
+	w = selfRequest(t, "", "POST", "/api/self/session", map[string]interface{}{"license": licenseKey, "code": code.Code})
+	assert.Equal(t, 401, w.Code)
+	w = selfRequest(t, "", "POST", "/api/self/code", map[string]interface{}{"license": licenseKey, "channel": "telegram"})
+	assert.Equal(t, 429, w.Code)
+}
+
+func TestListUsers(t *testing.T) {
+	var ids []int
+	for i, expiresIn := range []time.Duration{3 * 24 * time.Hour, 30 * 24 * time.Hour, 5 * 24 * time.Hour} {
+		w := adminRequest(t, "POST", "/api/user/create", map[string]interface{}{
+			"max_activations": 1,
+			"expires_at":      time.Now().Add(expiresIn).Unix(),
+			"telegram_id":     5353 + i,
+		})
+		assert.Equal(t, 200, w.Code)
+		var created struct {
+			User storage.User `json:"user"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		ids = append(ids, created.User.Id)
+	}
+
+	type page struct {
+		Users      []storage.User `json:"users"`
+		NextCursor string         `json:"nextCursor"`
+	}
+	list := func(query string) page {
+		w := adminRequest(t, "GET", "/api/users?"+query, nil)
+		assert.Equal(t, 200, w.Code)
+		var p page
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		return p
+	}
+
+	// walking every page sees each user once, in order
+	var seen []int
+	for p, cursor := list("limit=2&order=desc"), ""; ; p = list("limit=2&order=desc&cursor=" + cursor) {
+		assert.True(t, len(p.Users) <= 2)
+		for _, u := range p.Users {
+			seen = append(seen, u.Id)
+		}
+		if p.NextCursor == "" {
+			break
+		}
+		cursor = p.NextCursor
+	}
+	assert.True(t, slices.IsSortedFunc(seen, func(a, b int) int { return b - a }))
+	assert.Len(t, slices.Compact(slices.Clone(seen)), len(seen))
+	for _, id := range ids {
+		assert.Contains(t, seen, id)
+	}
+
+	// the users expiring within a week, soonest first
+	var expiring []int
+	for _, u := range list("expires_within=604800&sort=expires_at").Users {
+		if slices.Contains(ids, u.Id) {
+			expiring = append(expiring, u.Id)
+		}
+	}
+	assert.Equal(t, []int{ids[0], ids[2]}, expiring)
+
+	p := list("sort=created_at&limit=1")
+	assert.NotEmpty(t, p.NextCursor)
+	w := adminRequest(t, "GET", "/api/users?sort=expires_at&cursor="+p.NextCursor, nil)
+	assert.Equal(t, 400, w.Code)
+	w = adminRequest(t, "GET", "/api/users?cursor=garbage", nil)
+	assert.Equal(t, 400, w.Code)
+	w = adminRequest(t, "GET", "/api/users?sort=name", nil)
+	assert.Equal(t, 400, w.Code)
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/api/middleware"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	apiKeyPrefix = "lk_"
+	// touchInterval limits how often a key's last-used time is written
+	touchInterval = 60
+)
+
+// GenAPIKey returns a new random API key.
+func GenAPIKey() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// HashAPIKey returns the hash API keys are stored and looked up by. The keys
+// are random, so a fast hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyResolver authenticates the API keys managed in store. A key gets the
+// permissions of its role in roles and its own scopes, so changes to the role
+// definitions apply to existing keys. Unknown roles grant nothing.
+func APIKeyResolver(store storage.Store, roles middleware.Roles) middleware.KeyResolver {
+	return func(ctx context.Context, key string) *middleware.Principal {
+		k, err := store.GetAPIKeyByHash(ctx, HashAPIKey(key))
+		if err != nil {
+			logger.Debug(ctx, "failed to get api key", zap.Error(err))
+			return nil
+		}
+
+		now := time.Now().Unix()
+		if k.Expired(now) {
+			logger.Debug(ctx, "api key expired", zap.String("key_id", k.Id))
+			return nil
+		}
+		if now-int64(k.LastUsedAt) >= touchInterval {
+			if err := store.TouchAPIKey(ctx, k.Id, storage.Timestamp(now)); err != nil {
+				logger.Error(ctx, "failed to update api key last use", zap.String("key_id", k.Id), zap.Error(err))
+			}
+		}
+		scopes := append(slices.Clone(roles[k.Role]), k.Scopes...)
+		return &middleware.Principal{Name: "key:" + k.Name, Role: k.Role, Scopes: scopes}
+	}
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/api/middleware"
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RecordAudit appends an audit entry for a mutation made by the request in c.
+// before and after are stored as JSON and left out when nil. A failure is only
+// logged because the mutation has already happened.
+func RecordAudit(c *gin.Context, store storage.Store, action storage.AuditAction, userId int, target string, before, after any) {
+	ctx := c.Request.Context()
+
+	entry := storage.AuditEntry{
+		Time:      storage.Timestamp(time.Now().Unix()),
+		Actor:     middleware.Actor(ctx),
+		RequestId: middleware.RequestID(ctx),
+		Action:    action,
+		UserId:    userId,
+		Target:    target,
+		Before:    auditValue(before),
+		After:     auditValue(after),
+	}
+	if err := store.AppendAudit(ctx, entry); err != nil {
+		logger.Error(ctx, "failed to record audit entry", zap.String("action", string(action)), zap.Error(err))
+	}
+}
+
+// RecordRenewal appends r to the renewal history with the time, actor and
+// request id of c. Like RecordAudit it only logs a failure.
+func RecordRenewal(c *gin.Context, store storage.Store, r storage.Renewal) {
+	ctx := c.Request.Context()
+
+	r.Time = storage.Timestamp(time.Now().Unix())
+	r.Actor = middleware.Actor(ctx)
+	r.RequestId = middleware.RequestID(ctx)
+	if err := store.AppendRenewal(ctx, r); err != nil {
+		logger.Error(ctx, "failed to record renewal", zap.String("license", r.LicenseKey), zap.Error(err))
+	}
+}
+
+func auditValue(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	// the values are plain structs and maps, they always marshal
+	raw, _ := json.Marshal(v)
+	if string(raw) == "null" {
+		// a nil pointer or map inside the interface
+		return nil
+	}
+	return raw
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// StorageErrResponse logs err with msg and writes the response for an error
+// returned by the store. Errors the caller can act on keep their meaning,
+// everything else is an internal server error. Expected errors like a missing
+// user are logged at debug level only.
+func StorageErrResponse(c *gin.Context, msg string, err error) {
+	ctx := c.Request.Context()
+
+	status, code, text, details := storageError(err)
+	if status == http.StatusInternalServerError {
+		logger.Error(ctx, msg, zap.Error(err))
+	} else {
+		logger.Debug(ctx, msg, zap.Error(err))
+	}
+	ErrDetailsResponse(c, status, code, text, details)
+}
+
+func storageError(err error) (status int, code, msg string, details map[string]any) {
+	if record, ok := storage.NotFoundRecord(err); ok {
+		return http.StatusNotFound, licenseclient.CodeNotFound, record + " not found", map[string]any{"record": record}
+	}
+	switch {
+	case errors.Is(err, storage.ErrActivationLimit):
+		return http.StatusConflict, licenseclient.CodeDeviceLimit, "device limit reached", nil
+	case errors.Is(err, storage.ErrSeatLimit):
+		return http.StatusConflict, licenseclient.CodeSeatLimit, "every seat is leased", nil
+	case errors.Is(err, storage.ErrNoChange):
+		return http.StatusConflict, licenseclient.CodeNoChange, "nothing was changed", nil
+	case errors.Is(err, storage.ErrDuplicate):
+		return http.StatusConflict, licenseclient.CodeConflict, "conflicts with an existing record", nil
+	default:
+		return http.StatusInternalServerError, licenseclient.CodeInternal, "internal server error", nil
+	}
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"net/http"
 
+	"github.com/dzhisl/license-api/internal/api/middleware"
+	"github.com/dzhisl/license-api/pkg/licenseclient"
 	"github.com/gin-gonic/gin"
 )
 
@@ -10,14 +12,25 @@ func FormResponse(msg string) (int, gin.H) {
 	return 200, gin.H{"message": msg}
 }
 
-func FormErrResponse(status int, err string) (int, gin.H) {
-	return status, gin.H{"error": err}
+// ErrResponse writes an error response with a code from licenseclient.
+func ErrResponse(c *gin.Context, status int, code, msg string) {
+	middleware.AbortWithError(c, status, code, msg)
 }
 
-func FormInvalidRequestResponse() (int, gin.H) {
-	return FormErrResponse(http.StatusBadRequest, "invalid request")
+// ErrDetailsResponse is like ErrResponse with details for the code.
+func ErrDetailsResponse(c *gin.Context, status int, code, msg string, details map[string]any) {
+	middleware.AbortWithErrorDetails(c, status, code, msg, details)
 }
 
-func FormInternalErrResponse() (int, gin.H) {
-	return FormErrResponse(http.StatusInternalServerError, "internal server error")
+// BadRequestResponse rejects a request with an invalid parameter described by msg.
+func BadRequestResponse(c *gin.Context, msg string) {
+	ErrResponse(c, http.StatusBadRequest, licenseclient.CodeInvalidRequest, msg)
+}
+
+func InvalidRequestResponse(c *gin.Context) {
+	BadRequestResponse(c, "invalid request")
+}
+
+func InternalErrResponse(c *gin.Context) {
+	ErrResponse(c, http.StatusInternalServerError, licenseclient.CodeInternal, "internal server error")
 }
@@ -0,0 +1,216 @@
+package expiry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// Actor is the actor of the audit entries written by the worker.
+	Actor = "system:expiry"
+	// DefaultInterval is how often the licenses are checked if no interval is configured.
+	DefaultInterval = time.Minute
+
+	leaseName = "expiry"
+)
+
+// DefaultWindows are the warning windows used when none are configured.
+var DefaultWindows = []time.Duration{7 * 24 * time.Hour, 24 * time.Hour}
+
+// Worker marks licenses past their expiry as storage.Expired and warns about
+// licenses that are about to expire. It also reclaims the expired seat leases
+// of floating licenses. Every replica of the server can run one:
+// a lease in the store lets a single worker do the work at a time, and
+// expiring a license and recording a warning are atomic, so a worker that
+// lost its lease mid-run doesn't send anything twice.
+type Worker struct {
+	store    storage.Store
+	hooks    *webhook.Dispatcher
+	windows  []time.Duration
+	interval time.Duration
+	// gracePeriod is the grace period of licenses without their own, in seconds
+	gracePeriod int64
+	holder      string
+	now         func() time.Time
+}
+
+// NewWorker creates a worker that checks the licenses every interval
+// (DefaultInterval if it is 0) and publishes license.expiring once per
+// window before a license expires, DefaultWindows if windows is empty.
+// Call Run to start it.
+func NewWorker(store storage.Store, hooks *webhook.Dispatcher, windows []time.Duration, interval time.Duration) *Worker {
+	if len(windows) == 0 {
+		windows = DefaultWindows
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	// shortest window first, a license gets the warning of the shortest window it entered
+	windows = slices.Clone(windows)
+	slices.Sort(windows)
+
+	return &Worker{
+		store:    store,
+		hooks:    hooks,
+		windows:  windows,
+		interval: interval,
+		holder:   randomHex(8),
+		now:      time.Now,
+	}
+}
+
+// WithGracePeriod makes the worker wait for the grace period after expiry,
+// d unless a license has its own, before it marks a license as expired.
+func (w *Worker) WithGracePeriod(d time.Duration) *Worker {
+	w.gracePeriod = int64(d.Seconds())
+	return w
+}
+
+// Run checks the licenses every interval until ctx is done.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce reclaims expired seats, expires the licenses past their expiry and
+// sends the due warnings, unless another worker holds the lease.
+func (w *Worker) RunOnce(ctx context.Context) {
+	now := w.now()
+
+	// the lease outlives the next run, so the holder keeps it while it is alive
+	until := storage.Timestamp(now.Add(2 * w.interval).Unix())
+	held, err := w.store.AcquireLease(ctx, leaseName, w.holder, until, storage.Timestamp(now.Unix()))
+	if err != nil {
+		logger.Error(ctx, "failed to acquire expiry lease", zap.Error(err))
+		return
+	}
+	if !held {
+		return
+	}
+
+	// checkouts reclaim the seats of their license too, this frees the others
+	if err := w.store.ReclaimSeats(ctx, storage.Timestamp(now.Unix())); err != nil {
+		logger.Error(ctx, "failed to reclaim seats", zap.Error(err))
+	}
+
+	horizon := now.Add(w.windows[len(w.windows)-1])
+	users, err := w.store.ExpiringUsers(ctx, storage.Timestamp(horizon.Unix()))
+	if err != nil {
+		logger.Error(ctx, "failed to get expiring users", zap.Error(err))
+		return
+	}
+	for _, user := range users {
+		for _, l := range user.AllLicenses() {
+			if l.Status != storage.Active || l.ExpiresAt == 0 || int64(l.ExpiresAt) > horizon.Unix() {
+				continue
+			}
+			ref := storage.LicenseRef{UserId: user.Id}
+			if l.Key != user.License.Key {
+				ref.ProductId = l.ProductId
+			}
+			if l.Expired(now.Unix()) {
+				if !l.InGrace(now.Unix(), w.gracePeriod) {
+					w.expire(ctx, ref, now)
+				}
+			} else {
+				w.warn(ctx, user, ref, l, now)
+			}
+		}
+	}
+}
+
+// expire marks the license as expired, records it and publishes license.expired.
+func (w *Worker) expire(ctx context.Context, ref storage.LicenseRef, now time.Time) {
+	err := w.store.ExpireLicense(ctx, ref, storage.Timestamp(now.Unix()))
+	if errors.Is(err, storage.ErrNoChange) || errors.Is(err, storage.ErrNotFound) {
+		// renewed, changed or deleted since it was read
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "failed to expire license", zap.Int("user_id", ref.UserId), zap.Error(err))
+		return
+	}
+
+	before, _ := json.Marshal(map[string]any{"status": storage.Active})
+	after, _ := json.Marshal(map[string]any{"status": storage.Expired})
+	err = w.store.AppendAudit(ctx, storage.AuditEntry{
+		Time:   storage.Timestamp(now.Unix()),
+		Actor:  Actor,
+		Action: storage.AuditLicenseStatusChanged,
+		UserId: ref.UserId,
+		Target: ref.ProductId,
+		Before: before,
+		After:  after,
+	})
+	if err != nil {
+		logger.Error(ctx, "failed to record audit entry", zap.String("action", string(storage.AuditLicenseStatusChanged)), zap.Error(err))
+	}
+
+	user, err := w.store.GetUser(ctx, storage.GetUserParams{UserId: ref.UserId})
+	if err != nil {
+		logger.Error(ctx, "failed to get expired user", zap.Int("user_id", ref.UserId), zap.Error(err))
+		return
+	}
+	w.publish(ctx, webhook.EventLicenseExpired, webhook.UserData{User: user, Product: ref.ProductId})
+}
+
+// warn publishes license.expiring for the shortest window the license
+// has entered, once per window and expiry.
+func (w *Worker) warn(ctx context.Context, user *storage.User, ref storage.LicenseRef, l storage.License, now time.Time) {
+	remaining := time.Duration(int64(l.ExpiresAt)-now.Unix()) * time.Second
+	i := slices.IndexFunc(w.windows, func(window time.Duration) bool { return remaining <= window })
+	if i < 0 {
+		return
+	}
+	window := w.windows[i]
+
+	// a renewal changes the expiry, so the renewed license is warned again
+	noticeId := fmt.Sprintf("%s:%s:%d:%d", webhook.EventLicenseExpiring, l.Key, l.ExpiresAt, int64(window.Seconds()))
+	err := w.store.RecordNotice(ctx, noticeId, storage.Timestamp(now.Unix()))
+	if errors.Is(err, storage.ErrDuplicate) {
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "failed to record expiry notice", zap.String("notice_id", noticeId), zap.Error(err))
+		return
+	}
+
+	w.publish(ctx, webhook.EventLicenseExpiring, webhook.LicenseExpiringData{
+		UserData:  webhook.UserData{User: user, Product: ref.ProductId},
+		ExpiresAt: l.ExpiresAt,
+		Window:    int64(window.Seconds()),
+	})
+}
+
+// publish sends a webhook event, a failure is only logged like in the handlers.
+func (w *Worker) publish(ctx context.Context, event string, data any) {
+	if err := w.hooks.Publish(ctx, event, data); err != nil {
+		logger.Error(ctx, "failed to publish webhook event", zap.String("event", event), zap.Error(err))
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,146 @@
+package expiry
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/internal/webhook"
+	"github.com/dzhisl/license-api/pkg/config"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/test-go/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	config.InitConfig()
+	logger.InitLogger()
+
+	code := m.Run()
+	os.Exit(code)
+}
+
+// queuedEvents returns the types of the pending webhook deliveries, oldest first.
+func queuedEvents(t *testing.T, store storage.Store) []string {
+	t.Helper()
+	deliveries, err := store.DueDeliveries(context.Background(), storage.Timestamp(time.Now().Add(time.Hour).Unix()), 0)
+	assert.NoError(t, err)
+	var events []string
+	for _, d := range deliveries {
+		events = append(events, d.Event)
+	}
+	return events
+}
+
+func TestWorker(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	assert.NoError(t, store.CreateWebhook(ctx, webhook.NewWebhook("http://127.0.0.1:1", nil)))
+
+	now := time.Unix(1_000_000, 0)
+	day := int64(24 * 60 * 60)
+	users := []storage.User{
+		{Id: 1, License: storage.License{Key: "expired", ExpiresAt: storage.Timestamp(now.Unix() - 1), Status: storage.Active}},
+		{Id: 2, License: storage.License{Key: "in-a-week", ExpiresAt: storage.Timestamp(now.Unix() + 5*day), Status: storage.Active}},
+		{Id: 3, License: storage.License{Key: "lifetime", Status: storage.Active},
+			Licenses: []storage.License{{Key: "tomorrow", ProductId: "pro", ExpiresAt: storage.Timestamp(now.Unix() + day/2), Status: storage.Active}}},
+		{Id: 4, License: storage.License{Key: "later", ExpiresAt: storage.Timestamp(now.Unix() + 30*day), Status: storage.Active}},
+	}
+	for _, u := range users {
+		assert.NoError(t, store.CreateUser(ctx, u))
+	}
+
+	hooks := webhook.NewDispatcher(store)
+	w := NewWorker(store, hooks, nil, time.Minute)
+	w.now = func() time.Time { return now }
+	w.RunOnce(ctx)
+
+	assert.Equal(t, []string{webhook.EventLicenseExpired, webhook.EventLicenseExpiring, webhook.EventLicenseExpiring}, queuedEvents(t, store))
+	deliveries, err := store.DueDeliveries(ctx, storage.Timestamp(time.Now().Add(time.Hour).Unix()), 0)
+	assert.NoError(t, err)
+	var event struct {
+		Data webhook.LicenseExpiringData `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(deliveries[2].Payload, &event))
+	assert.Equal(t, "pro", event.Data.Product)
+	assert.Equal(t, day, event.Data.Window)
+
+	u, err := store.GetUser(ctx, storage.GetUserParams{UserId: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Expired, u.License.Status)
+	entries, err := store.ListAudit(ctx, storage.AuditFilter{UserId: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, Actor, entries[0].Actor)
+		assert.Equal(t, storage.AuditLicenseStatusChanged, entries[0].Action)
+	}
+
+	// another replica waits for the lease
+	other := NewWorker(store, hooks, nil, time.Minute)
+	other.now = w.now
+	assert.NoError(t, store.ChangeLicenseStatus(ctx, storage.LicenseRef{UserId: 1}, storage.Active))
+	other.RunOnce(ctx)
+	assert.Len(t, queuedEvents(t, store), 3)
+	assert.NoError(t, store.ChangeLicenseStatus(ctx, storage.LicenseRef{UserId: 1}, storage.Frozen))
+
+	// nothing is sent twice, the license of user 2 enters the one day window later
+	w.RunOnce(ctx)
+	assert.Len(t, queuedEvents(t, store), 3)
+	now = now.Add(time.Duration(4*day+1) * time.Second)
+	w.RunOnce(ctx)
+	assert.Equal(t, []string{webhook.EventLicenseExpiring, webhook.EventLicenseExpired}, queuedEvents(t, store)[3:])
+}
+
+func TestWorkerGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+
+	now := time.Unix(1_000_000, 0)
+	users := []storage.User{
+		{Id: 1, License: storage.License{Key: "default-grace", ExpiresAt: storage.Timestamp(now.Unix() - 60), Status: storage.Active}},
+		{Id: 2, License: storage.License{Key: "no-grace", ExpiresAt: storage.Timestamp(now.Unix() - 60), Status: storage.Active,
+			GracePeriod: new(int64)}},
+	}
+	for _, u := range users {
+		assert.NoError(t, store.CreateUser(ctx, u))
+	}
+
+	w := NewWorker(store, webhook.NewDispatcher(store), nil, time.Minute).WithGracePeriod(time.Hour)
+	w.now = func() time.Time { return now }
+	w.RunOnce(ctx)
+
+	status := func(userId int) storage.LicenseStatus {
+		u, err := store.GetUser(ctx, storage.GetUserParams{UserId: userId})
+		assert.NoError(t, err)
+		return u.License.Status
+	}
+	assert.Equal(t, storage.Active, status(1))
+	assert.Equal(t, storage.Expired, status(2))
+
+	now = now.Add(time.Hour)
+	w.RunOnce(ctx)
+	assert.Equal(t, storage.Expired, status(1))
+}
+
+func TestWorkerReclaimsSeats(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+
+	now := time.Unix(1_000_000, 0)
+	seats := []storage.Seat{
+		{Id: "expired", Hwid: "hwid-1", ExpiresAt: storage.Timestamp(now.Unix() - 1)},
+		{Id: "live", Hwid: "hwid-2", ExpiresAt: storage.Timestamp(now.Unix() + 60)},
+	}
+	assert.NoError(t, store.CreateUser(ctx, storage.User{Id: 1, License: storage.License{Key: "floating",
+		Mode: storage.Floating, MaxActivations: 2, Status: storage.Active, Seats: seats}}))
+
+	w := NewWorker(store, webhook.NewDispatcher(store), nil, time.Minute)
+	w.now = func() time.Time { return now }
+	w.RunOnce(ctx)
+
+	u, err := store.GetUser(ctx, storage.GetUserParams{UserId: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, seats[1:], u.License.Seats)
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Entitlements maps the features a license grants to an optional numeric quota
+// (nil for plain features). In JSON they are encoded like in the signed
+// payloads, true for plain features and numbers for quotas, so the type
+// converts to licenseclient.Entitlements as is.
+type Entitlements map[string]*int64
+
+// Has reports whether the entitlement is granted.
+func (e Entitlements) Has(name string) bool {
+	_, ok := e[name]
+	return ok
+}
+
+func (e Entitlements) MarshalJSON() ([]byte, error) {
+	if e == nil {
+		return []byte("null"), nil
+	}
+	m := make(map[string]any, len(e))
+	for name, quota := range e {
+		if quota == nil {
+			m[name] = true
+		} else {
+			m[name] = *quota
+		}
+	}
+	return json.Marshal(m)
+}
+
+func (e *Entitlements) UnmarshalJSON(data []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if m == nil {
+		*e = nil
+		return nil
+	}
+
+	out := make(Entitlements, len(m))
+	for name, raw := range m {
+		if string(raw) == "true" {
+			out[name] = nil
+			continue
+		}
+		var quota int64
+		if err := json.Unmarshal(raw, &quota); err != nil {
+			return fmt.Errorf("entitlement %s must be true or an integer quota", name)
+		}
+		out[name] = &quota
+	}
+	*e = out
+	return nil
+}
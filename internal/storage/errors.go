@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrNotFound matches every "record wasn't found" error of the stores,
+// errors.Is(err, ErrUserNotFound) narrows it down to a record type.
+var ErrNotFound = errors.New("record wasn't found")
+
+var (
+	ErrUserNotFound     = notFoundError("user")
+	ErrLicenseNotFound  = notFoundError("license")
+	ErrProductNotFound  = notFoundError("product")
+	ErrPlanNotFound     = notFoundError("plan")
+	ErrWebhookNotFound  = notFoundError("webhook")
+	ErrDeliveryNotFound = notFoundError("delivery")
+	ErrAPIKeyNotFound   = notFoundError("api key")
+	// ErrSeatNotFound is returned for a seat lease that expired or was released
+	ErrSeatNotFound = notFoundError("seat")
+)
+
+var (
+	// ErrActivationLimit is returned by AddHwidSession when the license has
+	// no free device slot left.
+	ErrActivationLimit = errors.New("user have maximum allowed activations")
+	// ErrSeatLimit is returned by CheckoutSeat when every seat of the
+	// floating license is leased.
+	ErrSeatLimit = errors.New("every seat of the license is leased")
+	// ErrNoChange is returned by updates that left the record as it was or
+	// whose condition didn't match it. A missing record is a not found error.
+	ErrNoChange = errors.New("no rows affected")
+	// ErrDuplicate is returned when a unique field such as an id, a license
+	// key or an account binding is already taken.
+	ErrDuplicate = errors.New("duplicate key error")
+)
+
+// ErrDuplicateUserId is returned by CreateUser when the id is already taken.
+var ErrDuplicateUserId = fmt.Errorf("%w: user id is already taken", ErrDuplicate)
+
+// notFoundError names the record type that wasn't found.
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return "record for " + string(e) + " wasn't found"
+}
+
+func (e notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// NotFoundRecord returns the record type of a not found error, like "user".
+func NotFoundRecord(err error) (string, bool) {
+	var nf notFoundError
+	if errors.As(err, &nf) {
+		return string(nf), true
+	}
+	return "", false
+}
+
+// duplicateError wraps unique index violations of the Mongo and SQL backends
+// into ErrDuplicate and returns other errors unchanged.
+func duplicateError(err error) error {
+	if err == nil || errors.Is(err, ErrDuplicate) {
+		return err
+	}
+	msg := err.Error()
+	if mongo.IsDuplicateKeyError(err) ||
+		strings.Contains(msg, "UNIQUE constraint failed") ||
+		strings.Contains(msg, "duplicate key value violates unique constraint") {
+		return fmt.Errorf("%w: %s", ErrDuplicate, msg)
+	}
+	return err
+}
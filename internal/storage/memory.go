@@ -0,0 +1,1015 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a thread-safe in-memory implementation of Store.
+// It is meant for tests and local development; nothing is persisted.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	users    map[int]User
+	products map[string]Product
+	plans    map[string]Plan
+	audit    []AuditEntry
+	renewals []Renewal
+	webhooks map[string]Webhook
+	// deliveries are kept in the order they were enqueued
+	deliveries []WebhookDelivery
+	apiKeys    map[string]APIKey
+	leases     map[string]memoryLease
+	notices    map[string]Timestamp
+	trials     []TrialClaim
+}
+
+type memoryLease struct {
+	holder    string
+	expiresAt Timestamp
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:    make(map[int]User),
+		products: make(map[string]Product),
+		plans:    make(map[string]Plan),
+		webhooks: make(map[string]Webhook),
+		apiKeys:  make(map[string]APIKey),
+		leases:   make(map[string]memoryLease),
+		notices:  make(map[string]Timestamp),
+	}
+}
+
+// cloneUser returns a copy of u that shares no slices with the stored record.
+func cloneUser(u User) User {
+	u.License = cloneLicense(u.License)
+	if u.Licenses != nil {
+		licenses := make([]License, len(u.Licenses))
+		for i, l := range u.Licenses {
+			licenses[i] = cloneLicense(l)
+		}
+		u.Licenses = licenses
+	}
+	return u
+}
+
+func cloneLicense(l License) License {
+	l.Devices = slices.Clone(l.Devices)
+	l.Seats = slices.Clone(l.Seats)
+	if l.GracePeriod != nil {
+		grace := *l.GracePeriod
+		l.GracePeriod = &grace
+	}
+	if l.Entitlements != nil {
+		entitlements := make(Entitlements, len(l.Entitlements))
+		for name, quota := range l.Entitlements {
+			if quota != nil {
+				q := *quota
+				quota = &q
+			}
+			entitlements[name] = quota
+		}
+		l.Entitlements = entitlements
+	}
+	return l
+}
+
+// sortedIds returns user ids in ascending order so lookups are deterministic.
+func (m *MemoryStore) sortedIds() []int {
+	ids := make([]int, 0, len(m.users))
+	for id := range m.users {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// update applies fn to the referenced license. It returns ErrUserNotFound or
+// ErrLicenseNotFound when it is missing and reports "no rows affected" when
+// fn didn't change anything, like Mongo's ModifiedCount.
+func (m *MemoryStore) update(ref LicenseRef, fn func(l *License) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, l, err := m.lockedLicense(ref)
+	if err != nil {
+		return err
+	}
+	if !fn(l) {
+		return ErrNoChange
+	}
+	m.users[ref.UserId] = *u
+	return nil
+}
+
+// updateUser is like update for fields of the user itself.
+func (m *MemoryStore) updateUser(userId int, fn func(u *User) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[userId]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u = cloneUser(u)
+	if !fn(&u) {
+		return ErrNoChange
+	}
+	if err := m.lockedConflict(u); err != nil {
+		return err
+	}
+	m.users[userId] = u
+	return nil
+}
+
+// lockedConflict returns a duplicate key error if another user has the Telegram
+// or Discord id or one of the license keys of u, like the unique indexes of the
+// other backends. The caller must hold m.mu.
+func (m *MemoryStore) lockedConflict(u User) error {
+	for _, other := range m.users {
+		switch {
+		case other.Id == u.Id:
+		case u.TelegramId != 0 && other.TelegramId == u.TelegramId:
+			return fmt.Errorf("%w: telegram id %d is bound to user %d", ErrDuplicate, u.TelegramId, other.Id)
+		case u.DiscordId != 0 && other.DiscordId == u.DiscordId:
+			return fmt.Errorf("%w: discord id %d is bound to user %d", ErrDuplicate, u.DiscordId, other.Id)
+		default:
+			for _, l := range u.AllLicenses() {
+				if other.LicenseByKey(l.Key) != nil {
+					return fmt.Errorf("%w: license key %s belongs to user %d", ErrDuplicate, l.Key, other.Id)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// lockedLicense returns a copy of the stored user and the referenced license in it.
+// The caller must hold m.mu.
+func (m *MemoryStore) lockedLicense(ref LicenseRef) (*User, *License, error) {
+	u, ok := m.users[ref.UserId]
+	if !ok {
+		return nil, nil, ErrUserNotFound
+	}
+	u = cloneUser(u)
+	l := u.FindLicense(ref.ProductId)
+	if l == nil {
+		return nil, nil, ErrLicenseNotFound
+	}
+	return &u, l, nil
+}
+
+func (m *MemoryStore) CreateUser(ctx context.Context, u User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[u.Id]; ok {
+		return fmt.Errorf("%w: %d", ErrDuplicateUserId, u.Id)
+	}
+	if err := m.lockedConflict(u); err != nil {
+		return err
+	}
+	m.users[u.Id] = cloneUser(u)
+	return nil
+}
+
+func (m *MemoryStore) DeleteUser(ctx context.Context, userId int) (deletedCount int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userId]; !ok {
+		return 0, nil
+	}
+	delete(m.users, userId)
+	return 1, nil
+}
+
+func (m *MemoryStore) GetUser(ctx context.Context, params GetUserParams) (user *User, err error) {
+	var match func(u User) bool
+
+	switch {
+	case params.UserId != 0:
+		match = func(u User) bool { return u.Id == params.UserId }
+	case params.TelegramId != 0:
+		match = func(u User) bool { return u.TelegramId == params.TelegramId }
+	case params.DiscordId != 0:
+		match = func(u User) bool { return u.DiscordId == params.DiscordId }
+	case params.License != "":
+		match = func(u User) bool { return u.LicenseByKey(params.License) != nil }
+	default:
+		return nil, fmt.Errorf("at least one param must be provided")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, id := range m.sortedIds() {
+		if u := m.users[id]; match(u) {
+			u = cloneUser(u)
+			return &u, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (m *MemoryStore) GetAllUsers(ctx context.Context) (user []*User, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]*User, 0, len(m.users))
+	for _, id := range m.sortedIds() {
+		u := cloneUser(m.users[id])
+		users = append(users, &u)
+	}
+	return users, nil
+}
+
+func (m *MemoryStore) ListUsers(ctx context.Context, filter UserFilter) ([]*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var users []*User
+	for _, u := range m.users {
+		if !filter.Match(&u) {
+			continue
+		}
+		if filter.After != nil && !cursorBefore(*filter.After, filter.Cursor(&u), filter.Desc) {
+			continue
+		}
+		u = cloneUser(u)
+		users = append(users, &u)
+	}
+	slices.SortFunc(users, func(a, b *User) int {
+		ca, cb := filter.Cursor(a), filter.Cursor(b)
+		order := cmp.Or(cmp.Compare(ca.Value, cb.Value), cmp.Compare(ca.Id, cb.Id))
+		if filter.Desc {
+			return -order
+		}
+		return order
+	})
+	if filter.Limit > 0 && len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+	return users, nil
+}
+
+// cursorBefore reports whether position a comes before b in the given direction.
+func cursorBefore(a, b UserCursor, desc bool) bool {
+	order := cmp.Or(cmp.Compare(a.Value, b.Value), cmp.Compare(a.Id, b.Id))
+	if desc {
+		return order > 0
+	}
+	return order < 0
+}
+
+func (m *MemoryStore) AddLicense(ctx context.Context, userId int, license License) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[userId]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if err := checkNewLicense(&u, license); err != nil {
+		return err
+	}
+	u = cloneUser(u)
+	u.Licenses = append(u.Licenses, cloneLicense(license))
+	if err := m.lockedConflict(u); err != nil {
+		return err
+	}
+	m.users[userId] = u
+	return nil
+}
+
+func (m *MemoryStore) AddHwidSession(ctx context.Context, ref LicenseRef, hwid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, l, err := m.lockedLicense(ref)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(l.Devices, hwid) {
+		return ErrNoChange
+	}
+	if len(l.Devices) >= l.MaxActivations {
+		return fmt.Errorf("%w: %d", ErrActivationLimit, l.MaxActivations)
+	}
+
+	l.Devices = append(l.Devices, hwid)
+	m.users[ref.UserId] = *u
+	return nil
+}
+
+func (m *MemoryStore) DeleteHwidSession(ctx context.Context, ref LicenseRef, hwid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, l, err := m.lockedLicense(ref)
+	if err != nil {
+		return err
+	}
+
+	var newHwidSessions []string
+	for _, session := range l.Devices {
+		if session != hwid {
+			newHwidSessions = append(newHwidSessions, session)
+		}
+	}
+	if len(newHwidSessions) == len(l.Devices) {
+		return ErrNoChange
+	}
+
+	l.Devices = newHwidSessions
+	m.users[ref.UserId] = *u
+	return nil
+}
+
+func (m *MemoryStore) ResetHwidSessions(ctx context.Context, ref LicenseRef) error {
+	return m.update(ref, func(l *License) bool {
+		if l.Devices == nil {
+			return false
+		}
+		l.Devices = nil
+		return true
+	})
+}
+
+func (m *MemoryStore) CheckoutSeat(ctx context.Context, ref LicenseRef, seat Seat, now Timestamp) (Seat, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, l, err := m.lockedLicense(ref)
+	if err != nil {
+		return Seat{}, err
+	}
+	reclaimSeats(l, now)
+	if held := l.HeldSeat(seat.Hwid, int64(now)); held != nil {
+		held.ExpiresAt = seat.ExpiresAt
+		seat = *held
+	} else {
+		if len(l.Seats) >= l.MaxActivations {
+			return Seat{}, fmt.Errorf("%w: %d", ErrSeatLimit, l.MaxActivations)
+		}
+		l.Seats = append(l.Seats, seat)
+	}
+	m.users[ref.UserId] = *u
+	return seat, nil
+}
+
+func (m *MemoryStore) HeartbeatSeat(ctx context.Context, ref LicenseRef, seatId string, until, now Timestamp) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, l, err := m.lockedLicense(ref)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(l.Seats, func(s Seat) bool { return s.Id == seatId && s.ExpiresAt > now })
+	if i < 0 {
+		return ErrSeatNotFound
+	}
+	l.Seats[i].ExpiresAt = until
+	m.users[ref.UserId] = *u
+	return nil
+}
+
+func (m *MemoryStore) ReleaseSeat(ctx context.Context, ref LicenseRef, seatId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, l, err := m.lockedLicense(ref)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(l.Seats, func(s Seat) bool { return s.Id == seatId })
+	if i < 0 {
+		return ErrSeatNotFound
+	}
+	l.Seats = slices.Delete(l.Seats, i, i+1)
+	if len(l.Seats) == 0 {
+		l.Seats = nil
+	}
+	m.users[ref.UserId] = *u
+	return nil
+}
+
+func (m *MemoryStore) ReclaimSeats(ctx context.Context, now Timestamp) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, u := range m.users {
+		u = cloneUser(u)
+		reclaimSeats(&u.License, now)
+		for i := range u.Licenses {
+			reclaimSeats(&u.Licenses[i], now)
+		}
+		m.users[id] = u
+	}
+	return nil
+}
+
+// reclaimSeats drops the leases of l that expired at now.
+func reclaimSeats(l *License, now Timestamp) {
+	l.Seats = slices.DeleteFunc(l.Seats, func(s Seat) bool { return s.ExpiresAt <= now })
+	if len(l.Seats) == 0 {
+		l.Seats = nil
+	}
+}
+
+func (m *MemoryStore) ChangeLicenseStatus(ctx context.Context, ref LicenseRef, status LicenseStatus) error {
+	return m.update(ref, func(l *License) bool {
+		if l.Status == status {
+			return false
+		}
+		l.Status = status
+		return true
+	})
+}
+
+func (m *MemoryStore) UpdateLicense(ctx context.Context, ref LicenseRef, license License) error {
+	return m.update(ref, func(l *License) bool {
+		license = cloneLicense(license)
+		license.ProductId = l.ProductId
+		if licensesEqual(*l, license) {
+			return false
+		}
+		*l = license
+		return true
+	})
+}
+
+func (m *MemoryStore) UpdateHwidLimit(ctx context.Context, ref LicenseRef, newLimit int) error {
+	return m.update(ref, func(l *License) bool {
+		if l.MaxActivations == newLimit {
+			return false
+		}
+		l.MaxActivations = newLimit
+		return true
+	})
+}
+
+func (m *MemoryStore) RenewLicense(ctx context.Context, ref LicenseRef, expiresAt Timestamp) error {
+	return m.update(ref, func(l *License) bool {
+		if l.ExpiresAt == expiresAt {
+			return false
+		}
+		l.ExpiresAt = expiresAt
+		return true
+	})
+}
+
+func (m *MemoryStore) ExtendLicense(ctx context.Context, ref LicenseRef, seconds int64, now Timestamp) (previous, expiresAt Timestamp, err error) {
+	err = m.update(ref, func(l *License) bool {
+		if l.ExpiresAt == 0 {
+			return false
+		}
+		previous = l.ExpiresAt
+		l.ExpiresAt = l.ExtendedExpiry(seconds, int64(now))
+		expiresAt = l.ExpiresAt
+		return true
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return previous, expiresAt, nil
+}
+
+func (m *MemoryStore) SetGracePeriod(ctx context.Context, ref LicenseRef, gracePeriod *int64) error {
+	return m.update(ref, func(l *License) bool {
+		if optionalEqual(l.GracePeriod, gracePeriod) {
+			return false
+		}
+		if gracePeriod != nil {
+			grace := *gracePeriod
+			gracePeriod = &grace
+		}
+		l.GracePeriod = gracePeriod
+		return true
+	})
+}
+
+func (m *MemoryStore) ExpiringUsers(ctx context.Context, before Timestamp) ([]*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var users []*User
+	for _, id := range m.sortedIds() {
+		u := m.users[id]
+		for _, l := range u.AllLicenses() {
+			if l.Status == Active && l.ExpiresAt != 0 && l.ExpiresAt <= before {
+				u = cloneUser(u)
+				users = append(users, &u)
+				break
+			}
+		}
+	}
+	return users, nil
+}
+
+func (m *MemoryStore) ExpireLicense(ctx context.Context, ref LicenseRef, now Timestamp) error {
+	return m.update(ref, func(l *License) bool {
+		if l.Status != Active || !l.Expired(int64(now)) {
+			return false
+		}
+		l.Status = Expired
+		return true
+	})
+}
+
+func (m *MemoryStore) ConvertTrial(ctx context.Context, ref LicenseRef, terms License) error {
+	return m.update(ref, func(l *License) bool {
+		if l.Type != Trial {
+			return false
+		}
+		terms = cloneLicense(terms)
+		l.Type = ""
+		l.PlanId = terms.PlanId
+		l.MaxActivations = terms.MaxActivations
+		l.ExpiresAt = terms.ExpiresAt
+		l.Status = Active
+		l.Entitlements = terms.Entitlements
+		l.GracePeriod = terms.GracePeriod
+		return true
+	})
+}
+
+func (m *MemoryStore) ClaimTrial(ctx context.Context, claim TrialClaim) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.trials {
+		if t.LicenseKey == claim.LicenseKey || t.Hwid == claim.Hwid ||
+			(claim.TelegramId != 0 && t.TelegramId == claim.TelegramId) ||
+			(claim.DiscordId != 0 && t.DiscordId == claim.DiscordId) {
+			return fmt.Errorf("%w: trial was already claimed", ErrDuplicate)
+		}
+	}
+	m.trials = append(m.trials, claim)
+	return nil
+}
+
+func (m *MemoryStore) GrantEntitlement(ctx context.Context, ref LicenseRef, name string, quota *int64) error {
+	return m.update(ref, func(l *License) bool {
+		if current, ok := l.Entitlements[name]; ok && optionalEqual(current, quota) {
+			return false
+		}
+		if l.Entitlements == nil {
+			l.Entitlements = make(Entitlements)
+		}
+		if quota != nil {
+			q := *quota
+			quota = &q
+		}
+		l.Entitlements[name] = quota
+		return true
+	})
+}
+
+func (m *MemoryStore) RevokeEntitlement(ctx context.Context, ref LicenseRef, name string) error {
+	return m.update(ref, func(l *License) bool {
+		if !l.Entitlements.Has(name) {
+			return false
+		}
+		delete(l.Entitlements, name)
+		if len(l.Entitlements) == 0 {
+			l.Entitlements = nil
+		}
+		return true
+	})
+}
+
+func (m *MemoryStore) BindDiscord(ctx context.Context, userId, discordId int) error {
+	return m.updateUser(userId, func(u *User) bool {
+		if u.DiscordId == discordId {
+			return false
+		}
+		u.DiscordId = discordId
+		return true
+	})
+}
+
+func (m *MemoryStore) BindTelegram(ctx context.Context, userId, telegramId int) error {
+	return m.updateUser(userId, func(u *User) bool {
+		if u.TelegramId == telegramId {
+			return false
+		}
+		u.TelegramId = telegramId
+		return true
+	})
+}
+
+func (m *MemoryStore) CreateProduct(ctx context.Context, p Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.products[p.Id]; ok {
+		return fmt.Errorf("%w: product %s already exists", ErrDuplicate, p.Id)
+	}
+	m.products[p.Id] = p
+	return nil
+}
+
+func (m *MemoryStore) GetProduct(ctx context.Context, productId string) (*Product, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.products[productId]
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+	return &p, nil
+}
+
+func (m *MemoryStore) GetAllProducts(ctx context.Context) ([]*Product, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	products := make([]*Product, 0, len(m.products))
+	for _, p := range m.products {
+		products = append(products, &p)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].Id < products[j].Id })
+	return products, nil
+}
+
+func (m *MemoryStore) DeleteProduct(ctx context.Context, productId string) (deletedCount int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.products[productId]; !ok {
+		return 0, nil
+	}
+	delete(m.products, productId)
+	return 1, nil
+}
+
+func (m *MemoryStore) CreatePlan(ctx context.Context, p Plan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.plans[p.Id]; ok {
+		return fmt.Errorf("%w: plan %s already exists", ErrDuplicate, p.Id)
+	}
+	p.Features = slices.Clone(p.Features)
+	m.plans[p.Id] = p
+	return nil
+}
+
+func (m *MemoryStore) GetPlan(ctx context.Context, planId string) (*Plan, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.plans[planId]
+	if !ok {
+		return nil, ErrPlanNotFound
+	}
+	p.Features = slices.Clone(p.Features)
+	return &p, nil
+}
+
+func (m *MemoryStore) GetAllPlans(ctx context.Context) ([]*Plan, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	plans := make([]*Plan, 0, len(m.plans))
+	for _, p := range m.plans {
+		p.Features = slices.Clone(p.Features)
+		plans = append(plans, &p)
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].Id < plans[j].Id })
+	return plans, nil
+}
+
+func (m *MemoryStore) UpdatePlan(ctx context.Context, p Plan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.plans[p.Id]
+	if !ok {
+		return ErrNoChange
+	}
+	// the creation time isn't part of the update
+	p.CreatedAt = current.CreatedAt
+	p.Features = slices.Clone(p.Features)
+	m.plans[p.Id] = p
+	return nil
+}
+
+func (m *MemoryStore) DeletePlan(ctx context.Context, planId string) (deletedCount int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.plans[planId]; !ok {
+		return 0, nil
+	}
+	delete(m.plans, planId)
+	return 1, nil
+}
+
+func (m *MemoryStore) AppendAudit(ctx context.Context, e AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.audit = append(m.audit, e)
+	return nil
+}
+
+func (m *MemoryStore) ListAudit(ctx context.Context, filter AuditFilter) ([]*AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// entries are appended as they happen, so walk them backwards
+	var entries []*AuditEntry
+	for i := len(m.audit) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+		if e := m.audit[i]; filter.Match(e) {
+			entries = append(entries, &e)
+		}
+	}
+	return entries, nil
+}
+
+func (m *MemoryStore) AppendRenewal(ctx context.Context, r Renewal) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.renewals = append(m.renewals, r)
+	return nil
+}
+
+func (m *MemoryStore) ListRenewals(ctx context.Context, licenseKey string) ([]*Renewal, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var renewals []*Renewal
+	for i := len(m.renewals) - 1; i >= 0; i-- {
+		if r := m.renewals[i]; r.LicenseKey == licenseKey {
+			renewals = append(renewals, &r)
+		}
+	}
+	return renewals, nil
+}
+
+func (m *MemoryStore) CreateWebhook(ctx context.Context, w Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[w.Id]; ok {
+		return fmt.Errorf("%w: webhook %s already exists", ErrDuplicate, w.Id)
+	}
+	w.Events = slices.Clone(w.Events)
+	m.webhooks[w.Id] = w
+	return nil
+}
+
+func (m *MemoryStore) GetWebhook(ctx context.Context, webhookId string) (*Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	w, ok := m.webhooks[webhookId]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	w.Events = slices.Clone(w.Events)
+	return &w, nil
+}
+
+func (m *MemoryStore) GetAllWebhooks(ctx context.Context) ([]*Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	webhooks := make([]*Webhook, 0, len(m.webhooks))
+	for _, w := range m.webhooks {
+		w.Events = slices.Clone(w.Events)
+		webhooks = append(webhooks, &w)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		if webhooks[i].CreatedAt != webhooks[j].CreatedAt {
+			return webhooks[i].CreatedAt < webhooks[j].CreatedAt
+		}
+		return webhooks[i].Id < webhooks[j].Id
+	})
+	return webhooks, nil
+}
+
+func (m *MemoryStore) DeleteWebhook(ctx context.Context, webhookId string) (deletedCount int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[webhookId]; !ok {
+		return 0, nil
+	}
+	delete(m.webhooks, webhookId)
+	return 1, nil
+}
+
+func (m *MemoryStore) EnqueueDelivery(ctx context.Context, d WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.deliveryIndex(d.Id) >= 0 {
+		return fmt.Errorf("%w: delivery %s already exists", ErrDuplicate, d.Id)
+	}
+	d.Payload = slices.Clone(d.Payload)
+	m.deliveries = append(m.deliveries, d)
+	return nil
+}
+
+func (m *MemoryStore) GetDelivery(ctx context.Context, deliveryId string) (*WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.deliveryIndex(deliveryId)
+	if i < 0 {
+		return nil, ErrDeliveryNotFound
+	}
+	d := m.deliveries[i]
+	return &d, nil
+}
+
+func (m *MemoryStore) DueDeliveries(ctx context.Context, now Timestamp, limit int) ([]*WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var due []*WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.Status == DeliveryPending && d.NextAttempt <= now {
+			due = append(due, &d)
+		}
+	}
+	// stable, so deliveries due at the same time keep the enqueue order
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttempt < due[j].NextAttempt })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (m *MemoryStore) ListDeliveries(ctx context.Context, status DeliveryStatus, limit int) ([]*WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var deliveries []*WebhookDelivery
+	for i := len(m.deliveries) - 1; i >= 0; i-- {
+		if limit > 0 && len(deliveries) == limit {
+			break
+		}
+		if d := m.deliveries[i]; d.Status == status {
+			deliveries = append(deliveries, &d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *MemoryStore) UpdateDelivery(ctx context.Context, d WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.deliveryIndex(d.Id)
+	if i < 0 {
+		return ErrNoChange
+	}
+	stored := &m.deliveries[i]
+	stored.Status = d.Status
+	stored.Attempts = d.Attempts
+	stored.NextAttempt = d.NextAttempt
+	stored.LastError = d.LastError
+	return nil
+}
+
+// deliveryIndex returns the position of the delivery in m.deliveries, -1 if it's missing.
+func (m *MemoryStore) deliveryIndex(deliveryId string) int {
+	return slices.IndexFunc(m.deliveries, func(d WebhookDelivery) bool { return d.Id == deliveryId })
+}
+
+func (m *MemoryStore) CreateAPIKey(ctx context.Context, k APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.apiKeys {
+		if stored.Id == k.Id || stored.Name == k.Name || stored.Hash == k.Hash {
+			return fmt.Errorf("%w: api key %s already exists", ErrDuplicate, k.Name)
+		}
+	}
+	k.Scopes = slices.Clone(k.Scopes)
+	m.apiKeys[k.Id] = k
+	return nil
+}
+
+func (m *MemoryStore) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, k := range m.apiKeys {
+		if k.Hash == hash {
+			k.Scopes = slices.Clone(k.Scopes)
+			return &k, nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+func (m *MemoryStore) GetAllAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]*APIKey, 0, len(m.apiKeys))
+	for _, k := range m.apiKeys {
+		k.Scopes = slices.Clone(k.Scopes)
+		keys = append(keys, &k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys, nil
+}
+
+func (m *MemoryStore) DeleteAPIKey(ctx context.Context, keyId string) (deletedCount int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.apiKeys[keyId]; !ok {
+		return 0, nil
+	}
+	delete(m.apiKeys, keyId)
+	return 1, nil
+}
+
+func (m *MemoryStore) TouchAPIKey(ctx context.Context, keyId string, usedAt Timestamp) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k, ok := m.apiKeys[keyId]
+	if !ok {
+		return ErrNoChange
+	}
+	k.LastUsedAt = usedAt
+	m.apiKeys[keyId] = k
+	return nil
+}
+
+func (m *MemoryStore) AcquireLease(ctx context.Context, name, holder string, until, now Timestamp) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if l, ok := m.leases[name]; ok && l.holder != holder && l.expiresAt > now {
+		return false, nil
+	}
+	m.leases[name] = memoryLease{holder: holder, expiresAt: until}
+	return true, nil
+}
+
+func (m *MemoryStore) RecordNotice(ctx context.Context, noticeId string, sentAt Timestamp) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.notices[noticeId]; ok {
+		return fmt.Errorf("%w: notice %s was already sent", ErrDuplicate, noticeId)
+	}
+	m.notices[noticeId] = sentAt
+	return nil
+}
+
+func licensesEqual(a, b License) bool {
+	return a.Key == b.Key &&
+		a.Type == b.Type &&
+		a.Mode == b.Mode &&
+		a.ProductId == b.ProductId &&
+		a.PlanId == b.PlanId &&
+		a.MaxActivations == b.MaxActivations &&
+		slices.Equal(a.Devices, b.Devices) &&
+		slices.Equal(a.Seats, b.Seats) &&
+		a.IssuedAt == b.IssuedAt &&
+		a.ExpiresAt == b.ExpiresAt &&
+		a.Status == b.Status &&
+		maps.EqualFunc(a.Entitlements, b.Entitlements, optionalEqual) &&
+		optionalEqual(a.GracePeriod, b.GracePeriod)
+}
+
+// optionalEqual compares optional numbers such as quotas, nil equals only nil.
+func optionalEqual(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// checkNewLicense validates a license that is about to be added to u.
+func checkNewLicense(u *User, license License) error {
+	if license.ProductId == "" {
+		return fmt.Errorf("additional licenses must belong to a product")
+	}
+	if u.FindLicense(license.ProductId) != nil {
+		return fmt.Errorf("%w: user already has a license for product %s", ErrDuplicate, license.ProductId)
+	}
+	return nil
+}
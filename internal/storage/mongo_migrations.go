@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dzhisl/license-api/pkg/logger"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+const migrationCollectionName = "migrations"
+
+// mongoMigration is a versioned change of the MongoDB indexes or data.
+// Applied versions are tracked in the migrations collection; new migrations
+// must be appended with the next version number. MongoDB can't run them in a
+// transaction, so a migration must be safe to run again after a failure.
+type mongoMigration struct {
+	version int
+	name    string
+	apply   func(ctx context.Context, db *mongo.Database) error
+}
+
+// appliedMigration is a document of the migrations collection.
+type appliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt Timestamp `bson:"appliedAt"`
+}
+
+var mongoMigrations = []mongoMigration{
+	{
+		version: 1,
+		name:    "unique user lookup indexes",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			// 0 means unbound, so only bound ids must be unique
+			bound := func(field string) *options.IndexOptionsBuilder {
+				return options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{field: bson.M{"$gt": 0}})
+			}
+			return createIndexes(ctx, db.Collection(collectionName), []mongo.IndexModel{
+				{Keys: bson.D{{Key: "license.key", Value: 1}}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.D{{Key: "licenses.key", Value: 1}},
+					Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"licenses.key": bson.M{"$exists": true}})},
+				{Keys: bson.D{{Key: "telegramId", Value: 1}}, Options: bound("telegramId")},
+				{Keys: bson.D{{Key: "discordId", Value: 1}}, Options: bound("discordId")},
+			})
+		},
+	},
+	{
+		version: 2,
+		name:    "user listing indexes",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection(collectionName), []mongo.IndexModel{
+				{Keys: bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}},
+				{Keys: bson.D{{Key: "license.expiresAt", Value: 1}, {Key: "_id", Value: 1}}},
+				{Keys: bson.D{{Key: "license.status", Value: 1}, {Key: "license.expiresAt", Value: 1}}},
+			})
+		},
+	},
+	{
+		version: 3,
+		name:    "audit, webhook and api key indexes",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			err := createIndexes(ctx, db.Collection(auditCollectionName), []mongo.IndexModel{
+				{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "time", Value: -1}}},
+				{Keys: bson.D{{Key: "time", Value: -1}}},
+			})
+			if err != nil {
+				return err
+			}
+			err = createIndexes(ctx, db.Collection(deliveryCollectionName), []mongo.IndexModel{
+				{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttempt", Value: 1}}},
+			})
+			if err != nil {
+				return err
+			}
+			return createIndexes(ctx, db.Collection(apiKeyCollectionName), []mongo.IndexModel{
+				{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+			})
+		},
+	},
+	{
+		version: 4,
+		name:    "empty device lists instead of null",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collectionName).UpdateMany(ctx,
+				bson.M{"license.devices": nil},
+				bson.M{"$set": bson.M{"license.devices": bson.A{}}})
+			return err
+		},
+	},
+	{
+		version: 5,
+		name:    "expiry worker indexes",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection(collectionName), []mongo.IndexModel{
+				{Keys: bson.D{{Key: "licenses.status", Value: 1}, {Key: "licenses.expiresAt", Value: 1}}},
+			})
+		},
+	},
+	{
+		version: 6,
+		name:    "renewal history index",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection(renewalCollectionName), []mongo.IndexModel{
+				{Keys: bson.D{{Key: "licenseKey", Value: 1}, {Key: "time", Value: -1}}},
+			})
+		},
+	},
+	{
+		version: 7,
+		name:    "unique trial claims",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			// 0 means no account was given, so only given ids must be unique
+			given := func(field string) *options.IndexOptionsBuilder {
+				return options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{field: bson.M{"$gt": 0}})
+			}
+			return createIndexes(ctx, db.Collection(trialCollectionName), []mongo.IndexModel{
+				{Keys: bson.D{{Key: "hwid", Value: 1}}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.D{{Key: "telegramId", Value: 1}}, Options: given("telegramId")},
+				{Keys: bson.D{{Key: "discordId", Value: 1}}, Options: given("discordId")},
+			})
+		},
+	},
+	{
+		version: 8,
+		name:    "seat reclaim indexes",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection(collectionName), []mongo.IndexModel{
+				{Keys: bson.D{{Key: "license.seats.expiresAt", Value: 1}}},
+				{Keys: bson.D{{Key: "licenses.seats.expiresAt", Value: 1}}},
+			})
+		},
+	},
+	{
+		version: 9,
+		name:    "empty device lists of every license",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			// version 4 missed the product licenses, and resets stored null again since
+			coll := db.Collection(collectionName)
+			_, err := coll.UpdateMany(ctx,
+				bson.M{"license.devices": nil},
+				bson.M{"$set": bson.M{"license.devices": bson.A{}}})
+			if err != nil {
+				return err
+			}
+			opts := options.UpdateMany().SetArrayFilters([]any{bson.M{"l.devices": nil}})
+			_, err = coll.UpdateMany(ctx,
+				bson.M{"licenses": bson.M{"$elemMatch": bson.M{"devices": nil}}},
+				bson.M{"$set": bson.M{"licenses.$[l].devices": bson.A{}}}, opts)
+			return err
+		},
+	},
+	{
+		version: 10,
+		name:    "drop null entitlements",
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			// converting a trial to a plan without entitlements stored null
+			coll := db.Collection(collectionName)
+			null := bson.M{"$type": "null"}
+			_, err := coll.UpdateMany(ctx,
+				bson.M{"license.entitlements": null},
+				bson.M{"$unset": bson.M{"license.entitlements": ""}})
+			if err != nil {
+				return err
+			}
+			opts := options.UpdateMany().SetArrayFilters([]any{bson.M{"l.entitlements": null}})
+			_, err = coll.UpdateMany(ctx,
+				bson.M{"licenses": bson.M{"$elemMatch": bson.M{"entitlements": null}}},
+				bson.M{"$unset": bson.M{"licenses.$[l].entitlements": ""}}, opts)
+			return err
+		},
+	},
+}
+
+// migrateMongo applies every migration from mongoMigrations that isn't recorded yet.
+func migrateMongo(ctx context.Context, db *mongo.Database) error {
+	coll := db.Collection(migrationCollectionName)
+
+	cursor, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	var done []appliedMigration
+	if err := cursor.All(ctx, &done); err != nil {
+		return fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	applied := make(map[int]bool, len(done))
+	for _, m := range done {
+		applied[m.Version] = true
+	}
+
+	for _, m := range mongoMigrations {
+		if applied[m.version] {
+			continue
+		}
+		if err := m.apply(ctx, db); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		record := appliedMigration{Version: m.version, Name: m.name, AppliedAt: Timestamp(time.Now().Unix())}
+		// another instance starting at the same time may have recorded it first
+		if _, err := coll.InsertOne(ctx, record); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+		logger.Info(ctx, "applied mongo migration", zap.Int("version", m.version), zap.String("name", m.name))
+	}
+	return nil
+}
+
+// createIndexes creates the indexes on coll, creating an existing index is a no-op.
+func createIndexes(ctx context.Context, coll *mongo.Collection, models []mongo.IndexModel) error {
+	if _, err := coll.Indexes().CreateMany(ctx, models); err != nil {
+		return fmt.Errorf("failed to create %s indexes: %w", coll.Name(), err)
+	}
+	return nil
+}
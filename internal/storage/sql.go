@@ -0,0 +1,1442 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLStore is the SQL implementation of Store. Users, licenses and devices
+// live in separate tables (see sqlMigrations). Queries stick to the subset of
+// SQL shared by SQLite and PostgreSQL; the pure-Go "sqlite" driver is bundled.
+//
+// Limit checks and sequence numbers are computed inside the insert that
+// depends on them. That is only race free because SQLite runs on a single
+// connection (see NewSQLStore). On PostgreSQL concurrent inserts can both
+// pass a limit or take the same seq, which needs row locks and sequences.
+type SQLStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLStore)(nil)
+
+// sqlQuerier is implemented by both *sql.DB and *sql.Tx.
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+const (
+	selectUserQuery     = `SELECT id, telegram_id, discord_id, created_at FROM users`
+	selectLicenseQuery  = `SELECT license_key, license_type, mode, position, product_id, plan_id, max_activations, issued_at, expires_at, status, grace_period FROM licenses`
+	selectPlanQuery     = `SELECT id, name, max_activations, duration, features, renewal, created_at FROM plans`
+	selectProductQuery  = `SELECT id, name, key_prefix, key_length, default_max_activations, default_duration, created_at FROM products`
+	selectWebhookQuery  = `SELECT id, url, secret, events, created_at FROM webhooks`
+	selectAPIKeyQuery   = `SELECT id, name, key_hash, prefix, role, scopes, expires_at, last_used_at, created_at FROM api_keys`
+	selectDeliveryQuery = `SELECT id, webhook_id, event, payload, status, attempts, next_attempt, last_error, created_at FROM webhook_deliveries`
+)
+
+// NewSQLStore opens the database with the given driver and dsn
+// and applies pending schema migrations.
+func NewSQLStore(ctx context.Context, driverName, dsn string) (*SQLStore, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", driverName, err)
+	}
+	if driverName == "sqlite" {
+		// sqlite allows a single writer, serialize access instead of failing with SQLITE_BUSY.
+		// The limit checks and seq numbers of SQLStore rely on this.
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping %s database: %w", driverName, err)
+	}
+	if err := migrateSQL(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLStore) CreateUser(ctx context.Context, u User) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, u.Id).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return fmt.Errorf("%w: %d", ErrDuplicateUserId, u.Id)
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO users (id, telegram_id, discord_id, created_at) VALUES ($1, $2, $3, $4)`,
+		u.Id, u.TelegramId, u.DiscordId, u.CreatedAt)
+	if err != nil {
+		return duplicateError(err)
+	}
+	for i, l := range u.AllLicenses() {
+		if err := insertLicense(ctx, tx, u.Id, i, l); err != nil {
+			return duplicateError(err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeleteUser(ctx context.Context, userId int) (deletedCount int64, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"devices", "entitlements", "seats"} {
+		_, err = tx.ExecContext(ctx,
+			`DELETE FROM `+table+` WHERE license_key IN (SELECT license_key FROM licenses WHERE user_id = $1)`, userId)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM licenses WHERE user_id = $1`, userId); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userId)
+	if err != nil {
+		return 0, err
+	}
+	if deletedCount, err = res.RowsAffected(); err != nil {
+		return 0, err
+	}
+	return deletedCount, tx.Commit()
+}
+
+func (s *SQLStore) GetUser(ctx context.Context, params GetUserParams) (user *User, err error) {
+	return getSQLUser(ctx, s.db, params)
+}
+
+func (s *SQLStore) GetAllUsers(ctx context.Context) (user []*User, err error) {
+	rows, err := s.db.QueryContext(ctx, selectUserQuery+` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.Id, &u.TelegramId, &u.DiscordId, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to unpack users to struct:%w", err)
+		}
+		users = append(users, &u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, u := range users {
+		if err := loadLicenses(ctx, s.db, u); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// userSortColumns maps the ListUsers orders to their columns in listUsersQuery
+var userSortColumns = map[UserSort]string{
+	SortById:        "u.id",
+	SortByCreatedAt: "u.created_at",
+	SortByExpiresAt: "l.expires_at",
+}
+
+// listUsersQuery joins the users with their primary license, devices counts its devices
+const listUsersQuery = `SELECT u.id, u.telegram_id, u.discord_id, u.created_at FROM users u
+	JOIN licenses l ON l.user_id = u.id AND l.position = 0`
+
+func (s *SQLStore) ListUsers(ctx context.Context, filter UserFilter) ([]*User, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	const devices = `(SELECT COUNT(*) FROM devices d WHERE d.license_key = l.license_key)`
+	if filter.Status != "" {
+		add("l.status = $%d", filter.Status)
+	}
+	if filter.ExpiresFrom != 0 || filter.ExpiresTo != 0 {
+		where = append(where, "l.expires_at <> 0")
+	}
+	if filter.ExpiresFrom != 0 {
+		add("l.expires_at >= $%d", filter.ExpiresFrom)
+	}
+	if filter.ExpiresTo != 0 {
+		add("l.expires_at <= $%d", filter.ExpiresTo)
+	}
+	if filter.CreatedFrom != 0 {
+		add("u.created_at >= $%d", filter.CreatedFrom)
+	}
+	if filter.CreatedTo != 0 {
+		add("u.created_at <= $%d", filter.CreatedTo)
+	}
+	if filter.HasTelegram != nil {
+		where = append(where, boundCondition("u.telegram_id", *filter.HasTelegram))
+	}
+	if filter.HasDiscord != nil {
+		where = append(where, boundCondition("u.discord_id", *filter.HasDiscord))
+	}
+	if filter.MinDevices != nil {
+		add(devices+" >= $%d", *filter.MinDevices)
+	}
+	if filter.MaxDevices != nil {
+		add(devices+" <= $%d", *filter.MaxDevices)
+	}
+
+	column, ok := userSortColumns[filter.Sort]
+	if !ok {
+		column = userSortColumns[SortById]
+	}
+	direction, op := "ASC", ">"
+	if filter.Desc {
+		direction, op = "DESC", "<"
+	}
+	if after := filter.After; after != nil {
+		args = append(args, after.Value, after.Id)
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s $%[3]d OR (%[1]s = $%[3]d AND u.id %[2]s $%[4]d))",
+			column, op, len(args)-1, len(args)))
+	}
+
+	query := listUsersQuery
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(` ORDER BY %s %s, u.id %s`, column, direction, direction)
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(` LIMIT %d`, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.Id, &u.TelegramId, &u.DiscordId, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to unpack users to struct:%w", err)
+		}
+		users = append(users, &u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, u := range users {
+		if err := loadLicenses(ctx, s.db, u); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// boundCondition selects the users with (or without) an account id in column.
+func boundCondition(column string, bound bool) string {
+	if bound {
+		return column + " <> 0"
+	}
+	return column + " = 0"
+}
+
+func (s *SQLStore) AddLicense(ctx context.Context, userId int, license License) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to add license: %w", err)
+	}
+	defer tx.Rollback()
+
+	user, err := getSQLUser(ctx, tx, GetUserParams{UserId: userId})
+	if err != nil {
+		return err
+	}
+	if err := checkNewLicense(user, license); err != nil {
+		return err
+	}
+	if err := insertLicense(ctx, tx, userId, len(user.Licenses)+1, license); err != nil {
+		return duplicateError(fmt.Errorf("failed to add license: %w", err))
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) AddHwidSession(ctx context.Context, ref LicenseRef, hwid string) error {
+	key, err := s.licenseKey(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	// the limit check and the insert are a single statement, which SQLite's
+	// single connection runs alone, so concurrent activations can't both pass
+	// the check
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO devices (license_key, position, hwid)
+		SELECT l.license_key, COALESCE((SELECT MAX(d.position) FROM devices d WHERE d.license_key = l.license_key), 0) + 1, $2
+		FROM licenses l
+		WHERE l.license_key = $1
+			AND NOT EXISTS (SELECT 1 FROM devices d WHERE d.license_key = l.license_key AND d.hwid = $2)
+			AND (SELECT COUNT(*) FROM devices d WHERE d.license_key = l.license_key) < l.max_activations`,
+		key, hwid)
+	if err != nil {
+		return fmt.Errorf("failed to update user devices: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	// nothing was inserted, find out why
+	user, err := s.GetUser(ctx, GetUserParams{UserId: ref.UserId})
+	if err != nil {
+		return err
+	}
+	license := user.FindLicense(ref.ProductId)
+	if license == nil {
+		return ErrLicenseNotFound
+	}
+	if slices.Contains(license.Devices, hwid) {
+		return ErrNoChange
+	}
+	return fmt.Errorf("%w: %d", ErrActivationLimit, license.MaxActivations)
+}
+
+func (s *SQLStore) CheckoutSeat(ctx context.Context, ref LicenseRef, seat Seat, now Timestamp) (Seat, error) {
+	key, err := s.licenseKey(ctx, ref)
+	if err != nil {
+		return Seat{}, err
+	}
+
+	_, err = s.db.ExecContext(ctx, `DELETE FROM seats WHERE license_key = $1 AND expires_at <= $2`, key, now)
+	if err != nil {
+		return Seat{}, fmt.Errorf("failed to reclaim seats: %w", err)
+	}
+	// a machine that checks out again keeps its seat, a concurrent checkout
+	// of the same machine fails the insert on (license_key, hwid) and renews
+	for range 2 {
+		held, err := s.renewSeat(ctx, key, seat, now)
+		if err == nil || !errors.Is(err, ErrSeatNotFound) {
+			return held, err
+		}
+
+		// like the device activations, the limit check and the insert are a
+		// single statement, serialized by SQLite's single connection
+		res, err := s.db.ExecContext(ctx,
+			`INSERT INTO seats (id, license_key, hwid, checked_out_at, expires_at)
+			SELECT $2, l.license_key, $3, $4, $5
+			FROM licenses l
+			WHERE l.license_key = $1
+				AND (SELECT COUNT(*) FROM seats s WHERE s.license_key = l.license_key AND s.expires_at > $6) < l.max_activations`,
+			key, seat.Id, seat.Hwid, seat.CheckedOutAt, seat.ExpiresAt, now)
+		if errors.Is(duplicateError(err), ErrDuplicate) {
+			continue
+		}
+		if err != nil {
+			return Seat{}, fmt.Errorf("failed to check out seat: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n > 0 {
+			return seat, err
+		}
+		return Seat{}, ErrSeatLimit
+	}
+	return Seat{}, ErrSeatLimit
+}
+
+// renewSeat moves the expiry of the live lease of seat.Hwid to seat.ExpiresAt
+// and returns it, ErrSeatNotFound if the machine holds no seat.
+func (s *SQLStore) renewSeat(ctx context.Context, key string, seat Seat, now Timestamp) (Seat, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE seats SET expires_at = $3 WHERE license_key = $1 AND hwid = $2 AND expires_at > $4`,
+		key, seat.Hwid, seat.ExpiresAt, now)
+	if err != nil {
+		return Seat{}, fmt.Errorf("failed to renew seat: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Seat{}, err
+	}
+	if n == 0 {
+		return Seat{}, ErrSeatNotFound
+	}
+
+	held := Seat{Hwid: seat.Hwid}
+	err = s.db.QueryRowContext(ctx,
+		`SELECT id, checked_out_at, expires_at FROM seats WHERE license_key = $1 AND hwid = $2`, key, seat.Hwid).
+		Scan(&held.Id, &held.CheckedOutAt, &held.ExpiresAt)
+	if err != nil {
+		return Seat{}, fmt.Errorf("failed to renew seat: %w", err)
+	}
+	return held, nil
+}
+
+func (s *SQLStore) HeartbeatSeat(ctx context.Context, ref LicenseRef, seatId string, until, now Timestamp) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE seats SET expires_at = $4
+		WHERE license_key IN (`+licenseKeyQuery+`) AND id = $3 AND expires_at > $5`, ref.UserId, ref.ProductId, seatId, until, now)
+	if err != nil {
+		return fmt.Errorf("failed to renew seat: %w", err)
+	}
+	err = checkRowsAffected(res)
+	if errors.Is(err, ErrNoChange) {
+		return ErrSeatNotFound
+	}
+	return err
+}
+
+func (s *SQLStore) ReleaseSeat(ctx context.Context, ref LicenseRef, seatId string) error {
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM seats WHERE license_key IN (`+licenseKeyQuery+`) AND id = $3`, ref.UserId, ref.ProductId, seatId)
+	if err != nil {
+		return fmt.Errorf("failed to release seat: %w", err)
+	}
+	err = checkRowsAffected(res)
+	if errors.Is(err, ErrNoChange) {
+		return ErrSeatNotFound
+	}
+	return err
+}
+
+func (s *SQLStore) ReclaimSeats(ctx context.Context, now Timestamp) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM seats WHERE expires_at <= $1`, now); err != nil {
+		return fmt.Errorf("failed to reclaim seats: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) DeleteHwidSession(ctx context.Context, ref LicenseRef, hwid string) error {
+	key, err := s.licenseKey(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM devices WHERE license_key = $1 AND hwid = $2`, key, hwid)
+	if err != nil {
+		return fmt.Errorf("failed to update user devices: %w", err)
+	}
+	return checkRowsAffected(res)
+}
+
+func (s *SQLStore) ResetHwidSessions(ctx context.Context, ref LicenseRef) error {
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM devices WHERE license_key IN (`+licenseKeyQuery+`)`, ref.UserId, ref.ProductId)
+	if err != nil {
+		return fmt.Errorf("failed to reset user devices: %w", err)
+	}
+	return s.checkLicenseChanged(ctx, ref, res)
+}
+
+func (s *SQLStore) ChangeLicenseStatus(ctx context.Context, ref LicenseRef, status LicenseStatus) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE licenses SET status = $3
+		WHERE license_key IN (`+licenseKeyQuery+`) AND status <> $3`, ref.UserId, ref.ProductId, status)
+	if err != nil {
+		return fmt.Errorf("failed to update license status: %w", err)
+	}
+	return s.checkLicenseChanged(ctx, ref, res)
+}
+
+func (s *SQLStore) UpdateLicense(ctx context.Context, ref LicenseRef, license License) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to update license: %w", err)
+	}
+	defer tx.Rollback()
+
+	user, err := getSQLUser(ctx, tx, GetUserParams{UserId: ref.UserId})
+	if err != nil {
+		return fmt.Errorf("failed to update license: %w", err)
+	}
+	current := user.FindLicense(ref.ProductId)
+	if current == nil {
+		return ErrLicenseNotFound
+	}
+	// the slot keeps its product
+	license.ProductId = current.ProductId
+	if licensesEqual(*current, license) {
+		return ErrNoChange
+	}
+
+	var position int
+	err = tx.QueryRowContext(ctx, `SELECT position FROM licenses WHERE license_key = $1`, current.Key).Scan(&position)
+	if err != nil {
+		return fmt.Errorf("failed to update license: %w", err)
+	}
+	if err := deleteLicenseRows(ctx, tx, current.Key); err != nil {
+		return fmt.Errorf("failed to update license: %w", err)
+	}
+	if err := insertLicense(ctx, tx, ref.UserId, position, license); err != nil {
+		return fmt.Errorf("failed to update license: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) UpdateHwidLimit(ctx context.Context, ref LicenseRef, newLimit int) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE licenses SET max_activations = $3
+		WHERE license_key IN (`+licenseKeyQuery+`) AND max_activations <> $3`, ref.UserId, ref.ProductId, newLimit)
+	if err != nil {
+		return fmt.Errorf("failed to update license hwid limits: %w", err)
+	}
+	return s.checkLicenseChanged(ctx, ref, res)
+}
+
+func (s *SQLStore) RenewLicense(ctx context.Context, ref LicenseRef, expiresAt Timestamp) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE licenses SET expires_at = $3
+		WHERE license_key IN (`+licenseKeyQuery+`) AND expires_at <> $3`, ref.UserId, ref.ProductId, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to renew license: %w", err)
+	}
+	return s.checkLicenseChanged(ctx, ref, res)
+}
+
+func (s *SQLStore) ExtendLicense(ctx context.Context, ref LicenseRef, seconds int64, now Timestamp) (previous, expiresAt Timestamp, err error) {
+	for range extendAttempts {
+		var key string
+		err := s.db.QueryRowContext(ctx,
+			`SELECT license_key, expires_at FROM licenses WHERE license_key IN (`+licenseKeyQuery+`)`,
+			ref.UserId, ref.ProductId).Scan(&key, &previous)
+		if err == sql.ErrNoRows {
+			// reports the missing user or license
+			_, err = s.licenseKey(ctx, ref)
+			return 0, 0, err
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to extend license: %w", err)
+		}
+		if previous == 0 {
+			return 0, 0, ErrNoChange
+		}
+
+		current := License{ExpiresAt: previous}
+		expiresAt = current.ExtendedExpiry(seconds, int64(now))
+		// the expiry in the condition makes a concurrent renewal fail this update
+		res, err := s.db.ExecContext(ctx,
+			`UPDATE licenses SET expires_at = $1 WHERE license_key = $2 AND expires_at = $3`, expiresAt, key, previous)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to extend license: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, 0, err
+		}
+		if n > 0 {
+			return previous, expiresAt, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("failed to extend license: the expiry kept changing")
+}
+
+func (s *SQLStore) SetGracePeriod(ctx context.Context, ref LicenseRef, gracePeriod *int64) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE licenses SET grace_period = $3
+		WHERE license_key IN (`+licenseKeyQuery+`) AND grace_period IS DISTINCT FROM $3`, ref.UserId, ref.ProductId, gracePeriod)
+	if err != nil {
+		return fmt.Errorf("failed to set license grace period: %w", err)
+	}
+	return s.checkLicenseChanged(ctx, ref, res)
+}
+
+func (s *SQLStore) ExpiringUsers(ctx context.Context, before Timestamp) ([]*User, error) {
+	rows, err := s.db.QueryContext(ctx, selectUserQuery+` WHERE id IN (
+		SELECT user_id FROM licenses WHERE status = $1 AND expires_at <> 0 AND expires_at <= $2
+	) ORDER BY id`, Active, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.Id, &u.TelegramId, &u.DiscordId, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to unpack users to struct:%w", err)
+		}
+		users = append(users, &u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, u := range users {
+		if err := loadLicenses(ctx, s.db, u); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+func (s *SQLStore) ExpireLicense(ctx context.Context, ref LicenseRef, now Timestamp) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE licenses SET status = $3
+		WHERE license_key IN (`+licenseKeyQuery+`) AND status = $4 AND expires_at <> 0 AND expires_at <= $5`,
+		ref.UserId, ref.ProductId, Expired, Active, now)
+	if err != nil {
+		return fmt.Errorf("failed to expire license: %w", err)
+	}
+	return s.checkLicenseChanged(ctx, ref, res)
+}
+
+// ConvertTrial updates the license row only while it is a trial and replaces
+// its entitlements in the same transaction.
+func (s *SQLStore) ConvertTrial(ctx context.Context, ref LicenseRef, terms License) error {
+	key, err := s.licenseKey(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to convert trial: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE licenses SET license_type = '', plan_id = $2, max_activations = $3, expires_at = $4, status = $5, grace_period = $6
+		WHERE license_key = $1 AND license_type = $7`,
+		key, terms.PlanId, terms.MaxActivations, terms.ExpiresAt, Active, terms.GracePeriod, Trial)
+	if err != nil {
+		return fmt.Errorf("failed to convert trial: %w", err)
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM entitlements WHERE license_key = $1`, key); err != nil {
+		return fmt.Errorf("failed to convert trial: %w", err)
+	}
+	for name, quota := range terms.Entitlements {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO entitlements (license_key, name, quota) VALUES ($1, $2, $3)`, key, name, quota)
+		if err != nil {
+			return fmt.Errorf("failed to convert trial: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) ClaimTrial(ctx context.Context, claim TrialClaim) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO trials (license_key, user_id, hwid, telegram_id, discord_id, claimed_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		claim.LicenseKey, claim.UserId, claim.Hwid, claim.TelegramId, claim.DiscordId, claim.ClaimedAt)
+	if err != nil {
+		return duplicateError(fmt.Errorf("failed to claim trial: %w", err))
+	}
+	return nil
+}
+
+func (s *SQLStore) GrantEntitlement(ctx context.Context, ref LicenseRef, name string, quota *int64) error {
+	key, err := s.licenseKey(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to grant entitlement: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current sql.NullInt64
+	err = tx.QueryRowContext(ctx,
+		`SELECT quota FROM entitlements WHERE license_key = $1 AND name = $2`, key, name).Scan(&current)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO entitlements (license_key, name, quota) VALUES ($1, $2, $3)`, key, name, quota)
+	case err != nil:
+	case optionalEqual(nullableInt64(current), quota):
+		return ErrNoChange
+	default:
+		_, err = tx.ExecContext(ctx,
+			`UPDATE entitlements SET quota = $3 WHERE license_key = $1 AND name = $2`, key, name, quota)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to grant entitlement: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) RevokeEntitlement(ctx context.Context, ref LicenseRef, name string) error {
+	key, err := s.licenseKey(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM entitlements WHERE license_key = $1 AND name = $2`, key, name)
+	if err != nil {
+		return fmt.Errorf("failed to revoke entitlement: %w", err)
+	}
+	return checkRowsAffected(res)
+}
+
+func (s *SQLStore) BindDiscord(ctx context.Context, userId, discordId int) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE users SET discord_id = $2 WHERE id = $1 AND discord_id <> $2`, userId, discordId)
+	if err != nil {
+		return duplicateError(fmt.Errorf("failed to bind discord for user: %w", err))
+	}
+	return s.checkUserChanged(ctx, userId, res)
+}
+
+func (s *SQLStore) BindTelegram(ctx context.Context, userId, telegramId int) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE users SET telegram_id = $2 WHERE id = $1 AND telegram_id <> $2`, userId, telegramId)
+	if err != nil {
+		return duplicateError(fmt.Errorf("failed to bind telegram for user: %w", err))
+	}
+	return s.checkUserChanged(ctx, userId, res)
+}
+
+func (s *SQLStore) CreateProduct(ctx context.Context, p Product) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO products (id, name, key_prefix, key_length, default_max_activations, default_duration, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		p.Id, p.Name, p.KeyPrefix, p.KeyLength, p.DefaultMaxActivations, p.DefaultDuration, p.CreatedAt)
+	return duplicateError(err)
+}
+
+func (s *SQLStore) GetProduct(ctx context.Context, productId string) (*Product, error) {
+	var p Product
+	err := s.db.QueryRowContext(ctx, selectProductQuery+` WHERE id = $1`, productId).Scan(
+		&p.Id, &p.Name, &p.KeyPrefix, &p.KeyLength, &p.DefaultMaxActivations, &p.DefaultDuration, &p.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *SQLStore) GetAllProducts(ctx context.Context) ([]*Product, error) {
+	rows, err := s.db.QueryContext(ctx, selectProductQuery+` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []*Product
+	for rows.Next() {
+		var p Product
+		err := rows.Scan(&p.Id, &p.Name, &p.KeyPrefix, &p.KeyLength, &p.DefaultMaxActivations, &p.DefaultDuration, &p.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack products to struct:%w", err)
+		}
+		products = append(products, &p)
+	}
+	return products, rows.Err()
+}
+
+func (s *SQLStore) DeleteProduct(ctx context.Context, productId string) (deletedCount int64, err error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM products WHERE id = $1`, productId)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLStore) CreatePlan(ctx context.Context, p Plan) error {
+	features, err := json.Marshal(p.Features)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO plans (id, name, max_activations, duration, features, renewal, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		p.Id, p.Name, p.MaxActivations, p.Duration, string(features), p.Renewal, p.CreatedAt)
+	return duplicateError(err)
+}
+
+func (s *SQLStore) GetPlan(ctx context.Context, planId string) (*Plan, error) {
+	p, err := scanPlan(s.db.QueryRowContext(ctx, selectPlanQuery+` WHERE id = $1`, planId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPlanNotFound
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *SQLStore) GetAllPlans(ctx context.Context) ([]*Plan, error) {
+	rows, err := s.db.QueryContext(ctx, selectPlanQuery+` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var plans []*Plan
+	for rows.Next() {
+		p, err := scanPlan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack plans to struct:%w", err)
+		}
+		plans = append(plans, p)
+	}
+	return plans, rows.Err()
+}
+
+func (s *SQLStore) UpdatePlan(ctx context.Context, p Plan) error {
+	features, err := json.Marshal(p.Features)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE plans SET name = $2, max_activations = $3, duration = $4, features = $5, renewal = $6 WHERE id = $1`,
+		p.Id, p.Name, p.MaxActivations, p.Duration, string(features), p.Renewal)
+	if err != nil {
+		return fmt.Errorf("failed to update plan: %w", err)
+	}
+	return checkRowsAffected(res)
+}
+
+func (s *SQLStore) DeletePlan(ctx context.Context, planId string) (deletedCount int64, err error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM plans WHERE id = $1`, planId)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// sqlScanner is implemented by both *sql.Row and *sql.Rows.
+type sqlScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPlan(row sqlScanner) (*Plan, error) {
+	var (
+		p        Plan
+		features string
+	)
+	err := row.Scan(&p.Id, &p.Name, &p.MaxActivations, &p.Duration, &features, &p.Renewal, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(features), &p.Features); err != nil {
+		return nil, fmt.Errorf("failed to decode plan features: %w", err)
+	}
+	return &p, nil
+}
+
+func (s *SQLStore) AppendAudit(ctx context.Context, e AuditEntry) error {
+	// MAX(seq) + 1 is only unique because SQLite serializes the inserts
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO audit_log (seq, time, actor, request_id, action, user_id, target, before_value, after_value)
+		SELECT COALESCE(MAX(seq), 0) + 1, $1, $2, $3, $4, $5, $6, $7, $8 FROM audit_log`,
+		e.Time, e.Actor, e.RequestId, e.Action, e.UserId, e.Target, nullableJSON(e.Before), nullableJSON(e.After))
+	return err
+}
+
+func (s *SQLStore) ListAudit(ctx context.Context, filter AuditFilter) ([]*AuditEntry, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.UserId != 0 {
+		add("user_id = $%d", filter.UserId)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.From != 0 {
+		add("time >= $%d", filter.From)
+	}
+	if filter.To != 0 {
+		add("time <= $%d", filter.To)
+	}
+
+	query := `SELECT time, actor, request_id, action, user_id, target, before_value, after_value FROM audit_log`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY seq DESC`
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(` LIMIT %d`, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		var (
+			e             AuditEntry
+			before, after sql.NullString
+		)
+		err := rows.Scan(&e.Time, &e.Actor, &e.RequestId, &e.Action, &e.UserId, &e.Target, &before, &after)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack audit entries to struct:%w", err)
+		}
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLStore) AppendRenewal(ctx context.Context, r Renewal) error {
+	// MAX(seq) + 1 is only unique because SQLite serializes the inserts
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO renewals (seq, license_key, user_id, time, actor, request_id, source, amount, previous_expires_at, expires_at)
+		SELECT COALESCE(MAX(seq), 0) + 1, $1, $2, $3, $4, $5, $6, $7, $8, $9 FROM renewals`,
+		r.LicenseKey, r.UserId, r.Time, r.Actor, r.RequestId, r.Source, r.Amount, r.PreviousExpiresAt, r.ExpiresAt)
+	return err
+}
+
+func (s *SQLStore) ListRenewals(ctx context.Context, licenseKey string) ([]*Renewal, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT license_key, user_id, time, actor, request_id, source, amount, previous_expires_at, expires_at
+		FROM renewals WHERE license_key = $1 ORDER BY seq DESC`, licenseKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var renewals []*Renewal
+	for rows.Next() {
+		var r Renewal
+		err := rows.Scan(&r.LicenseKey, &r.UserId, &r.Time, &r.Actor, &r.RequestId, &r.Source, &r.Amount, &r.PreviousExpiresAt, &r.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack renewals to struct:%w", err)
+		}
+		renewals = append(renewals, &r)
+	}
+	return renewals, rows.Err()
+}
+
+func (s *SQLStore) CreateWebhook(ctx context.Context, w Webhook) error {
+	events, err := json.Marshal(w.Events)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO webhooks (id, url, secret, events, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		w.Id, w.URL, w.Secret, string(events), w.CreatedAt)
+	return duplicateError(err)
+}
+
+func (s *SQLStore) GetWebhook(ctx context.Context, webhookId string) (*Webhook, error) {
+	w, err := scanWebhook(s.db.QueryRowContext(ctx, selectWebhookQuery+` WHERE id = $1`, webhookId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return w, nil
+}
+
+func (s *SQLStore) GetAllWebhooks(ctx context.Context) ([]*Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, selectWebhookQuery+` ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack webhooks to struct:%w", err)
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *SQLStore) DeleteWebhook(ctx context.Context, webhookId string) (deletedCount int64, err error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, webhookId)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanWebhook(row sqlScanner) (*Webhook, error) {
+	var (
+		w      Webhook
+		events string
+	)
+	if err := row.Scan(&w.Id, &w.URL, &w.Secret, &events, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(events), &w.Events); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook events: %w", err)
+	}
+	return &w, nil
+}
+
+func (s *SQLStore) EnqueueDelivery(ctx context.Context, d WebhookDelivery) error {
+	// MAX(seq) + 1 is only unique because SQLite serializes the inserts
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries (seq, id, webhook_id, event, payload, status, attempts, next_attempt, last_error, created_at)
+		SELECT COALESCE(MAX(seq), 0) + 1, $1, $2, $3, $4, $5, $6, $7, $8, $9 FROM webhook_deliveries`,
+		d.Id, d.WebhookId, d.Event, string(d.Payload), d.Status, d.Attempts, d.NextAttempt, d.LastError, d.CreatedAt)
+	return duplicateError(err)
+}
+
+func (s *SQLStore) GetDelivery(ctx context.Context, deliveryId string) (*WebhookDelivery, error) {
+	d, err := scanDelivery(s.db.QueryRowContext(ctx, selectDeliveryQuery+` WHERE id = $1`, deliveryId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *SQLStore) DueDeliveries(ctx context.Context, now Timestamp, limit int) ([]*WebhookDelivery, error) {
+	query := selectDeliveryQuery + ` WHERE status = $1 AND next_attempt <= $2 ORDER BY next_attempt, seq`
+	if limit > 0 {
+		query += fmt.Sprintf(` LIMIT %d`, limit)
+	}
+	return s.queryDeliveries(ctx, query, DeliveryPending, now)
+}
+
+func (s *SQLStore) ListDeliveries(ctx context.Context, status DeliveryStatus, limit int) ([]*WebhookDelivery, error) {
+	query := selectDeliveryQuery + ` WHERE status = $1 ORDER BY seq DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(` LIMIT %d`, limit)
+	}
+	return s.queryDeliveries(ctx, query, status)
+}
+
+func (s *SQLStore) queryDeliveries(ctx context.Context, query string, args ...any) ([]*WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack deliveries to struct:%w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *SQLStore) UpdateDelivery(ctx context.Context, d WebhookDelivery) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status = $2, attempts = $3, next_attempt = $4, last_error = $5 WHERE id = $1`,
+		d.Id, d.Status, d.Attempts, d.NextAttempt, d.LastError)
+	if err != nil {
+		return fmt.Errorf("failed to update delivery: %w", err)
+	}
+	return checkRowsAffected(res)
+}
+
+func scanDelivery(row sqlScanner) (*WebhookDelivery, error) {
+	var (
+		d       WebhookDelivery
+		payload string
+	)
+	err := row.Scan(&d.Id, &d.WebhookId, &d.Event, &payload, &d.Status, &d.Attempts, &d.NextAttempt, &d.LastError, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	d.Payload = json.RawMessage(payload)
+	return &d, nil
+}
+
+func (s *SQLStore) CreateAPIKey(ctx context.Context, k APIKey) error {
+	scopes, err := json.Marshal(k.Scopes)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO api_keys (id, name, key_hash, prefix, role, scopes, expires_at, last_used_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		k.Id, k.Name, k.Hash, k.Prefix, k.Role, string(scopes), k.ExpiresAt, k.LastUsedAt, k.CreatedAt)
+	return duplicateError(err)
+}
+
+func (s *SQLStore) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	k, err := scanAPIKey(s.db.QueryRowContext(ctx, selectAPIKeyQuery+` WHERE key_hash = $1`, hash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+	return k, nil
+}
+
+func (s *SQLStore) GetAllAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, selectAPIKeyQuery+` ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack api keys to struct:%w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *SQLStore) DeleteAPIKey(ctx context.Context, keyId string) (deletedCount int64, err error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE id = $1`, keyId)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLStore) TouchAPIKey(ctx context.Context, keyId string, usedAt Timestamp) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, keyId, usedAt)
+	if err != nil {
+		return fmt.Errorf("failed to touch api key: %w", err)
+	}
+	return checkRowsAffected(res)
+}
+
+func scanAPIKey(row sqlScanner) (*APIKey, error) {
+	var (
+		k      APIKey
+		scopes string
+	)
+	err := row.Scan(&k.Id, &k.Name, &k.Hash, &k.Prefix, &k.Role, &scopes, &k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &k.Scopes); err != nil {
+		return nil, fmt.Errorf("failed to decode api key scopes: %w", err)
+	}
+	return &k, nil
+}
+
+// AcquireLease upserts the lease, the condition of the update only lets it
+// take over a lease of the same holder or one that expired at now.
+func (s *SQLStore) AcquireLease(ctx context.Context, name, holder string, until, now Timestamp) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO leases (name, holder, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE leases.holder = excluded.holder OR leases.expires_at <= $4`,
+		name, holder, until, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *SQLStore) RecordNotice(ctx context.Context, noticeId string, sentAt Timestamp) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO notices (id, sent_at) VALUES ($1, $2)`, noticeId, sentAt)
+	return duplicateError(err)
+}
+
+func nullableJSON(raw json.RawMessage) any {
+	if raw == nil {
+		return nil
+	}
+	return string(raw)
+}
+
+// licenseKeyQuery selects the key of the license a LicenseRef ($1 user id,
+// $2 product id) points to: the primary one for an empty product id.
+const licenseKeyQuery = `SELECT license_key FROM licenses
+	WHERE user_id = $1 AND (($2 = '' AND position = 0) OR ($2 <> '' AND product_id = $2))`
+
+// licenseKey resolves ref to a license key. It reports a missing user
+// and a missing license the same way GetUser does.
+func (s *SQLStore) licenseKey(ctx context.Context, ref LicenseRef) (string, error) {
+	var key string
+	err := s.db.QueryRowContext(ctx, licenseKeyQuery+` ORDER BY position LIMIT 1`, ref.UserId, ref.ProductId).Scan(&key)
+	if err == nil {
+		return key, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+	if _, err := s.GetUser(ctx, GetUserParams{UserId: ref.UserId}); err != nil {
+		return "", err
+	}
+	return "", ErrLicenseNotFound
+}
+
+func getSQLUser(ctx context.Context, q sqlQuerier, params GetUserParams) (*User, error) {
+	var (
+		where string
+		arg   any
+	)
+
+	switch {
+	case params.UserId != 0:
+		where, arg = "id = $1", params.UserId
+	case params.TelegramId != 0:
+		where, arg = "telegram_id = $1", params.TelegramId
+	case params.DiscordId != 0:
+		where, arg = "discord_id = $1", params.DiscordId
+	case params.License != "":
+		where, arg = "id IN (SELECT user_id FROM licenses WHERE license_key = $1)", params.License
+	default:
+		return nil, fmt.Errorf("at least one param must be provided")
+	}
+
+	var u User
+	err := q.QueryRowContext(ctx, selectUserQuery+` WHERE `+where+` ORDER BY id LIMIT 1`, arg).Scan(
+		&u.Id, &u.TelegramId, &u.DiscordId, &u.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if err := loadLicenses(ctx, q, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// loadLicenses fills the licenses of u and their devices.
+func loadLicenses(ctx context.Context, q sqlQuerier, u *User) error {
+	rows, err := q.QueryContext(ctx, selectLicenseQuery+` WHERE user_id = $1 ORDER BY position`, u.Id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var licenses []License
+	for rows.Next() {
+		var (
+			l        License
+			position int
+			grace    sql.NullInt64
+		)
+		err := rows.Scan(&l.Key, &l.Type, &l.Mode, &position, &l.ProductId, &l.PlanId, &l.MaxActivations, &l.IssuedAt, &l.ExpiresAt, &l.Status, &grace)
+		if err != nil {
+			return err
+		}
+		l.GracePeriod = nullableInt64(grace)
+		licenses = append(licenses, l)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for i := range licenses {
+		if licenses[i].Devices, err = loadDevices(ctx, q, licenses[i].Key); err != nil {
+			return err
+		}
+		if licenses[i].Entitlements, err = loadEntitlements(ctx, q, licenses[i].Key); err != nil {
+			return err
+		}
+		if licenses[i].Seats, err = loadSeats(ctx, q, licenses[i].Key); err != nil {
+			return err
+		}
+	}
+	if len(licenses) > 0 {
+		u.License = licenses[0]
+		u.Licenses = licenses[1:]
+	}
+	if len(u.Licenses) == 0 {
+		u.Licenses = nil
+	}
+	return nil
+}
+
+// loadDevices returns the license's HWIDs in activation order, nil when there are none.
+func loadDevices(ctx context.Context, q sqlQuerier, licenseKey string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `SELECT hwid FROM devices WHERE license_key = $1 ORDER BY position`, licenseKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []string
+	for rows.Next() {
+		var hwid string
+		if err := rows.Scan(&hwid); err != nil {
+			return nil, err
+		}
+		devices = append(devices, hwid)
+	}
+	return devices, rows.Err()
+}
+
+// loadSeats returns the license's seat leases in checkout order, nil when there are none.
+func loadSeats(ctx context.Context, q sqlQuerier, licenseKey string) ([]Seat, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT id, hwid, checked_out_at, expires_at FROM seats WHERE license_key = $1 ORDER BY checked_out_at, id`, licenseKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seats []Seat
+	for rows.Next() {
+		var seat Seat
+		if err := rows.Scan(&seat.Id, &seat.Hwid, &seat.CheckedOutAt, &seat.ExpiresAt); err != nil {
+			return nil, err
+		}
+		seats = append(seats, seat)
+	}
+	return seats, rows.Err()
+}
+
+// loadEntitlements returns the license's entitlements, nil when there are none.
+func loadEntitlements(ctx context.Context, q sqlQuerier, licenseKey string) (Entitlements, error) {
+	rows, err := q.QueryContext(ctx, `SELECT name, quota FROM entitlements WHERE license_key = $1`, licenseKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entitlements Entitlements
+	for rows.Next() {
+		var (
+			name  string
+			quota sql.NullInt64
+		)
+		if err := rows.Scan(&name, &quota); err != nil {
+			return nil, err
+		}
+		if entitlements == nil {
+			entitlements = make(Entitlements)
+		}
+		entitlements[name] = nullableInt64(quota)
+	}
+	return entitlements, rows.Err()
+}
+
+func nullableInt64(q sql.NullInt64) *int64 {
+	if !q.Valid {
+		return nil
+	}
+	return &q.Int64
+}
+
+func insertLicense(ctx context.Context, q sqlQuerier, userId, position int, license License) error {
+	_, err := q.ExecContext(ctx,
+		`INSERT INTO licenses (license_key, user_id, position, product_id, plan_id, max_activations, issued_at, expires_at, status, grace_period, license_type, mode)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		license.Key, userId, position, license.ProductId, license.PlanId, license.MaxActivations, license.IssuedAt, license.ExpiresAt, license.Status,
+		license.GracePeriod, license.Type, license.Mode)
+	if err != nil {
+		return err
+	}
+	for i, hwid := range license.Devices {
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO devices (license_key, position, hwid) VALUES ($1, $2, $3)`, license.Key, i+1, hwid)
+		if err != nil {
+			return err
+		}
+	}
+	for name, quota := range license.Entitlements {
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO entitlements (license_key, name, quota) VALUES ($1, $2, $3)`, license.Key, name, quota)
+		if err != nil {
+			return err
+		}
+	}
+	for _, seat := range license.Seats {
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO seats (id, license_key, hwid, checked_out_at, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+			seat.Id, license.Key, seat.Hwid, seat.CheckedOutAt, seat.ExpiresAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteLicenseRows deletes the license and the rows that belong to it.
+func deleteLicenseRows(ctx context.Context, q sqlQuerier, licenseKey string) error {
+	for _, table := range []string{"devices", "entitlements", "seats"} {
+		if _, err := q.ExecContext(ctx, `DELETE FROM `+table+` WHERE license_key = $1`, licenseKey); err != nil {
+			return err
+		}
+	}
+	_, err := q.ExecContext(ctx, `DELETE FROM licenses WHERE license_key = $1`, licenseKey)
+	return err
+}
+
+func checkRowsAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoChange
+	}
+	return nil
+}
+
+// checkLicenseChanged is checkRowsAffected for updates of the license ref
+// points to. When nothing was affected it tells a missing user or license
+// apart from a license that was left as it was.
+func (s *SQLStore) checkLicenseChanged(ctx context.Context, ref LicenseRef, res sql.Result) error {
+	err := checkRowsAffected(res)
+	if !errors.Is(err, ErrNoChange) {
+		return err
+	}
+	if _, err := s.licenseKey(ctx, ref); err != nil {
+		return err
+	}
+	return ErrNoChange
+}
+
+// checkUserChanged is like checkLicenseChanged for updates of the user itself.
+func (s *SQLStore) checkUserChanged(ctx context.Context, userId int, res sql.Result) error {
+	err := checkRowsAffected(res)
+	if !errors.Is(err, ErrNoChange) {
+		return err
+	}
+	if _, err := s.GetUser(ctx, GetUserParams{UserId: userId}); err != nil {
+		return err
+	}
+	return ErrNoChange
+}
@@ -0,0 +1,359 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dzhisl/license-api/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// sqlMigration is a versioned schema change of the SQL backend.
+// Applied versions are tracked in the schema_migrations table;
+// new migrations must be appended with the next version number.
+type sqlMigration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+var sqlMigrations = []sqlMigration{
+	{
+		version: 1,
+		name:    "create users, licenses and devices",
+		statements: []string{
+			`CREATE TABLE users (
+				id          BIGINT PRIMARY KEY,
+				telegram_id BIGINT NOT NULL DEFAULT 0,
+				discord_id  BIGINT NOT NULL DEFAULT 0,
+				created_at  BIGINT NOT NULL
+			)`,
+			`CREATE INDEX users_telegram_id_idx ON users (telegram_id)`,
+			`CREATE INDEX users_discord_id_idx ON users (discord_id)`,
+			`CREATE TABLE licenses (
+				user_id         BIGINT PRIMARY KEY REFERENCES users (id),
+				license_key     TEXT NOT NULL,
+				max_activations INTEGER NOT NULL,
+				issued_at       BIGINT NOT NULL,
+				expires_at      BIGINT NOT NULL,
+				status          TEXT NOT NULL
+			)`,
+			`CREATE INDEX licenses_license_key_idx ON licenses (license_key)`,
+			`CREATE TABLE devices (
+				user_id  BIGINT NOT NULL REFERENCES users (id),
+				position INTEGER NOT NULL,
+				hwid     TEXT NOT NULL,
+				PRIMARY KEY (user_id, position)
+			)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "products and multiple licenses per user",
+		statements: []string{
+			`CREATE TABLE products (
+				id                      TEXT PRIMARY KEY,
+				name                    TEXT NOT NULL,
+				key_prefix              TEXT NOT NULL DEFAULT '',
+				key_length              INTEGER NOT NULL DEFAULT 0,
+				default_max_activations INTEGER NOT NULL DEFAULT 0,
+				default_duration        BIGINT NOT NULL DEFAULT 0,
+				created_at              BIGINT NOT NULL
+			)`,
+			// licenses are now identified by their key, position 0 is the primary license
+			`CREATE TABLE user_licenses (
+				license_key     TEXT PRIMARY KEY,
+				user_id         BIGINT NOT NULL REFERENCES users (id),
+				position        INTEGER NOT NULL,
+				product_id      TEXT NOT NULL DEFAULT '',
+				max_activations INTEGER NOT NULL,
+				issued_at       BIGINT NOT NULL,
+				expires_at      BIGINT NOT NULL,
+				status          TEXT NOT NULL
+			)`,
+			`INSERT INTO user_licenses (license_key, user_id, position, product_id, max_activations, issued_at, expires_at, status)
+			SELECT license_key, user_id, 0, '', max_activations, issued_at, expires_at, status FROM licenses`,
+			`CREATE TABLE license_devices (
+				license_key TEXT NOT NULL REFERENCES user_licenses (license_key),
+				position    INTEGER NOT NULL,
+				hwid        TEXT NOT NULL,
+				PRIMARY KEY (license_key, position)
+			)`,
+			`INSERT INTO license_devices (license_key, position, hwid)
+			SELECT l.license_key, d.position, d.hwid FROM devices d JOIN licenses l ON l.user_id = d.user_id`,
+			`DROP TABLE devices`,
+			`DROP TABLE licenses`,
+			`ALTER TABLE user_licenses RENAME TO licenses`,
+			`ALTER TABLE license_devices RENAME TO devices`,
+			`CREATE UNIQUE INDEX licenses_user_position_idx ON licenses (user_id, position)`,
+			`CREATE UNIQUE INDEX licenses_user_product_idx ON licenses (user_id, product_id)`,
+		},
+	},
+	{
+		version: 3,
+		name:    "plans",
+		statements: []string{
+			// features is a JSON array of strings
+			`CREATE TABLE plans (
+				id              TEXT PRIMARY KEY,
+				name            TEXT NOT NULL,
+				max_activations INTEGER NOT NULL,
+				duration        BIGINT NOT NULL DEFAULT 0,
+				features        TEXT NOT NULL DEFAULT '[]',
+				renewal         TEXT NOT NULL,
+				created_at      BIGINT NOT NULL
+			)`,
+			`ALTER TABLE licenses ADD COLUMN plan_id TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 4,
+		name:    "license entitlements",
+		statements: []string{
+			// a NULL quota is a plain feature
+			`CREATE TABLE entitlements (
+				license_key TEXT NOT NULL REFERENCES licenses (license_key),
+				name        TEXT NOT NULL,
+				quota       BIGINT,
+				PRIMARY KEY (license_key, name)
+			)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "audit log",
+		statements: []string{
+			// seq orders entries written within the same second
+			`CREATE TABLE audit_log (
+				seq          BIGINT NOT NULL,
+				time         BIGINT NOT NULL,
+				actor        TEXT NOT NULL,
+				request_id   TEXT NOT NULL,
+				action       TEXT NOT NULL,
+				user_id      BIGINT NOT NULL DEFAULT 0,
+				target       TEXT NOT NULL DEFAULT '',
+				before_value TEXT,
+				after_value  TEXT,
+				PRIMARY KEY (seq)
+			)`,
+			`CREATE INDEX audit_log_user_time_idx ON audit_log (user_id, time)`,
+			`CREATE INDEX audit_log_time_idx ON audit_log (time)`,
+		},
+	},
+	{
+		version: 6,
+		name:    "webhooks",
+		statements: []string{
+			`CREATE TABLE webhooks (
+				id         TEXT PRIMARY KEY,
+				url        TEXT NOT NULL,
+				secret     TEXT NOT NULL,
+				events     TEXT NOT NULL DEFAULT '[]',
+				created_at BIGINT NOT NULL
+			)`,
+			// seq keeps the enqueue order, ids are random
+			`CREATE TABLE webhook_deliveries (
+				seq          BIGINT NOT NULL,
+				id           TEXT NOT NULL UNIQUE,
+				webhook_id   TEXT NOT NULL,
+				event        TEXT NOT NULL,
+				payload      TEXT NOT NULL,
+				status       TEXT NOT NULL,
+				attempts     INTEGER NOT NULL DEFAULT 0,
+				next_attempt BIGINT NOT NULL,
+				last_error   TEXT NOT NULL DEFAULT '',
+				created_at   BIGINT NOT NULL,
+				PRIMARY KEY (seq)
+			)`,
+			`CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (status, next_attempt)`,
+		},
+	},
+	{
+		version: 7,
+		name:    "api keys",
+		statements: []string{
+			`CREATE TABLE api_keys (
+				id           TEXT PRIMARY KEY,
+				name         TEXT NOT NULL UNIQUE,
+				key_hash     TEXT NOT NULL UNIQUE,
+				prefix       TEXT NOT NULL,
+				scopes       TEXT NOT NULL DEFAULT '[]',
+				expires_at   BIGINT NOT NULL DEFAULT 0,
+				last_used_at BIGINT NOT NULL DEFAULT 0,
+				created_at   BIGINT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 8,
+		name:    "api key roles",
+		statements: []string{
+			`ALTER TABLE api_keys ADD COLUMN role TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 9,
+		name:    "user listing indexes",
+		statements: []string{
+			`CREATE INDEX users_created_at_idx ON users (created_at, id)`,
+			`CREATE INDEX licenses_expires_at_idx ON licenses (position, expires_at)`,
+			`CREATE INDEX licenses_status_idx ON licenses (position, status, expires_at)`,
+		},
+	},
+	{
+		version: 10,
+		name:    "unique telegram and discord ids",
+		statements: []string{
+			// 0 means unbound, so only bound ids must be unique
+			`DROP INDEX users_telegram_id_idx`,
+			`DROP INDEX users_discord_id_idx`,
+			`CREATE UNIQUE INDEX users_telegram_id_idx ON users (telegram_id) WHERE telegram_id <> 0`,
+			`CREATE UNIQUE INDEX users_discord_id_idx ON users (discord_id) WHERE discord_id <> 0`,
+		},
+	},
+	{
+		version: 11,
+		name:    "leases and notices for background jobs",
+		statements: []string{
+			`CREATE TABLE leases (
+				name       TEXT PRIMARY KEY,
+				holder     TEXT NOT NULL,
+				expires_at BIGINT NOT NULL
+			)`,
+			`CREATE TABLE notices (
+				id      TEXT PRIMARY KEY,
+				sent_at BIGINT NOT NULL
+			)`,
+			`CREATE INDEX licenses_expiry_idx ON licenses (status, expires_at)`,
+		},
+	},
+	{
+		version: 12,
+		name:    "license grace periods",
+		statements: []string{
+			// NULL uses the default grace period
+			`ALTER TABLE licenses ADD COLUMN grace_period BIGINT`,
+		},
+	},
+	{
+		version: 13,
+		name:    "renewal history",
+		statements: []string{
+			// seq orders renewals written within the same second
+			`CREATE TABLE renewals (
+				seq                 BIGINT PRIMARY KEY,
+				license_key         TEXT NOT NULL,
+				user_id             BIGINT NOT NULL,
+				time                BIGINT NOT NULL,
+				actor               TEXT NOT NULL,
+				request_id          TEXT NOT NULL,
+				source              TEXT NOT NULL,
+				amount              BIGINT NOT NULL,
+				previous_expires_at BIGINT NOT NULL,
+				expires_at          BIGINT NOT NULL
+			)`,
+			`CREATE INDEX renewals_license_key_idx ON renewals (license_key, seq)`,
+		},
+	},
+	{
+		version: 14,
+		name:    "trial licenses",
+		statements: []string{
+			// regular licenses have no type
+			`ALTER TABLE licenses ADD COLUMN license_type TEXT NOT NULL DEFAULT ''`,
+			`CREATE TABLE trials (
+				license_key TEXT PRIMARY KEY,
+				user_id     BIGINT NOT NULL,
+				hwid        TEXT NOT NULL UNIQUE,
+				telegram_id BIGINT NOT NULL,
+				discord_id  BIGINT NOT NULL,
+				claimed_at  BIGINT NOT NULL
+			)`,
+			// 0 means no account was given, so only given ids must be unique
+			`CREATE UNIQUE INDEX trials_telegram_id_idx ON trials (telegram_id) WHERE telegram_id <> 0`,
+			`CREATE UNIQUE INDEX trials_discord_id_idx ON trials (discord_id) WHERE discord_id <> 0`,
+		},
+	},
+	{
+		version: 15,
+		name:    "floating licenses",
+		statements: []string{
+			// node-locked licenses have no mode
+			`ALTER TABLE licenses ADD COLUMN mode TEXT NOT NULL DEFAULT ''`,
+			`CREATE TABLE seats (
+				id             TEXT PRIMARY KEY,
+				license_key    TEXT NOT NULL,
+				hwid           TEXT NOT NULL,
+				checked_out_at BIGINT NOT NULL,
+				expires_at     BIGINT NOT NULL,
+				UNIQUE (license_key, hwid)
+			)`,
+			`CREATE INDEX seats_expires_at_idx ON seats (expires_at)`,
+		},
+	},
+}
+
+// migrateSQL applies every migration from sqlMigrations that isn't recorded yet.
+// Each migration runs in its own transaction.
+func migrateSQL(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	for _, m := range sqlMigrations {
+		if applied[m.version] {
+			continue
+		}
+		if err := applySQLMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		logger.Info(ctx, "applied sql migration", zap.Int("version", m.version), zap.String("name", m.name))
+	}
+	return nil
+}
+
+func applySQLMigration(ctx context.Context, db *sql.DB, m sqlMigration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+		m.version, m.name, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -3,62 +3,145 @@ package storage
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/dzhisl/license-api/pkg/config"
 	"github.com/dzhisl/license-api/pkg/logger"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	// the v2 driver encodes v1 bson.D as an array, ordered documents
+	// such as sort specifications must use the v2 type
+	bsonv2 "go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 	"go.uber.org/zap"
 )
 
 var (
-	databaseName   = "license-manager"
-	collectionName = "users"
+	databaseName           = "license-manager"
+	collectionName         = "users"
+	productCollectionName  = "products"
+	planCollectionName     = "plans"
+	auditCollectionName    = "audit"
+	renewalCollectionName  = "renewals"
+	webhookCollectionName  = "webhooks"
+	deliveryCollectionName = "webhook_deliveries"
+	apiKeyCollectionName   = "api_keys"
+	leaseCollectionName    = "leases"
+	noticeCollectionName   = "notices"
+	trialCollectionName    = "trials"
 )
 
-var (
-	connector Connector
+// Supported values of config.AppConfig.StorageBackend.
+const (
+	BackendMongo  = "mongo"
+	BackendMemory = "memory"
+	BackendSQLite = "sqlite"
 )
 
+const defaultSQLiteDSN = "license-manager.db"
+
+// Connector is the MongoDB implementation of Store.
 type Connector struct {
-	userCollection *mongo.Collection
+	userCollection     *mongo.Collection
+	productCollection  *mongo.Collection
+	planCollection     *mongo.Collection
+	auditCollection    *mongo.Collection
+	renewalCollection  *mongo.Collection
+	webhookCollection  *mongo.Collection
+	deliveryCollection *mongo.Collection
+	apiKeyCollection   *mongo.Collection
+	leaseCollection    *mongo.Collection
+	noticeCollection   *mongo.Collection
+	trialCollection    *mongo.Collection
 }
 
-func GetConnector() Connector {
-	return connector
+var _ Store = (*Connector)(nil)
+
+// InitStorage connects to the storage backend selected by STORAGE_BACKEND
+// (MongoDB by default) and returns it.
+// It terminates the process if the backend can't be reached.
+func InitStorage(ctx context.Context) Store {
+	switch config.AppConfig.StorageBackend {
+	case BackendMemory:
+		logger.Info(ctx, "using in-memory storage")
+		return NewMemoryStore()
+	case BackendSQLite:
+		dsn := config.AppConfig.SQLiteDSN
+		if dsn == "" {
+			dsn = defaultSQLiteDSN
+		}
+		store, err := NewSQLStore(ctx, "sqlite", dsn)
+		if err != nil {
+			logger.Fatal(ctx, "failed to init sqlite storage", zap.Error(err))
+		}
+		logger.Info(ctx, "connected to SQLite", zap.String("dsn", dsn))
+		return store
+	case BackendMongo, "":
+		conn, err := NewConnector(ctx, config.AppConfig.MongoHost)
+		if err != nil {
+			logger.Fatal(ctx, "failed to init mongoDB storage", zap.Error(err))
+		}
+		logger.Info(ctx, "connected to MONGO DB")
+		return conn
+	default:
+		logger.Fatal(ctx, "unknown storage backend", zap.String("backend", config.AppConfig.StorageBackend))
+		return nil
+	}
 }
 
-func InitStorage(ctx context.Context) {
-	client, err := mongo.Connect(options.Client().ApplyURI(config.AppConfig.MongoHost))
+// NewConnector connects to MongoDB at uri and pings it up to 3 times.
+func NewConnector(ctx context.Context, uri string) (*Connector, error) {
+	// nil slices like License.Devices are stored as empty arrays, $push and $pull fail on null
+	bsonOpts := &options.BSONOptions{NilSliceAsEmpty: true}
+	client, err := mongo.Connect(options.Client().ApplyURI(uri).SetBSONOptions(bsonOpts))
 	if err != nil {
-		logger.Fatal(ctx, "failed to connect to mongoDB", zap.Error(err))
+		return nil, fmt.Errorf("failed to connect to mongoDB: %w", err)
 	}
 
 	userColl := client.Database(databaseName).Collection(collectionName)
 	for i := 0; i < 3; i++ {
-		err = userColl.Database().Client().Ping(context.Background(), nil)
-		if err != nil {
-			logger.Warn(ctx, "failed to ping mongoDB", zap.Error(err))
-			time.Sleep(5 * time.Second)
-			continue
+		err = userColl.Database().Client().Ping(ctx, nil)
+		if err == nil {
+			break
 		}
+		logger.Warn(ctx, "failed to ping mongoDB", zap.Error(err))
+		time.Sleep(5 * time.Second)
 	}
 	if err != nil {
-		logger.Fatal(ctx, "failed to ping mongoDB after 3 attempts")
+		return nil, fmt.Errorf("failed to ping mongoDB after 3 attempts: %w", err)
 	}
 
-	connector.userCollection = userColl
+	if err := migrateMongo(ctx, userColl.Database()); err != nil {
+		return nil, err
+	}
 
-	logger.Info(ctx, "connected to MONGO DB")
+	return &Connector{
+		userCollection:     userColl,
+		productCollection:  userColl.Database().Collection(productCollectionName),
+		planCollection:     userColl.Database().Collection(planCollectionName),
+		auditCollection:    userColl.Database().Collection(auditCollectionName),
+		renewalCollection:  userColl.Database().Collection(renewalCollectionName),
+		webhookCollection:  userColl.Database().Collection(webhookCollectionName),
+		deliveryCollection: userColl.Database().Collection(deliveryCollectionName),
+		apiKeyCollection:   userColl.Database().Collection(apiKeyCollectionName),
+		leaseCollection:    userColl.Database().Collection(leaseCollectionName),
+		noticeCollection:   userColl.Database().Collection(noticeCollectionName),
+		trialCollection:    userColl.Database().Collection(trialCollectionName),
+	}, nil
 }
 
 func (c *Connector) CreateUser(ctx context.Context, u User) error {
 	_, err := c.userCollection.InsertOne(ctx, u)
 	if err != nil {
-		return err
+		// the other unique indexes are on the bindings and license keys
+		if mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "index: _id_ ") {
+			return fmt.Errorf("%w: %d", ErrDuplicateUserId, u.Id)
+		}
+		return duplicateError(err)
 	}
 	return nil
 }
@@ -85,7 +168,10 @@ func (c *Connector) GetUser(ctx context.Context, params GetUserParams) (user *Us
 	case params.DiscordId != 0:
 		filter = bson.M{"discordId": params.DiscordId}
 	case params.License != "":
-		filter = bson.M{"license.key": params.License}
+		filter = bson.M{"$or": bson.A{
+			bson.M{"license.key": params.License},
+			bson.M{"licenses.key": params.License},
+		}}
 	default:
 		return nil, fmt.Errorf("at least one param must be provided")
 	}
@@ -96,7 +182,7 @@ func (c *Connector) GetUser(ctx context.Context, params GetUserParams) (user *Us
 
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("record for user wasn't found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -106,7 +192,7 @@ func (c *Connector) GetUser(ctx context.Context, params GetUserParams) (user *Us
 func (c *Connector) GetAllUsers(ctx context.Context) (user []*User, err error) {
 	var u []*User
 
-	cursor, err := c.userCollection.Find(ctx, nil)
+	cursor, err := c.userCollection.Find(ctx, bson.M{})
 
 	if err != nil {
 		return nil, err
@@ -118,115 +204,574 @@ func (c *Connector) GetAllUsers(ctx context.Context) (user []*User, err error) {
 	return u, nil
 }
 
-func (c *Connector) AddHwidSession(ctx context.Context, userId int, hwid string) error {
-	filter := bson.M{"_id": userId}
+// userSortFields maps the ListUsers orders to their document fields
+var userSortFields = map[UserSort]string{
+	SortById:        "_id",
+	SortByCreatedAt: "createdAt",
+	SortByExpiresAt: "license.expiresAt",
+}
+
+func (c *Connector) ListUsers(ctx context.Context, filter UserFilter) ([]*User, error) {
+	var conditions bson.A
+	if filter.Status != "" {
+		conditions = append(conditions, bson.M{"license.status": filter.Status})
+	}
+	if filter.ExpiresFrom != 0 || filter.ExpiresTo != 0 {
+		expiry := bson.M{"$ne": 0}
+		if filter.ExpiresFrom != 0 {
+			expiry["$gte"] = filter.ExpiresFrom
+		}
+		if filter.ExpiresTo != 0 {
+			expiry["$lte"] = filter.ExpiresTo
+		}
+		conditions = append(conditions, bson.M{"license.expiresAt": expiry})
+	}
+	if filter.CreatedFrom != 0 || filter.CreatedTo != 0 {
+		created := bson.M{}
+		if filter.CreatedFrom != 0 {
+			created["$gte"] = filter.CreatedFrom
+		}
+		if filter.CreatedTo != 0 {
+			created["$lte"] = filter.CreatedTo
+		}
+		conditions = append(conditions, bson.M{"createdAt": created})
+	}
+	if filter.HasTelegram != nil {
+		conditions = append(conditions, boundFilter("telegramId", *filter.HasTelegram))
+	}
+	if filter.HasDiscord != nil {
+		conditions = append(conditions, boundFilter("discordId", *filter.HasDiscord))
+	}
+	// devices is missing or null on licenses that never had one
+	devices := bson.M{"$size": bson.M{"$ifNull": bson.A{"$license.devices", bson.A{}}}}
+	if filter.MinDevices != nil {
+		conditions = append(conditions, bson.M{"$expr": bson.M{"$gte": bson.A{devices, *filter.MinDevices}}})
+	}
+	if filter.MaxDevices != nil {
+		conditions = append(conditions, bson.M{"$expr": bson.M{"$lte": bson.A{devices, *filter.MaxDevices}}})
+	}
+
+	field, ok := userSortFields[filter.Sort]
+	if !ok {
+		field = userSortFields[SortById]
+	}
+	direction, op := 1, "$gt"
+	if filter.Desc {
+		direction, op = -1, "$lt"
+	}
+	if after := filter.After; after != nil {
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{field: bson.M{op: after.Value}},
+			bson.M{field: after.Value, "_id": bson.M{op: after.Id}},
+		}})
+	}
+
+	query := bson.M{}
+	if len(conditions) > 0 {
+		query["$and"] = conditions
+	}
+	sort := bsonv2.D{{Key: field, Value: direction}}
+	if field != "_id" {
+		sort = append(sort, bsonv2.E{Key: "_id", Value: direction})
+	}
+	opts := options.Find().SetSort(sort)
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+
+	cursor, err := c.userCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	var users []*User
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("failed to unpack users to struct:%w", err)
+	}
+	return users, nil
+}
 
+// boundFilter selects the users with (or without) an account id in field.
+func boundFilter(field string, bound bool) bson.M {
+	if bound {
+		return bson.M{field: bson.M{"$ne": 0}}
+	}
+	return bson.M{field: 0}
+}
+
+func (c *Connector) AddLicense(ctx context.Context, userId int, license License) error {
 	user, err := c.GetUser(ctx, GetUserParams{UserId: userId})
 	if err != nil {
 		return err
 	}
-	if len(user.License.Devices) >= user.License.MaxActivations {
-		return fmt.Errorf("user have maximum allowed activations: %d", user.License.MaxActivations)
+	if err := checkNewLicense(user, license); err != nil {
+		return err
 	}
 
-	user.License.Devices = append(user.License.Devices, hwid)
-	update := bson.M{"$set": bson.M{"license.devices": user.License.Devices}}
+	// the filter makes sure no license for the product was added concurrently
+	filter := bson.M{
+		"_id":                userId,
+		"license.productId":  bson.M{"$ne": license.ProductId},
+		"licenses.productId": bson.M{"$ne": license.ProductId},
+	}
+	update := bson.M{"$push": bson.M{"licenses": license}}
 	res, err := c.userCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return fmt.Errorf("failed to update user devices: %w", err)
+		return duplicateError(fmt.Errorf("failed to add license: %w", err))
 	}
 	if res.ModifiedCount == 0 {
-		return fmt.Errorf("no rows affected")
+		return fmt.Errorf("%w: user already has a license for product %s", ErrDuplicate, license.ProductId)
 	}
 	return nil
 }
 
-func (c *Connector) DeleteHwidSession(ctx context.Context, userId int, hwid string) error {
-	filter := bson.M{"_id": userId}
+// licenseLocation tells where a license lives inside a user document.
+type licenseLocation struct {
+	// filter matches the user and guards against the license being replaced
+	filter bson.M
+	// index into "licenses", -1 for the primary license
+	index int
+}
 
-	user, err := c.GetUser(ctx, GetUserParams{UserId: userId})
+// path returns the update path of a license field.
+func (loc licenseLocation) path(field string) string {
+	if loc.index < 0 {
+		return "license." + field
+	}
+	return fmt.Sprintf("licenses.%d.%s", loc.index, field)
+}
+
+// expr returns an aggregation expression resolving to a license field.
+func (loc licenseLocation) expr(field string) any {
+	if loc.index < 0 {
+		return "$license." + field
+	}
+	return bson.M{"$let": bson.M{
+		"vars": bson.M{"l": bson.M{"$arrayElemAt": bson.A{"$licenses", loc.index}}},
+		"in":   "$$l." + field,
+	}}
+}
+
+// locateLicense resolves ref. The primary license is addressed without a read,
+// product licenses need the user document to find their position.
+func (c *Connector) locateLicense(ctx context.Context, ref LicenseRef) (licenseLocation, error) {
+	if ref.ProductId == "" {
+		return licenseLocation{filter: bson.M{"_id": ref.UserId}, index: -1}, nil
+	}
+
+	user, err := c.GetUser(ctx, GetUserParams{UserId: ref.UserId})
+	if err != nil {
+		return licenseLocation{}, err
+	}
+	if user.License.ProductId == ref.ProductId {
+		return licenseLocation{filter: bson.M{"_id": ref.UserId, "license.key": user.License.Key}, index: -1}, nil
+	}
+	for i, l := range user.Licenses {
+		if l.ProductId == ref.ProductId {
+			loc := licenseLocation{index: i}
+			loc.filter = bson.M{"_id": ref.UserId, loc.path("key"): l.Key}
+			return loc, nil
+		}
+	}
+	return licenseLocation{}, ErrLicenseNotFound
+}
+
+// updateLicenseField sets a single field of the referenced license.
+// action describes the update in the returned database errors.
+func (c *Connector) updateLicenseField(ctx context.Context, ref LicenseRef, field string, value any, action string) error {
+	loc, err := c.locateLicense(ctx, ref)
 	if err != nil {
 		return err
 	}
+	update := bson.M{"$set": bson.M{loc.path(field): value}}
+	res, err := c.userCollection.UpdateOne(ctx, loc.filter, update)
+	if err != nil {
+		return fmt.Errorf("%s: %w", action, err)
+	}
+	if res.MatchedCount == 0 {
+		return c.missingLicense(ctx, ref)
+	}
+	if res.ModifiedCount == 0 {
+		return ErrNoChange
+	}
+	return nil
+}
 
-	var newHwidSessions []string
-	for _, session := range user.License.Devices {
-		if session != hwid {
-			newHwidSessions = append(newHwidSessions, session)
-		}
+// missingLicense tells why an update filtered by a licenseLocation matched
+// nothing: the user or the license is gone.
+func (c *Connector) missingLicense(ctx context.Context, ref LicenseRef) error {
+	if _, err := c.GetUser(ctx, GetUserParams{UserId: ref.UserId}); err != nil {
+		return err
 	}
-	update := bson.M{"$set": bson.M{"license.devices": newHwidSessions}}
+	return ErrLicenseNotFound
+}
+
+// AddHwidSession binds hwid to the license. The device limit is checked
+// by the update filter itself, so concurrent activations can't exceed it.
+func (c *Connector) AddHwidSession(ctx context.Context, ref LicenseRef, hwid string) error {
+	loc, err := c.locateLicense(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	filter := loc.filter
+	filter[loc.path("devices")] = bson.M{"$ne": hwid}
+	filter["$expr"] = bson.M{"$lt": bson.A{
+		bson.M{"$size": bson.M{"$ifNull": bson.A{loc.expr("devices"), bson.A{}}}},
+		loc.expr("maxActivations"),
+	}}
+	update := bson.M{"$push": bson.M{loc.path("devices"): hwid}}
 	res, err := c.userCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return fmt.Errorf("failed to update user devices: %w", err)
 	}
+	if res.ModifiedCount > 0 {
+		return nil
+	}
+
+	// nothing matched, find out why
+	user, err := c.GetUser(ctx, GetUserParams{UserId: ref.UserId})
+	if err != nil {
+		return err
+	}
+	license := user.FindLicense(ref.ProductId)
+	if license == nil {
+		return ErrLicenseNotFound
+	}
+	if slices.Contains(license.Devices, hwid) {
+		return ErrNoChange
+	}
+	return fmt.Errorf("%w: %d", ErrActivationLimit, license.MaxActivations)
+}
+
+func (c *Connector) DeleteHwidSession(ctx context.Context, ref LicenseRef, hwid string) error {
+	loc, err := c.locateLicense(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$pull": bson.M{loc.path("devices"): hwid}}
+	res, err := c.userCollection.UpdateOne(ctx, loc.filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to update user devices: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return c.missingLicense(ctx, ref)
+	}
 	if res.ModifiedCount == 0 {
-		return fmt.Errorf("no rows affected")
+		return ErrNoChange
 	}
 	return nil
 }
 
-func (c *Connector) ResetHwidSessions(ctx context.Context, userId int) error {
-	filter := bson.M{"_id": userId}
-	update := bson.M{"$set": bson.M{"license.devices": nil}}
-	res, err := c.userCollection.UpdateOne(ctx, filter, update)
+func (c *Connector) ResetHwidSessions(ctx context.Context, ref LicenseRef) error {
+	return c.updateLicenseField(ctx, ref, "devices", bson.A{}, "failed to reset user devices")
+}
+
+// CheckoutSeat first pulls the expired leases, then renews the lease of the
+// machine or pushes a new one. Like in AddHwidSession the seat limit is
+// checked by the update filter, so concurrent checkouts can't exceed it.
+func (c *Connector) CheckoutSeat(ctx context.Context, ref LicenseRef, seat Seat, now Timestamp) (Seat, error) {
+	loc, err := c.locateLicense(ctx, ref)
 	if err != nil {
-		return fmt.Errorf("failed to reset user devices: %w", err)
+		return Seat{}, err
 	}
-	if res.ModifiedCount == 0 {
-		return fmt.Errorf("no rows affected")
+
+	expired := bson.M{"$pull": bson.M{loc.path("seats"): bson.M{"expiresAt": bson.M{"$lte": now}}}}
+	if _, err := c.userCollection.UpdateOne(ctx, loc.filter, expired); err != nil {
+		return Seat{}, fmt.Errorf("failed to reclaim seats: %w", err)
+	}
+
+	held, err := c.renewSeat(ctx, loc, bson.M{"hwid": seat.Hwid}, seat.ExpiresAt, now)
+	if err != nil {
+		return Seat{}, err
+	}
+	if held {
+		return c.heldSeat(ctx, ref, seat.Hwid, now)
+	}
+
+	filter := bson.M{loc.path("seats.hwid"): bson.M{"$ne": seat.Hwid}}
+	maps.Copy(filter, loc.filter)
+	live := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{loc.expr("seats"), bson.A{}}},
+		"cond":  bson.M{"$gt": bson.A{"$$this.expiresAt", now}},
+	}}
+	filter["$expr"] = bson.M{"$lt": bson.A{bson.M{"$size": live}, loc.expr("maxActivations")}}
+	res, err := c.userCollection.UpdateOne(ctx, filter, bson.M{"$push": bson.M{loc.path("seats"): seat}})
+	if err != nil {
+		return Seat{}, fmt.Errorf("failed to check out seat: %w", err)
+	}
+	if res.ModifiedCount > 0 {
+		return seat, nil
+	}
+
+	// nothing matched, the machine may have checked out concurrently
+	return c.heldSeat(ctx, ref, seat.Hwid, now)
+}
+
+// renewSeat moves the expiry of the live lease matching match to until and
+// reports whether there was one.
+func (c *Connector) renewSeat(ctx context.Context, loc licenseLocation, match bson.M, until, now Timestamp) (bool, error) {
+	elem := bson.M{"expiresAt": bson.M{"$gt": now}}
+	arrayFilter := bson.M{"seat.expiresAt": bson.M{"$gt": now}}
+	for field, value := range match {
+		elem[field] = value
+		arrayFilter["seat."+field] = value
+	}
+	filter := bson.M{loc.path("seats"): bson.M{"$elemMatch": elem}}
+	maps.Copy(filter, loc.filter)
+
+	update := bson.M{"$set": bson.M{loc.path("seats.$[seat].expiresAt"): until}}
+	opts := options.UpdateOne().SetArrayFilters([]any{arrayFilter})
+	res, err := c.userCollection.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return false, fmt.Errorf("failed to renew seat: %w", err)
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// heldSeat reads the live lease of hwid, ErrSeatLimit if it holds none.
+func (c *Connector) heldSeat(ctx context.Context, ref LicenseRef, hwid string, now Timestamp) (Seat, error) {
+	user, err := c.GetUser(ctx, GetUserParams{UserId: ref.UserId})
+	if err != nil {
+		return Seat{}, err
+	}
+	license := user.FindLicense(ref.ProductId)
+	if license == nil {
+		return Seat{}, ErrLicenseNotFound
+	}
+	if seat := license.HeldSeat(hwid, int64(now)); seat != nil {
+		return *seat, nil
+	}
+	return Seat{}, fmt.Errorf("%w: %d", ErrSeatLimit, license.MaxActivations)
+}
+
+func (c *Connector) HeartbeatSeat(ctx context.Context, ref LicenseRef, seatId string, until, now Timestamp) error {
+	loc, err := c.locateLicense(ctx, ref)
+	if err != nil {
+		return err
+	}
+	held, err := c.renewSeat(ctx, loc, bson.M{"id": seatId}, until, now)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return ErrSeatNotFound
 	}
 	return nil
 }
 
-func (c *Connector) ChangeLicenseStatus(ctx context.Context, userId int, status LicenseStatus) error {
-	filter := bson.M{"_id": userId}
-	update := bson.M{"$set": bson.M{"license.status": status}}
-	res, err := c.userCollection.UpdateOne(ctx, filter, update)
+func (c *Connector) ReleaseSeat(ctx context.Context, ref LicenseRef, seatId string) error {
+	loc, err := c.locateLicense(ctx, ref)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$pull": bson.M{loc.path("seats"): bson.M{"id": seatId}}}
+	res, err := c.userCollection.UpdateOne(ctx, loc.filter, update)
 	if err != nil {
-		return fmt.Errorf("failed to update license status: %w", err)
+		return fmt.Errorf("failed to release seat: %w", err)
 	}
 	if res.ModifiedCount == 0 {
-		return fmt.Errorf("no rows affected")
+		return ErrSeatNotFound
 	}
 	return nil
 }
 
-func (c *Connector) UpdateLicense(ctx context.Context, userId int, license License) error {
-	filter := bson.M{"_id": userId}
-	update := bson.M{"$set": bson.M{"license": license}}
-	res, err := c.userCollection.UpdateOne(ctx, filter, update)
+func (c *Connector) ReclaimSeats(ctx context.Context, now Timestamp) error {
+	expired := bson.M{"expiresAt": bson.M{"$lte": now}}
+	_, err := c.userCollection.UpdateMany(ctx,
+		bson.M{"license.seats.expiresAt": bson.M{"$lte": now}},
+		bson.M{"$pull": bson.M{"license.seats": expired}})
+	if err != nil {
+		return fmt.Errorf("failed to reclaim seats: %w", err)
+	}
+	_, err = c.userCollection.UpdateMany(ctx,
+		bson.M{"licenses.seats.expiresAt": bson.M{"$lte": now}},
+		bson.M{"$pull": bson.M{"licenses.$[].seats": expired}})
+	if err != nil {
+		return fmt.Errorf("failed to reclaim seats: %w", err)
+	}
+	return nil
+}
+
+func (c *Connector) ChangeLicenseStatus(ctx context.Context, ref LicenseRef, status LicenseStatus) error {
+	return c.updateLicenseField(ctx, ref, "status", status, "failed to update license status")
+}
+
+func (c *Connector) UpdateLicense(ctx context.Context, ref LicenseRef, license License) error {
+	user, err := c.GetUser(ctx, GetUserParams{UserId: ref.UserId})
+	if err != nil {
+		return err
+	}
+	current := user.FindLicense(ref.ProductId)
+	if current == nil {
+		return ErrLicenseNotFound
+	}
+	// the slot keeps its product
+	license.ProductId = current.ProductId
+
+	loc, err := c.locateLicense(ctx, ref)
+	if err != nil {
+		return err
+	}
+	field := "license"
+	if loc.index >= 0 {
+		field = fmt.Sprintf("licenses.%d", loc.index)
+	}
+	update := bson.M{"$set": bson.M{field: license}}
+	res, err := c.userCollection.UpdateOne(ctx, loc.filter, update)
 	if err != nil {
 		return fmt.Errorf("failed to update license: %w", err)
 	}
+	if res.MatchedCount == 0 {
+		return c.missingLicense(ctx, ref)
+	}
 	if res.ModifiedCount == 0 {
-		return fmt.Errorf("no rows affected")
+		return ErrNoChange
 	}
 	return nil
 }
 
-func (c *Connector) UpdateHwidLimit(ctx context.Context, userId, newLimit int) error {
-	filter := bson.M{"_id": userId}
-	update := bson.M{"$set": bson.M{"license.maxActivations": newLimit}}
+func (c *Connector) UpdateHwidLimit(ctx context.Context, ref LicenseRef, newLimit int) error {
+	return c.updateLicenseField(ctx, ref, "maxActivations", newLimit, "failed to update license hwid limits")
+}
+
+func (c *Connector) RenewLicense(ctx context.Context, ref LicenseRef, expiresAt Timestamp) error {
+	return c.updateLicenseField(ctx, ref, "expiresAt", expiresAt, "failed to renew license")
+}
+
+func (c *Connector) ExpiringUsers(ctx context.Context, before Timestamp) ([]*User, error) {
+	expiring := bson.M{"status": Active, "expiresAt": bson.M{"$gt": 0, "$lte": before}}
+	filter := bson.M{"$or": bson.A{
+		bson.M{"license.status": Active, "license.expiresAt": bson.M{"$gt": 0, "$lte": before}},
+		bson.M{"licenses": bson.M{"$elemMatch": expiring}},
+	}}
+	cursor, err := c.userCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*User
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("failed to unpack users to struct:%w", err)
+	}
+	return users, nil
+}
+
+func (c *Connector) ExpireLicense(ctx context.Context, ref LicenseRef, now Timestamp) error {
+	loc, err := c.locateLicense(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	filter := loc.filter
+	filter[loc.path("status")] = Active
+	filter[loc.path("expiresAt")] = bson.M{"$gt": 0, "$lte": now}
+	update := bson.M{"$set": bson.M{loc.path("status"): Expired}}
 	res, err := c.userCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return fmt.Errorf("failed to update license hwid limits: %w", err)
+		return fmt.Errorf("failed to expire license: %w", err)
 	}
 	if res.ModifiedCount == 0 {
-		return fmt.Errorf("no rows affected")
+		return ErrNoChange
 	}
 	return nil
 }
 
-func (c *Connector) RenewLicense(ctx context.Context, userId int, expiresAt Timestamp) error {
-	filter := bson.M{"_id": userId}
-	update := bson.M{"$set": bson.M{"license.expiresAt": expiresAt}}
+// ConvertTrial updates the license only while it is a trial, the filter
+// on its type makes a concurrent conversion a no-op.
+func (c *Connector) ConvertTrial(ctx context.Context, ref LicenseRef, terms License) error {
+	loc, err := c.locateLicense(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	filter := loc.filter
+	filter[loc.path("type")] = Trial
+	set := bson.M{
+		loc.path("planId"):         terms.PlanId,
+		loc.path("maxActivations"): terms.MaxActivations,
+		loc.path("expiresAt"):      terms.ExpiresAt,
+		loc.path("status"):         Active,
+		loc.path("gracePeriod"):    terms.GracePeriod,
+	}
+	unset := bson.M{loc.path("type"): ""}
+	// a null map would make a later GrantEntitlement fail
+	if len(terms.Entitlements) == 0 {
+		unset[loc.path("entitlements")] = ""
+	} else {
+		set[loc.path("entitlements")] = terms.Entitlements
+	}
+	update := bson.M{"$set": set, "$unset": unset}
 	res, err := c.userCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return fmt.Errorf("failed to renew license: %w", err)
+		return fmt.Errorf("failed to convert trial: %w", err)
 	}
 	if res.ModifiedCount == 0 {
-		return fmt.Errorf("no rows affected")
+		return ErrNoChange
+	}
+	return nil
+}
+
+func (c *Connector) ClaimTrial(ctx context.Context, claim TrialClaim) error {
+	_, err := c.trialCollection.InsertOne(ctx, claim)
+	return duplicateError(err)
+}
+
+func (c *Connector) ExtendLicense(ctx context.Context, ref LicenseRef, seconds int64, now Timestamp) (previous, expiresAt Timestamp, err error) {
+	for range extendAttempts {
+		user, err := c.GetUser(ctx, GetUserParams{UserId: ref.UserId})
+		if err != nil {
+			return 0, 0, err
+		}
+		license := user.FindLicense(ref.ProductId)
+		if license == nil {
+			return 0, 0, ErrLicenseNotFound
+		}
+		if license.ExpiresAt == 0 {
+			return 0, 0, ErrNoChange
+		}
+		previous, expiresAt = license.ExpiresAt, license.ExtendedExpiry(seconds, int64(now))
+
+		loc, err := c.locateLicense(ctx, ref)
+		if err != nil {
+			return 0, 0, err
+		}
+		// the expiry in the filter makes a concurrent renewal fail this update
+		filter := loc.filter
+		filter[loc.path("expiresAt")] = previous
+		update := bson.M{"$set": bson.M{loc.path("expiresAt"): expiresAt}}
+		res, err := c.userCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to extend license: %w", err)
+		}
+		if res.ModifiedCount > 0 {
+			return previous, expiresAt, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("failed to extend license: the expiry kept changing")
+}
+
+func (c *Connector) SetGracePeriod(ctx context.Context, ref LicenseRef, gracePeriod *int64) error {
+	return c.updateLicenseField(ctx, ref, "gracePeriod", gracePeriod, "failed to set license grace period")
+}
+
+// GrantEntitlement sets the quota of the entitlement, names must not contain dots.
+func (c *Connector) GrantEntitlement(ctx context.Context, ref LicenseRef, name string, quota *int64) error {
+	return c.updateLicenseField(ctx, ref, "entitlements."+name, quota, "failed to grant entitlement")
+}
+
+func (c *Connector) RevokeEntitlement(ctx context.Context, ref LicenseRef, name string) error {
+	loc, err := c.locateLicense(ctx, ref)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$unset": bson.M{loc.path("entitlements." + name): ""}}
+	res, err := c.userCollection.UpdateOne(ctx, loc.filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to revoke entitlement: %w", err)
+	}
+	if res.ModifiedCount == 0 {
+		return ErrNoChange
 	}
 	return nil
 }
@@ -236,10 +781,13 @@ func (c *Connector) BindDiscord(ctx context.Context, userId, discordId int) erro
 	update := bson.M{"$set": bson.M{"discordId": discordId}}
 	res, err := c.userCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return fmt.Errorf("failed to bind discord for user: %w", err)
+		return duplicateError(fmt.Errorf("failed to bind discord for user: %w", err))
+	}
+	if res.MatchedCount == 0 {
+		return ErrUserNotFound
 	}
 	if res.ModifiedCount == 0 {
-		return fmt.Errorf("no rows affected")
+		return ErrNoChange
 	}
 	return nil
 }
@@ -249,10 +797,387 @@ func (c *Connector) BindTelegram(ctx context.Context, userId, telegramId int) er
 	update := bson.M{"$set": bson.M{"telegramId": telegramId}}
 	res, err := c.userCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return fmt.Errorf("failed to bind telegram for user: %w", err)
+		return duplicateError(fmt.Errorf("failed to bind telegram for user: %w", err))
+	}
+	if res.MatchedCount == 0 {
+		return ErrUserNotFound
 	}
 	if res.ModifiedCount == 0 {
-		return fmt.Errorf("no rows affected")
+		return ErrNoChange
+	}
+	return nil
+}
+
+func (c *Connector) CreateProduct(ctx context.Context, p Product) error {
+	_, err := c.productCollection.InsertOne(ctx, p)
+	if err != nil {
+		return duplicateError(err)
+	}
+	return nil
+}
+
+func (c *Connector) GetProduct(ctx context.Context, productId string) (*Product, error) {
+	var p *Product
+
+	err := c.productCollection.FindOne(ctx, bson.M{"_id": productId}).Decode(&p)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+func (c *Connector) GetAllProducts(ctx context.Context) ([]*Product, error) {
+	var p []*Product
+
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	cursor, err := c.productCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cursor.All(ctx, &p); err != nil {
+		return nil, fmt.Errorf("failed to unpack products to struct:%w", err)
+	}
+	return p, nil
+}
+
+func (c *Connector) DeleteProduct(ctx context.Context, productId string) (deletedCount int64, err error) {
+	res, err := c.productCollection.DeleteOne(ctx, bson.M{"_id": productId})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (c *Connector) CreatePlan(ctx context.Context, p Plan) error {
+	_, err := c.planCollection.InsertOne(ctx, p)
+	if err != nil {
+		return duplicateError(err)
 	}
 	return nil
 }
+
+func (c *Connector) GetPlan(ctx context.Context, planId string) (*Plan, error) {
+	var p *Plan
+
+	err := c.planCollection.FindOne(ctx, bson.M{"_id": planId}).Decode(&p)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPlanNotFound
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+func (c *Connector) GetAllPlans(ctx context.Context) ([]*Plan, error) {
+	var p []*Plan
+
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	cursor, err := c.planCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cursor.All(ctx, &p); err != nil {
+		return nil, fmt.Errorf("failed to unpack plans to struct:%w", err)
+	}
+	return p, nil
+}
+
+func (c *Connector) UpdatePlan(ctx context.Context, p Plan) error {
+	filter := bson.M{"_id": p.Id}
+	update := bson.M{"$set": bson.M{
+		"name":           p.Name,
+		"maxActivations": p.MaxActivations,
+		"duration":       p.Duration,
+		"features":       p.Features,
+		"renewal":        p.Renewal,
+	}}
+	res, err := c.planCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to update plan: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNoChange
+	}
+	return nil
+}
+
+func (c *Connector) DeletePlan(ctx context.Context, planId string) (deletedCount int64, err error) {
+	res, err := c.planCollection.DeleteOne(ctx, bson.M{"_id": planId})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (c *Connector) AppendAudit(ctx context.Context, e AuditEntry) error {
+	_, err := c.auditCollection.InsertOne(ctx, e)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Connector) ListAudit(ctx context.Context, filter AuditFilter) ([]*AuditEntry, error) {
+	query := bson.M{}
+	if filter.UserId != 0 {
+		query["userId"] = filter.UserId
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	timeRange := bson.M{}
+	if filter.From != 0 {
+		timeRange["$gte"] = filter.From
+	}
+	if filter.To != 0 {
+		timeRange["$lte"] = filter.To
+	}
+	if len(timeRange) > 0 {
+		query["time"] = timeRange
+	}
+
+	// _id breaks ties within a second, ObjectIds grow with insertion
+	opts := options.Find().SetSort(bsonv2.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+	cursor, err := c.auditCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*AuditEntry
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to unpack audit entries to struct:%w", err)
+	}
+	return entries, nil
+}
+
+func (c *Connector) AppendRenewal(ctx context.Context, r Renewal) error {
+	_, err := c.renewalCollection.InsertOne(ctx, r)
+	return err
+}
+
+func (c *Connector) ListRenewals(ctx context.Context, licenseKey string) ([]*Renewal, error) {
+	// _id breaks ties within a second, ObjectIds grow with insertion
+	opts := options.Find().SetSort(bsonv2.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := c.renewalCollection.Find(ctx, bson.M{"licenseKey": licenseKey}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var renewals []*Renewal
+	if err = cursor.All(ctx, &renewals); err != nil {
+		return nil, fmt.Errorf("failed to unpack renewals to struct:%w", err)
+	}
+	return renewals, nil
+}
+
+func (c *Connector) CreateWebhook(ctx context.Context, w Webhook) error {
+	_, err := c.webhookCollection.InsertOne(ctx, w)
+	if err != nil {
+		return duplicateError(err)
+	}
+	return nil
+}
+
+func (c *Connector) GetWebhook(ctx context.Context, webhookId string) (*Webhook, error) {
+	var w *Webhook
+
+	err := c.webhookCollection.FindOne(ctx, bson.M{"_id": webhookId}).Decode(&w)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return w, nil
+}
+
+func (c *Connector) GetAllWebhooks(ctx context.Context) ([]*Webhook, error) {
+	var w []*Webhook
+
+	opts := options.Find().SetSort(bsonv2.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := c.webhookCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cursor.All(ctx, &w); err != nil {
+		return nil, fmt.Errorf("failed to unpack webhooks to struct:%w", err)
+	}
+	return w, nil
+}
+
+func (c *Connector) DeleteWebhook(ctx context.Context, webhookId string) (deletedCount int64, err error) {
+	res, err := c.webhookCollection.DeleteOne(ctx, bson.M{"_id": webhookId})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (c *Connector) EnqueueDelivery(ctx context.Context, d WebhookDelivery) error {
+	_, err := c.deliveryCollection.InsertOne(ctx, d)
+	if err != nil {
+		return duplicateError(err)
+	}
+	return nil
+}
+
+func (c *Connector) GetDelivery(ctx context.Context, deliveryId string) (*WebhookDelivery, error) {
+	var d *WebhookDelivery
+
+	err := c.deliveryCollection.FindOne(ctx, bson.M{"_id": deliveryId}).Decode(&d)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+func (c *Connector) DueDeliveries(ctx context.Context, now Timestamp, limit int) ([]*WebhookDelivery, error) {
+	filter := bson.M{"status": DeliveryPending, "nextAttempt": bson.M{"$lte": now}}
+	opts := options.Find().SetSort(bsonv2.D{{Key: "nextAttempt", Value: 1}, {Key: "createdAt", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	return c.findDeliveries(ctx, filter, opts)
+}
+
+func (c *Connector) ListDeliveries(ctx context.Context, status DeliveryStatus, limit int) ([]*WebhookDelivery, error) {
+	opts := options.Find().SetSort(bsonv2.D{{Key: "createdAt", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	return c.findDeliveries(ctx, bson.M{"status": status}, opts)
+}
+
+func (c *Connector) findDeliveries(ctx context.Context, filter bson.M, opts *options.FindOptionsBuilder) ([]*WebhookDelivery, error) {
+	cursor, err := c.deliveryCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var d []*WebhookDelivery
+	if err = cursor.All(ctx, &d); err != nil {
+		return nil, fmt.Errorf("failed to unpack deliveries to struct:%w", err)
+	}
+	return d, nil
+}
+
+func (c *Connector) UpdateDelivery(ctx context.Context, d WebhookDelivery) error {
+	filter := bson.M{"_id": d.Id}
+	update := bson.M{"$set": bson.M{
+		"status":      d.Status,
+		"attempts":    d.Attempts,
+		"nextAttempt": d.NextAttempt,
+		"lastError":   d.LastError,
+	}}
+	res, err := c.deliveryCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to update delivery: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNoChange
+	}
+	return nil
+}
+
+func (c *Connector) CreateAPIKey(ctx context.Context, k APIKey) error {
+	// names and hashes are unique, like the constraints of the SQL schema
+	filter := bson.M{"$or": bson.A{bson.M{"name": k.Name}, bson.M{"hash": k.Hash}}}
+	count, err := c.apiKeyCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: api key %s already exists", ErrDuplicate, k.Name)
+	}
+
+	_, err = c.apiKeyCollection.InsertOne(ctx, k)
+	if err != nil {
+		return duplicateError(err)
+	}
+	return nil
+}
+
+func (c *Connector) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	var k *APIKey
+
+	err := c.apiKeyCollection.FindOne(ctx, bson.M{"hash": hash}).Decode(&k)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+	return k, nil
+}
+
+func (c *Connector) GetAllAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	var k []*APIKey
+
+	opts := options.Find().SetSort(bson.M{"name": 1})
+	cursor, err := c.apiKeyCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cursor.All(ctx, &k); err != nil {
+		return nil, fmt.Errorf("failed to unpack api keys to struct:%w", err)
+	}
+	return k, nil
+}
+
+func (c *Connector) DeleteAPIKey(ctx context.Context, keyId string) (deletedCount int64, err error) {
+	res, err := c.apiKeyCollection.DeleteOne(ctx, bson.M{"_id": keyId})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (c *Connector) TouchAPIKey(ctx context.Context, keyId string, usedAt Timestamp) error {
+	filter := bson.M{"_id": keyId}
+	update := bson.M{"$set": bson.M{"lastUsedAt": usedAt}}
+	res, err := c.apiKeyCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to touch api key: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNoChange
+	}
+	return nil
+}
+
+// AcquireLease upserts the lease document. When another holder has a lease
+// that is still valid the filter doesn't match, and the insert fails on its id.
+func (c *Connector) AcquireLease(ctx context.Context, name, holder string, until, now Timestamp) (bool, error) {
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{bson.M{"holder": holder}, bson.M{"expiresAt": bson.M{"$lte": now}}},
+	}
+	update := bson.M{"$set": bson.M{"holder": holder, "expiresAt": until}}
+	_, err := c.leaseCollection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+	return true, nil
+}
+
+func (c *Connector) RecordNotice(ctx context.Context, noticeId string, sentAt Timestamp) error {
+	_, err := c.noticeCollection.InsertOne(ctx, bson.M{"_id": noticeId, "sentAt": sentAt})
+	return duplicateError(err)
+}
@@ -2,17 +2,30 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/dzhisl/license-api/pkg/config"
 	"github.com/dzhisl/license-api/pkg/logger"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 var testCtx = context.Background()
+
+// equateEmpty makes nil and empty slices equal, Mongo stores nil ones as empty arrays
+var equateEmpty = cmpopts.EquateEmpty()
 var (
 	user = User{
 		Id:         1,
@@ -28,23 +41,61 @@ var (
 			IssuedAt:  Timestamp(1234567890),
 			ExpiresAt: Timestamp(1234567890 + 30*24*3600),
 			Status:    Frozen,
+			Entitlements: Entitlements{
+				"export":       nil,
+				"max_projects": quota(10),
+			},
 		},
 		CreatedAt: Timestamp(234567890),
 	}
 )
 
+func quota(q int64) *int64 {
+	return &q
+}
+
 func TestMain(m *testing.M) {
 	config.InitConfig()
 	logger.InitLogger()
 
-	InitStorage(testCtx)
 	code := m.Run()
 	os.Exit(code)
 }
 
+// testStores returns every backend the behavioral suite runs against.
+// MongoDB needs a live server, so it's only included with STORAGE_BACKEND=mongo.
+func testStores(t *testing.T) map[string]Store {
+	sqlStore, err := NewSQLStore(testCtx, "sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite database: %v", err)
+	}
+	t.Cleanup(func() { sqlStore.Close() })
+
+	stores := map[string]Store{
+		BackendMemory: NewMemoryStore(),
+		BackendSQLite: sqlStore,
+	}
+	if config.AppConfig.StorageBackend == BackendMongo {
+		conn, err := NewConnector(testCtx, config.AppConfig.MongoHost)
+		if err != nil {
+			t.Fatalf("failed to connect to mongoDB: %v", err)
+		}
+		stores[BackendMongo] = conn
+	}
+	return stores
+}
+
 func TestUserFlow(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			testUserFlow(t, store)
+		})
+	}
+}
+
+func testUserFlow(t *testing.T, store Store) {
 	t.Run("CreateUser", func(t *testing.T) {
-		err := connector.CreateUser(testCtx, user)
+		err := store.CreateUser(testCtx, user)
 		if err != nil {
 			t.Errorf("failed to create user in database: %v", err)
 		}
@@ -63,12 +114,12 @@ func TestUserFlow(t *testing.T) {
 
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
-				got, err := connector.GetUser(testCtx, tc.params)
+				got, err := store.GetUser(testCtx, tc.params)
 				if err != nil {
 					t.Fatalf("unexpected error: %v", err)
 				}
 
-				if diff := cmp.Diff(&user, got); diff != "" {
+				if diff := cmp.Diff(&user, got, equateEmpty); diff != "" {
 					t.Errorf("User mismatch (-want +got):\n%v", diff)
 				}
 			})
@@ -76,11 +127,11 @@ func TestUserFlow(t *testing.T) {
 	})
 
 	t.Run("UpdateDevices", func(t *testing.T) {
-		err := connector.AddHwidSession(testCtx, user.Id, "device_3")
+		err := store.AddHwidSession(testCtx, LicenseRef{UserId: user.Id}, "device_3")
 		if err != nil {
 			t.Fatalf("failed to add hwid session: %v", err)
 		}
-		userObj, err := connector.GetUser(testCtx, GetUserParams{UserId: user.Id})
+		userObj, err := store.GetUser(testCtx, GetUserParams{UserId: user.Id})
 		if err != nil {
 			t.Fatalf("failed to find user from database: %v", err)
 		}
@@ -96,7 +147,7 @@ func TestUserFlow(t *testing.T) {
 
 	t.Run("UpdateLimitDevices", func(t *testing.T) {
 		// Attempt to add a 4th device, which should fail as MaxActivations is 3.
-		err := connector.AddHwidSession(testCtx, user.Id, "device_4")
+		err := store.AddHwidSession(testCtx, LicenseRef{UserId: user.Id}, "device_4")
 		if err == nil {
 			t.Fatalf("added session, but should've had an error as limit was reached")
 		}
@@ -104,11 +155,11 @@ func TestUserFlow(t *testing.T) {
 	})
 
 	t.Run("RemoveDevice", func(t *testing.T) {
-		err := connector.DeleteHwidSession(testCtx, user.Id, "device_3")
+		err := store.DeleteHwidSession(testCtx, LicenseRef{UserId: user.Id}, "device_3")
 		if err != nil {
 			t.Fatalf("failed to delete hwid session: %v", err)
 		}
-		userObj, err := connector.GetUser(testCtx, GetUserParams{UserId: user.Id})
+		userObj, err := store.GetUser(testCtx, GetUserParams{UserId: user.Id})
 		if err != nil {
 			t.Fatalf("failed to find user from database: %v", err)
 		}
@@ -120,12 +171,12 @@ func TestUserFlow(t *testing.T) {
 	})
 
 	t.Run("ResetDevices", func(t *testing.T) {
-		err := connector.ResetHwidSessions(testCtx, user.Id)
+		err := store.ResetHwidSessions(testCtx, LicenseRef{UserId: user.Id})
 		if err != nil {
 			t.Fatalf("failed to reset user's devices: %v", err)
 		}
 
-		user, err := connector.GetUser(testCtx, GetUserParams{UserId: user.Id})
+		user, err := store.GetUser(testCtx, GetUserParams{UserId: user.Id})
 		if err != nil {
 			t.Fatalf("failed to find user from database: %v", err)
 		}
@@ -136,11 +187,11 @@ func TestUserFlow(t *testing.T) {
 
 	t.Run("UpdateLicenseStatus", func(t *testing.T) {
 		newStatus := Active
-		err := connector.ChangeLicenseStatus(testCtx, user.Id, newStatus)
+		err := store.ChangeLicenseStatus(testCtx, LicenseRef{UserId: user.Id}, newStatus)
 		if err != nil {
 			t.Fatalf("failed to change license status for user: %v", err)
 		}
-		user, err := connector.GetUser(testCtx, GetUserParams{UserId: user.Id})
+		user, err := store.GetUser(testCtx, GetUserParams{UserId: user.Id})
 		if err != nil {
 			t.Fatalf("failed to find user from database: %v", err)
 		}
@@ -157,22 +208,22 @@ func TestUserFlow(t *testing.T) {
 			ExpiresAt:      Timestamp(1234567892 + 30*24*3600),
 			Status:         Burned,
 		}
-		err := connector.UpdateLicense(testCtx, user.Id, newLicense)
+		err := store.UpdateLicense(testCtx, LicenseRef{UserId: user.Id}, newLicense)
 		if err != nil {
 			t.Fatalf("failed to update license for user: %v", err)
 		}
-		userObj, err := connector.GetUser(testCtx, GetUserParams{UserId: user.Id})
+		userObj, err := store.GetUser(testCtx, GetUserParams{UserId: user.Id})
 		if err != nil {
 			t.Fatalf("failed to find user from database: %v", err)
 		}
 
-		if diff := cmp.Diff(newLicense, userObj.License); diff != "" {
+		if diff := cmp.Diff(newLicense, userObj.License, equateEmpty); diff != "" {
 			t.Errorf("License mismatch (-want +got):\n%v", diff)
 		}
 	})
 
 	t.Run("UpdateHwidLimit", func(t *testing.T) {
-		err := connector.UpdateHwidLimit(testCtx, user.Id, 5)
+		err := store.UpdateHwidLimit(testCtx, LicenseRef{UserId: user.Id}, 5)
 		if err != nil {
 			t.Fatalf("failed to update hwid limit: %v", err)
 		}
@@ -180,7 +231,7 @@ func TestUserFlow(t *testing.T) {
 
 	t.Run("RenewLicense", func(t *testing.T) {
 		newTimestamp := Timestamp(9999999999)
-		err := connector.RenewLicense(testCtx, user.Id, newTimestamp)
+		err := store.RenewLicense(testCtx, LicenseRef{UserId: user.Id}, newTimestamp)
 		if err != nil {
 			t.Fatalf("failed to renew license: %v", err)
 		}
@@ -188,11 +239,11 @@ func TestUserFlow(t *testing.T) {
 
 	t.Run("BindDiscord", func(t *testing.T) {
 		newDiscordID := 98765
-		err := connector.BindDiscord(testCtx, user.Id, newDiscordID)
+		err := store.BindDiscord(testCtx, user.Id, newDiscordID)
 		if err != nil {
 			t.Fatalf("failed to bind discord for user: %v", err)
 		}
-		user, err := connector.GetUser(testCtx, GetUserParams{UserId: user.Id})
+		user, err := store.GetUser(testCtx, GetUserParams{UserId: user.Id})
 		if err != nil {
 			t.Fatalf("failed to find user from database: %v", err)
 		}
@@ -203,11 +254,11 @@ func TestUserFlow(t *testing.T) {
 
 	t.Run("BindTelegram", func(t *testing.T) {
 		newTelegramID := 12345
-		err := connector.BindTelegram(testCtx, user.Id, newTelegramID)
+		err := store.BindTelegram(testCtx, user.Id, newTelegramID)
 		if err != nil {
 			t.Fatalf("failed to bind telegram for user: %v", err)
 		}
-		user, err := connector.GetUser(testCtx, GetUserParams{UserId: user.Id})
+		user, err := store.GetUser(testCtx, GetUserParams{UserId: user.Id})
 		if err != nil {
 			t.Fatalf("failed to find user from database: %v", err)
 		}
@@ -217,7 +268,7 @@ func TestUserFlow(t *testing.T) {
 	})
 
 	t.Run("DeleteUser", func(t *testing.T) {
-		count, err := connector.DeleteUser(testCtx, user.Id)
+		count, err := store.DeleteUser(testCtx, user.Id)
 		if err != nil {
 			t.Errorf("failed to delete user from database: %v", err)
 			return
@@ -228,7 +279,7 @@ func TestUserFlow(t *testing.T) {
 		}
 
 		// Verify user is deleted
-		_, err = connector.GetUser(testCtx, GetUserParams{UserId: user.Id})
+		_, err = store.GetUser(testCtx, GetUserParams{UserId: user.Id})
 		if err == nil {
 			t.Errorf("user should have been deleted, but was found")
 		}
@@ -236,19 +287,1184 @@ func TestUserFlow(t *testing.T) {
 }
 
 func TestGetUserNotFound(t *testing.T) {
-	// a user that is not in the database
-	nonExistentUserID := 999
-	_, err := connector.GetUser(testCtx, GetUserParams{UserId: nonExistentUserID})
-	if err == nil {
-		t.Errorf("expected an error when getting a non-existent user, but got nil")
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			// a user that is not in the database
+			nonExistentUserID := 999
+			_, err := store.GetUser(testCtx, GetUserParams{UserId: nonExistentUserID})
+			if !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("expected ErrUserNotFound when getting a non-existent user, got %v", err)
+			}
+		})
 	}
 }
 
 // bind a discord ID to user which is not in DB
 func TestBindDiscordUserNotFound(t *testing.T) {
-	nonExistentUserID := 999
-	err := connector.BindDiscord(testCtx, nonExistentUserID, 2345678)
-	if err == nil {
-		t.Errorf("expected an error when setting a discord ID for a non-existent user, but got nil")
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			nonExistentUserID := 999
+			err := store.BindDiscord(testCtx, nonExistentUserID, 2345678)
+			if err == nil {
+				t.Errorf("expected an error when setting a discord ID for a non-existent user, but got nil")
+			}
+		})
+	}
+}
+
+func TestSQLMigrationsAreIdempotent(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "migrations.db")
+
+	for i := 0; i < 2; i++ {
+		store, err := NewSQLStore(testCtx, "sqlite", dsn)
+		if err != nil {
+			t.Fatalf("failed to open sqlite database (attempt %d): %v", i+1, err)
+		}
+
+		var applied int
+		err = store.db.QueryRowContext(testCtx, `SELECT COUNT(*) FROM schema_migrations`).Scan(&applied)
+		store.Close()
+		if err != nil {
+			t.Fatalf("failed to count applied migrations: %v", err)
+		}
+		if applied != len(sqlMigrations) {
+			t.Fatalf("applied migrations don't match: want %d got: %d", len(sqlMigrations), applied)
+		}
+	}
+}
+
+func TestMigrationVersions(t *testing.T) {
+	for i, m := range sqlMigrations {
+		if m.version != i+1 {
+			t.Errorf("sql migration %q has version %d, want %d", m.name, m.version, i+1)
+		}
+	}
+	for i, m := range mongoMigrations {
+		if m.version != i+1 {
+			t.Errorf("mongo migration %q has version %d, want %d", m.name, m.version, i+1)
+		}
+	}
+}
+
+func TestUniqueUserFields(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			newUser := func(id, telegramId, discordId int, key string) User {
+				return User{Id: id, TelegramId: telegramId, DiscordId: discordId, CreatedAt: 1000,
+					License: License{Key: key, MaxActivations: 1, Status: Active}}
+			}
+			for _, u := range []User{newUser(9201, 92011, 0, "unique-key-1"), newUser(9202, 0, 0, "unique-key-2")} {
+				if err := store.CreateUser(testCtx, u); err != nil {
+					t.Fatalf("failed to create user: %v", err)
+				}
+				t.Cleanup(func() { store.DeleteUser(testCtx, u.Id) })
+			}
+
+			testCases := []struct {
+				name string
+				fn   func() error
+			}{
+				{"Create with taken telegram id", func() error {
+					return store.CreateUser(testCtx, newUser(9203, 92011, 0, "unique-key-3"))
+				}},
+				{"Create with taken license key", func() error {
+					return store.CreateUser(testCtx, newUser(9203, 0, 0, "unique-key-1"))
+				}},
+				{"Bind taken telegram id", func() error {
+					return store.BindTelegram(testCtx, 9202, 92011)
+				}},
+				{"Add license with taken key", func() error {
+					return store.AddLicense(testCtx, 9202, License{Key: "unique-key-1", ProductId: "unique", MaxActivations: 1, Status: Active})
+				}},
+			}
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					if err := tc.fn(); !errors.Is(err, ErrDuplicate) {
+						t.Errorf("expected a duplicate key error, got %v", err)
+					}
+				})
+			}
+			store.DeleteUser(testCtx, 9203)
+
+			// unbound ids are 0 for many users
+			if err := store.CreateUser(testCtx, newUser(9204, 0, 0, "unique-key-4")); err != nil {
+				t.Errorf("failed to create a second user without bindings: %v", err)
+			}
+			store.DeleteUser(testCtx, 9204)
+		})
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			u := User{Id: 9301, CreatedAt: 1000,
+				License: License{Key: "typed-key-1", MaxActivations: 1, Status: Active}}
+			if err := store.CreateUser(testCtx, u); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			t.Cleanup(func() { store.DeleteUser(testCtx, u.Id) })
+			ref := LicenseRef{UserId: u.Id}
+			if err := store.AddHwidSession(testCtx, ref, "device_1"); err != nil {
+				t.Fatalf("failed to add device: %v", err)
+			}
+
+			testCases := []struct {
+				name string
+				fn   func() error
+				want error
+			}{
+				{"Get missing user", func() error {
+					_, err := store.GetUser(testCtx, GetUserParams{UserId: 9399})
+					return err
+				}, ErrUserNotFound},
+				{"Add device to missing license", func() error {
+					return store.AddHwidSession(testCtx, LicenseRef{UserId: u.Id, ProductId: "missing"}, "device_2")
+				}, ErrLicenseNotFound},
+				{"Get missing product", func() error {
+					_, err := store.GetProduct(testCtx, "typed-missing")
+					return err
+				}, ErrProductNotFound},
+				{"Get missing plan", func() error {
+					_, err := store.GetPlan(testCtx, "typed-missing")
+					return err
+				}, ErrPlanNotFound},
+				{"Add device over the limit", func() error {
+					return store.AddHwidSession(testCtx, ref, "device_2")
+				}, ErrActivationLimit},
+				{"Add the same device twice", func() error {
+					return store.AddHwidSession(testCtx, ref, "device_1")
+				}, ErrNoChange},
+				{"Delete unknown device", func() error {
+					return store.DeleteHwidSession(testCtx, ref, "device_3")
+				}, ErrNoChange},
+				{"Create taken user id", func() error {
+					return store.CreateUser(testCtx, User{Id: u.Id, License: License{Key: "typed-key-2"}})
+				}, ErrDuplicate},
+				{"Change status of missing user", func() error {
+					return store.ChangeLicenseStatus(testCtx, LicenseRef{UserId: 9399}, Frozen)
+				}, ErrUserNotFound},
+				{"Change status of missing license", func() error {
+					return store.ChangeLicenseStatus(testCtx, LicenseRef{UserId: u.Id, ProductId: "missing"}, Frozen)
+				}, ErrLicenseNotFound},
+				{"Change status to the same", func() error {
+					return store.ChangeLicenseStatus(testCtx, ref, Active)
+				}, ErrNoChange},
+				{"Reset devices of missing user", func() error {
+					return store.ResetHwidSessions(testCtx, LicenseRef{UserId: 9399})
+				}, ErrUserNotFound},
+				{"Renew license of missing user", func() error {
+					return store.RenewLicense(testCtx, LicenseRef{UserId: 9399}, 5000)
+				}, ErrUserNotFound},
+				{"Update hwid limit of missing user", func() error {
+					return store.UpdateHwidLimit(testCtx, LicenseRef{UserId: 9399}, 3)
+				}, ErrUserNotFound},
+				{"Update license of missing user", func() error {
+					return store.UpdateLicense(testCtx, LicenseRef{UserId: 9399}, License{Key: "typed-key-3"})
+				}, ErrUserNotFound},
+				{"Bind discord of missing user", func() error {
+					return store.BindDiscord(testCtx, 9399, 9399)
+				}, ErrUserNotFound},
+				{"Bind telegram of missing user", func() error {
+					return store.BindTelegram(testCtx, 9399, 9399)
+				}, ErrUserNotFound},
+			}
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					if err := tc.fn(); !errors.Is(err, tc.want) {
+						t.Errorf("expected %v, got %v", tc.want, err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestConcurrentActivations(t *testing.T) {
+	const (
+		maxActivations = 5
+		attempts       = 50
+	)
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			u := User{
+				Id:         2,
+				TelegramId: 2,
+				License: License{
+					Key:            "concurrentKey",
+					MaxActivations: maxActivations,
+					Status:         Active,
+				},
+			}
+			if err := store.CreateUser(testCtx, u); err != nil {
+				t.Fatalf("failed to create user in database: %v", err)
+			}
+			t.Cleanup(func() { store.DeleteUser(testCtx, u.Id) })
+
+			var (
+				wg        sync.WaitGroup
+				succeeded atomic.Int32
+			)
+			for i := 0; i < attempts; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					if err := store.AddHwidSession(testCtx, LicenseRef{UserId: u.Id}, fmt.Sprintf("device_%d", i)); err == nil {
+						succeeded.Add(1)
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			if got := succeeded.Load(); got != maxActivations {
+				t.Errorf("successful activations don't match: want %d got: %d", maxActivations, got)
+			}
+			userObj, err := store.GetUser(testCtx, GetUserParams{UserId: u.Id})
+			if err != nil {
+				t.Fatalf("failed to find user from database: %v", err)
+			}
+			if len(userObj.License.Devices) != maxActivations {
+				spew.Dump(userObj.License.Devices)
+				t.Fatalf("devices length doesn't match: want %d got: %d", maxActivations, len(userObj.License.Devices))
+			}
+
+			// a reset license takes new devices again
+			if err := store.ResetHwidSessions(testCtx, LicenseRef{UserId: u.Id}); err != nil {
+				t.Fatalf("failed to reset devices: %v", err)
+			}
+			if err := store.AddHwidSession(testCtx, LicenseRef{UserId: u.Id}, "device_after_reset"); err != nil {
+				t.Errorf("failed to add device after reset: %v", err)
+			}
+			if err := store.DeleteHwidSession(testCtx, LicenseRef{UserId: u.Id}, "device_after_reset"); err != nil {
+				t.Errorf("failed to delete device after reset: %v", err)
+			}
+		})
+	}
+}
+
+func TestProductLicenses(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			product := Product{Id: "pro", Name: "Pro", KeyPrefix: "PRO-", KeyLength: 16, DefaultMaxActivations: 2}
+			if err := store.CreateProduct(testCtx, product); err != nil {
+				t.Fatalf("failed to create product: %v", err)
+			}
+			got, err := store.GetProduct(testCtx, product.Id)
+			if err != nil {
+				t.Fatalf("failed to get product: %v", err)
+			}
+			if diff := cmp.Diff(&product, got, equateEmpty); diff != "" {
+				t.Errorf("Product mismatch (-want +got):\n%v", diff)
+			}
+
+			u := User{
+				Id:      3,
+				License: License{Key: "primaryKey", MaxActivations: 1, Status: Active},
+			}
+			if err := store.CreateUser(testCtx, u); err != nil {
+				t.Fatalf("failed to create user in database: %v", err)
+			}
+			t.Cleanup(func() { store.DeleteUser(testCtx, u.Id) })
+
+			proLicense := License{Key: "proKey", ProductId: product.Id, MaxActivations: 2, Status: Active}
+			if err := store.AddLicense(testCtx, u.Id, proLicense); err != nil {
+				t.Fatalf("failed to add license: %v", err)
+			}
+			if err := store.AddLicense(testCtx, u.Id, proLicense); err == nil {
+				t.Errorf("added a second license for the same product")
+			}
+
+			ref := LicenseRef{UserId: u.Id, ProductId: product.Id}
+			for _, hwid := range []string{"device_1", "device_2"} {
+				if err := store.AddHwidSession(testCtx, ref, hwid); err != nil {
+					t.Fatalf("failed to add hwid session: %v", err)
+				}
+			}
+			// the primary license keeps its own limit
+			if err := store.AddHwidSession(testCtx, LicenseRef{UserId: u.Id}, "device_1"); err != nil {
+				t.Fatalf("failed to add hwid session to primary license: %v", err)
+			}
+			if err := store.AddHwidSession(testCtx, LicenseRef{UserId: u.Id, ProductId: "missing"}, "device_1"); err == nil {
+				t.Errorf("added hwid session to a license the user doesn't have")
+			}
+
+			userObj, err := store.GetUser(testCtx, GetUserParams{License: proLicense.Key})
+			if err != nil {
+				t.Fatalf("failed to find user by product license: %v", err)
+			}
+			if userObj.Id != u.Id {
+				t.Fatalf("user id doesn't match: want %d got: %d", u.Id, userObj.Id)
+			}
+			if diff := cmp.Diff([]string{"device_1", "device_2"}, userObj.FindLicense(product.Id).Devices, equateEmpty); diff != "" {
+				t.Errorf("product devices mismatch (-want +got):\n%v", diff)
+			}
+			if diff := cmp.Diff([]string{"device_1"}, userObj.License.Devices, equateEmpty); diff != "" {
+				t.Errorf("primary devices mismatch (-want +got):\n%v", diff)
+			}
+
+			if err := store.ChangeLicenseStatus(testCtx, ref, Frozen); err != nil {
+				t.Fatalf("failed to change product license status: %v", err)
+			}
+			userObj, err = store.GetUser(testCtx, GetUserParams{UserId: u.Id})
+			if err != nil {
+				t.Fatalf("failed to find user from database: %v", err)
+			}
+			if userObj.License.Status != Active || userObj.FindLicense(product.Id).Status != Frozen {
+				t.Errorf("status change leaked between licenses: primary %s product %s",
+					userObj.License.Status, userObj.FindLicense(product.Id).Status)
+			}
+
+			count, err := store.DeleteProduct(testCtx, product.Id)
+			if err != nil || count != 1 {
+				t.Fatalf("failed to delete product: count %d err %v", count, err)
+			}
+			if _, err := store.GetProduct(testCtx, product.Id); err == nil {
+				t.Errorf("product should have been deleted, but was found")
+			}
+		})
+	}
+}
+
+func TestPlans(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			plan := Plan{
+				Id:             "monthly-1-device",
+				Name:           "Monthly",
+				MaxActivations: 1,
+				Duration:       30 * 24 * 3600,
+				Features:       []string{"export"},
+				Renewal:        RenewExtend,
+				CreatedAt:      Timestamp(1234567890),
+			}
+			if err := store.CreatePlan(testCtx, plan); err != nil {
+				t.Fatalf("failed to create plan: %v", err)
+			}
+			t.Cleanup(func() { store.DeletePlan(testCtx, plan.Id) })
+			if err := store.CreatePlan(testCtx, plan); err == nil {
+				t.Errorf("created a plan with a duplicate id")
+			}
+
+			got, err := store.GetPlan(testCtx, plan.Id)
+			if err != nil {
+				t.Fatalf("failed to get plan: %v", err)
+			}
+			if diff := cmp.Diff(&plan, got, equateEmpty); diff != "" {
+				t.Errorf("Plan mismatch (-want +got):\n%v", diff)
+			}
+
+			updated := plan
+			updated.MaxActivations = 3
+			updated.Features = []string{"export", "sync"}
+			updated.Renewal = RenewReset
+			updated.CreatedAt = 0
+			if err := store.UpdatePlan(testCtx, updated); err != nil {
+				t.Fatalf("failed to update plan: %v", err)
+			}
+			plans, err := store.GetAllPlans(testCtx)
+			if err != nil {
+				t.Fatalf("failed to list plans: %v", err)
+			}
+			updated.CreatedAt = plan.CreatedAt
+			if diff := cmp.Diff([]*Plan{&updated}, plans, equateEmpty); diff != "" {
+				t.Errorf("Plans mismatch (-want +got):\n%v", diff)
+			}
+
+			if err := store.UpdatePlan(testCtx, Plan{Id: "missing", Name: "Missing"}); err == nil {
+				t.Errorf("updated a plan that doesn't exist")
+			}
+
+			count, err := store.DeletePlan(testCtx, plan.Id)
+			if err != nil || count != 1 {
+				t.Fatalf("failed to delete plan: count %d err %v", count, err)
+			}
+			if _, err := store.GetPlan(testCtx, plan.Id); err == nil {
+				t.Errorf("plan should have been deleted, but was found")
+			}
+		})
+	}
+}
+
+func TestPlanRenewedExpiry(t *testing.T) {
+	const now = 1000
+	testCases := []struct {
+		name      string
+		plan      Plan
+		expiresAt Timestamp
+		want      Timestamp
+	}{
+		{"extend active", Plan{Duration: 100, Renewal: RenewExtend}, 1500, 1600},
+		{"extend expired", Plan{Duration: 100, Renewal: RenewExtend}, 500, 1100},
+		{"reset active", Plan{Duration: 100, Renewal: RenewReset}, 1500, 1100},
+		{"lifetime", Plan{Renewal: RenewExtend}, 1500, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.plan.RenewedExpiry(License{ExpiresAt: tc.expiresAt}, now)
+			if got != tc.want {
+				t.Errorf("expiry doesn't match: want %d got: %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEntitlements(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			u := User{
+				Id:      4,
+				License: License{Key: "entitledKey", MaxActivations: 1, Status: Active},
+			}
+			if err := store.CreateUser(testCtx, u); err != nil {
+				t.Fatalf("failed to create user in database: %v", err)
+			}
+			t.Cleanup(func() { store.DeleteUser(testCtx, u.Id) })
+			ref := LicenseRef{UserId: u.Id}
+
+			if err := store.GrantEntitlement(testCtx, ref, "export", nil); err != nil {
+				t.Fatalf("failed to grant entitlement: %v", err)
+			}
+			if err := store.GrantEntitlement(testCtx, ref, "max_projects", quota(5)); err != nil {
+				t.Fatalf("failed to grant entitlement: %v", err)
+			}
+			if err := store.GrantEntitlement(testCtx, ref, "max_projects", quota(5)); err == nil {
+				t.Errorf("granting an unchanged entitlement should report no change")
+			}
+			if err := store.GrantEntitlement(testCtx, ref, "max_projects", quota(10)); err != nil {
+				t.Fatalf("failed to change entitlement quota: %v", err)
+			}
+
+			userObj, err := store.GetUser(testCtx, GetUserParams{UserId: u.Id})
+			if err != nil {
+				t.Fatalf("failed to find user from database: %v", err)
+			}
+			want := Entitlements{"export": nil, "max_projects": quota(10)}
+			if diff := cmp.Diff(want, userObj.License.Entitlements, equateEmpty); diff != "" {
+				t.Errorf("Entitlements mismatch (-want +got):\n%v", diff)
+			}
+
+			if err := store.RevokeEntitlement(testCtx, ref, "export"); err != nil {
+				t.Fatalf("failed to revoke entitlement: %v", err)
+			}
+			if err := store.RevokeEntitlement(testCtx, ref, "export"); err == nil {
+				t.Errorf("revoked an entitlement the license doesn't have")
+			}
+			userObj, err = store.GetUser(testCtx, GetUserParams{UserId: u.Id})
+			if err != nil {
+				t.Fatalf("failed to find user from database: %v", err)
+			}
+			if userObj.License.Entitlements.Has("export") {
+				t.Errorf("revoked entitlement is still granted")
+			}
+		})
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if name == BackendMongo {
+				t.Skip("the audit collection is append-only and keeps the entries of earlier runs")
+			}
+			entries := []AuditEntry{
+				{Time: 100, Actor: "admin", RequestId: "req-1", Action: AuditUserCreated, UserId: 7},
+				{Time: 200, Actor: "admin", RequestId: "req-2", Action: AuditLicenseStatusChanged, UserId: 7,
+					Before: json.RawMessage(`{"status":"active"}`), After: json.RawMessage(`{"status":"frozen"}`)},
+				{Time: 200, Actor: "admin", RequestId: "req-3", Action: AuditLicenseStatusChanged, UserId: 8},
+				{Time: 300, Actor: "admin", RequestId: "req-4", Action: AuditPlanCreated, Target: "monthly"},
+			}
+			for _, e := range entries {
+				if err := store.AppendAudit(testCtx, e); err != nil {
+					t.Fatalf("failed to append audit entry: %v", err)
+				}
+			}
+
+			testCases := []struct {
+				name   string
+				filter AuditFilter
+				want   []string
+			}{
+				{"All", AuditFilter{}, []string{"req-4", "req-3", "req-2", "req-1"}},
+				{"By user", AuditFilter{UserId: 7}, []string{"req-2", "req-1"}},
+				{"By action", AuditFilter{Action: AuditLicenseStatusChanged}, []string{"req-3", "req-2"}},
+				{"By time range", AuditFilter{From: 150, To: 250}, []string{"req-3", "req-2"}},
+				{"Limit", AuditFilter{Limit: 2}, []string{"req-4", "req-3"}},
+			}
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					got, err := store.ListAudit(testCtx, tc.filter)
+					if err != nil {
+						t.Fatalf("failed to list audit entries: %v", err)
+					}
+					var ids []string
+					for _, e := range got {
+						ids = append(ids, e.RequestId)
+					}
+					if diff := cmp.Diff(tc.want, ids, equateEmpty); diff != "" {
+						t.Errorf("entries mismatch (-want +got):\n%v", diff)
+					}
+				})
+			}
+
+			got, err := store.ListAudit(testCtx, AuditFilter{UserId: 7, Action: AuditLicenseStatusChanged})
+			if err != nil || len(got) != 1 {
+				t.Fatalf("failed to list audit entries: %v", err)
+			}
+			if diff := cmp.Diff(entries[1], *got[0], equateEmpty); diff != "" {
+				t.Errorf("entry mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestWebhookQueue(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if name == BackendMongo {
+				t.Skip("the delivery queue keeps the deliveries of earlier runs")
+			}
+			hook := Webhook{Id: "hook-1", URL: "https://example.com/hook", Secret: "s3cret",
+				Events: []string{"user.created"}, CreatedAt: 100}
+			if err := store.CreateWebhook(testCtx, hook); err != nil {
+				t.Fatalf("failed to create webhook: %v", err)
+			}
+			if err := store.CreateWebhook(testCtx, hook); err == nil {
+				t.Errorf("expected an error for a duplicate webhook")
+			}
+			got, err := store.GetWebhook(testCtx, hook.Id)
+			if err != nil {
+				t.Fatalf("failed to get webhook: %v", err)
+			}
+			if diff := cmp.Diff(hook, *got, equateEmpty); diff != "" {
+				t.Errorf("webhook mismatch (-want +got):\n%v", diff)
+			}
+			if !got.Subscribed("user.created") || got.Subscribed("user.deleted") {
+				t.Errorf("unexpected subscriptions %v", got.Events)
+			}
+
+			deliveries := []WebhookDelivery{
+				{Id: "d-1", WebhookId: hook.Id, Event: "user.created", Payload: json.RawMessage(`{"n":1}`),
+					Status: DeliveryPending, NextAttempt: 200, CreatedAt: 100},
+				{Id: "d-2", WebhookId: hook.Id, Event: "user.created", Payload: json.RawMessage(`{"n":2}`),
+					Status: DeliveryPending, NextAttempt: 100, CreatedAt: 100},
+				{Id: "d-3", WebhookId: hook.Id, Event: "user.created", Payload: json.RawMessage(`{"n":3}`),
+					Status: DeliveryPending, NextAttempt: 500, CreatedAt: 100},
+			}
+			for _, d := range deliveries {
+				if err := store.EnqueueDelivery(testCtx, d); err != nil {
+					t.Fatalf("failed to enqueue delivery: %v", err)
+				}
+			}
+
+			deliveryIds := func(deliveries []*WebhookDelivery) []string {
+				var ids []string
+				for _, d := range deliveries {
+					ids = append(ids, d.Id)
+				}
+				return ids
+			}
+			due, err := store.DueDeliveries(testCtx, 300, 10)
+			if err != nil {
+				t.Fatalf("failed to get due deliveries: %v", err)
+			}
+			if diff := cmp.Diff([]string{"d-2", "d-1"}, deliveryIds(due), equateEmpty); diff != "" {
+				t.Errorf("due deliveries mismatch (-want +got):\n%v", diff)
+			}
+			if diff := cmp.Diff(deliveries[1], *due[0], equateEmpty); diff != "" {
+				t.Errorf("delivery mismatch (-want +got):\n%v", diff)
+			}
+
+			failed := deliveries[1]
+			failed.Status, failed.Attempts, failed.LastError = DeliveryDead, 8, "status 500"
+			if err := store.UpdateDelivery(testCtx, failed); err != nil {
+				t.Fatalf("failed to update delivery: %v", err)
+			}
+			if err := store.UpdateDelivery(testCtx, WebhookDelivery{Id: "missing"}); err == nil {
+				t.Errorf("expected an error for a missing delivery")
+			}
+			gotDelivery, err := store.GetDelivery(testCtx, failed.Id)
+			if err != nil {
+				t.Fatalf("failed to get delivery: %v", err)
+			}
+			if diff := cmp.Diff(failed, *gotDelivery, equateEmpty); diff != "" {
+				t.Errorf("delivery mismatch (-want +got):\n%v", diff)
+			}
+
+			due, err = store.DueDeliveries(testCtx, 300, 10)
+			if err != nil {
+				t.Fatalf("failed to get due deliveries: %v", err)
+			}
+			if diff := cmp.Diff([]string{"d-1"}, deliveryIds(due), equateEmpty); diff != "" {
+				t.Errorf("due deliveries mismatch (-want +got):\n%v", diff)
+			}
+			pending, err := store.ListDeliveries(testCtx, DeliveryPending, 0)
+			if err != nil {
+				t.Fatalf("failed to list deliveries: %v", err)
+			}
+			if diff := cmp.Diff([]string{"d-3", "d-1"}, deliveryIds(pending), equateEmpty); diff != "" {
+				t.Errorf("pending deliveries mismatch (-want +got):\n%v", diff)
+			}
+			dead, err := store.ListDeliveries(testCtx, DeliveryDead, 0)
+			if err != nil {
+				t.Fatalf("failed to list deliveries: %v", err)
+			}
+			if diff := cmp.Diff([]string{"d-2"}, deliveryIds(dead), equateEmpty); diff != "" {
+				t.Errorf("dead deliveries mismatch (-want +got):\n%v", diff)
+			}
+
+			if n, err := store.DeleteWebhook(testCtx, hook.Id); err != nil || n != 1 {
+				t.Errorf("failed to delete webhook: %d, %v", n, err)
+			}
+			if _, err := store.GetWebhook(testCtx, hook.Id); err == nil {
+				t.Errorf("expected an error for a deleted webhook")
+			}
+		})
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+			key := APIKey{Id: "key-" + suffix, Name: "support-" + suffix, Hash: "hash-" + suffix, Prefix: "lk_abcd", Role: "support",
+				Scopes: []string{"users:read", "devices:write"}, ExpiresAt: 2000, CreatedAt: 1000}
+			if err := store.CreateAPIKey(testCtx, key); err != nil {
+				t.Fatalf("failed to create api key: %v", err)
+			}
+			t.Cleanup(func() { store.DeleteAPIKey(testCtx, key.Id) })
+
+			duplicate := key
+			duplicate.Id, duplicate.Hash = "other-"+suffix, "other-"+suffix
+			if err := store.CreateAPIKey(testCtx, duplicate); err == nil {
+				t.Errorf("expected an error for a duplicate api key name")
+			}
+
+			got, err := store.GetAPIKeyByHash(testCtx, key.Hash)
+			if err != nil {
+				t.Fatalf("failed to get api key: %v", err)
+			}
+			if diff := cmp.Diff(key, *got, equateEmpty); diff != "" {
+				t.Errorf("api key mismatch (-want +got):\n%v", diff)
+			}
+			if !got.Expired(2000) || got.Expired(1999) {
+				t.Errorf("unexpected expiry check for key expiring at %d", got.ExpiresAt)
+			}
+
+			if err := store.TouchAPIKey(testCtx, key.Id, 1500); err != nil {
+				t.Fatalf("failed to touch api key: %v", err)
+			}
+			all, err := store.GetAllAPIKeys(testCtx)
+			if err != nil {
+				t.Fatalf("failed to get api keys: %v", err)
+			}
+			i := slices.IndexFunc(all, func(k *APIKey) bool { return k.Id == key.Id })
+			if i < 0 {
+				t.Fatalf("api key %s is missing from %v", key.Id, all)
+			}
+			if all[i].LastUsedAt != 1500 {
+				t.Errorf("expected last used at 1500, got %d", all[i].LastUsedAt)
+			}
+
+			if n, err := store.DeleteAPIKey(testCtx, key.Id); err != nil || n != 1 {
+				t.Errorf("failed to delete api key: %d, %v", n, err)
+			}
+			if _, err := store.GetAPIKeyByHash(testCtx, key.Hash); err == nil {
+				t.Errorf("expected an error for a deleted api key")
+			}
+			if err := store.TouchAPIKey(testCtx, key.Id, 1600); err == nil {
+				t.Errorf("expected an error for a deleted api key")
+			}
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			// created in their own time range, so users of other tests in a shared database don't match
+			newUser := func(id, createdAt, expiresAt, telegramId int, status LicenseStatus, devices ...string) User {
+				return User{Id: id, TelegramId: telegramId, CreatedAt: Timestamp(createdAt), License: License{
+					Key: fmt.Sprintf("list-key-%d", id), MaxActivations: 3, Devices: devices,
+					IssuedAt: Timestamp(createdAt), ExpiresAt: Timestamp(expiresAt), Status: status,
+				}}
+			}
+			users := []User{
+				newUser(9101, 5000, 9000, 11, Active, "a"),
+				newUser(9102, 5100, 0, 0, Active),
+				newUser(9103, 5100, 7000, 12, Frozen, "a", "b"),
+				newUser(9104, 5300, 8000, 0, Active, "a", "b", "c"),
+			}
+			for _, u := range users {
+				if err := store.CreateUser(testCtx, u); err != nil {
+					t.Fatalf("failed to create user: %v", err)
+				}
+				t.Cleanup(func() { store.DeleteUser(testCtx, u.Id) })
+			}
+
+			yes, no, two := true, false, 2
+			inRange := UserFilter{CreatedFrom: 5000, CreatedTo: 5300}
+			with := func(change func(*UserFilter)) UserFilter {
+				f := inRange
+				change(&f)
+				return f
+			}
+			testCases := []struct {
+				name   string
+				filter UserFilter
+				want   []int
+			}{
+				{"All", inRange, []int{9101, 9102, 9103, 9104}},
+				{"Status", with(func(f *UserFilter) { f.Status = Frozen }), []int{9103}},
+				{"Expiry window", with(func(f *UserFilter) { f.ExpiresFrom, f.ExpiresTo = 7500, 9000 }), []int{9101, 9104}},
+				{"Expires before", with(func(f *UserFilter) { f.ExpiresTo = 8000 }), []int{9103, 9104}},
+				{"Created range", with(func(f *UserFilter) { f.CreatedFrom = 5100 }), []int{9102, 9103, 9104}},
+				{"Telegram bound", with(func(f *UserFilter) { f.HasTelegram = &yes }), []int{9101, 9103}},
+				{"Telegram unbound", with(func(f *UserFilter) { f.HasTelegram = &no }), []int{9102, 9104}},
+				{"Discord unbound", with(func(f *UserFilter) { f.HasDiscord = &no }), []int{9101, 9102, 9103, 9104}},
+				{"Min devices", with(func(f *UserFilter) { f.MinDevices = &two }), []int{9103, 9104}},
+				{"Max devices", with(func(f *UserFilter) { f.MaxDevices = &two }), []int{9101, 9102, 9103}},
+				{"Descending", with(func(f *UserFilter) { f.Desc = true }), []int{9104, 9103, 9102, 9101}},
+				{"By created at", with(func(f *UserFilter) { f.Sort, f.Desc = SortByCreatedAt, true }), []int{9104, 9103, 9102, 9101}},
+				{"By expiry", with(func(f *UserFilter) { f.Sort = SortByExpiresAt }), []int{9102, 9103, 9104, 9101}},
+				{"Limit", with(func(f *UserFilter) { f.Limit = 2 }), []int{9101, 9102}},
+				{"After cursor", with(func(f *UserFilter) {
+					f.Sort, f.After = SortByCreatedAt, &UserCursor{Value: 5100, Id: 9102}
+				}), []int{9103, 9104}},
+				{"After cursor descending", with(func(f *UserFilter) {
+					f.Sort, f.Desc, f.After = SortByCreatedAt, true, &UserCursor{Value: 5100, Id: 9103}
+				}), []int{9102, 9101}},
+			}
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					got, err := store.ListUsers(testCtx, tc.filter)
+					if err != nil {
+						t.Fatalf("failed to list users: %v", err)
+					}
+					var ids []int
+					for _, u := range got {
+						ids = append(ids, u.Id)
+					}
+					if diff := cmp.Diff(tc.want, ids, equateEmpty); diff != "" {
+						t.Errorf("users mismatch (-want +got):\n%v", diff)
+					}
+				})
+			}
+
+			got, err := store.ListUsers(testCtx, with(func(f *UserFilter) { f.Status = Frozen }))
+			if err != nil || len(got) != 1 {
+				t.Fatalf("failed to list users: %v", err)
+			}
+			if diff := cmp.Diff(users[2], *got[0], equateEmpty); diff != "" {
+				t.Errorf("user mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestCreateUserWithNewId(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			taken := User{Id: 9301, CreatedAt: 1000, License: License{Key: "id-key-1", MaxActivations: 1, Status: Active}}
+			if err := store.CreateUser(testCtx, taken); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			t.Cleanup(func() { store.DeleteUser(testCtx, taken.Id) })
+			if err := store.CreateUser(testCtx, taken); !errors.Is(err, ErrDuplicateUserId) {
+				t.Errorf("expected ErrDuplicateUserId for a taken id, got %v", err)
+			}
+
+			ids := []int{taken.Id, taken.Id, 9302}
+			defer func(gen func() int) { newUserId = gen }(newUserId)
+			newUserId = func() int {
+				id := ids[0]
+				ids = ids[1:]
+				return id
+			}
+
+			u := User{CreatedAt: 1000, License: License{Key: "id-key-2", MaxActivations: 1, Status: Active}}
+			if err := CreateUserWithNewId(testCtx, store, &u); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			t.Cleanup(func() { store.DeleteUser(testCtx, u.Id) })
+			if u.Id != 9302 {
+				t.Errorf("expected the first free id 9302, got %d", u.Id)
+			}
+
+			newUserId = func() int { return taken.Id }
+			u = User{CreatedAt: 1000, License: License{Key: "id-key-3", MaxActivations: 1, Status: Active}}
+			if err := CreateUserWithNewId(testCtx, store, &u); !errors.Is(err, ErrDuplicateUserId) {
+				t.Errorf("expected ErrDuplicateUserId once the attempts are used up, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExpireLicenses(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			users := []User{
+				{Id: 9401, License: License{Key: "expiry-key-1", ExpiresAt: 1000, Status: Active}},
+				// a product license expires on its own
+				{Id: 9402, License: License{Key: "expiry-key-2", ExpiresAt: 0, Status: Active},
+					Licenses: []License{{Key: "expiry-key-3", ProductId: "pro", ExpiresAt: 1500, Status: Active}}},
+				{Id: 9403, License: License{Key: "expiry-key-4", ExpiresAt: 1000, Status: Frozen}},
+				{Id: 9404, License: License{Key: "expiry-key-5", ExpiresAt: 5000, Status: Active}},
+				{Id: 9405, License: License{Key: "expiry-key-6", ExpiresAt: 0, Status: Active}},
+			}
+			for _, u := range users {
+				if err := store.CreateUser(testCtx, u); err != nil {
+					t.Fatalf("failed to create user: %v", err)
+				}
+				t.Cleanup(func() { store.DeleteUser(testCtx, u.Id) })
+			}
+
+			expiring, err := store.ExpiringUsers(testCtx, 2000)
+			if err != nil {
+				t.Fatalf("failed to get expiring users: %v", err)
+			}
+			var ids []int
+			for _, u := range expiring {
+				ids = append(ids, u.Id)
+			}
+			if diff := cmp.Diff([]int{9401, 9402}, ids, equateEmpty); diff != "" {
+				t.Errorf("expiring users mismatch (-want +got):\n%v", diff)
+			}
+
+			if err := store.ExpireLicense(testCtx, LicenseRef{UserId: 9401}, 999); !errors.Is(err, ErrNoChange) {
+				t.Errorf("expired a license before its expiry: %v", err)
+			}
+			if err := store.ExpireLicense(testCtx, LicenseRef{UserId: 9401}, 1000); err != nil {
+				t.Fatalf("failed to expire license: %v", err)
+			}
+			if err := store.ExpireLicense(testCtx, LicenseRef{UserId: 9401}, 1000); !errors.Is(err, ErrNoChange) {
+				t.Errorf("expired a license twice: %v", err)
+			}
+			if err := store.ExpireLicense(testCtx, LicenseRef{UserId: 9402, ProductId: "pro"}, 2000); err != nil {
+				t.Fatalf("failed to expire product license: %v", err)
+			}
+			if err := store.ExpireLicense(testCtx, LicenseRef{UserId: 9403}, 2000); !errors.Is(err, ErrNoChange) {
+				t.Errorf("expired a frozen license: %v", err)
+			}
+			if err := store.ExpireLicense(testCtx, LicenseRef{UserId: 9405}, 2000); !errors.Is(err, ErrNoChange) {
+				t.Errorf("expired a lifetime license: %v", err)
+			}
+
+			u, err := store.GetUser(testCtx, GetUserParams{UserId: 9402})
+			if err != nil {
+				t.Fatalf("failed to get user: %v", err)
+			}
+			if u.License.Status != Active || u.FindLicense("pro").Status != Expired {
+				t.Errorf("expected only the product license to expire, got %s and %s", u.License.Status, u.FindLicense("pro").Status)
+			}
+			expiring, err = store.ExpiringUsers(testCtx, 2000)
+			if err != nil {
+				t.Fatalf("failed to get expiring users: %v", err)
+			}
+			if len(expiring) != 0 {
+				t.Errorf("expected no expiring users after expiry, got %d", len(expiring))
+			}
+		})
+	}
+}
+
+func TestLeasesAndNotices(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			acquire := func(holder string, until, now Timestamp, want bool) {
+				t.Helper()
+				got, err := store.AcquireLease(testCtx, "test-lease", holder, until, now)
+				if err != nil {
+					t.Fatalf("failed to acquire lease: %v", err)
+				}
+				if got != want {
+					t.Errorf("%s acquiring at %d: expected %v, got %v", holder, now, want, got)
+				}
+			}
+			acquire("a", 1100, 1000, true)
+			acquire("b", 1150, 1050, false)
+			// the holder extends its lease
+			acquire("a", 1200, 1100, true)
+			acquire("b", 1250, 1150, false)
+			// until it runs out
+			acquire("b", 1300, 1200, true)
+			acquire("a", 1300, 1250, false)
+
+			if err := store.RecordNotice(testCtx, "test-notice", 1000); err != nil {
+				t.Fatalf("failed to record notice: %v", err)
+			}
+			if err := store.RecordNotice(testCtx, "test-notice", 1001); !errors.Is(err, ErrDuplicate) {
+				t.Errorf("expected %v for a notice sent twice, got %v", ErrDuplicate, err)
+			}
+		})
+	}
+}
+
+func TestGracePeriod(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			u := User{Id: 9501, License: License{Key: "grace-key-1", ExpiresAt: 1000, Status: Active}}
+			if err := store.CreateUser(testCtx, u); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			t.Cleanup(func() { store.DeleteUser(testCtx, u.Id) })
+			ref := LicenseRef{UserId: u.Id}
+
+			gracePeriod := func() *int64 {
+				t.Helper()
+				got, err := store.GetUser(testCtx, GetUserParams{UserId: u.Id})
+				if err != nil {
+					t.Fatalf("failed to get user: %v", err)
+				}
+				return got.License.GracePeriod
+			}
+
+			if err := store.SetGracePeriod(testCtx, ref, quota(3600)); err != nil {
+				t.Fatalf("failed to set grace period: %v", err)
+			}
+			if diff := cmp.Diff(quota(3600), gracePeriod(), equateEmpty); diff != "" {
+				t.Errorf("grace period mismatch (-want +got):\n%v", diff)
+			}
+			if err := store.SetGracePeriod(testCtx, ref, quota(3600)); !errors.Is(err, ErrNoChange) {
+				t.Errorf("expected %v for the same grace period, got %v", ErrNoChange, err)
+			}
+			if err := store.SetGracePeriod(testCtx, ref, nil); err != nil {
+				t.Fatalf("failed to reset grace period: %v", err)
+			}
+			if got := gracePeriod(); got != nil {
+				t.Errorf("expected the default grace period, got %d", *got)
+			}
+		})
+	}
+}
+
+func TestLicenseGraceEnd(t *testing.T) {
+	license := License{ExpiresAt: 1000}
+	if got := license.GraceEnd(60); got != 1060 {
+		t.Errorf("expected the default grace period to end at 1060, got %d", got)
+	}
+	if !license.InGrace(1059, 60) || license.InGrace(1060, 60) || license.InGrace(999, 60) {
+		t.Errorf("wrong grace period with the default")
+	}
+	license.GracePeriod = quota(0)
+	if license.InGrace(1000, 60) {
+		t.Errorf("a license without grace period is in grace")
+	}
+	if lifetime := (License{}); lifetime.GraceEnd(60) != 0 {
+		t.Errorf("lifetime license has a grace period")
+	}
+}
+
+func TestRenewals(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			u := User{Id: 9601, License: License{Key: "renewal-key-1", ExpiresAt: 5000, Status: Active},
+				Licenses: []License{{Key: "renewal-key-2", ProductId: "pro", Status: Active}}}
+			if err := store.CreateUser(testCtx, u); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			t.Cleanup(func() { store.DeleteUser(testCtx, u.Id) })
+			ref := LicenseRef{UserId: u.Id}
+
+			// extended from the expiry while it is in the future, from now after it
+			previous, expiresAt, err := store.ExtendLicense(testCtx, ref, 100, 1000)
+			if err != nil {
+				t.Fatalf("failed to extend license: %v", err)
+			}
+			if previous != 5000 || expiresAt != 5100 {
+				t.Errorf("expected the expiry to go from 5000 to 5100, got %d to %d", previous, expiresAt)
+			}
+			if _, expiresAt, err = store.ExtendLicense(testCtx, ref, 100, 9000); err != nil || expiresAt != 9100 {
+				t.Errorf("expected the expired license to be extended to 9100, got %d (%v)", expiresAt, err)
+			}
+			if _, _, err := store.ExtendLicense(testCtx, LicenseRef{UserId: u.Id, ProductId: "pro"}, 100, 1000); !errors.Is(err, ErrNoChange) {
+				t.Errorf("expected %v for a lifetime license, got %v", ErrNoChange, err)
+			}
+
+			renewals := []Renewal{
+				{LicenseKey: u.License.Key, UserId: u.Id, Time: 1000, Actor: "admin", Source: RenewalExtension, Amount: 100, PreviousExpiresAt: 5000, ExpiresAt: 5100},
+				{LicenseKey: u.License.Key, UserId: u.Id, Time: 9000, Actor: "admin", Source: RenewalExtension, Amount: 100, PreviousExpiresAt: 5100, ExpiresAt: 9100},
+				{LicenseKey: "renewal-key-2", UserId: u.Id, Time: 9000, Actor: "admin", Source: RenewalAbsolute, Amount: 20000, ExpiresAt: 20000},
+			}
+			for _, r := range renewals {
+				if err := store.AppendRenewal(testCtx, r); err != nil {
+					t.Fatalf("failed to append renewal: %v", err)
+				}
+			}
+			got, err := store.ListRenewals(testCtx, u.License.Key)
+			if err != nil {
+				t.Fatalf("failed to list renewals: %v", err)
+			}
+			want := []*Renewal{&renewals[1], &renewals[0]}
+			if diff := cmp.Diff(want, got, equateEmpty); diff != "" {
+				t.Errorf("renewals mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestTrials(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			u := User{Id: 9701, TelegramId: 9701, License: License{Key: "trial-key-1", Type: Trial, PlanId: "trial",
+				MaxActivations: 1, Devices: []string{"trial-hwid-1"}, ExpiresAt: 1000, Status: Expired, GracePeriod: new(int64)}}
+			if err := store.CreateUser(testCtx, u); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			t.Cleanup(func() { store.DeleteUser(testCtx, u.Id) })
+
+			claim := TrialClaim{LicenseKey: u.License.Key, UserId: u.Id, Hwid: "trial-hwid-1", TelegramId: 9701, ClaimedAt: 500}
+			if err := store.ClaimTrial(testCtx, claim); err != nil {
+				t.Fatalf("failed to claim trial: %v", err)
+			}
+			for _, again := range []TrialClaim{
+				{LicenseKey: "trial-key-2", UserId: 9702, Hwid: "trial-hwid-1"},
+				{LicenseKey: "trial-key-3", UserId: 9703, Hwid: "trial-hwid-3", TelegramId: 9701},
+			} {
+				if err := store.ClaimTrial(testCtx, again); !errors.Is(err, ErrDuplicate) {
+					t.Errorf("expected %v for claim %+v, got %v", ErrDuplicate, again, err)
+				}
+			}
+			// accounts that weren't given don't collide
+			other := TrialClaim{LicenseKey: "trial-key-4", UserId: 9704, Hwid: "trial-hwid-4", DiscordId: 9704}
+			if err := store.ClaimTrial(testCtx, other); err != nil {
+				t.Errorf("failed to claim trial without a telegram id: %v", err)
+			}
+
+			ref := LicenseRef{UserId: u.Id}
+			terms := License{PlanId: "monthly", MaxActivations: 3, ExpiresAt: 5000, Entitlements: Entitlements{"export": nil}}
+			if err := store.ConvertTrial(testCtx, ref, terms); err != nil {
+				t.Fatalf("failed to convert trial: %v", err)
+			}
+			got, err := store.GetUser(testCtx, GetUserParams{UserId: u.Id})
+			if err != nil {
+				t.Fatalf("failed to get user: %v", err)
+			}
+			want := License{Key: "trial-key-1", PlanId: "monthly", MaxActivations: 3, Devices: []string{"trial-hwid-1"},
+				ExpiresAt: 5000, Status: Active, Entitlements: Entitlements{"export": nil}}
+			if diff := cmp.Diff(want, got.License, equateEmpty); diff != "" {
+				t.Errorf("converted license mismatch (-want +got):\n%v", diff)
+			}
+			if err := store.ConvertTrial(testCtx, ref, terms); !errors.Is(err, ErrNoChange) {
+				t.Errorf("expected %v for a license that isn't a trial, got %v", ErrNoChange, err)
+			}
+
+			// a plan without entitlements still takes grants after converting
+			bare := User{Id: 9705, TelegramId: 9705, License: License{Key: "trial-key-5", Type: Trial, PlanId: "trial",
+				MaxActivations: 1, ExpiresAt: 1000, Status: Active, Entitlements: Entitlements{"trial": nil}}}
+			if err := store.CreateUser(testCtx, bare); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			t.Cleanup(func() { store.DeleteUser(testCtx, bare.Id) })
+			bareRef := LicenseRef{UserId: bare.Id}
+			if err := store.ConvertTrial(testCtx, bareRef, License{PlanId: "basic", MaxActivations: 1, ExpiresAt: 5000}); err != nil {
+				t.Fatalf("failed to convert trial: %v", err)
+			}
+			if err := store.GrantEntitlement(testCtx, bareRef, "export", nil); err != nil {
+				t.Fatalf("failed to grant entitlement after converting: %v", err)
+			}
+			got, err = store.GetUser(testCtx, GetUserParams{UserId: bare.Id})
+			if err != nil {
+				t.Fatalf("failed to get user: %v", err)
+			}
+			if diff := cmp.Diff(Entitlements{"export": nil}, got.License.Entitlements); diff != "" {
+				t.Errorf("entitlements mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestSeats(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			u := User{Id: 9801, TelegramId: 9801, License: License{Key: "seat-key-1", Mode: Floating,
+				MaxActivations: 2, ExpiresAt: 5000, Status: Active}}
+			if err := store.CreateUser(testCtx, u); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			t.Cleanup(func() { store.DeleteUser(testCtx, u.Id) })
+			ref := LicenseRef{UserId: u.Id}
+
+			a, err := store.CheckoutSeat(testCtx, ref, Seat{Id: "seat-a", Hwid: "hwid-a", CheckedOutAt: 100, ExpiresAt: 200}, 100)
+			if err != nil {
+				t.Fatalf("failed to check out seat: %v", err)
+			}
+			if _, err := store.CheckoutSeat(testCtx, ref, Seat{Id: "seat-b", Hwid: "hwid-b", CheckedOutAt: 100, ExpiresAt: 200}, 100); err != nil {
+				t.Fatalf("failed to check out second seat: %v", err)
+			}
+			if _, err := store.CheckoutSeat(testCtx, ref, Seat{Id: "seat-c", Hwid: "hwid-c", CheckedOutAt: 100, ExpiresAt: 200}, 100); !errors.Is(err, ErrSeatLimit) {
+				t.Errorf("expected %v with every seat leased, got %v", ErrSeatLimit, err)
+			}
+
+			// the same machine keeps its seat and only gets the new expiry
+			again, err := store.CheckoutSeat(testCtx, ref, Seat{Id: "seat-a2", Hwid: "hwid-a", CheckedOutAt: 150, ExpiresAt: 250}, 150)
+			if err != nil {
+				t.Fatalf("failed to check out held seat: %v", err)
+			}
+			want := Seat{Id: a.Id, Hwid: "hwid-a", CheckedOutAt: 100, ExpiresAt: 250}
+			if diff := cmp.Diff(want, again, equateEmpty); diff != "" {
+				t.Errorf("held seat mismatch (-want +got):\n%v", diff)
+			}
+
+			if err := store.HeartbeatSeat(testCtx, ref, "seat-b", 300, 150); err != nil {
+				t.Errorf("failed to renew seat: %v", err)
+			}
+			if err := store.HeartbeatSeat(testCtx, ref, "seat-unknown", 300, 150); !errors.Is(err, ErrSeatNotFound) {
+				t.Errorf("expected %v for an unknown seat, got %v", ErrSeatNotFound, err)
+			}
+
+			// seat-a expired at 260, its seat is free for another machine
+			if err := store.HeartbeatSeat(testCtx, ref, "seat-a", 400, 260); !errors.Is(err, ErrSeatNotFound) {
+				t.Errorf("expected %v for an expired seat, got %v", ErrSeatNotFound, err)
+			}
+			if _, err := store.CheckoutSeat(testCtx, ref, Seat{Id: "seat-c", Hwid: "hwid-c", CheckedOutAt: 260, ExpiresAt: 360}, 260); err != nil {
+				t.Fatalf("failed to check out reclaimed seat: %v", err)
+			}
+
+			if err := store.ReleaseSeat(testCtx, ref, "seat-b"); err != nil {
+				t.Errorf("failed to release seat: %v", err)
+			}
+			if err := store.ReleaseSeat(testCtx, ref, "seat-b"); !errors.Is(err, ErrSeatNotFound) {
+				t.Errorf("expected %v for a released seat, got %v", ErrSeatNotFound, err)
+			}
+
+			got, err := store.GetUser(testCtx, GetUserParams{UserId: u.Id})
+			if err != nil {
+				t.Fatalf("failed to get user: %v", err)
+			}
+			wantSeats := []Seat{{Id: "seat-c", Hwid: "hwid-c", CheckedOutAt: 260, ExpiresAt: 360}}
+			if diff := cmp.Diff(wantSeats, got.License.Seats, equateEmpty); diff != "" {
+				t.Errorf("seats mismatch (-want +got):\n%v", diff)
+			}
+			if got.License.Mode != Floating {
+				t.Errorf("expected mode %q, got %q", Floating, got.License.Mode)
+			}
+
+			// replacing the license keeps its leases
+			updated := got.License
+			updated.MaxActivations = 3
+			if err := store.UpdateLicense(testCtx, ref, updated); err != nil {
+				t.Fatalf("failed to update license with seats: %v", err)
+			}
+			got, err = store.GetUser(testCtx, GetUserParams{UserId: u.Id})
+			if err != nil {
+				t.Fatalf("failed to get user: %v", err)
+			}
+			if diff := cmp.Diff(updated, got.License, equateEmpty); diff != "" {
+				t.Errorf("updated license mismatch (-want +got):\n%v", diff)
+			}
+
+			if err := store.ReclaimSeats(testCtx, 360); err != nil {
+				t.Fatalf("failed to reclaim seats: %v", err)
+			}
+			got, err = store.GetUser(testCtx, GetUserParams{UserId: u.Id})
+			if err != nil {
+				t.Fatalf("failed to get user: %v", err)
+			}
+			if len(got.License.Seats) != 0 {
+				t.Errorf("expected the expired seats to be reclaimed, got %+v", got.License.Seats)
+			}
+		})
 	}
 }
@@ -0,0 +1,121 @@
+package storage
+
+import "context"
+
+// Store is the persistence contract used by the API handlers.
+// Every storage backend (MongoDB, SQL, in-memory) must implement it.
+type Store interface {
+	CreateUser(ctx context.Context, u User) error
+	DeleteUser(ctx context.Context, userId int) (deletedCount int64, err error)
+	GetUser(ctx context.Context, params GetUserParams) (*User, error)
+	GetAllUsers(ctx context.Context) ([]*User, error)
+	// ListUsers returns up to filter.Limit users matching filter, in its order
+	// and starting after its cursor.
+	ListUsers(ctx context.Context, filter UserFilter) ([]*User, error)
+
+	// AddLicense gives the user a license for another product.
+	AddLicense(ctx context.Context, userId int, license License) error
+
+	AddHwidSession(ctx context.Context, ref LicenseRef, hwid string) error
+	DeleteHwidSession(ctx context.Context, ref LicenseRef, hwid string) error
+	ResetHwidSessions(ctx context.Context, ref LicenseRef) error
+
+	// CheckoutSeat leases a seat of the floating license to seat.Hwid until
+	// seat.ExpiresAt and returns the lease. A machine with a lease at now keeps
+	// its seat and only gets the new expiry. Leases that expired at now don't
+	// take a seat, it returns ErrSeatLimit if the live ones take every seat.
+	CheckoutSeat(ctx context.Context, ref LicenseRef, seat Seat, now Timestamp) (Seat, error)
+	// HeartbeatSeat extends the lease with the given id until the given time.
+	// It returns ErrSeatNotFound if the lease expired at now or was released.
+	HeartbeatSeat(ctx context.Context, ref LicenseRef, seatId string, until, now Timestamp) error
+	// ReleaseSeat ends the lease with the given id, ErrSeatNotFound if there is none.
+	ReleaseSeat(ctx context.Context, ref LicenseRef, seatId string) error
+	// ReclaimSeats drops the leases of every license that expired at now.
+	ReclaimSeats(ctx context.Context, now Timestamp) error
+
+	ChangeLicenseStatus(ctx context.Context, ref LicenseRef, status LicenseStatus) error
+	UpdateLicense(ctx context.Context, ref LicenseRef, license License) error
+	UpdateHwidLimit(ctx context.Context, ref LicenseRef, newLimit int) error
+	RenewLicense(ctx context.Context, ref LicenseRef, expiresAt Timestamp) error
+	// ExtendLicense extends the expiry of the license by seconds, counted from
+	// now if it already expired, and returns the expiry before and after.
+	// Lifetime licenses can't be extended, they return ErrNoChange.
+	ExtendLicense(ctx context.Context, ref LicenseRef, seconds int64, now Timestamp) (previous, expiresAt Timestamp, err error)
+	// SetGracePeriod overrides the default grace period of the license,
+	// nil makes it use the default again.
+	SetGracePeriod(ctx context.Context, ref LicenseRef, gracePeriod *int64) error
+	// ExpiringUsers returns the users with an active license that has an
+	// expiry at or before the given time, by id.
+	ExpiringUsers(ctx context.Context, before Timestamp) ([]*User, error)
+	// ExpireLicense sets the status of the license to Expired if it is active
+	// and expired at now, it returns ErrNoChange otherwise.
+	ExpireLicense(ctx context.Context, ref LicenseRef, now Timestamp) error
+
+	// ConvertTrial turns the trial license into a regular one with the plan,
+	// activation limit, expiry, entitlements and grace period of terms. It keeps
+	// its key and devices and becomes active. It returns ErrNoChange if the
+	// license isn't a trial.
+	ConvertTrial(ctx context.Context, ref LicenseRef, terms License) error
+	// ClaimTrial records a trial license. It returns ErrDuplicate if the HWID,
+	// Telegram id or Discord id of the claim already got one.
+	ClaimTrial(ctx context.Context, claim TrialClaim) error
+
+	// GrantEntitlement adds the entitlement to the license or changes its quota,
+	// a nil quota grants a plain feature.
+	GrantEntitlement(ctx context.Context, ref LicenseRef, name string, quota *int64) error
+	RevokeEntitlement(ctx context.Context, ref LicenseRef, name string) error
+
+	BindDiscord(ctx context.Context, userId, discordId int) error
+	BindTelegram(ctx context.Context, userId, telegramId int) error
+
+	CreateProduct(ctx context.Context, p Product) error
+	GetProduct(ctx context.Context, productId string) (*Product, error)
+	GetAllProducts(ctx context.Context) ([]*Product, error)
+	DeleteProduct(ctx context.Context, productId string) (deletedCount int64, err error)
+
+	CreatePlan(ctx context.Context, p Plan) error
+	GetPlan(ctx context.Context, planId string) (*Plan, error)
+	GetAllPlans(ctx context.Context) ([]*Plan, error)
+	// UpdatePlan replaces the plan with the same id. Licenses already issued on it keep their terms.
+	UpdatePlan(ctx context.Context, p Plan) error
+	DeletePlan(ctx context.Context, planId string) (deletedCount int64, err error)
+
+	AppendAudit(ctx context.Context, e AuditEntry) error
+	// ListAudit returns the entries matching filter, newest first.
+	ListAudit(ctx context.Context, filter AuditFilter) ([]*AuditEntry, error)
+
+	AppendRenewal(ctx context.Context, r Renewal) error
+	// ListRenewals returns the renewal history of the license with the given key, newest first.
+	ListRenewals(ctx context.Context, licenseKey string) ([]*Renewal, error)
+
+	CreateWebhook(ctx context.Context, w Webhook) error
+	GetWebhook(ctx context.Context, webhookId string) (*Webhook, error)
+	GetAllWebhooks(ctx context.Context) ([]*Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookId string) (deletedCount int64, err error)
+
+	// EnqueueDelivery adds a delivery to the persistent webhook queue.
+	EnqueueDelivery(ctx context.Context, d WebhookDelivery) error
+	GetDelivery(ctx context.Context, deliveryId string) (*WebhookDelivery, error)
+	// DueDeliveries returns up to limit pending deliveries whose next attempt is at or before now, oldest first.
+	DueDeliveries(ctx context.Context, now Timestamp, limit int) ([]*WebhookDelivery, error)
+	// ListDeliveries returns up to limit deliveries with the given status, newest first.
+	ListDeliveries(ctx context.Context, status DeliveryStatus, limit int) ([]*WebhookDelivery, error)
+	// UpdateDelivery stores the status, attempts, next attempt and last error of d.
+	UpdateDelivery(ctx context.Context, d WebhookDelivery) error
+
+	CreateAPIKey(ctx context.Context, k APIKey) error
+	// GetAPIKeyByHash returns the key whose Hash is hash.
+	GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error)
+	GetAllAPIKeys(ctx context.Context) ([]*APIKey, error)
+	DeleteAPIKey(ctx context.Context, keyId string) (deletedCount int64, err error)
+	// TouchAPIKey sets the last-used time of the key.
+	TouchAPIKey(ctx context.Context, keyId string, usedAt Timestamp) error
+
+	// AcquireLease takes the named lease for holder until the given time if it is
+	// free, held by holder or expired at now. It reports whether holder has it,
+	// so only one of several server replicas runs a background job.
+	AcquireLease(ctx context.Context, name, holder string, until, now Timestamp) (bool, error)
+	// RecordNotice remembers that the notice with the given id was sent.
+	// It returns ErrDuplicate if it already was.
+	RecordNotice(ctx context.Context, noticeId string, sentAt Timestamp) error
+}
@@ -1,5 +1,10 @@
 package storage
 
+import (
+	"encoding/json"
+	"slices"
+)
+
 type LicenseStatus string
 type Timestamp int
 
@@ -7,23 +12,330 @@ const (
 	Frozen LicenseStatus = "frozen"
 	Active LicenseStatus = "active"
 	Burned LicenseStatus = "burned"
+	// Expired is set by the expiry worker once ExpiresAt has passed,
+	// renewing the license makes it active again
+	Expired LicenseStatus = "expired"
 )
 
+// LicenseType tells trial licenses from regular ones, which have no type.
+type LicenseType string
+
+// Trial licenses are handed out by the public trial endpoint and can be
+// converted to a regular license on a plan.
+const Trial LicenseType = "trial"
+
+// LicenseMode tells how a license limits the machines using it. Licenses
+// without a mode are node-locked: they bind up to MaxActivations devices for good.
+type LicenseMode string
+
+// Floating licenses lease up to MaxActivations seats at a time to any
+// machine instead of binding devices.
+const Floating LicenseMode = "floating"
+
 type User struct {
-	Id         int       `bson:"_id" json:"id"`
-	TelegramId int       `bson:"telegramId" json:"telegramId"`
-	DiscordId  int       `bson:"discordId" json:"discordId"`
-	License    License   `bson:"license" json:"license"`
-	CreatedAt  Timestamp `bson:"createdAt" json:"createdAt"`
+	Id         int     `bson:"_id" json:"id"`
+	TelegramId int     `bson:"telegramId" json:"telegramId"`
+	DiscordId  int     `bson:"discordId" json:"discordId"`
+	License    License `bson:"license" json:"license"`
+	// Licenses holds the user's licenses for other products than the primary one.
+	Licenses  []License `bson:"licenses,omitempty" json:"licenses,omitempty"`
+	CreatedAt Timestamp `bson:"createdAt" json:"createdAt"`
 }
 
 type License struct {
 	Key            string        `bson:"key" json:"key"`
+	Type           LicenseType   `bson:"type,omitempty" json:"type,omitempty"`
+	Mode           LicenseMode   `bson:"mode,omitempty" json:"mode,omitempty"`
+	ProductId      string        `bson:"productId,omitempty" json:"productId,omitempty"`
+	PlanId         string        `bson:"planId,omitempty" json:"planId,omitempty"`
 	MaxActivations int           `bson:"maxActivations" json:"maxActivations"`
 	Devices        []string      `bson:"devices" json:"devices"`
 	IssuedAt       Timestamp     `bson:"issuedAt" json:"issuedAt"`
-	ExpiresAt      Timestamp     `bson:"expiresAt" json:"expiresAt"`
+	ExpiresAt      Timestamp     `bson:"expiresAt" json:"expiresAt"` // 0 for lifetime licenses
 	Status         LicenseStatus `bson:"status" json:"status"`
+	Entitlements   Entitlements  `bson:"entitlements,omitempty" json:"entitlements,omitempty"`
+	// GracePeriod is how many seconds after ExpiresAt verify still succeeds,
+	// nil for the server default (GRACE_PERIOD)
+	GracePeriod *int64 `bson:"gracePeriod,omitempty" json:"gracePeriod,omitempty"`
+	// Seats are the leases of a floating license, expired ones until they are reclaimed
+	Seats []Seat `bson:"seats,omitempty" json:"seats,omitempty"`
+}
+
+// Seat is the lease of a seat of a floating license. The machine with Hwid
+// holds it until ExpiresAt, heartbeats move ExpiresAt forward.
+type Seat struct {
+	Id           string    `bson:"id" json:"id"`
+	Hwid         string    `bson:"hwid" json:"hwid"`
+	CheckedOutAt Timestamp `bson:"checkedOutAt" json:"checkedOutAt"`
+	ExpiresAt    Timestamp `bson:"expiresAt" json:"expiresAt"`
+}
+
+// Expired reports whether the license is past its expiry at now (unix seconds).
+func (l *License) Expired(now int64) bool {
+	return l.ExpiresAt != 0 && now >= int64(l.ExpiresAt)
+}
+
+// GraceEnd returns when the grace period after the expiry of the license ends:
+// its own GracePeriod or defaultGrace seconds after ExpiresAt, 0 for lifetime licenses.
+func (l *License) GraceEnd(defaultGrace int64) Timestamp {
+	if l.ExpiresAt == 0 {
+		return 0
+	}
+	grace := defaultGrace
+	if l.GracePeriod != nil {
+		grace = *l.GracePeriod
+	}
+	return l.ExpiresAt + Timestamp(grace)
+}
+
+// ExtendedExpiry returns the expiry of the license after extending it by seconds
+// at now: from its current expiry, or from now if it already expired.
+func (l *License) ExtendedExpiry(seconds, now int64) Timestamp {
+	return Timestamp(max(int64(l.ExpiresAt), now) + seconds)
+}
+
+// extendAttempts is how often a backend without atomic read-modify-write
+// updates retries an extension that raced with another renewal.
+const extendAttempts = 3
+
+// HeldSeat returns the seat hwid holds at now (unix seconds), or nil if it holds none.
+func (l *License) HeldSeat(hwid string, now int64) *Seat {
+	for i := range l.Seats {
+		if l.Seats[i].Hwid == hwid && int64(l.Seats[i].ExpiresAt) > now {
+			return &l.Seats[i]
+		}
+	}
+	return nil
+}
+
+// InGrace reports whether the license is expired at now but still in its grace period.
+func (l *License) InGrace(now, defaultGrace int64) bool {
+	return l.Expired(now) && now < int64(l.GraceEnd(defaultGrace))
+}
+
+// Product is something we sell licenses for. Its settings are used
+// as defaults when a license for it is issued.
+type Product struct {
+	Id                    string    `bson:"_id" json:"id"`
+	Name                  string    `bson:"name" json:"name"`
+	KeyPrefix             string    `bson:"keyPrefix" json:"keyPrefix"`
+	KeyLength             int       `bson:"keyLength" json:"keyLength"`
+	DefaultMaxActivations int       `bson:"defaultMaxActivations" json:"defaultMaxActivations"`
+	DefaultDuration       int64     `bson:"defaultDuration" json:"defaultDuration"` // seconds
+	CreatedAt             Timestamp `bson:"createdAt" json:"createdAt"`
+}
+
+// PlanRenewal tells how renewing a license on a plan moves its expiry.
+type PlanRenewal string
+
+const (
+	// RenewExtend adds the plan duration to the current expiry,
+	// or to the renewal time if the license already expired.
+	RenewExtend PlanRenewal = "extend"
+	// RenewReset sets the expiry to the renewal time plus the plan duration.
+	RenewReset PlanRenewal = "reset"
+)
+
+// Plan is a named license template like "monthly-1-device".
+type Plan struct {
+	Id             string      `bson:"_id" json:"id"`
+	Name           string      `bson:"name" json:"name"`
+	MaxActivations int         `bson:"maxActivations" json:"maxActivations"`
+	Duration       int64       `bson:"duration" json:"duration"` // seconds, 0 for lifetime licenses
+	Features       []string    `bson:"features" json:"features"`
+	Renewal        PlanRenewal `bson:"renewal" json:"renewal"`
+	CreatedAt      Timestamp   `bson:"createdAt" json:"createdAt"`
+}
+
+// ExpiresAt returns the expiry of a license on p issued at issuedAt.
+func (p *Plan) ExpiresAt(issuedAt int64) Timestamp {
+	if p.Duration == 0 {
+		return 0
+	}
+	return Timestamp(issuedAt + p.Duration)
+}
+
+// Entitlements returns the features of p as plain entitlements, nil without features.
+func (p *Plan) Entitlements() Entitlements {
+	var entitlements Entitlements
+	for _, feature := range p.Features {
+		if entitlements == nil {
+			entitlements = make(Entitlements)
+		}
+		entitlements[feature] = nil
+	}
+	return entitlements
+}
+
+// RenewedExpiry returns the expiry of license after renewing it at now.
+func (p *Plan) RenewedExpiry(license License, now int64) Timestamp {
+	if p.Duration == 0 {
+		return 0
+	}
+	from := now
+	if p.Renewal != RenewReset && int64(license.ExpiresAt) > now {
+		from = int64(license.ExpiresAt)
+	}
+	return Timestamp(from + p.Duration)
+}
+
+// AuditAction names an administrative mutation recorded in the audit log.
+type AuditAction string
+
+const (
+	AuditUserCreated          AuditAction = "user.created"
+	AuditUserDeleted          AuditAction = "user.deleted"
+	AuditDiscordBound         AuditAction = "user.discord_bound"
+	AuditTelegramBound        AuditAction = "user.telegram_bound"
+	AuditLicenseAdded         AuditAction = "license.added"
+	AuditLicenseStatusChanged AuditAction = "license.status_changed"
+	AuditLicenseRenewed       AuditAction = "license.renewed"
+	AuditLicenseConverted     AuditAction = "license.converted"
+	AuditHwidLimitChanged     AuditAction = "license.hwid_limit_changed"
+	AuditGracePeriodChanged   AuditAction = "license.grace_period_changed"
+	AuditEntitlementGranted   AuditAction = "license.entitlement_granted"
+	AuditEntitlementRevoked   AuditAction = "license.entitlement_revoked"
+	AuditDeviceAdded          AuditAction = "device.added"
+	AuditDeviceRemoved        AuditAction = "device.removed"
+	AuditDevicesReset         AuditAction = "devices.reset"
+	AuditProductCreated       AuditAction = "product.created"
+	AuditProductDeleted       AuditAction = "product.deleted"
+	AuditPlanCreated          AuditAction = "plan.created"
+	AuditPlanUpdated          AuditAction = "plan.updated"
+	AuditPlanDeleted          AuditAction = "plan.deleted"
+	AuditWebhookCreated       AuditAction = "webhook.created"
+	AuditWebhookDeleted       AuditAction = "webhook.deleted"
+	AuditAPIKeyCreated        AuditAction = "api_key.created"
+	AuditAPIKeyRevoked        AuditAction = "api_key.revoked"
+)
+
+// AuditEntry records who changed what. Entries are only ever appended.
+type AuditEntry struct {
+	Time      Timestamp   `bson:"time" json:"time"`
+	Actor     string      `bson:"actor" json:"actor"`
+	RequestId string      `bson:"requestId" json:"requestId"`
+	Action    AuditAction `bson:"action" json:"action"`
+	// UserId is the target user, 0 for actions on products and plans
+	UserId int `bson:"userId" json:"userId"`
+	// Target is the product of the changed license, or the changed product, plan, webhook or API key
+	Target string          `bson:"target,omitempty" json:"target,omitempty"`
+	Before json.RawMessage `bson:"before,omitempty" json:"before,omitempty" swaggertype:"object"`
+	After  json.RawMessage `bson:"after,omitempty" json:"after,omitempty" swaggertype:"object"`
+}
+
+// RenewalSource tells how the new expiry of a renewal was given.
+type RenewalSource string
+
+const (
+	// RenewalAbsolute set the expiry to a timestamp
+	RenewalAbsolute RenewalSource = "expires_at"
+	// RenewalExtension extended the license by a duration
+	RenewalExtension RenewalSource = "extend_by"
+	// RenewalPlan renewed the license by its plan
+	RenewalPlan RenewalSource = "plan"
+)
+
+// Renewal is an entry of the renewal history of a license.
+// Like the audit log it is only appended to.
+type Renewal struct {
+	LicenseKey string        `bson:"licenseKey" json:"licenseKey"`
+	UserId     int           `bson:"userId" json:"userId"`
+	Time       Timestamp     `bson:"time" json:"time"`
+	Actor      string        `bson:"actor" json:"actor"`
+	RequestId  string        `bson:"requestId" json:"requestId"`
+	Source     RenewalSource `bson:"source" json:"source"`
+	// Amount is the extension in seconds for extend_by, how far the expiry moved otherwise
+	Amount            int64     `bson:"amount" json:"amount"`
+	PreviousExpiresAt Timestamp `bson:"previousExpiresAt" json:"previousExpiresAt"`
+	ExpiresAt         Timestamp `bson:"expiresAt" json:"expiresAt"`
+}
+
+// TrialClaim records who got a trial license. A HWID, Telegram id or Discord id
+// can claim a single trial, also after the license was converted or deleted.
+type TrialClaim struct {
+	LicenseKey string    `bson:"_id" json:"licenseKey"`
+	UserId     int       `bson:"userId" json:"userId"`
+	Hwid       string    `bson:"hwid" json:"hwid"`
+	TelegramId int       `bson:"telegramId" json:"telegramId"`
+	DiscordId  int       `bson:"discordId" json:"discordId"`
+	ClaimedAt  Timestamp `bson:"claimedAt" json:"claimedAt"`
+}
+
+// AuditFilter selects audit entries, zero fields don't filter.
+type AuditFilter struct {
+	UserId int
+	Action AuditAction
+	From   Timestamp // inclusive
+	To     Timestamp // inclusive
+	Limit  int
+}
+
+// Match reports whether e is selected by f, ignoring the limit.
+func (f AuditFilter) Match(e AuditEntry) bool {
+	return (f.UserId == 0 || e.UserId == f.UserId) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.From == 0 || e.Time >= f.From) &&
+		(f.To == 0 || e.Time <= f.To)
+}
+
+// Webhook is an endpoint that receives signed license lifecycle events.
+type Webhook struct {
+	Id     string `bson:"_id" json:"id"`
+	URL    string `bson:"url" json:"url"`
+	Secret string `bson:"secret" json:"secret,omitempty"` // HMAC-SHA256 key, only returned on creation
+	// Events lists the subscribed event types, empty for all of them
+	Events    []string  `bson:"events" json:"events"`
+	CreatedAt Timestamp `bson:"createdAt" json:"createdAt"`
+}
+
+// Subscribed reports whether w receives events of the given type.
+func (w *Webhook) Subscribed(event string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// DeliveryStatus is the state of a queued webhook delivery.
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryDead is set once all attempts failed, the delivery waits for a manual redelivery.
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// WebhookDelivery is one event queued for one webhook.
+type WebhookDelivery struct {
+	Id          string          `bson:"_id" json:"id"`
+	WebhookId   string          `bson:"webhookId" json:"webhookId"`
+	Event       string          `bson:"event" json:"event"`
+	Payload     json.RawMessage `bson:"payload" json:"payload" swaggertype:"object"`
+	Status      DeliveryStatus  `bson:"status" json:"status"`
+	Attempts    int             `bson:"attempts" json:"attempts"`
+	NextAttempt Timestamp       `bson:"nextAttempt" json:"nextAttempt"`
+	LastError   string          `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	CreatedAt   Timestamp       `bson:"createdAt" json:"createdAt"`
+}
+
+// APIKey is a named credential for the private endpoints, limited to the
+// permissions of its role and its scopes.
+// Only a hash of the key is stored, the key itself is shown once when it's minted.
+type APIKey struct {
+	Id   string `bson:"_id" json:"id"`
+	Name string `bson:"name" json:"name"`
+	Hash string `bson:"hash" json:"-"` // hex SHA-256 of the key
+	// Prefix is the start of the key, enough to tell keys apart
+	Prefix string `bson:"prefix" json:"prefix"`
+	// Role grants the permissions defined for it in ADMIN_ROLES, on top of Scopes
+	Role       string    `bson:"role,omitempty" json:"role,omitempty"`
+	Scopes     []string  `bson:"scopes" json:"scopes"`
+	ExpiresAt  Timestamp `bson:"expiresAt" json:"expiresAt"`   // 0 for keys that don't expire
+	LastUsedAt Timestamp `bson:"lastUsedAt" json:"lastUsedAt"` // 0 until the key is used
+	CreatedAt  Timestamp `bson:"createdAt" json:"createdAt"`
+}
+
+// Expired reports whether the key is past its expiry at now (unix seconds).
+func (k *APIKey) Expired(now int64) bool {
+	return k.ExpiresAt != 0 && now >= int64(k.ExpiresAt)
 }
 
 type GetUserParams struct {
@@ -32,3 +344,109 @@ type GetUserParams struct {
 	DiscordId  int
 	License    string
 }
+
+// UserSort is the order of ListUsers, users with the same sort value are ordered by id.
+type UserSort string
+
+const (
+	SortById        UserSort = "id"
+	SortByCreatedAt UserSort = "created_at"
+	// SortByExpiresAt orders by the expiry of the primary license, lifetime licenses (0) come first
+	SortByExpiresAt UserSort = "expires_at"
+)
+
+// UserCursor is the position a page of ListUsers starts after: the sort value
+// and id of the last user of the previous page.
+type UserCursor struct {
+	Value int64 `json:"v"`
+	Id    int   `json:"id"`
+}
+
+// UserFilter selects users for ListUsers, zero fields don't filter.
+// The license filters apply to the primary license.
+type UserFilter struct {
+	Status LicenseStatus
+	// ExpiresFrom and ExpiresTo are inclusive, setting either excludes lifetime licenses
+	ExpiresFrom Timestamp
+	ExpiresTo   Timestamp
+	CreatedFrom Timestamp // inclusive
+	CreatedTo   Timestamp // inclusive
+	HasTelegram *bool
+	HasDiscord  *bool
+	MinDevices  *int
+	MaxDevices  *int
+
+	Sort  UserSort // SortById when empty
+	Desc  bool
+	After *UserCursor
+	Limit int
+}
+
+// Match reports whether u is selected by f, ignoring the cursor and the limit.
+func (f UserFilter) Match(u *User) bool {
+	l := &u.License
+	devices := len(l.Devices)
+	if (f.ExpiresFrom != 0 || f.ExpiresTo != 0) && l.ExpiresAt == 0 {
+		return false
+	}
+	return (f.Status == "" || l.Status == f.Status) &&
+		(f.ExpiresFrom == 0 || l.ExpiresAt >= f.ExpiresFrom) &&
+		(f.ExpiresTo == 0 || l.ExpiresAt <= f.ExpiresTo) &&
+		(f.CreatedFrom == 0 || u.CreatedAt >= f.CreatedFrom) &&
+		(f.CreatedTo == 0 || u.CreatedAt <= f.CreatedTo) &&
+		(f.HasTelegram == nil || (u.TelegramId != 0) == *f.HasTelegram) &&
+		(f.HasDiscord == nil || (u.DiscordId != 0) == *f.HasDiscord) &&
+		(f.MinDevices == nil || devices >= *f.MinDevices) &&
+		(f.MaxDevices == nil || devices <= *f.MaxDevices)
+}
+
+// Cursor returns the cursor of the page starting after u in the order of f.
+func (f UserFilter) Cursor(u *User) UserCursor {
+	switch f.Sort {
+	case SortByCreatedAt:
+		return UserCursor{Value: int64(u.CreatedAt), Id: u.Id}
+	case SortByExpiresAt:
+		return UserCursor{Value: int64(u.License.ExpiresAt), Id: u.Id}
+	default:
+		return UserCursor{Value: int64(u.Id), Id: u.Id}
+	}
+}
+
+// LicenseRef addresses one license of a user. An empty ProductId refers to the
+// primary license (User.License), otherwise the user's license for that product.
+type LicenseRef struct {
+	UserId    int
+	ProductId string
+}
+
+// FindLicense returns u's license for productId (the primary one for an
+// empty productId), or nil if u has none.
+func (u *User) FindLicense(productId string) *License {
+	if productId == "" || u.License.ProductId == productId {
+		return &u.License
+	}
+	for i := range u.Licenses {
+		if u.Licenses[i].ProductId == productId {
+			return &u.Licenses[i]
+		}
+	}
+	return nil
+}
+
+// LicenseByKey returns u's license with the given key, or nil if u has none.
+func (u *User) LicenseByKey(key string) *License {
+	if u.License.Key == key {
+		return &u.License
+	}
+	for i := range u.Licenses {
+		if u.Licenses[i].Key == key {
+			return &u.Licenses[i]
+		}
+	}
+	return nil
+}
+
+// AllLicenses returns the primary license followed by the product licenses.
+func (u *User) AllLicenses() []License {
+	return append([]License{u.License}, u.Licenses...)
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// user ids have 8 digits, like the ones issued before ids were checked for collisions
+	minUserId = 10_000_000
+	maxUserId = 99_999_999
+	// createUserAttempts bounds the retries on id collisions, each one is unlikely
+	// until the id space is mostly used
+	createUserAttempts = 5
+)
+
+// newUserId generates a random user id, tests replace it to force collisions.
+var newUserId = func() int {
+	n, _ := rand.Int(rand.Reader, big.NewInt(maxUserId-minUserId+1))
+	return minUserId + int(n.Int64())
+}
+
+// CreateUserWithNewId stores u under a newly generated id, which it sets on u.
+// An id that is already taken is replaced by another one.
+func CreateUserWithNewId(ctx context.Context, store Store, u *User) error {
+	for range createUserAttempts {
+		u.Id = newUserId()
+		err := store.CreateUser(ctx, *u)
+		if !errors.Is(err, ErrDuplicateUserId) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to find a free user id after %d attempts: %w", createUserAttempts, ErrDuplicateUserId)
+}
@@ -0,0 +1,257 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	pollInterval       = 5 * time.Second
+	batchSize          = 50
+	defaultMaxAttempts = 8
+	deliveryTimeout    = 10 * time.Second
+	firstRetryDelay    = 30 * time.Second
+	maxRetryDelay      = 6 * time.Hour
+)
+
+// Dispatcher queues events for the subscribed webhooks and delivers them in
+// the background. The queue lives in the store, so pending deliveries survive
+// restarts. Only one dispatcher should run against a store.
+type Dispatcher struct {
+	store       storage.Store
+	client      *http.Client
+	maxAttempts int
+	backoff     func(attempt int) time.Duration
+	wake        chan struct{}
+}
+
+// NewDispatcher creates a dispatcher on top of store. Call Run to start delivering.
+func NewDispatcher(store storage.Store) *Dispatcher {
+	return &Dispatcher{
+		store:       store,
+		client:      &http.Client{Timeout: deliveryTimeout},
+		maxAttempts: defaultMaxAttempts,
+		backoff:     backoff,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// backoff returns the delay before retrying a delivery that failed attempt
+// times: 30 seconds, doubled with every failure up to 6 hours.
+func backoff(attempt int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// NewWebhook returns a webhook for url with a generated id and secret.
+// An empty events list subscribes it to every event.
+func NewWebhook(url string, events []string) storage.Webhook {
+	return storage.Webhook{
+		Id:        randomHex(8),
+		URL:       url,
+		Secret:    randomHex(32),
+		Events:    events,
+		CreatedAt: storage.Timestamp(time.Now().Unix()),
+	}
+}
+
+// Signature returns the X-Webhook-Signature header of body sent at timestamp:
+// "sha256=" and the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the
+// webhook secret. Receivers should recompute it and reject old timestamps.
+func Signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// HasSubscribers reports whether any webhook is subscribed to eventType, for
+// events that are useless when nobody receives them.
+func (d *Dispatcher) HasSubscribers(ctx context.Context, eventType string) (bool, error) {
+	hooks, err := d.store.GetAllWebhooks(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	return slices.ContainsFunc(hooks, func(hook *storage.Webhook) bool { return hook.Subscribed(eventType) }), nil
+}
+
+// Publish queues the event for every webhook subscribed to eventType.
+// data becomes the "data" field of the delivered JSON.
+func (d *Dispatcher) Publish(ctx context.Context, eventType string, data any) error {
+	hooks, err := d.store.GetAllWebhooks(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get webhooks: %w", err)
+	}
+
+	now := storage.Timestamp(time.Now().Unix())
+	var payload []byte
+	for _, hook := range hooks {
+		if !hook.Subscribed(eventType) {
+			continue
+		}
+		if payload == nil {
+			payload, err = json.Marshal(Event{Id: randomHex(16), Type: eventType, CreatedAt: now, Data: data})
+			if err != nil {
+				return fmt.Errorf("failed to encode event: %w", err)
+			}
+		}
+		err := d.store.EnqueueDelivery(ctx, storage.WebhookDelivery{
+			Id:          randomHex(16),
+			WebhookId:   hook.Id,
+			Event:       eventType,
+			Payload:     payload,
+			Status:      storage.DeliveryPending,
+			NextAttempt: now,
+			CreatedAt:   now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to enqueue delivery: %w", err)
+		}
+	}
+	if payload != nil {
+		d.notify()
+	}
+	return nil
+}
+
+// Redeliver queues a delivery again, typically a dead one after its receiver
+// was fixed. Its attempts start over.
+func (d *Dispatcher) Redeliver(ctx context.Context, deliveryId string) (*storage.WebhookDelivery, error) {
+	delivery, err := d.store.GetDelivery(ctx, deliveryId)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Status = storage.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttempt = storage.Timestamp(time.Now().Unix())
+	delivery.LastError = ""
+	if err := d.store.UpdateDelivery(ctx, *delivery); err != nil {
+		return nil, err
+	}
+	d.notify()
+	return delivery, nil
+}
+
+// Run delivers queued events until ctx is done. Due deliveries are picked up
+// right after they are queued and every few seconds for retries.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.DeliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// DeliverDue attempts every delivery that is due now.
+func (d *Dispatcher) DeliverDue(ctx context.Context) {
+	for {
+		due, err := d.store.DueDeliveries(ctx, storage.Timestamp(time.Now().Unix()), batchSize)
+		if err != nil {
+			logger.Error(ctx, "failed to get due webhook deliveries", zap.Error(err))
+			return
+		}
+		for _, delivery := range due {
+			if err := d.deliver(ctx, delivery); err != nil {
+				logger.Error(ctx, "failed to update webhook delivery", zap.String("delivery_id", delivery.Id), zap.Error(err))
+				return
+			}
+		}
+		if len(due) < batchSize {
+			return
+		}
+	}
+}
+
+// notify wakes Run without blocking, a pending wake-up covers this one too.
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver makes one attempt and stores its outcome. Only a failure
+// to store it is returned.
+func (d *Dispatcher) deliver(ctx context.Context, delivery *storage.WebhookDelivery) error {
+	err := d.send(ctx, delivery)
+	delivery.Attempts++
+
+	switch {
+	case err == nil:
+		delivery.Status = storage.DeliveryDelivered
+		delivery.LastError = ""
+	case delivery.Attempts >= d.maxAttempts:
+		delivery.Status = storage.DeliveryDead
+		delivery.LastError = err.Error()
+		logger.Warn(ctx, "webhook delivery moved to the dead-letter list",
+			zap.String("delivery_id", delivery.Id), zap.String("webhook_id", delivery.WebhookId), zap.Error(err))
+	default:
+		delivery.NextAttempt = storage.Timestamp(time.Now().Add(d.backoff(delivery.Attempts)).Unix())
+		delivery.LastError = err.Error()
+		logger.Debug(ctx, "webhook delivery failed", zap.String("delivery_id", delivery.Id), zap.Error(err))
+	}
+	return d.store.UpdateDelivery(ctx, *delivery)
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *storage.WebhookDelivery) error {
+	hook, err := d.store.GetWebhook(ctx, delivery.WebhookId)
+	if err != nil {
+		return fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", delivery.Id)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", Signature(hook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain a bit of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dzhisl/license-api/internal/storage"
+	"github.com/dzhisl/license-api/pkg/config"
+	"github.com/dzhisl/license-api/pkg/logger"
+	"github.com/test-go/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	config.InitConfig()
+	logger.InitLogger()
+
+	code := m.Run()
+	os.Exit(code)
+}
+
+// receiver records the events it gets and answers with status.
+type receiver struct {
+	mu     sync.Mutex
+	status int
+	events []Event
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	var e Event
+	if err := json.Unmarshal(body, &e); err == nil {
+		rc.events = append(rc.events, e)
+	}
+	w.WriteHeader(rc.status)
+}
+
+func TestDeliver(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+
+	var signatureOk bool
+	hook := NewWebhook("", []string{EventUserCreated})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+		signatureOk = r.Header.Get("X-Webhook-Signature") == Signature(hook.Secret, timestamp, body) &&
+			r.Header.Get("X-Webhook-Event") == EventUserCreated
+	}))
+	defer srv.Close()
+	hook.URL = srv.URL
+	assert.NoError(t, store.CreateWebhook(ctx, hook))
+
+	d := NewDispatcher(store)
+	user := &storage.User{Id: 7}
+	assert.NoError(t, d.Publish(ctx, EventUserCreated, UserData{User: user}))
+	// not subscribed
+	assert.NoError(t, d.Publish(ctx, EventUserDeleted, UserData{User: user}))
+	d.DeliverDue(ctx)
+
+	assert.True(t, signatureOk)
+	delivered, err := store.ListDeliveries(ctx, storage.DeliveryDelivered, 0)
+	assert.NoError(t, err)
+	assert.Len(t, delivered, 1)
+	pending, err := store.ListDeliveries(ctx, storage.DeliveryPending, 0)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 0)
+}
+
+func TestRetryAndRedeliver(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+
+	rc := &receiver{status: http.StatusInternalServerError}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	assert.NoError(t, store.CreateWebhook(ctx, NewWebhook(srv.URL, nil)))
+
+	d := NewDispatcher(store)
+	d.maxAttempts = 3
+	// retry right away so every DeliverDue makes an attempt
+	d.backoff = func(int) time.Duration { return 0 }
+
+	assert.NoError(t, d.Publish(ctx, EventDevicesReset, UserData{User: &storage.User{Id: 7}, Product: "pro"}))
+	for i := 0; i < d.maxAttempts; i++ {
+		d.DeliverDue(ctx)
+	}
+	assert.Len(t, rc.events, d.maxAttempts)
+
+	dead, err := store.ListDeliveries(ctx, storage.DeliveryDead, 0)
+	assert.NoError(t, err)
+	if !assert.Len(t, dead, 1) {
+		return
+	}
+	assert.Equal(t, d.maxAttempts, dead[0].Attempts)
+	assert.Equal(t, "webhook responded with status 500", dead[0].LastError)
+
+	// dead deliveries aren't retried until they are redelivered
+	d.DeliverDue(ctx)
+	assert.Len(t, rc.events, d.maxAttempts)
+
+	rc.status = http.StatusNoContent
+	_, err = d.Redeliver(ctx, dead[0].Id)
+	assert.NoError(t, err)
+	d.DeliverDue(ctx)
+
+	got, err := store.GetDelivery(ctx, dead[0].Id)
+	assert.NoError(t, err)
+	assert.Equal(t, storage.DeliveryDelivered, got.Status)
+	assert.Equal(t, 1, got.Attempts)
+	if assert.Len(t, rc.events, d.maxAttempts+1) {
+		// every attempt carries the same event
+		assert.Equal(t, rc.events[0].Id, rc.events[d.maxAttempts].Id)
+		assert.Equal(t, EventDevicesReset, rc.events[0].Type)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, backoff(1))
+	assert.Equal(t, time.Minute, backoff(2))
+	assert.Equal(t, 4*time.Minute, backoff(4))
+	assert.Equal(t, 6*time.Hour, backoff(20))
+}
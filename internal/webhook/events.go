@@ -0,0 +1,73 @@
+package webhook
+
+import "github.com/dzhisl/license-api/internal/storage"
+
+// Event types sent to webhooks.
+const (
+	EventUserCreated          = "user.created"
+	EventUserDeleted          = "user.deleted"
+	EventLicenseRenewed       = "license.renewed"
+	EventLicenseConverted     = "license.converted"
+	EventLicenseStatusChanged = "license.status_changed"
+	EventLicenseExpired       = "license.expired"
+	EventLicenseExpiring      = "license.expiring"
+	EventDeviceAdded          = "device.added"
+	EventDeviceRemoved        = "device.removed"
+	EventDevicesReset         = "devices.reset"
+	// EventSelfServiceCode carries a one-time self-service code for the
+	// receiver to send to the customer over Telegram or Discord
+	EventSelfServiceCode = "self_service.code"
+)
+
+// Events lists every event type a webhook can subscribe to.
+var Events = []string{
+	EventUserCreated,
+	EventUserDeleted,
+	EventLicenseRenewed,
+	EventLicenseConverted,
+	EventLicenseStatusChanged,
+	EventLicenseExpired,
+	EventLicenseExpiring,
+	EventDeviceAdded,
+	EventDeviceRemoved,
+	EventDevicesReset,
+	EventSelfServiceCode,
+}
+
+// Event is the JSON body of a delivery. Every webhook subscribed to an event
+// receives the same Id, receivers can use it to drop duplicates.
+type Event struct {
+	Id        string            `json:"id"`
+	Type      string            `json:"type"`
+	CreatedAt storage.Timestamp `json:"createdAt"`
+	Data      any               `json:"data"`
+}
+
+// UserData is the data of the user and license events: the user after the
+// change (before it for user.deleted), as returned by GET /api/user.
+type UserData struct {
+	User *storage.User `json:"user"`
+	// Product is the product of the changed license, empty for the primary license
+	Product string `json:"product,omitempty"`
+}
+
+// LicenseExpiringData is the data of license.expiring, sent once per warning
+// window (EXPIRY_WARNING_WINDOWS) before the license expires.
+type LicenseExpiringData struct {
+	UserData
+	ExpiresAt storage.Timestamp `json:"expiresAt"`
+	// Window is the warning window in seconds, e.g. 86400 for the one day warning
+	Window int64 `json:"window"`
+}
+
+// SelfServiceCodeData is the data of self_service.code: the code and where to send it.
+type SelfServiceCodeData struct {
+	UserId  int    `json:"userId"`
+	Product string `json:"product,omitempty"`
+	// Channel is "telegram" or "discord", the matching account id is set
+	Channel    string            `json:"channel"`
+	TelegramId int               `json:"telegramId,omitempty"`
+	DiscordId  int               `json:"discordId,omitempty"`
+	Code       string            `json:"code"`
+	ExpiresAt  storage.Timestamp `json:"expiresAt"`
+}
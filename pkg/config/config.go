@@ -1,19 +1,41 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	StageLevel    string `mapstructure:"STAGE_ENV"`
-	MongoHost     string `mapstructure:"MONGODB_URI"`
-	LicensePrefix string `mapstructure:"LICENSE_PREFIX"`
-	LicenseLen    int    `mapstructure:"LICENSE_LENGTH"`
+	StageLevel     string `mapstructure:"STAGE_ENV"`
+	StorageBackend string `mapstructure:"STORAGE_BACKEND"`
+	MongoHost      string `mapstructure:"MONGODB_URI"`
+	SQLiteDSN      string `mapstructure:"SQLITE_DSN"`
+	LicensePrefix  string `mapstructure:"LICENSE_PREFIX"`
+	LicenseLen     int    `mapstructure:"LICENSE_LENGTH"`
+	SigningKey     string `mapstructure:"SIGNING_PRIVATE_KEY"`
+	// AdminRoles is a JSON object of role names to permissions, see middleware.ParseRoles
+	AdminRoles string `mapstructure:"ADMIN_ROLES"`
+	// SelfServiceCooldown is the time between device deactivations by customers, like "24h"
+	SelfServiceCooldown time.Duration `mapstructure:"SELF_SERVICE_COOLDOWN"`
+	// GracePeriod is how long after expiry licenses still verify, like "24h", licenses can override it
+	GracePeriod time.Duration `mapstructure:"GRACE_PERIOD"`
+	// ExpiryWarningWindows are how long before expiry licenses are warned about, like "168h,24h"
+	ExpiryWarningWindows []time.Duration `mapstructure:"EXPIRY_WARNING_WINDOWS"`
+	// ExpiryCheckInterval is how often the expiry worker runs, like "1m"
+	ExpiryCheckInterval time.Duration `mapstructure:"EXPIRY_CHECK_INTERVAL"`
+	// TrialPlan is the plan of the licenses handed out by the public trial endpoint, trials are off without it
+	TrialPlan string `mapstructure:"TRIAL_PLAN"`
+	// SeatLeaseTTL is how long a seat of a floating license is leased without a heartbeat, like "5m"
+	SeatLeaseTTL time.Duration `mapstructure:"SEAT_LEASE_TTL"`
 	// TODO: Add more
 }
 
@@ -40,7 +62,37 @@ func InitConfig() {
 		log.Printf("Warning: Could not read .env file: %v", err)
 	}
 
+	// make plain env vars visible to Unmarshal even when they're missing in .env
+	t := reflect.TypeOf(AppConfig)
+	for i := 0; i < t.NumField(); i++ {
+		if key := t.Field(i).Tag.Get("mapstructure"); key != "" {
+			viper.BindEnv(key)
+		}
+	}
+
 	if err := viper.Unmarshal(&AppConfig); err != nil {
 		log.Fatalf("Error unmarshaling env vars: %v", err)
 	}
 }
+
+// LoadSigningKey decodes AppConfig.SigningKey, a base64 encoded
+// Ed25519 seed (32 bytes) or private key (64 bytes).
+// It returns nil without error when no key is configured.
+func LoadSigningKey() (ed25519.PrivateKey, error) {
+	if AppConfig.SigningKey == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(AppConfig.SigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode SIGNING_PRIVATE_KEY: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("SIGNING_PRIVATE_KEY must be %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+	}
+}
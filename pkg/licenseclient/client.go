@@ -0,0 +1,102 @@
+package licenseclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Client calls POST /api/license/verify and checks the signed answer.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	verifier   *Verifier
+	product    string
+}
+
+// NewClient creates a client for the API at baseURL (e.g. "https://licenses.example.com/api").
+func NewClient(baseURL string, verifier *Verifier) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		verifier:   verifier,
+	}
+}
+
+// WithHTTPClient overrides http.DefaultClient.
+func (c *Client) WithHTTPClient(hc *http.Client) *Client {
+	c.httpClient = hc
+	return c
+}
+
+// WithProduct makes the client claim to be product, the server rejects
+// licenses issued for other products.
+func (c *Client) WithProduct(product string) *Client {
+	c.product = product
+	return c
+}
+
+type verifyRequest struct {
+	License string `json:"license"`
+	HWID    string `json:"hwid"`
+	Nonce   string `json:"nonce"`
+	Product string `json:"product,omitempty"`
+}
+
+// Verify asks the server to verify license for hwid using a fresh nonce
+// and returns the signed payload once its signature has been checked.
+func (c *Client) Verify(ctx context.Context, license, hwid string) (*VerifyPayload, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(verifyRequest{License: license, HWID: hwid, Nonce: nonce, Product: c.product})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/license/verify", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call license API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var er ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&er); err != nil {
+			return nil, fmt.Errorf("failed to decode license API response: %w", err)
+		}
+		return nil, newAPIError(resp.StatusCode, er)
+	}
+	var sp SignedPayload
+	if err := json.NewDecoder(resp.Body).Decode(&sp); err != nil {
+		return nil, fmt.Errorf("failed to decode license API response: %w", err)
+	}
+	p, err := c.verifier.Verify(sp, license, hwid, nonce)
+	if err != nil {
+		return nil, err
+	}
+	if c.product != "" && p.Product != c.product {
+		return nil, ErrMismatch
+	}
+	return p, nil
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
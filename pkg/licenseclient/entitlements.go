@@ -0,0 +1,68 @@
+package licenseclient
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Entitlements maps the features a license grants to an optional numeric quota.
+// Plain features have a nil quota. In JSON they are encoded as true, quotas as
+// numbers: {"export": true, "max_projects": 10}.
+type Entitlements map[string]*int64
+
+// Has reports whether the entitlement is granted.
+func (e Entitlements) Has(name string) bool {
+	_, ok := e[name]
+	return ok
+}
+
+// Quota returns the quota of the entitlement. ok is false if it isn't granted
+// or is a plain feature without a quota.
+func (e Entitlements) Quota(name string) (quota int64, ok bool) {
+	q := e[name]
+	if q == nil {
+		return 0, false
+	}
+	return *q, true
+}
+
+func (e Entitlements) MarshalJSON() ([]byte, error) {
+	if e == nil {
+		return []byte("null"), nil
+	}
+	m := make(map[string]any, len(e))
+	for name, quota := range e {
+		if quota == nil {
+			m[name] = true
+		} else {
+			m[name] = *quota
+		}
+	}
+	return json.Marshal(m)
+}
+
+func (e *Entitlements) UnmarshalJSON(data []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if m == nil {
+		*e = nil
+		return nil
+	}
+
+	out := make(Entitlements, len(m))
+	for name, raw := range m {
+		if string(raw) == "true" {
+			out[name] = nil
+			continue
+		}
+		var quota int64
+		if err := json.Unmarshal(raw, &quota); err != nil {
+			return fmt.Errorf("entitlement %s must be true or an integer quota", name)
+		}
+		out[name] = &quota
+	}
+	*e = out
+	return nil
+}
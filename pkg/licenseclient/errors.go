@@ -0,0 +1,95 @@
+package licenseclient
+
+import "fmt"
+
+// ErrorVersion is the version of the error response format. It changes when
+// fields are removed or change their meaning, new fields and codes can be
+// added without a new version.
+const ErrorVersion = 1
+
+// Error codes of the API. They are stable, unlike the messages.
+const (
+	CodeInvalidRequest = "INVALID_REQUEST"
+	CodeUnauthorized   = "UNAUTHORIZED"
+	CodeForbidden      = "FORBIDDEN"
+	CodeNotFound       = "NOT_FOUND"
+	CodeConflict       = "CONFLICT"
+	// CodeNoChange means the request wouldn't change anything, e.g. the
+	// device is already bound
+	CodeNoChange    = "NO_CHANGE"
+	CodeRateLimited = "RATE_LIMITED"
+	CodeInternal    = "INTERNAL"
+	CodeUnavailable = "UNAVAILABLE"
+
+	CodeLicenseNotFound = "LICENSE_NOT_FOUND"
+	CodeLicenseExpired  = "LICENSE_EXPIRED"
+	CodeLicenseFrozen   = "LICENSE_FROZEN"
+	CodeLicenseBurned   = "LICENSE_BURNED"
+	// CodeProductMismatch means the license was issued for another product
+	CodeProductMismatch = "PRODUCT_MISMATCH"
+	// CodeDeviceLimit means every device slot of the license is taken
+	CodeDeviceLimit = "DEVICE_LIMIT"
+	// CodeTrialClaimed means the HWID, Telegram or Discord account already got a trial
+	CodeTrialClaimed = "TRIAL_CLAIMED"
+	// CodeSeatLimit means every seat of the floating license is leased
+	CodeSeatLimit = "SEAT_LIMIT"
+	// CodeSeatNotFound means the seat lease expired or was released
+	CodeSeatNotFound = "SEAT_NOT_FOUND"
+	// CodeSeatRequired means the device must check out a seat of the floating license first
+	CodeSeatRequired = "SEAT_REQUIRED"
+)
+
+// ErrorResponse is the body of every failed API request.
+type ErrorResponse struct {
+	Version int    `json:"version" example:"1"`
+	Code    string `json:"code" example:"LICENSE_EXPIRED"`
+	Message string `json:"message" example:"license expired"`
+	// Error repeats Message for clients of the unversioned format, which only had this field
+	Error     string `json:"error" example:"license expired"`
+	RequestId string `json:"request_id,omitempty" example:"0b5c3a1e-6f0e-4d5c-9a53-2f1d2b7c8e90"`
+	// Details depend on the code, e.g. max_activations for DEVICE_LIMIT
+	Details map[string]any `json:"details,omitempty" swaggertype:"object"`
+}
+
+// APIError is returned by Client when the API rejects a request.
+type APIError struct {
+	StatusCode int
+	// Code is empty for servers that predate error codes
+	Code      string
+	Message   string
+	RequestId string
+	Details   map[string]any
+}
+
+func newAPIError(statusCode int, resp ErrorResponse) *APIError {
+	msg := resp.Message
+	if msg == "" {
+		msg = resp.Error
+	}
+	return &APIError{
+		StatusCode: statusCode,
+		Code:       resp.Code,
+		Message:    msg,
+		RequestId:  resp.RequestId,
+		Details:    resp.Details,
+	}
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("license rejected (%d): %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("license rejected (%d %s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is makes rejections match the errors of offline tokens with the same meaning,
+// so errors.Is(err, ErrExpired) holds online and offline.
+func (e *APIError) Is(target error) bool {
+	switch e.Code {
+	case CodeLicenseExpired:
+		return target == ErrExpired
+	case CodeLicenseBurned:
+		return target == ErrRevoked
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+// Package licenseclient verifies signed responses of the license API.
+//
+// The server signs every successful POST /api/license/verify response with
+// its Ed25519 key. Client applications embed the matching public key and use
+// a Verifier (or Client) to make sure the answer came from the server and
+// belongs to their own request.
+package licenseclient
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultMaxClockSkew is how far the server timestamp may drift from the local clock.
+const DefaultMaxClockSkew = 5 * time.Minute
+
+var (
+	ErrUnsigned         = errors.New("response is not signed")
+	ErrInvalidSignature = errors.New("invalid response signature")
+	ErrMismatch         = errors.New("signed payload doesn't match the request")
+	ErrStale            = errors.New("signed payload timestamp is out of range")
+)
+
+// VerifyPayload is the signed part of a successful verify response.
+type VerifyPayload struct {
+	License      string       `json:"license"`
+	Product      string       `json:"product,omitempty"`
+	HWID         string       `json:"hwid"`
+	Status       string       `json:"status"`
+	ExpiresAt    int64        `json:"expiresAt"`
+	Entitlements Entitlements `json:"entitlements,omitempty"`
+	// Type is "trial" for trial licenses and empty for regular ones
+	Type string `json:"type,omitempty"`
+	// Grace is true when the license expired but is in its grace period,
+	// it is valid for GraceRemaining more seconds
+	Grace          bool   `json:"grace,omitempty"`
+	GraceRemaining int64  `json:"graceRemaining,omitempty"`
+	Timestamp      int64  `json:"timestamp"`
+	Nonce          string `json:"nonce"`
+}
+
+// SignedPayload carries the base64 encoded JSON payload and its Ed25519 signature.
+type SignedPayload struct {
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// Sign encodes p and signs it with key. It is used by the server.
+func Sign(key ed25519.PrivateKey, p VerifyPayload) (SignedPayload, error) {
+	return sign(key, p)
+}
+
+func sign(key ed25519.PrivateKey, v any) (SignedPayload, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return SignedPayload{}, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	return SignedPayload{
+		Payload:   base64.StdEncoding.EncodeToString(raw),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, raw)),
+	}, nil
+}
+
+// ParsePublicKey decodes a base64 encoded Ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// MustParsePublicKey is like ParsePublicKey but panics on error.
+// It is meant for keys embedded at build time.
+func MustParsePublicKey(s string) ed25519.PublicKey {
+	key, err := ParsePublicKey(s)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// Verifier checks signed payloads against the server public key.
+type Verifier struct {
+	publicKey    ed25519.PublicKey
+	maxClockSkew time.Duration
+	now          func() time.Time
+}
+
+func NewVerifier(publicKey ed25519.PublicKey) *Verifier {
+	return &Verifier{
+		publicKey:    publicKey,
+		maxClockSkew: DefaultMaxClockSkew,
+		now:          time.Now,
+	}
+}
+
+// WithMaxClockSkew overrides DefaultMaxClockSkew.
+func (v *Verifier) WithMaxClockSkew(d time.Duration) *Verifier {
+	v.maxClockSkew = d
+	return v
+}
+
+// Verify checks the signature of sp and that the payload answers the request
+// made with license, hwid and nonce. It returns the decoded payload.
+func (v *Verifier) Verify(sp SignedPayload, license, hwid, nonce string) (*VerifyPayload, error) {
+	var p VerifyPayload
+	if err := v.open(sp, &p); err != nil {
+		return nil, err
+	}
+	if p.License != license || p.HWID != hwid || p.Nonce != nonce {
+		return nil, ErrMismatch
+	}
+
+	skew := v.now().Sub(time.Unix(p.Timestamp, 0))
+	if skew > v.maxClockSkew || skew < -v.maxClockSkew {
+		return nil, ErrStale
+	}
+	return &p, nil
+}
+
+// open checks the signature of sp and decodes its payload into dst.
+func (v *Verifier) open(sp SignedPayload, dst any) error {
+	if sp.Payload == "" || sp.Signature == "" {
+		return ErrUnsigned
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(sp.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to decode payload: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(sp.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+	if !ed25519.Verify(v.publicKey, raw, sig) {
+		return ErrInvalidSignature
+	}
+
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return fmt.Errorf("failed to decode payload: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package licenseclient
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+
+	payload := VerifyPayload{
+		License: "KEY-1",
+		HWID:    "hwid_1",
+		Status:  "active",
+		Entitlements: Entitlements{
+			"export":       nil,
+			"max_projects": quota(10),
+		},
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		Timestamp: time.Now().Unix(),
+		Nonce:     "nonce",
+	}
+	signed, err := Sign(priv, payload)
+	if err != nil {
+		t.Fatalf("failed to sign payload: %v", err)
+	}
+	forged, _ := Sign(otherPriv, payload)
+
+	tampered := payload
+	tampered.ExpiresAt += 365 * 24 * 3600
+	tamperedSigned, _ := Sign(priv, tampered)
+
+	stale := payload
+	stale.Timestamp = time.Now().Add(-time.Hour).Unix()
+	staleSigned, _ := Sign(priv, stale)
+
+	testCases := []struct {
+		name    string
+		signed  SignedPayload
+		hwid    string
+		nonce   string
+		wantErr error
+	}{
+		{"Valid", signed, "hwid_1", "nonce", nil},
+		{"Unsigned", SignedPayload{}, "hwid_1", "nonce", ErrUnsigned},
+		{"Wrong key", forged, "hwid_1", "nonce", ErrInvalidSignature},
+		{"Tampered payload", SignedPayload{Payload: tamperedSigned.Payload, Signature: signed.Signature}, "hwid_1", "nonce", ErrInvalidSignature},
+		{"Other HWID", signed, "hwid_2", "nonce", ErrMismatch},
+		{"Replayed nonce", signed, "hwid_1", "other", ErrMismatch},
+		{"Stale", staleSigned, "hwid_1", "nonce", ErrStale},
+	}
+
+	v := NewVerifier(pub)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := v.Verify(tc.signed, "KEY-1", tc.hwid, tc.nonce)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("error doesn't match: want %v got: %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(payload, *got); diff != "" {
+				t.Errorf("payload mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+
+	now := time.Now().Unix()
+	claims := TokenClaims{
+		License:        "KEY-1",
+		HWIDs:          []string{"hwid_1"},
+		MaxActivations: 1,
+		Features:       []string{"export"},
+		IssuedAt:       now,
+		ExpiresAt:      now + 3600,
+	}
+	inGrace := claims
+	inGrace.ExpiresAt = now - 60
+	inGrace.GracePeriod = 3600
+	expired := inGrace
+	expired.GracePeriod = 30
+	lifetime := claims
+	lifetime.ExpiresAt = 0
+
+	sign := func(key ed25519.PrivateKey, c TokenClaims) string {
+		token, err := SignToken(key, c)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return token
+	}
+	revoked := &RevocationList{IssuedAt: now, Keys: []string{"KEY-1"}}
+
+	testCases := []struct {
+		name    string
+		token   string
+		hwid    string
+		rl      *RevocationList
+		wantErr error
+	}{
+		{"Valid", sign(priv, claims), "hwid_1", &RevocationList{}, nil},
+		{"In grace period", sign(priv, inGrace), "hwid_1", nil, nil},
+		{"Expired", sign(priv, expired), "hwid_1", nil, ErrExpired},
+		{"Lifetime", sign(priv, lifetime), "hwid_1", nil, nil},
+		{"Unknown device", sign(priv, claims), "hwid_2", nil, ErrUnknownDevice},
+		{"Revoked", sign(priv, claims), "hwid_1", revoked, ErrRevoked},
+		{"Wrong key", sign(otherPriv, claims), "hwid_1", nil, ErrInvalidSignature},
+		{"Malformed", "not-a-token", "hwid_1", nil, ErrMalformedToken},
+	}
+
+	v := NewVerifier(pub)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := v.VerifyToken(tc.token, tc.hwid, tc.rl)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("error doesn't match: want %v got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func quota(q int64) *int64 {
+	return &q
+}
+
+func TestEntitlementsJSON(t *testing.T) {
+	e := Entitlements{"export": nil, "max_projects": quota(10)}
+
+	raw, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("failed to marshal entitlements: %v", err)
+	}
+	if want := `{"export":true,"max_projects":10}`; string(raw) != want {
+		t.Errorf("json mismatch: want %s got: %s", want, raw)
+	}
+
+	var decoded Entitlements
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal entitlements: %v", err)
+	}
+	if diff := cmp.Diff(e, decoded); diff != "" {
+		t.Errorf("entitlements mismatch (-want +got):\n%v", diff)
+	}
+	if !decoded.Has("export") || decoded.Has("sync") {
+		t.Errorf("Has doesn't match the granted entitlements")
+	}
+	if q, ok := decoded.Quota("max_projects"); !ok || q != 10 {
+		t.Errorf("quota mismatch: want 10 got: %d (%v)", q, ok)
+	}
+	if _, ok := decoded.Quota("export"); ok {
+		t.Errorf("plain feature reported a quota")
+	}
+
+	if err := json.Unmarshal([]byte(`{"export":"yes"}`), &decoded); err == nil {
+		t.Errorf("accepted an entitlement that is neither true nor a number")
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		body     string
+		wantCode string
+		wantMsg  string
+		wantErr  error
+	}{
+		{"Envelope", `{"version":1,"code":"LICENSE_EXPIRED","message":"license expired","error":"license expired","request_id":"req-1"}`,
+			CodeLicenseExpired, "license expired", ErrExpired},
+		{"Burned", `{"version":1,"code":"LICENSE_BURNED","message":"license not active","error":"license not active"}`,
+			CodeLicenseBurned, "license not active", ErrRevoked},
+		{"Unversioned", `{"error":"license expired"}`, "", "license expired", nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			_, err := NewClient(srv.URL, NewVerifier(pub)).Verify(context.Background(), "KEY-1", "hwid_1")
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected an APIError, got: %v", err)
+			}
+			if apiErr.StatusCode != http.StatusForbidden || apiErr.Code != tc.wantCode || apiErr.Message != tc.wantMsg {
+				t.Errorf("unexpected error: %+v", apiErr)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("error doesn't match: want %v got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package licenseclient
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrMalformedToken = errors.New("malformed license token")
+	ErrExpired        = errors.New("license expired")
+	ErrUnknownDevice  = errors.New("device is not allowed by the license token")
+	ErrRevoked        = errors.New("license is revoked")
+)
+
+// tokenHeader is fixed, tokens are JWS compact serializations signed with EdDSA.
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","typ":"LIC"}`))
+
+// TokenClaims is the content of an offline license token.
+type TokenClaims struct {
+	License        string       `json:"license"`
+	Product        string       `json:"product,omitempty"`
+	HWIDs          []string     `json:"hwids"`
+	MaxActivations int          `json:"maxActivations"`
+	Features       []string     `json:"features,omitempty"`
+	Entitlements   Entitlements `json:"entitlements,omitempty"`
+	IssuedAt       int64        `json:"issuedAt"`
+	ExpiresAt      int64        `json:"expiresAt"` // 0 for lifetime licenses
+	// GracePeriod is how many seconds after ExpiresAt the token is still accepted.
+	GracePeriod int64 `json:"gracePeriod"`
+}
+
+// RevocationList is the signed list of license keys that must not be accepted anymore.
+type RevocationList struct {
+	IssuedAt int64    `json:"issuedAt"`
+	Keys     []string `json:"keys"`
+}
+
+// IsRevoked reports whether license is on the list.
+func (rl *RevocationList) IsRevoked(license string) bool {
+	return rl != nil && slices.Contains(rl.Keys, license)
+}
+
+// SignToken encodes and signs claims as an offline license token. It is used by the server.
+func SignToken(key ed25519.PrivateKey, claims TokenClaims) (string, error) {
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token claims: %w", err)
+	}
+	signingInput := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(raw)
+	sig := ed25519.Sign(key, []byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// SignRevocationList signs rl. It is used by the server.
+func SignRevocationList(key ed25519.PrivateKey, rl RevocationList) (SignedPayload, error) {
+	return sign(key, rl)
+}
+
+// VerifyToken checks an offline license token locally: the signature,
+// the expiry (including the grace period), that hwid is one of the bound
+// devices and, when rl is not nil, that the license isn't revoked.
+func (v *Verifier) VerifyToken(token, hwid string, rl *RevocationList) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, ErrMalformedToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	if !ed25519.Verify(v.publicKey, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, ErrInvalidSignature
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	var claims TokenClaims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	if claims.ExpiresAt != 0 && v.now().Unix() >= claims.ExpiresAt+claims.GracePeriod {
+		return nil, ErrExpired
+	}
+	if !slices.Contains(claims.HWIDs, hwid) {
+		return nil, ErrUnknownDevice
+	}
+	if rl.IsRevoked(claims.License) {
+		return nil, ErrRevoked
+	}
+	return &claims, nil
+}
+
+// VerifyRevocationList checks the signature of a downloaded revocation list.
+func (v *Verifier) VerifyRevocationList(sp SignedPayload) (*RevocationList, error) {
+	var rl RevocationList
+	if err := v.open(sp, &rl); err != nil {
+		return nil, err
+	}
+	return &rl, nil
+}
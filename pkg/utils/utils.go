@@ -8,11 +8,16 @@ import (
 	"github.com/dzhisl/license-api/pkg/config"
 )
 
+// GenLicense generates a license key with the globally configured prefix and length.
 func GenLicense() string {
+	return GenLicenseKey(config.AppConfig.LicensePrefix, config.AppConfig.LicenseLen)
+}
+
+// GenLicenseKey generates a random license key of length characters,
+// prefixed with "prefix-" when prefix is set.
+func GenLicenseKey(prefix string, length int) string {
 	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
-	prefix := config.AppConfig.LicensePrefix
-	length := config.AppConfig.LicenseLen
 	if length <= 0 {
 		length = 16 // fallback default
 	}